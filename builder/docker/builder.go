@@ -29,6 +29,16 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	return warnings, nil
 }
 
+// Plan implements packer.BuilderPlanner.
+func (b *Builder) Plan() ([]string, error) {
+	steps, err := b.steps()
+	if err != nil {
+		return nil, err
+	}
+
+	return common.StepNames(steps), nil
+}
+
 func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
 	driver := &DockerDriver{Ctx: &b.config.ctx, Ui: ui}
 	if err := driver.Verify(); err != nil {
@@ -41,31 +51,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	}
 	log.Printf("[DEBUG] Docker version: %s", version.String())
 
-	steps := []multistep.Step{
-		&StepTempDir{},
-		&StepPull{},
-		&StepRun{},
-		&communicator.StepConnect{
-			Config:    &b.config.Comm,
-			Host:      commHost,
-			SSHConfig: sshConfig(&b.config.Comm),
-			CustomConnect: map[string]multistep.Step{
-				"docker": &StepConnectDocker{},
-			},
-		},
-		&common.StepProvision{},
-	}
-
-	if b.config.Discard {
-		log.Print("[DEBUG] Container will be discarded")
-	} else if b.config.Commit {
-		log.Print("[DEBUG] Container will be committed")
-		steps = append(steps, new(StepCommit))
-	} else if b.config.ExportPath != "" {
-		log.Printf("[DEBUG] Container will be exported to %s", b.config.ExportPath)
-		steps = append(steps, new(StepExport))
-	} else {
-		return nil, errArtifactNotUsed
+	steps, err := b.steps()
+	if err != nil {
+		return nil, err
 	}
 
 	// Setup the state bag and initial state for the steps
@@ -106,6 +94,37 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	return artifact, nil
 }
 
+func (b *Builder) steps() ([]multistep.Step, error) {
+	steps := []multistep.Step{
+		&StepTempDir{},
+		&StepPull{},
+		&StepRun{},
+		&communicator.StepConnect{
+			Config:    &b.config.Comm,
+			Host:      commHost,
+			SSHConfig: sshConfig(&b.config.Comm),
+			CustomConnect: map[string]multistep.Step{
+				"docker": &StepConnectDocker{},
+			},
+		},
+		&common.StepProvision{},
+	}
+
+	if b.config.Discard {
+		log.Print("[DEBUG] Container will be discarded")
+	} else if b.config.Commit {
+		log.Print("[DEBUG] Container will be committed")
+		steps = append(steps, new(StepCommit))
+	} else if b.config.ExportPath != "" {
+		log.Printf("[DEBUG] Container will be exported to %s", b.config.ExportPath)
+		steps = append(steps, new(StepExport))
+	} else {
+		return nil, errArtifactNotUsed
+	}
+
+	return steps, nil
+}
+
 func (b *Builder) Cancel() {
 	if b.runner != nil {
 		log.Println("Cancelling the step runner...")
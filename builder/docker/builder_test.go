@@ -1,10 +1,43 @@
 package docker
 
 import (
-	"github.com/mitchellh/packer/packer"
+	"reflect"
 	"testing"
+
+	"github.com/mitchellh/packer/packer"
 )
 
 func TestBuilder_implBuilder(t *testing.T) {
 	var _ packer.Builder = new(Builder)
 }
+
+func TestBuilder_implBuilderPlanner(t *testing.T) {
+	var _ packer.BuilderPlanner = new(Builder)
+}
+
+func TestBuilderPlan(t *testing.T) {
+	b := &Builder{config: testConfigStruct(t)}
+
+	steps, err := b.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"StepTempDir", "StepPull", "StepRun", "StepConnect",
+		"StepProvision", "StepExport",
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("bad: %#v", steps)
+	}
+
+	b.config.Commit = true
+	b.config.ExportPath = ""
+	steps, err = b.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if steps[len(steps)-1] != "StepCommit" {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
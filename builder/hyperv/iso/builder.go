@@ -316,6 +316,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 			Url:          b.config.ISOUrls,
 			Extension:    b.config.TargetExtension,
 			TargetPath:   b.config.TargetPath,
+			Options:      b.config.DownloadOptions,
 		},
 		&common.StepCreateFloppy{
 			Files: b.config.FloppyFiles,
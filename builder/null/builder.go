@@ -26,18 +26,13 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	return warnings, nil
 }
 
+// Plan implements packer.BuilderPlanner.
+func (b *Builder) Plan() ([]string, error) {
+	return common.StepNames(b.steps()), nil
+}
+
 func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
-	steps := []multistep.Step{
-		&communicator.StepConnect{
-			Config: &b.config.CommConfig,
-			Host:   CommHost(b.config.CommConfig.Host()),
-			SSHConfig: SSHConfig(
-				b.config.CommConfig.SSHUsername,
-				b.config.CommConfig.SSHPassword,
-				b.config.CommConfig.SSHPrivateKey),
-		},
-		&common.StepProvision{},
-	}
+	steps := b.steps()
 
 	// Setup the state bag and initial state for the steps
 	state := new(multistep.BasicStateBag)
@@ -46,7 +41,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	state.Put("ui", ui)
 
 	// Run!
-	b.runner = common.NewRunner(steps, b.config.PackerConfig, ui)
+	b.runner = common.NewResumableRunner(steps, b.config.PackerConfig, ui, state)
 	b.runner.Run(state)
 
 	// If there was an error, return that
@@ -59,6 +54,20 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	return artifact, nil
 }
 
+func (b *Builder) steps() []multistep.Step {
+	return []multistep.Step{
+		&communicator.StepConnect{
+			Config: &b.config.CommConfig,
+			Host:   CommHost(b.config.CommConfig.Host()),
+			SSHConfig: SSHConfig(
+				b.config.CommConfig.SSHUsername,
+				b.config.CommConfig.SSHPassword,
+				b.config.CommConfig.SSHPrivateKey),
+		},
+		&common.StepProvision{},
+	}
+}
+
 func (b *Builder) Cancel() {
 	if b.runner != nil {
 		log.Println("Cancelling the step runner...")
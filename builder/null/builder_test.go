@@ -1,10 +1,33 @@
 package null
 
 import (
-	"github.com/mitchellh/packer/packer"
+	"reflect"
 	"testing"
+
+	"github.com/mitchellh/packer/packer"
 )
 
 func TestBuilder_implBuilder(t *testing.T) {
 	var _ packer.Builder = new(Builder)
 }
+
+func TestBuilder_implBuilderPlanner(t *testing.T) {
+	var _ packer.BuilderPlanner = new(Builder)
+}
+
+func TestBuilderPlan(t *testing.T) {
+	var b Builder
+	if _, err := b.Prepare(testConfig()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	steps, err := b.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"StepConnect", "StepProvision"}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/packer"
 )
 
@@ -58,6 +60,28 @@ func TestBuilder_ImplementsBuilder(t *testing.T) {
 	}
 }
 
+func TestBuilderPlan(t *testing.T) {
+	var b Builder
+	config := testConfig()
+	config["communicator"] = "none"
+	if _, err := b.Prepare(config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	steps, err := b.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if steps[0] != "StepDownload" || steps[len(steps)-1] != "stepConvertDisk" {
+		t.Fatalf("bad: %#v", steps)
+	}
+	for _, step := range steps {
+		if step == "StepConnect" || step == "stepForwardSSH" {
+			t.Fatalf("no communicator should be connected: %#v", steps)
+		}
+	}
+}
+
 func TestBuilderPrepare_Defaults(t *testing.T) {
 	var b Builder
 	config := testConfig()
@@ -361,6 +385,46 @@ func TestBuilderPrepare_OutputDir(t *testing.T) {
 	}
 }
 
+func TestBuilderPrepare_OutputDirResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := os.Getenv(common.CheckpointDirEnvVar)
+	os.Setenv(common.CheckpointDirEnvVar, filepath.Join(dir, "checkpoints"))
+	defer os.Setenv(common.CheckpointDirEnvVar, old)
+
+	config := testConfig()
+	config["output_directory"] = dir
+	config[packer.ResumeConfigKey] = true
+
+	// Without a checkpoint, the output directory must not exist
+	var b Builder
+	if _, err := b.Prepare(config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// The output directory of the failed build is kept for resuming
+	path := common.CheckpointPath("foo")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b = Builder{}
+	warns, err := b.Prepare(config)
+	if len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+}
+
 func TestBuilderPrepare_ShutdownTimeout(t *testing.T) {
 	var b Builder
 	config := testConfig()
@@ -5,9 +5,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -28,6 +31,15 @@ type Driver interface {
 	// Qemu executes the given command via qemu-system-x86_64
 	Qemu(qemuArgs ...string) error
 
+	// Attach takes over a machine that was started by a previous run with
+	// the given -pidfile, so that it can be stopped and waited on. It
+	// fails if the process isn't running anymore, or if it isn't the
+	// machine that wrote the pid file, since the pid may have been reused.
+	Attach(pid int, pidFile string) error
+
+	// Pid returns the process ID of the running machine, or 0.
+	Pid() int
+
 	// wait on shutdown of the VM with option to cancel
 	WaitForShutdown(<-chan struct{}) bool
 
@@ -47,7 +59,7 @@ type QemuDriver struct {
 	QemuPath    string
 	QemuImgPath string
 
-	vmCmd   *exec.Cmd
+	vmProc  *os.Process
 	vmEndCh <-chan int
 	lock    sync.Mutex
 }
@@ -56,8 +68,8 @@ func (d *QemuDriver) Stop() error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	if d.vmCmd != nil {
-		if err := d.vmCmd.Process.Kill(); err != nil {
+	if d.vmProc != nil {
+		if err := d.vmProc.Kill(); err != nil {
 			return err
 		}
 	}
@@ -65,11 +77,94 @@ func (d *QemuDriver) Stop() error {
 	return nil
 }
 
+func (d *QemuDriver) Attach(pid int, pidFile string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.vmProc != nil {
+		panic("Existing VM state found")
+	}
+
+	if err := checkQemuPid(pid, pidFile); err != nil {
+		return err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := proc.Signal(syscall.Signal(0)); err != nil {
+		return fmt.Errorf("VM process %d isn't running: %s", pid, err)
+	}
+
+	log.Printf("Attached to Qemu. Pid: %d", pid)
+
+	// The process isn't a child of this one, so it can't be waited on and
+	// is polled instead
+	endCh := make(chan int, 1)
+	go func() {
+		for proc.Signal(syscall.Signal(0)) == nil {
+			time.Sleep(1 * time.Second)
+		}
+
+		endCh <- 0
+
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.vmProc = nil
+		d.vmEndCh = nil
+	}()
+
+	d.vmProc = proc
+	d.vmEndCh = endCh
+
+	return nil
+}
+
+// checkQemuPid checks that the process with the pid is the qemu that was
+// started with the pid file: the pid file has to hold the pid, and the
+// command line of the process has to name the pid file. The command line
+// is read from /proc, where there is no /proc the process is never
+// trusted.
+func checkQemuPid(pid int, pidFile string) error {
+	contents, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return fmt.Errorf("Error reading pid file: %s", err)
+	}
+	if strings.TrimSpace(string(contents)) != strconv.Itoa(pid) {
+		return fmt.Errorf("VM process %d didn't write the pid file %s", pid, pidFile)
+	}
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return fmt.Errorf("Error reading the command line of VM process %d: %s", pid, err)
+	}
+	args := strings.Split(string(cmdline), "\x00")
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-pidfile" && args[i+1] == pidFile {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Process %d isn't the VM with the pid file %s", pid, pidFile)
+}
+
+func (d *QemuDriver) Pid() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.vmProc == nil {
+		return 0
+	}
+
+	return d.vmProc.Pid
+}
+
 func (d *QemuDriver) Qemu(qemuArgs ...string) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	if d.vmCmd != nil {
+	if d.vmProc != nil {
 		panic("Existing VM state found")
 	}
 
@@ -114,7 +209,7 @@ func (d *QemuDriver) Qemu(qemuArgs ...string) error {
 
 		d.lock.Lock()
 		defer d.lock.Unlock()
-		d.vmCmd = nil
+		d.vmProc = nil
 		d.vmEndCh = nil
 	}()
 
@@ -129,7 +224,7 @@ func (d *QemuDriver) Qemu(qemuArgs ...string) error {
 	}
 
 	// Setup our state so we know we are running
-	d.vmCmd = cmd
+	d.vmProc = cmd.Process
 	d.vmEndCh = endCh
 
 	return nil
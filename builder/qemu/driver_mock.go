@@ -0,0 +1,78 @@
+package qemu
+
+import "sync"
+
+type DriverMock struct {
+	sync.Mutex
+
+	// Calls are the names of the methods that were called, in order.
+	Calls []string
+
+	StopErr error
+
+	QemuArgs []string
+	QemuErr  error
+
+	AttachPid     int
+	AttachPidFile string
+	AttachErr     error
+
+	PidResult int
+
+	WaitForShutdownResult bool
+
+	QemuImgArgs [][]string
+	QemuImgErr  error
+
+	VerifyErr error
+
+	VersionResult string
+	VersionErr    error
+}
+
+func (d *DriverMock) call(name string) {
+	d.Lock()
+	defer d.Unlock()
+	d.Calls = append(d.Calls, name)
+}
+
+func (d *DriverMock) Stop() error {
+	d.call("Stop")
+	return d.StopErr
+}
+
+func (d *DriverMock) Qemu(args ...string) error {
+	d.call("Qemu")
+	d.QemuArgs = args
+	return d.QemuErr
+}
+
+func (d *DriverMock) Attach(pid int, pidFile string) error {
+	d.call("Attach")
+	d.AttachPid = pid
+	d.AttachPidFile = pidFile
+	return d.AttachErr
+}
+
+func (d *DriverMock) Pid() int {
+	return d.PidResult
+}
+
+func (d *DriverMock) WaitForShutdown(<-chan struct{}) bool {
+	d.call("WaitForShutdown")
+	return d.WaitForShutdownResult
+}
+
+func (d *DriverMock) QemuImg(args ...string) error {
+	d.call("QemuImg")
+	d.QemuImgArgs = append(d.QemuImgArgs, args)
+	return d.QemuImgErr
+}
+
+func (d *DriverMock) Verify() error {
+	return d.VerifyErr
+}
+
+func (d *DriverMock) Version() (string, error) {
+	return d.VersionResult, d.VersionErr
+}
@@ -0,0 +1,58 @@
+package qemu
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestCheckQemuPid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the command line is read from /proc")
+	}
+
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "qemu.pid")
+
+	// A process started with the pid file, like qemu
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60; true", "-pidfile", pidFile)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer cmd.Process.Kill()
+	pid := cmd.Process.Pid
+
+	if err := checkQemuPid(pid, pidFile); err == nil {
+		t.Fatal("should fail without the pid file")
+	}
+
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := checkQemuPid(pid, pidFile); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The pid was reused by another process
+	other := exec.Command("sleep", "60")
+	if err := other.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer other.Process.Kill()
+
+	contents := []byte(strconv.Itoa(other.Process.Pid))
+	if err := ioutil.WriteFile(pidFile, contents, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := checkQemuPid(other.Process.Pid, pidFile); err == nil {
+		t.Fatal("should fail for another process")
+	}
+}
@@ -3,6 +3,7 @@ package qemu
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -12,7 +13,11 @@ import (
 	"github.com/mitchellh/packer/template/interpolate"
 )
 
-// stepRun runs the virtual machine
+// stepRun runs the virtual machine. When a build is resumed it runs again
+// and reattaches to the machine the previous run started, or restarts it
+// from the disk if it is gone. The process ID of the machine is put in
+// qemu_pid for that, and qemu writes it to a pid file in the output
+// directory, which tells that the process is still the same machine.
 type stepRun struct {
 	BootDrive string
 	Message   string
@@ -31,9 +36,23 @@ func (s *stepRun) Run(state multistep.StateBag) multistep.StepAction {
 	driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packer.Ui)
 
-	ui.Say(s.Message)
+	bootDrive, message := s.BootDrive, s.Message
+	if pid, ok := state.GetOk("qemu_pid"); ok {
+		config := state.Get("config").(*Config)
+		err := driver.Attach(pid.(int), qemuPidFile(config))
+		if err == nil {
+			ui.Say(fmt.Sprintf("Reattached to the running VM (pid %d)", pid))
+			return multistep.ActionContinue
+		}
+		log.Printf("Can't reattach to the VM: %s", err)
+
+		// The machine was installed already
+		bootDrive, message = "c", "Restarting VM, booting disk image"
+	}
 
-	command, err := getCommandArgs(s.BootDrive, state)
+	ui.Say(message)
+
+	command, err := getCommandArgs(bootDrive, state)
 	if err != nil {
 		err := fmt.Errorf("Error processing QemuArgs: %s", err)
 		ui.Error(err.Error())
@@ -46,9 +65,17 @@ func (s *stepRun) Run(state multistep.StateBag) multistep.StepAction {
 		return multistep.ActionHalt
 	}
 
+	state.Put("qemu_pid", driver.Pid())
+
 	return multistep.ActionContinue
 }
 
+// RerunOnResume always returns true since the machine of the previous run
+// has to be reattached to or started again.
+func (s *stepRun) RerunOnResume() bool {
+	return true
+}
+
 func (s *stepRun) Cleanup(state multistep.StateBag) {
 	driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packer.Ui)
@@ -56,6 +83,16 @@ func (s *stepRun) Cleanup(state multistep.StateBag) {
 	if err := driver.Stop(); err != nil {
 		ui.Error(fmt.Sprintf("Error shutting down VM: %s", err))
 	}
+
+	config := state.Get("config").(*Config)
+	if err := os.Remove(qemuPidFile(config)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing the pid file: %s", err)
+	}
+}
+
+// qemuPidFile returns the path of the pid file of the machine.
+func qemuPidFile(config *Config) string {
+	return filepath.Join(config.OutputDir, "qemu.pid")
 }
 
 func getCommandArgs(bootDrive string, state multistep.StateBag) ([]string, error) {
@@ -76,6 +113,7 @@ func getCommandArgs(bootDrive string, state multistep.StateBag) ([]string, error
 	var sshHostPort uint
 
 	defaultArgs["-name"] = vmName
+	defaultArgs["-pidfile"] = qemuPidFile(config)
 	defaultArgs["-machine"] = fmt.Sprintf("type=%s", config.MachineType)
 	if config.Comm.Type != "none" {
 		sshHostPort = state.Get("sshHostPort").(uint)
@@ -0,0 +1,137 @@
+package qemu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/helper/communicator"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepHaltOnce halts the first run of a build, like a failed provisioner.
+type stepHaltOnce struct {
+	halt bool
+}
+
+func (s *stepHaltOnce) Run(multistep.StateBag) multistep.StepAction {
+	if s.halt {
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepHaltOnce) Cleanup(multistep.StateBag) {}
+
+func testStepRunResume(t *testing.T, driver *DriverMock) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := os.Getenv(common.CheckpointDirEnvVar)
+	os.Setenv(common.CheckpointDirEnvVar, filepath.Join(dir, "checkpoints"))
+	defer os.Setenv(common.CheckpointDirEnvVar, old)
+
+	config := &Config{
+		PackerConfig: common.PackerConfig{
+			PackerBuildName: "test",
+			PackerResume:    true,
+		},
+		Comm:            communicator.Config{Type: "none"},
+		Accelerator:     "none",
+		DiskInterface:   "virtio",
+		Format:          "qcow2",
+		Headless:        true,
+		NetDevice:       "virtio-net",
+		OutputDir:       dir,
+		VMName:          "disk",
+		shutdownTimeout: time.Minute,
+	}
+
+	run := func(driver Driver, halt bool) {
+		steps := []multistep.Step{
+			&stepRun{BootDrive: "once=d", Message: "Starting VM"},
+			&stepHaltOnce{halt: halt},
+			new(stepShutdown),
+			new(stepConvertDisk),
+		}
+
+		ui := &packer.BasicUi{
+			Reader: new(bytes.Buffer),
+			Writer: new(bytes.Buffer),
+		}
+		state := new(multistep.BasicStateBag)
+		state.Put("config", config)
+		state.Put("disk_filename", "disk")
+		state.Put("driver", driver)
+		state.Put("iso_path", "iso")
+		state.Put("ui", ui)
+		state.Put("vnc_ip", "127.0.0.1")
+		state.Put("vnc_port", uint(5900))
+		common.NewResumableRunner(steps, config.PackerConfig, ui, state).Run(state)
+	}
+
+	// The first run starts the machine and fails
+	run(&DriverMock{PidResult: 42, VersionResult: "2.0"}, true)
+
+	// The converted disk is moved over the disk
+	if err := ioutil.WriteFile(filepath.Join(dir, "disk.convert"), nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	run(driver, false)
+	if driver.AttachPid != 42 {
+		t.Fatalf("bad: %d", driver.AttachPid)
+	}
+	if driver.AttachPidFile != filepath.Join(dir, "qemu.pid") {
+		t.Fatalf("bad: %s", driver.AttachPidFile)
+	}
+}
+
+func TestStepRun_resumeAttach(t *testing.T) {
+	driver := &DriverMock{
+		PidResult:             42,
+		VersionResult:         "2.0",
+		WaitForShutdownResult: true,
+	}
+	testStepRunResume(t, driver)
+
+	expected := []string{"Attach", "WaitForShutdown", "QemuImg", "Stop"}
+	if !reflect.DeepEqual(driver.Calls, expected) {
+		t.Fatalf("bad: %#v", driver.Calls)
+	}
+}
+
+func TestStepRun_resumeRestart(t *testing.T) {
+	driver := &DriverMock{
+		AttachErr:             os.ErrNotExist,
+		PidResult:             43,
+		VersionResult:         "2.0",
+		WaitForShutdownResult: true,
+	}
+	testStepRunResume(t, driver)
+
+	expected := []string{"Attach", "Qemu", "WaitForShutdown", "QemuImg", "Stop"}
+	if !reflect.DeepEqual(driver.Calls, expected) {
+		t.Fatalf("bad: %#v", driver.Calls)
+	}
+
+	// The machine boots from the disk it was installed on
+	var boot string
+	for i, arg := range driver.QemuArgs {
+		if arg == "-boot" {
+			boot = driver.QemuArgs[i+1]
+		}
+	}
+	if boot != "c" {
+		t.Fatalf("bad: %#v", driver.QemuArgs)
+	}
+}
@@ -2,14 +2,18 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/mitchellh/packer/common/sensitive"
 	"github.com/mitchellh/packer/helper/enumflag"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/template"
@@ -20,9 +24,10 @@ type BuildCommand struct {
 }
 
 func (c BuildCommand) Run(args []string) int {
-	var cfgColor, cfgDebug, cfgForce, cfgParallel bool
+	var cfgColor, cfgDebug, cfgForce, cfgParallel, cfgPlan, cfgResume bool
 	var cfgOnError string
-	flags := c.Meta.FlagSet("build", FlagSetBuildFilter|FlagSetVars)
+	var cfgParallelBuilds int
+	flags := c.Meta.FlagSet("build", FlagSetBuildFilter|FlagSetVars|FlagSetLogFormat)
 	flags.Usage = func() { c.Ui.Say(c.Help()) }
 	flags.BoolVar(&cfgColor, "color", true, "")
 	flags.BoolVar(&cfgDebug, "debug", false, "")
@@ -30,16 +35,32 @@ func (c BuildCommand) Run(args []string) int {
 	flagOnError := enumflag.New(&cfgOnError, "cleanup", "abort", "ask")
 	flags.Var(flagOnError, "on-error", "")
 	flags.BoolVar(&cfgParallel, "parallel", true, "")
+	flags.IntVar(&cfgParallelBuilds, "parallel-builds", 0, "")
+	flags.BoolVar(&cfgPlan, "plan", false, "")
+	flags.BoolVar(&cfgResume, "resume", false, "")
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
+	if err := c.setupLogFormat(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
 	args = flags.Args()
 	if len(args) != 1 {
 		flags.Usage()
 		return 1
 	}
 
+	if cfgParallelBuilds < 0 {
+		c.Ui.Error("-parallel-builds must not be negative")
+		return 1
+	}
+	if !cfgParallel {
+		cfgParallelBuilds = 1
+	}
+
 	// Parse the template
 	var tpl *template.Template
 	var err error
@@ -56,8 +77,9 @@ func (c BuildCommand) Run(args []string) int {
 		return 1
 	}
 
-	// Get the builds we care about
-	buildNames := c.Meta.BuildNames(core)
+	// Get the builds we care about. Builds come after the builds they
+	// depend on so that they can run one at a time.
+	buildNames := core.BuildOrder(c.Meta.BuildNames(core))
 	builds := make([]packer.Build, 0, len(buildNames))
 	for _, n := range buildNames {
 		b, err := core.Build(n)
@@ -92,7 +114,7 @@ func (c BuildCommand) Run(args []string) int {
 				Color: colors[i%len(colors)],
 				Ui:    ui,
 			}
-			if _, ok := c.Ui.(*packer.MachineReadableUi); !ok {
+			if !c.machineOutput() && !cfgPlan {
 				ui.Say(fmt.Sprintf("%s output will be in this color.", b))
 				if i+1 == len(buildNames) {
 					// Add a newline between the color output and the actual output
@@ -107,27 +129,66 @@ func (c BuildCommand) Run(args []string) int {
 	log.Printf("Build debug mode: %v", cfgDebug)
 	log.Printf("Force build: %v", cfgForce)
 	log.Printf("On error: %v", cfgOnError)
+	log.Printf("Resume: %v", cfgResume)
+	log.Printf("Parallel builds: %d", cfgParallelBuilds)
+
+	printWarnings := func(name string, warnings []string) {
+		if len(warnings) == 0 {
+			return
+		}
+
+		ui := buildUis[name]
+		ui.Say(fmt.Sprintf("Warnings for build '%s':\n", name))
+		for _, warning := range warnings {
+			ui.Say(fmt.Sprintf("* %s", warning))
+		}
+		ui.Say("")
+	}
+
+	// Builds that depend on builds of this run are prepared once those
+	// have finished, so that their configuration can use the artifacts.
+	// With -plan, placeholders stand in for the artifacts.
+	running := make(map[string]struct{}, len(buildNames))
+	for _, n := range buildNames {
+		running[n] = struct{}{}
+	}
+	deferred := make(map[string]bool)
+	for _, n := range buildNames {
+		for _, dep := range core.BuildDependencies(n) {
+			if _, ok := running[dep]; ok {
+				deferred[n] = true
+			}
+		}
+	}
 
 	// Set the debug and force mode and prepare all the builds
 	for _, b := range builds {
-		log.Printf("Preparing build: %s", b.Name())
 		b.SetDebug(cfgDebug)
 		b.SetForce(cfgForce)
 		b.SetOnError(cfgOnError)
+		b.SetResume(cfgResume)
 
+		if deferred[b.Name()] {
+			if !cfgPlan {
+				log.Printf("Preparing build after its dependencies: %s", b.Name())
+				continue
+			}
+
+			b.SetBuildArtifacts(placeholderArtifacts(core.BuildDependencies(b.Name())))
+		}
+
+		log.Printf("Preparing build: %s", b.Name())
 		warnings, err := b.Prepare()
 		if err != nil {
 			c.Ui.Error(err.Error())
 			return 1
 		}
-		if len(warnings) > 0 {
-			ui := buildUis[b.Name()]
-			ui.Say(fmt.Sprintf("Warnings for build '%s':\n", b.Name()))
-			for _, warning := range warnings {
-				ui.Say(fmt.Sprintf("* %s", warning))
-			}
-			ui.Say("")
-		}
+		printWarnings(b.Name(), warnings)
+	}
+
+	// With -plan, the builds are only described
+	if cfgPlan {
+		return c.plan(core, builds)
 	}
 
 	// Run all the builds in parallel and wait for them to complete
@@ -137,8 +198,25 @@ func (c BuildCommand) Run(args []string) int {
 		sync.RWMutex
 		m map[string][]packer.Artifact
 	}{m: make(map[string][]packer.Artifact)}
-	errors := make(map[string]error)
+	var errors = struct {
+		sync.RWMutex
+		m map[string]error
+	}{m: make(map[string]error)}
+
+	// Each build closes its channel when it is done, so that the builds
+	// depending on it can start.
+	done := make(map[string]chan struct{}, len(builds))
 	for _, b := range builds {
+		done[b.Name()] = make(chan struct{})
+	}
+
+	// Limit the number of builds that run at the same time
+	var slots chan struct{}
+	if cfgParallelBuilds > 0 {
+		slots = make(chan struct{}, cfgParallelBuilds)
+	}
+
+	for i, b := range builds {
 		// Increment the waitgroup so we wait for this item to finish properly
 		wg.Add(1)
 
@@ -162,14 +240,89 @@ func (c BuildCommand) Run(args []string) int {
 			defer wg.Done()
 
 			name := b.Name()
-			log.Printf("Starting build run: %s", name)
+			defer close(done[name])
+
 			ui := buildUis[name]
+			machineUi := &packer.TargettedUi{
+				Target: name,
+				Ui:     c.Ui,
+			}
+
+			// Wait for the builds this build depends on. Dependencies
+			// that aren't being built, because of -only or -except, are
+			// assumed to have been built before.
+			for _, dep := range core.BuildDependencies(name) {
+				depDone, ok := done[dep]
+				if !ok {
+					continue
+				}
+
+				log.Printf("Build '%s' waiting on dependency: %s", name, dep)
+				<-depDone
+
+				artifacts.RLock()
+				_, ok = artifacts.m[dep]
+				artifacts.RUnlock()
+				if !ok {
+					err := fmt.Errorf("dependency '%s' didn't complete successfully", dep)
+					machineUi.Machine("build-finish", packer.MachineDuration(0), "error", err.Error())
+					ui.Error(fmt.Sprintf("Build '%s' skipped: %s", name, err))
+					errors.Lock()
+					errors.m[name] = err
+					errors.Unlock()
+					return
+				}
+			}
+
+			if deferred[name] {
+				buildArtifacts := make(map[string]map[string]string)
+				artifacts.RLock()
+				for _, dep := range core.BuildDependencies(name) {
+					if depArtifacts, ok := artifacts.m[dep]; ok {
+						buildArtifacts[dep] = packer.ArtifactVariables(depArtifacts)
+					}
+				}
+				artifacts.RUnlock()
+
+				log.Printf("Preparing build: %s", name)
+				b.SetBuildArtifacts(buildArtifacts)
+				warnings, err := b.Prepare()
+				if err != nil {
+					machineUi.Machine("build-finish", packer.MachineDuration(0), "error", err.Error())
+					ui.Error(fmt.Sprintf("Build '%s' errored: %s", name, err))
+					errors.Lock()
+					errors.m[name] = err
+					errors.Unlock()
+					return
+				}
+				printWarnings(name, warnings)
+			}
+
+			if slots != nil {
+				log.Printf("Build '%s' waiting for a free build slot", name)
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+
+			if interrupted {
+				log.Printf("Interrupted, not starting build: %s", name)
+				return
+			}
+
+			log.Printf("Starting build run: %s", name)
+			machineUi.Machine("build-start")
+			start := time.Now()
 			runArtifacts, err := b.Run(ui, c.Cache)
+			duration := packer.MachineDuration(time.Since(start))
 
 			if err != nil {
+				machineUi.Machine("build-finish", duration, "error", err.Error())
 				ui.Error(fmt.Sprintf("Build '%s' errored: %s", name, err))
-				errors[name] = err
+				errors.Lock()
+				errors.m[name] = err
+				errors.Unlock()
 			} else {
+				machineUi.Machine("build-finish", duration, "success")
 				ui.Say(fmt.Sprintf("Build '%s' finished.", name))
 				artifacts.Lock()
 				artifacts.m[name] = runArtifacts
@@ -189,6 +342,11 @@ func (c BuildCommand) Run(args []string) int {
 
 		if interrupted {
 			log.Println("Interrupted, not going to start any more builds.")
+
+			// Release the builds waiting on builds that won't start
+			for _, rest := range builds[i+1:] {
+				close(done[rest.Name()])
+			}
 			break
 		}
 	}
@@ -206,11 +364,11 @@ func (c BuildCommand) Run(args []string) int {
 		return 1
 	}
 
-	if len(errors) > 0 {
-		c.Ui.Machine("error-count", strconv.FormatInt(int64(len(errors)), 10))
+	if len(errors.m) > 0 {
+		c.Ui.Machine("error-count", strconv.FormatInt(int64(len(errors.m)), 10))
 
 		c.Ui.Error("\n==> Some builds didn't complete successfully and had errors:")
-		for name, err := range errors {
+		for name, err := range errors.m {
 			// Create a UI for the machine readable stuff to be targetted
 			ui := &packer.TargettedUi{
 				Target: name,
@@ -271,7 +429,7 @@ func (c BuildCommand) Run(args []string) int {
 		c.Ui.Say("\n==> Builds finished but no artifacts were created.")
 	}
 
-	if len(errors) > 0 {
+	if len(errors.m) > 0 {
 		// If any errors occurred, exit with a non-zero exit status
 		return 1
 	}
@@ -279,6 +437,173 @@ func (c BuildCommand) Run(args []string) int {
 	return 0
 }
 
+// placeholderArtifacts returns stand-ins for the values of the artifacts
+// of the given builds, so that the builds that use them can be checked
+// before the artifacts exist.
+func placeholderArtifacts(names []string) map[string]map[string]string {
+	result := make(map[string]map[string]string, len(names))
+	for _, n := range names {
+		vars := make(map[string]string)
+		for _, k := range []string{"id", "builder_id", "files", "string"} {
+			vars[k] = fmt.Sprintf("<%s of build '%s'>", k, n)
+		}
+		result[n] = vars
+	}
+
+	return result
+}
+
+// plan outputs what the prepared builds would do, in the order they would
+// start, without running them.
+func (c BuildCommand) plan(core *packer.Core, builds []packer.Build) int {
+	for i, b := range builds {
+		name := b.Name()
+		ui := &packer.TargettedUi{
+			Target: name,
+			Ui:     c.Ui,
+		}
+
+		resolved, err := core.Resolve(name)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to resolve build '%s': %s", name, err))
+			return 1
+		}
+
+		steps, err := packer.BuildSteps(b)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to plan build '%s': %s", name, err))
+			return 1
+		}
+
+		if i > 0 {
+			c.Ui.Say("")
+		}
+
+		header := fmt.Sprintf("==> Build '%s' (%s)", name, resolved.Type)
+		if deps := core.BuildDependencies(name); len(deps) > 0 {
+			header += fmt.Sprintf(", after %s", strings.Join(deps, ", "))
+			for _, dep := range deps {
+				ui.Machine("plan-depends-on", dep)
+			}
+		}
+		ui.Machine("plan-builder", resolved.Type)
+		c.Ui.Say(header + ":")
+
+		if len(resolved.Config) == 0 {
+			c.Ui.Say("  Builder configuration: none")
+		} else {
+			c.Ui.Say("  Builder configuration:")
+			planConfig(c.Ui, ui, "    ", []string{"plan-builder-config"}, resolved.Config)
+		}
+
+		if steps == nil {
+			c.Ui.Say("  Steps: the builder doesn't describe its steps")
+		} else {
+			c.Ui.Say("  Steps:")
+			for j, step := range steps {
+				ui.Machine("plan-step", strconv.Itoa(j+1), step)
+				c.Ui.Say(fmt.Sprintf("    %d. %s", j+1, step))
+			}
+		}
+
+		if len(resolved.Provisioners) == 0 {
+			c.Ui.Say("  Provisioners: none")
+		} else {
+			c.Ui.Say("  Provisioners:")
+			for j, p := range resolved.Provisioners {
+				id := strconv.Itoa(j + 1)
+				output := fmt.Sprintf("    %s. %s", id, p.Type)
+				if p.PauseBefore > 0 {
+					output += fmt.Sprintf(", after pausing %s", p.PauseBefore)
+				}
+
+				ui.Machine("plan-provisioner", id, p.Type, p.PauseBefore.String())
+				c.Ui.Say(output)
+				planConfig(c.Ui, ui, "       ", []string{"plan-provisioner-config", id}, p.Config)
+			}
+		}
+
+		if len(resolved.PostProcessors) == 0 {
+			c.Ui.Say("  Post-processors: none")
+		} else {
+			c.Ui.Say("  Post-processors:")
+			for j, chain := range resolved.PostProcessors {
+				for k, p := range chain {
+					id := fmt.Sprintf("%d.%d", j+1, k+1)
+					output := fmt.Sprintf("    %s. %s", id, p.Type)
+					if p.KeepInputArtifact {
+						output += ", keeping its input artifact"
+					}
+
+					ui.Machine("plan-post-processor", id, p.Type,
+						strconv.FormatBool(p.KeepInputArtifact))
+					c.Ui.Say(output)
+					planConfig(c.Ui, ui, "         ", []string{"plan-post-processor-config", id}, p.Config)
+				}
+			}
+		}
+	}
+
+	c.Ui.Say("\n==> Nothing was built. Run the build without -plan to run these builds.")
+	return 0
+}
+
+// planConfig outputs the keys of a configuration in order, along with
+// their values as JSON. The values of settings for credentials are masked
+// even if they aren't known to be sensitive.
+func planConfig(ui, machineUi packer.Ui, indent string, machine []string, config map[string]interface{}) {
+	config = redactSecretKeys(redactConfig(config)).(map[string]interface{})
+
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		// HTML isn't escaped, so that masked values read as the mask
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		var value []byte
+		if err := enc.Encode(config[k]); err != nil {
+			value = []byte(fmt.Sprintf("%v", config[k]))
+		} else {
+			value = bytes.TrimSpace(buf.Bytes())
+		}
+
+		args := append(append([]string(nil), machine[1:]...), k, string(value))
+		machineUi.Machine(machine[0], args...)
+		ui.Say(fmt.Sprintf("%s%s = %s", indent, k, value))
+	}
+}
+
+// redactSecretKeys returns a copy of the value with the values of the
+// settings for credentials, at any depth, masked.
+func redactSecretKeys(raw interface{}) interface{} {
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			if isSecretKey(k) && elem != nil && elem != "" {
+				result[k] = sensitive.Mask
+				continue
+			}
+
+			result[k] = redactSecretKeys(elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = redactSecretKeys(elem)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
 func (BuildCommand) Help() string {
 	helpText := `
 Usage: packer build [options] TEMPLATE
@@ -294,10 +619,14 @@ Options:
   -only=foo,bar,baz          Build only the specified builds
   -force                     Force a build to continue if artifacts exist, deletes existing artifacts
   -machine-readable          Machine-readable output
+  -log-format=json           Machine-readable output as newline-delimited JSON events
   -on-error=[cleanup|abort|ask] If the build fails do: clean up (default), abort, or ask
   -parallel=false            Disable parallelization (on by default)
+  -parallel-builds=N         Run at most N builds at the same time (unlimited by default)
+  -plan                      Show what the builds would do after preparing them, without running them
+  -resume                    Checkpoint builds and resume them at the failed step (qemu, null)
   -var 'key=value'           Variable for templates, can be used multiple times.
-  -var-file=path             JSON file containing user variables.
+  -var-file=path             JSON, YAML or HCL file containing user variables.
 `
 
 	return strings.TrimSpace(helpText)
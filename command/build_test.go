@@ -2,8 +2,11 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mitchellh/packer/builder/file"
@@ -122,6 +125,184 @@ func TestBuildExceptFileCommaFlags(t *testing.T) {
 	}
 }
 
+func TestBuildDependsOnArtifact(t *testing.T) {
+	c := &BuildCommand{
+		Meta: testMetaFile(t),
+	}
+
+	args := []string{
+		filepath.Join(testFixture("build-depends-on"), "template.json"),
+	}
+
+	defer cleanup()
+
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	contents, err := ioutil.ReadFile("vanilla.txt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(contents) != "chocolate.txt" {
+		t.Fatalf("bad: %q", contents)
+	}
+}
+
+func TestBuildDependsOnArtifact_only(t *testing.T) {
+	c := &BuildCommand{
+		Meta: testMetaFile(t),
+	}
+
+	args := []string{
+		"-only=vanilla",
+		filepath.Join(testFixture("build-depends-on"), "template.json"),
+	}
+
+	defer cleanup()
+
+	if code := c.Run(args); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	_, stderr := outputCommand(t, c.Meta)
+	if !strings.Contains(stderr, "build 'chocolate' not available") {
+		t.Fatalf("bad: %s", stderr)
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	builder := &packer.MockBuilder{PlanSteps: []string{"StepOne", "StepTwo"}}
+	provisioner := new(packer.MockProvisioner)
+	postProcessor := new(packer.MockPostProcessor)
+
+	var out, errOut bytes.Buffer
+	c := &BuildCommand{
+		Meta: Meta{
+			CoreConfig: &packer.CoreConfig{
+				Components: packer.ComponentFinder{
+					Builder: func(string) (packer.Builder, error) {
+						return builder, nil
+					},
+					Provisioner: func(string) (packer.Provisioner, error) {
+						return provisioner, nil
+					},
+					PostProcessor: func(string) (packer.PostProcessor, error) {
+						return postProcessor, nil
+					},
+				},
+			},
+			Ui: &packer.BasicUi{
+				Writer:      &out,
+				ErrorWriter: &errOut,
+			},
+		},
+	}
+
+	args := []string{
+		"-plan",
+		"-var", "size=20",
+		filepath.Join(testFixture("build-plan"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	if !builder.PrepareCalled || !provisioner.PrepCalled || !postProcessor.ConfigureCalled {
+		t.Fatal("the components should be prepared")
+	}
+	if builder.RunCalled || provisioner.ProvCalled || postProcessor.PostProcessCalled {
+		t.Fatal("nothing should run")
+	}
+
+	output := out.String()
+	expected := []string{
+		"==> Build 'base' (test):",
+		"    disk_size = \"20\"",
+		"    ssh_password = \"<sensitive>\"",
+		"    1. StepOne\n    2. StepTwo",
+		"==> Build 'app' (test), after base:",
+		"    1. shell, after pausing 5s\n       inline = [\"echo app\"]",
+		"    1.1. compress\n    1.2. upload, keeping its input artifact",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Fatalf("missing %q in:\n%s", e, output)
+		}
+	}
+	if strings.Contains(output, `ssh_password = "y"`) {
+		t.Fatalf("credentials should be masked:\n%s", output)
+	}
+	if strings.Index(output, "Build 'base'") > strings.Index(output, "Build 'app'") {
+		t.Fatalf("builds should be in the order they run:\n%s", output)
+	}
+}
+
+func TestBuildLogFormat(t *testing.T) {
+	c := &BuildCommand{
+		Meta: testMetaFile(t),
+	}
+
+	out, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+	defer os.Setenv("PACKER_NO_COLOR", os.Getenv("PACKER_NO_COLOR"))
+
+	// The value can be the next argument too
+	args := []string{
+		"-log-format", "json",
+		"-only=chocolate",
+		filepath.Join(testFixture("build-only"), "template.json"),
+	}
+
+	defer cleanup()
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	contents, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		var event packer.JSONUiEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("bad line %q: %s", line, err)
+		}
+		types = append(types, event.Type)
+	}
+	if len(types) == 0 || types[0] != "build-start" {
+		t.Fatalf("bad: %#v", types)
+	}
+}
+
+func TestBuildLogFormat_invalid(t *testing.T) {
+	c := &BuildCommand{
+		Meta: testMetaFile(t),
+	}
+
+	args := []string{
+		"-log-format=xml",
+		filepath.Join(testFixture("build-only"), "template.json"),
+	}
+	if code := c.Run(args); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	if _, errOut := outputCommand(t, c.Meta); !strings.Contains(errOut, "Unknown log format") {
+		t.Fatalf("bad: %s", errOut)
+	}
+}
+
 // fileExists returns true if the filename is found
 func fileExists(filename string) bool {
 	if _, err := os.Stat(filename); err == nil {
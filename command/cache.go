@@ -0,0 +1,368 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/mitchellh/packer/packer"
+)
+
+// CacheCommand is the parent of the commands that manage the download
+// cache. By itself it only shows the help.
+type CacheCommand struct {
+	Meta
+}
+
+func (c *CacheCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (*CacheCommand) Help() string {
+	helpText := `
+Usage: packer cache <subcommand> [options]
+
+  Manages the cache of files that builders download, such as ISOs. The
+  cache is located at PACKER_CACHE_DIR, or at "packer_cache" in the
+  current directory if it isn't set.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheCommand) Synopsis() string {
+	return "manage the download cache"
+}
+
+// CacheListCommand lists the files in the cache.
+type CacheListCommand struct {
+	Meta
+}
+
+func (c *CacheListCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("cache list", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	cache, err := c.fileCache()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading cache: %s", err))
+		return 1
+	}
+
+	if len(entries) == 0 {
+		c.Ui.Say(fmt.Sprintf("The cache at %s is empty.", cache.CacheDir))
+		return 0
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		c.Ui.Machine("cache-entry", e.File, e.Key, e.Source,
+			strconv.FormatInt(e.Size, 10), strconv.FormatInt(e.LastUsed.Unix(), 10))
+
+		c.Ui.Say(e.File)
+		if source := cacheEntrySource(e); source != "" {
+			c.Ui.Say(fmt.Sprintf("  source:    %s", source))
+		}
+		if e.Checksum != "" {
+			c.Ui.Say(fmt.Sprintf("  checksum:  %s:%s", e.ChecksumType, e.Checksum))
+		}
+		c.Ui.Say(fmt.Sprintf("  size:      %s", formatByteSize(e.Size)))
+		c.Ui.Say(fmt.Sprintf("  last used: %s", e.LastUsed.Local().Format(time.RFC1123)))
+	}
+
+	c.Ui.Say(fmt.Sprintf("\n%d files, %s in total.", len(entries), formatByteSize(total)))
+	return 0
+}
+
+func (*CacheListCommand) Help() string {
+	helpText := `
+Usage: packer cache list
+
+  Lists the files in the cache, most recently used first, with where they
+  were downloaded from, their size and when they were last used.
+
+Options:
+
+  -machine-readable  Machine-readable output
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheListCommand) Synopsis() string {
+	return "list the files in the cache"
+}
+
+// CachePruneCommand removes old files from the cache.
+type CachePruneCommand struct {
+	Meta
+}
+
+func (c *CachePruneCommand) Run(args []string) int {
+	cache, err := c.fileCache()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	var maxSize string
+	maxAge := cache.MaxAge
+	if cache.MaxSize > 0 {
+		maxSize = strconv.FormatInt(cache.MaxSize, 10)
+	}
+
+	flags := c.Meta.FlagSet("cache prune", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	flags.StringVar(&maxSize, "max-size", maxSize, "max size")
+	flags.DurationVar(&maxAge, "max-age", maxAge, "max age")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	var size int64
+	if maxSize != "" {
+		size, err = packer.ParseByteSize(maxSize)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error parsing -max-size: %s", err))
+			return 1
+		}
+	}
+
+	if size == 0 && maxAge == 0 {
+		c.Ui.Error("Either -max-size or -max-age must be set.\n")
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	removed, err := cache.Prune(size, maxAge)
+	for _, e := range removed {
+		c.Ui.Machine("cache-removed", e.File, strconv.FormatInt(e.Size, 10))
+		c.Ui.Say(fmt.Sprintf("Removed %s (%s)", e.File, formatByteSize(e.Size)))
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error pruning cache: %s", err))
+		return 1
+	}
+
+	c.Ui.Say(fmt.Sprintf("Removed %d files from the cache.", len(removed)))
+	return 0
+}
+
+func (*CachePruneCommand) Help() string {
+	helpText := `
+Usage: packer cache prune [options]
+
+  Removes files from the cache. Files that weren't used within the maximum
+  age are removed first, then the least recently used files until the cache
+  is within the maximum size. Files that are in use by a running build are
+  never removed.
+
+  The limits default to the PACKER_CACHE_MAX_SIZE and PACKER_CACHE_MAX_AGE
+  environment variables.
+
+Options:
+
+  -max-size=10GB     Maximum total size of the cache
+  -max-age=720h      Remove files that weren't used for this long
+  -machine-readable  Machine-readable output
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CachePruneCommand) Synopsis() string {
+	return "remove old files from the cache"
+}
+
+// CacheVerifyCommand checks the files in the cache against their
+// checksums.
+type CacheVerifyCommand struct {
+	Meta
+}
+
+func (c *CacheVerifyCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("cache verify", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	cache, err := c.fileCache()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading cache: %s", err))
+		return 1
+	}
+
+	failed := 0
+	for _, e := range entries {
+		if e.Checksum == "" {
+			c.Ui.Machine("cache-verify", e.File, "unknown", "")
+			c.Ui.Say(fmt.Sprintf("%s: no checksum known", e.File))
+			continue
+		}
+
+		if err := cache.Verify(e); err != nil {
+			failed++
+			c.Ui.Machine("cache-verify", e.File, "failed", err.Error())
+			c.Ui.Error(fmt.Sprintf("%s: FAILED: %s", e.File, err))
+			continue
+		}
+
+		c.Ui.Machine("cache-verify", e.File, "ok", "")
+		c.Ui.Say(fmt.Sprintf("%s: OK", e.File))
+	}
+
+	if failed > 0 {
+		c.Ui.Error(fmt.Sprintf(
+			"\n%d files failed verification. Remove them with 'packer cache clear'\n"+
+				"or delete them from %s.", failed, cache.CacheDir))
+		return 1
+	}
+
+	return 0
+}
+
+func (*CacheVerifyCommand) Help() string {
+	helpText := `
+Usage: packer cache verify
+
+  Checks the files in the cache against the checksums they were downloaded
+  with. Files that were cached without a checksum are skipped. The exit
+  status is non-zero if any file doesn't match.
+
+Options:
+
+  -machine-readable  Machine-readable output
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheVerifyCommand) Synopsis() string {
+	return "check the files in the cache against their checksums"
+}
+
+// CacheClearCommand removes all the files from the cache.
+type CacheClearCommand struct {
+	Meta
+}
+
+func (c *CacheClearCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("cache clear", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	cache, err := c.fileCache()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading cache: %s", err))
+		return 1
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if err := cache.Remove(e); err != nil {
+			if err == packer.ErrCacheEntryLocked {
+				c.Ui.Say(fmt.Sprintf("Skipping %s, it is in use", e.File))
+				continue
+			}
+
+			c.Ui.Error(fmt.Sprintf("Error removing %s: %s", e.File, err))
+			return 1
+		}
+
+		removed++
+		c.Ui.Machine("cache-removed", e.File, strconv.FormatInt(e.Size, 10))
+	}
+
+	c.Ui.Say(fmt.Sprintf("Removed %d files from the cache.", removed))
+	return 0
+}
+
+func (*CacheClearCommand) Help() string {
+	helpText := `
+Usage: packer cache clear
+
+  Removes all the files from the cache, except those that are in use by a
+  running build.
+
+Options:
+
+  -machine-readable  Machine-readable output
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*CacheClearCommand) Synopsis() string {
+	return "remove all the files from the cache"
+}
+
+// fileCache returns the cache the commands manage. Only a FileCache keeps
+// the index that the commands need.
+func (m *Meta) fileCache() (*packer.FileCache, error) {
+	cache, ok := m.Cache.(*packer.FileCache)
+	if !ok {
+		return nil, fmt.Errorf("The cache doesn't support being managed.")
+	}
+
+	if _, err := os.Stat(cache.CacheDir); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error reading cache directory: %s", err)
+	}
+
+	return cache, nil
+}
+
+// cacheEntrySource returns where the file of the entry came from, which is
+// its key if it wasn't described.
+func cacheEntrySource(e *packer.CacheEntry) string {
+	if e.Source != "" {
+		return e.Source
+	}
+
+	return e.Key
+}
+
+// formatByteSize formats a size in bytes for humans.
+func formatByteSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/mitchellh/packer/packer"
+)
+
+func TestCacheCommand_implements(t *testing.T) {
+	var _ cli.Command = &CacheCommand{}
+	var _ cli.Command = &CacheClearCommand{}
+	var _ cli.Command = &CacheListCommand{}
+	var _ cli.Command = &CachePruneCommand{}
+	var _ cli.Command = &CacheVerifyCommand{}
+}
+
+func testCacheMeta(t *testing.T) (Meta, *packer.FileCache) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cache := &packer.FileCache{CacheDir: dir}
+	path := cache.Lock("foo.iso")
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cache.Describe("foo.iso", packer.CacheInfo{
+		Source:       "http://example.com/foo.iso",
+		ChecksumType: "md5",
+		Checksum:     "acbd18db4cc2f85cedef654fccc4a4d8",
+	})
+	cache.Unlock("foo.iso")
+
+	m := testMeta(t)
+	m.Cache = cache
+	return m, cache
+}
+
+func TestCacheListCommand(t *testing.T) {
+	m, cache := testCacheMeta(t)
+	defer os.RemoveAll(cache.CacheDir)
+
+	c := &CacheListCommand{Meta: m}
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	if !strings.Contains(out, "http://example.com/foo.iso") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestCacheVerifyCommand(t *testing.T) {
+	m, cache := testCacheMeta(t)
+	defer os.RemoveAll(cache.CacheDir)
+
+	c := &CacheVerifyCommand{Meta: m}
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	// Corrupt the file
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(cache.CacheDir, entries[0].File)
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+}
+
+func TestCacheClearCommand(t *testing.T) {
+	m, cache := testCacheMeta(t)
+	defer os.RemoveAll(cache.CacheDir)
+
+	c := &CacheClearCommand{Meta: m}
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
+
+func TestCachePruneCommand_noLimits(t *testing.T) {
+	m, cache := testCacheMeta(t)
+	defer os.RemoveAll(cache.CacheDir)
+
+	c := &CachePruneCommand{Meta: m}
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	if code := c.Run([]string{"-max-size", "1B"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
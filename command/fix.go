@@ -17,9 +17,10 @@ type FixCommand struct {
 }
 
 func (c *FixCommand) Run(args []string) int {
-	var flagValidate bool
+	var flagValidate, flagToHCL bool
 	flags := c.Meta.FlagSet("fix", FlagSetNone)
 	flags.BoolVar(&flagValidate, "validate", true, "")
+	flags.BoolVar(&flagToHCL, "to-hcl", false, "")
 	flags.Usage = func() { c.Ui.Say(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -66,27 +67,56 @@ func (c *FixCommand) Run(args []string) int {
 		}
 	}
 
-	var output bytes.Buffer
-	encoder := json.NewEncoder(&output)
-	if err := encoder.Encode(input); err != nil {
-		c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
-		return 1
-	}
+	var result string
+	if flagToHCL {
+		// The fixers leave values of their own types in the template, so
+		// decode it again to get the generic structure of JSON.
+		encoded, err := json.Marshal(input)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
+			return 1
+		}
 
-	var indented bytes.Buffer
-	if err := json.Indent(&indented, output.Bytes(), "", "  "); err != nil {
-		c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
-		return 1
-	}
+		var generic map[string]interface{}
+		if err := json.Unmarshal(encoded, &generic); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
+			return 1
+		}
 
-	result := indented.String()
-	result = strings.Replace(result, `\u003c`, "<", -1)
-	result = strings.Replace(result, `\u003e`, ">", -1)
+		output, err := template.FormatHCL(generic)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error converting to HCL: %s", err))
+			return 1
+		}
+
+		result = string(output)
+	} else {
+		var output bytes.Buffer
+		encoder := json.NewEncoder(&output)
+		if err := encoder.Encode(input); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
+			return 1
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, output.Bytes(), "", "  "); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error encoding: %s", err))
+			return 1
+		}
+
+		result = indented.String()
+		result = strings.Replace(result, `\u003c`, "<", -1)
+		result = strings.Replace(result, `\u003e`, ">", -1)
+	}
 	c.Ui.Say(result)
 
 	if flagValidate {
 		// Attemot to parse and validate the template
-		tpl, err := template.Parse(strings.NewReader(result))
+		parse := template.Parse
+		if flagToHCL {
+			parse = template.ParseHCL
+		}
+		tpl, err := parse(strings.NewReader(result))
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf(
 				"Error! Fixed template fails to parse: %s\n\n"+
@@ -132,6 +162,8 @@ Fixes that are run:
 Options:
 
   -validate=true      If true (default), validates the fixed template.
+  -to-hcl             Output the fixed template in the HCL template format
+                      instead of JSON.
 `
 
 	return strings.TrimSpace(helpText)
@@ -2,6 +2,7 @@ package command
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -56,3 +57,41 @@ func TestFix_invalidTemplateDisableValidation(t *testing.T) {
 		fatalCommand(t, c.Meta)
 	}
 }
+
+func TestFix_toHCL(t *testing.T) {
+	c := &FixCommand{
+		Meta: testMeta(t),
+	}
+
+	args := []string{
+		"-to-hcl",
+		filepath.Join(testFixture("fix"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+}
+
+func TestFix_toHCLNull(t *testing.T) {
+	c := &FixCommand{
+		Meta: testMeta(t),
+	}
+
+	args := []string{
+		"-to-hcl",
+		filepath.Join(testFixture("fix-null"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	for _, s := range []string{`variable "required" {}`, `builder "dummy"`, `tags = ["a", ""]`} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("missing %q:\n\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "ssh_password") {
+		t.Fatalf("null should be left out:\n\n%s", out)
+	}
+}
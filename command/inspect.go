@@ -1,10 +1,14 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/mitchellh/packer/common/sensitive"
 	"github.com/mitchellh/packer/template"
 )
 
@@ -13,8 +17,10 @@ type InspectCommand struct {
 }
 
 func (c *InspectCommand) Run(args []string) int {
-	flags := c.Meta.FlagSet("inspect", FlagSetNone)
+	var flagJSON bool
+	flags := c.Meta.FlagSet("inspect", FlagSetBuildFilter|FlagSetVars)
 	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	flags.BoolVar(&flagJSON, "json", false, "json")
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
@@ -32,6 +38,10 @@ func (c *InspectCommand) Run(args []string) int {
 		return 1
 	}
 
+	if flagJSON {
+		return c.inspectJSON(tpl)
+	}
+
 	// Convenience...
 	ui := c.Ui
 
@@ -41,6 +51,40 @@ func (c *InspectCommand) Run(args []string) int {
 		ui.Say(tpl.Description + "\n")
 	}
 
+	// Imports
+	if len(tpl.Imports) > 0 {
+		ui.Say("Imports:\n")
+		for _, v := range tpl.Imports {
+			ui.Machine("template-import", v)
+			ui.Say("  " + v)
+		}
+		ui.Say("")
+	}
+
+	// source describes which imported template a piece came from
+	source := func(kind, name, path string) string {
+		if path == "" {
+			return ""
+		}
+
+		ui.Machine("template-source", kind, name, path)
+		if rel, err := filepath.Rel(filepath.Dir(tpl.Path), path); err == nil {
+			path = rel
+		}
+		return fmt.Sprintf(" (from %s)", path)
+	}
+
+	// describe shows the type and description of a variable, if it has them
+	describe := func(k string, v *template.Variable) {
+		if v.Type != "" {
+			ui.Machine("template-variable-type", k, v.Type)
+		}
+		if v.Description != "" {
+			ui.Machine("template-variable-description", k, v.Description)
+			ui.Say("      " + v.Description)
+		}
+	}
+
 	// Variables
 	if len(tpl.Variables) == 0 {
 		ui.Say("Variables:\n")
@@ -55,7 +99,12 @@ func (c *InspectCommand) Run(args []string) int {
 				}
 
 				ui.Machine("template-variable", k, v.Default, "1")
-				ui.Say("  " + k)
+				output := "  " + k
+				if v.Type != "" {
+					output += fmt.Sprintf(" (%s)", v.Type)
+				}
+				ui.Say(output + source("variable", k, v.Source))
+				describe(k, v)
 			}
 		}
 
@@ -83,9 +132,14 @@ func (c *InspectCommand) Run(args []string) int {
 
 			padding := strings.Repeat(" ", max-len(k))
 			output := fmt.Sprintf("  %s%s = %s", k, padding, v.Default)
+			if v.Type != "" {
+				output += fmt.Sprintf(" (%s)", v.Type)
+			}
+			output += source("variable", k, v.Source)
 
 			ui.Machine("template-variable", k, v.Default, "0")
 			ui.Say(output)
+			describe(k, v)
 		}
 	}
 
@@ -114,10 +168,42 @@ func (c *InspectCommand) Run(args []string) int {
 			if v.Name != v.Type {
 				output = fmt.Sprintf("%s (%s)", output, v.Type)
 			}
+			if v.Extends != "" {
+				output = fmt.Sprintf("%s extends %s", output, v.Extends)
+			}
+			if len(v.DependsOn) > 0 {
+				output = fmt.Sprintf("%s depends on %s",
+					output, strings.Join(v.DependsOn, ", "))
+				for _, dep := range v.DependsOn {
+					ui.Machine("template-builder-depends-on", k, dep)
+				}
+			}
+			output += source("builder", k, v.Source)
 
 			ui.Machine("template-builder", k, v.Type)
 			ui.Say(output)
 
+			// Show the effective configuration of builders that are
+			// based on another builder, since it isn't written out
+			// anywhere.
+			if v.Extends != "" {
+				configKeys := make([]string, 0, len(v.Config))
+				for ck := range v.Config {
+					configKeys = append(configKeys, ck)
+				}
+				sort.Strings(configKeys)
+
+				for _, ck := range configKeys {
+					value, err := json.Marshal(v.Config[ck])
+					if err != nil {
+						value = []byte(fmt.Sprintf("%v", v.Config[ck]))
+					}
+
+					ui.Machine("template-builder-config", k, ck, string(value))
+					ui.Say(fmt.Sprintf("    %s = %s", ck, value))
+				}
+			}
+
 		}
 	}
 
@@ -128,9 +214,30 @@ func (c *InspectCommand) Run(args []string) int {
 	if len(tpl.Provisioners) == 0 {
 		ui.Say("  <No provisioners>")
 	} else {
-		for _, v := range tpl.Provisioners {
+		for i, v := range tpl.Provisioners {
 			ui.Machine("template-provisioner", v.Type)
-			ui.Say(fmt.Sprintf("  %s", v.Type))
+			ui.Say(fmt.Sprintf("  %s%s", v.Type,
+				source("provisioner", strconv.Itoa(i+1), v.Source)))
+		}
+	}
+
+	ui.Say("")
+
+	// Post-processors
+	ui.Say("Post-processors:\n")
+	if len(tpl.PostProcessors) == 0 {
+		ui.Say("  <No post-processors>")
+	} else {
+		for i, chain := range tpl.PostProcessors {
+			types := make([]string, len(chain))
+			from := ""
+			for j, v := range chain {
+				name := fmt.Sprintf("%d.%d", i+1, j+1)
+				ui.Machine("template-post-processor", name, v.Type)
+				types[j] = v.Type
+				from = source("post-processor", name, v.Source)
+			}
+			ui.Say(fmt.Sprintf("  %d: %s%s", i+1, strings.Join(types, " -> "), from))
 		}
 	}
 
@@ -141,17 +248,165 @@ func (c *InspectCommand) Run(args []string) int {
 	return 0
 }
 
+// inspectJSON outputs the builds of the template as they would run, along
+// with the user variables and where their values come from.
+func (c *InspectCommand) inspectJSON(tpl *template.Template) int {
+	core, err := c.Meta.Core(tpl)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	result := inspectResult{
+		Variables: make(map[string]inspectVariable),
+		Builds:    make([]inspectBuild, 0),
+	}
+
+	for k, v := range core.Context().UserVariables {
+		source, file := c.Meta.VariableSource(tpl, k)
+		result.Variables[k] = inspectVariable{
+			Value:  sensitive.Redact(v),
+			Source: source,
+			File:   file,
+		}
+	}
+
+	for _, n := range core.BuildOrder(c.Meta.BuildNames(core)) {
+		b, err := core.Resolve(n)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to resolve build '%s': %s", n, err))
+			return 1
+		}
+
+		build := inspectBuild{
+			Name:           b.Name,
+			Type:           b.Type,
+			DependsOn:      core.BuildDependencies(n),
+			Config:         redactConfig(b.Config),
+			Provisioners:   make([]inspectProvisioner, 0, len(b.Provisioners)),
+			PostProcessors: make([][]inspectPostProcessor, 0, len(b.PostProcessors)),
+		}
+		for _, p := range b.Provisioners {
+			pause := ""
+			if p.PauseBefore > 0 {
+				pause = p.PauseBefore.String()
+			}
+
+			build.Provisioners = append(build.Provisioners, inspectProvisioner{
+				Type:        p.Type,
+				Config:      redactConfig(p.Config),
+				PauseBefore: pause,
+			})
+		}
+		for _, chain := range b.PostProcessors {
+			current := make([]inspectPostProcessor, 0, len(chain))
+			for _, p := range chain {
+				current = append(current, inspectPostProcessor{
+					Type:              p.Type,
+					Config:            redactConfig(p.Config),
+					KeepInputArtifact: p.KeepInputArtifact,
+				})
+			}
+			build.PostProcessors = append(build.PostProcessors, current)
+		}
+
+		result.Builds = append(result.Builds, build)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to encode the template: %s", err))
+		return 1
+	}
+
+	c.Ui.Say(string(data))
+	return 0
+}
+
+// inspectResult is the output of inspect -json.
+type inspectResult struct {
+	Variables map[string]inspectVariable `json:"variables"`
+	Builds    []inspectBuild             `json:"builds"`
+}
+
+type inspectVariable struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+}
+
+type inspectBuild struct {
+	Name           string                   `json:"name"`
+	Type           string                   `json:"type"`
+	DependsOn      []string                 `json:"depends_on,omitempty"`
+	Config         map[string]interface{}   `json:"config"`
+	Provisioners   []inspectProvisioner     `json:"provisioners"`
+	PostProcessors [][]inspectPostProcessor `json:"post_processors"`
+}
+
+type inspectProvisioner struct {
+	Type        string                 `json:"type"`
+	Config      map[string]interface{} `json:"config"`
+	PauseBefore string                 `json:"pause_before,omitempty"`
+}
+
+type inspectPostProcessor struct {
+	Type              string                 `json:"type"`
+	Config            map[string]interface{} `json:"config"`
+	KeepInputArtifact bool                   `json:"keep_input_artifact"`
+}
+
+// redactConfig returns a copy of the configuration with the sensitive
+// values in its strings masked. The masking is done before the values are
+// encoded, since the Ui can't find values that encoding escaped.
+func redactConfig(config map[string]interface{}) map[string]interface{} {
+	return redactValue(config).(map[string]interface{})
+}
+
+func redactValue(raw interface{}) interface{} {
+	switch v := raw.(type) {
+	case string:
+		return sensitive.Redact(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			result[k] = redactValue(elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = redactValue(elem)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
 func (*InspectCommand) Help() string {
 	helpText := `
-Usage: packer inspect TEMPLATE
+Usage: packer inspect [options] TEMPLATE
 
   Inspects a template, parsing and outputting the components a template
   defines. This does not validate the contents of a template (other than
-  basic syntax by necessity).
+  basic syntax by necessity). Components that come from imported templates
+  show the template they were imported from, and builders that extend
+  another builder show their effective configuration.
+
+  With -json, the builds are output as JSON the way they would run: their
+  configuration with user variables interpolated, and the provisioners and
+  post-processors that run for each of them in order. The user variables
+  are output along with where their values come from.
 
 Options:
 
-  -machine-readable  Machine-readable output
+  -json                      Output the resolved builds as JSON
+  -except=foo,bar,baz        With -json, output all builds except these
+  -only=foo,bar,baz          With -json, only output these builds
+  -var 'key=value'           Variable for the template, can be repeated
+  -var-file=path             JSON, YAML or HCL file containing user variables
+  -machine-readable          Machine-readable output
 `
 
 	return strings.TrimSpace(helpText)
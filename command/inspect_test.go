@@ -0,0 +1,118 @@
+package command
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInspect_json(t *testing.T) {
+	os.Setenv("PACKER_TEST_INSPECT", "/home/packer")
+	defer os.Setenv("PACKER_TEST_INSPECT", "")
+
+	c := &InspectCommand{
+		Meta: testMeta(t),
+	}
+
+	varFile := filepath.Join(testFixture("inspect"), "vars.json")
+	args := []string{
+		"-json",
+		"-var-file", varFile,
+		"-var", "region=us-west-2",
+		"-only", "main",
+		"-var", "name=main",
+		filepath.Join(testFixture("inspect"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	var result inspectResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("err: %s\n\n%s", err, out)
+	}
+
+	expectedVars := map[string]inspectVariable{
+		"size":   {Value: "20", Source: "file", File: varFile},
+		"region": {Value: "us-west-2", Source: "cli"},
+		"home":   {Value: "/home/packer", Source: "env"},
+		"name":   {Value: "main", Source: "cli"},
+	}
+	if !reflect.DeepEqual(result.Variables, expectedVars) {
+		t.Fatalf("bad: %#v", result.Variables)
+	}
+
+	if len(result.Builds) != 1 {
+		t.Fatalf("bad: %#v", result.Builds)
+	}
+	build := result.Builds[0]
+	if build.Name != "main" || build.Type != "test" {
+		t.Fatalf("bad: %#v", build)
+	}
+
+	expectedConfig := map[string]interface{}{
+		"disk_size": "20",
+		"region":    "us-west-2",
+	}
+	if !reflect.DeepEqual(build.Config, expectedConfig) {
+		t.Fatalf("bad: %#v", build.Config)
+	}
+
+	expectedProvisioners := []inspectProvisioner{
+		{
+			Type: "shell",
+			Config: map[string]interface{}{
+				"inline": []interface{}{"echo main"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(build.Provisioners, expectedProvisioners) {
+		t.Fatalf("bad: %#v", build.Provisioners)
+	}
+
+	if len(build.PostProcessors) != 1 || len(build.PostProcessors[0]) != 2 {
+		t.Fatalf("bad: %#v", build.PostProcessors)
+	}
+	if build.PostProcessors[0][0].Type != "compress" || build.PostProcessors[0][1].Type != "upload" {
+		t.Fatalf("bad: %#v", build.PostProcessors)
+	}
+}
+
+func TestInspect_jsonExcept(t *testing.T) {
+	c := &InspectCommand{
+		Meta: testMeta(t),
+	}
+
+	args := []string{
+		"-json",
+		"-except", "default",
+		filepath.Join(testFixture("inspect"), "template.json"),
+	}
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	var result inspectResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("err: %s\n\n%s", err, out)
+	}
+
+	if len(result.Builds) != 1 || result.Builds[0].Name != "other" {
+		t.Fatalf("bad: %#v", result.Builds)
+	}
+
+	build := result.Builds[0]
+	if len(build.Provisioners) != 2 || build.Provisioners[1].Type != "file" {
+		t.Fatalf("bad: %#v", build.Provisioners)
+	}
+	if len(build.PostProcessors) != 1 || len(build.PostProcessors[0]) != 1 {
+		t.Fatalf("bad: %#v", build.PostProcessors)
+	}
+	if result.Variables["size"].Source != "default" {
+		t.Fatalf("bad: %#v", result.Variables["size"])
+	}
+}
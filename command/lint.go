@@ -0,0 +1,422 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/packer/fix"
+	"github.com/mitchellh/packer/template"
+	"github.com/mitchellh/packer/template/interpolate"
+)
+
+// lintWarning is something in a template that is legal, but is likely a
+// mistake or will be a problem.
+type lintWarning struct {
+	// Check is the name of the check that found the problem.
+	Check   string
+	Message string
+}
+
+// lintChecks are the checks of validate -lint, in the order they run.
+var lintChecks = []struct {
+	Name  string
+	Check func(*template.Template) []string
+}{
+	{"unused-variable", lintUnusedVariables},
+	{"override", lintOverrides},
+	{"deprecated", lintDeprecated},
+	{"secret", lintSecrets},
+	{"shutdown-command", lintShutdownCommand},
+	{"post-processor-input", lintPostProcessorInputs},
+}
+
+// lintTemplate runs all the lint checks on the template.
+func lintTemplate(tpl *template.Template) []lintWarning {
+	var result []lintWarning
+	for _, c := range lintChecks {
+		for _, message := range c.Check(tpl) {
+			result = append(result, lintWarning{Check: c.Name, Message: message})
+		}
+	}
+
+	return result
+}
+
+// lintShutdownBuilders are the builders that stop the machine forcibly if
+// they have no shutdown_command.
+var lintShutdownBuilders = map[string]struct{}{
+	"hyperv-iso":     {},
+	"parallels-iso":  {},
+	"parallels-pvm":  {},
+	"qemu":           {},
+	"virtualbox-iso": {},
+	"virtualbox-ovf": {},
+	"vmware-iso":     {},
+	"vmware-vmx":     {},
+}
+
+// lintPassThroughPostProcessors are the post-processors that pass on the
+// artifact they get.
+var lintPassThroughPostProcessors = map[string]struct{}{
+	"manifest":    {},
+	"shell-local": {},
+}
+
+// lintPostProcessorAccepts are the builders and post-processors whose
+// artifacts a post-processor accepts. Artifacts of the artifice
+// post-processor are accepted by all of them. The docker builder creates
+// the same artifacts as docker-import when it commits the container.
+var lintPostProcessorAccepts = map[string][]string{
+	"docker-import":        {"docker"},
+	"docker-push":          {"docker", "docker-import", "docker-tag"},
+	"docker-save":          {"docker", "docker-import", "docker-tag"},
+	"docker-tag":           {"docker", "docker-import", "docker-tag"},
+	"googlecompute-export": {"googlecompute"},
+	"vagrant": {
+		"amazon-ebs", "amazon-instance", "digitalocean", "hyperv-iso",
+		"parallels-iso", "parallels-pvm", "qemu", "virtualbox-iso",
+		"virtualbox-ovf", "vmware-iso", "vmware-vmx",
+	},
+	"vagrant-cloud": {"vagrant"},
+	"vsphere":       {"vmware-iso", "vmware-vmx"},
+}
+
+// lintUnusedVariables warns about the variables that nothing in the
+// template reads.
+func lintUnusedVariables(tpl *template.Template) []string {
+	used := make(map[string]struct{})
+	var visit func(interface{})
+	visit = func(raw interface{}) {
+		switch v := raw.(type) {
+		case string:
+			refs, err := interpolate.ReferencedUserVariables(v)
+			if err != nil {
+				return
+			}
+			for _, ref := range refs {
+				used[ref] = struct{}{}
+			}
+		case []string:
+			for _, elem := range v {
+				visit(elem)
+			}
+		case map[string]interface{}:
+			for _, elem := range v {
+				visit(elem)
+			}
+		case []interface{}:
+			for _, elem := range v {
+				visit(elem)
+			}
+		case []map[string]interface{}:
+			for _, elem := range v {
+				visit(elem)
+			}
+		}
+	}
+
+	for _, v := range tpl.Variables {
+		visit(v.Default)
+	}
+	for _, b := range tpl.Builders {
+		visit(b.Name)
+		visit(b.Config)
+	}
+	for _, p := range tpl.Provisioners {
+		visit(p.Config)
+		visit(p.Override)
+	}
+	for _, chain := range tpl.PostProcessors {
+		for _, p := range chain {
+			visit(p.Config)
+		}
+	}
+	visit([]string{tpl.Push.Name, tpl.Push.Address, tpl.Push.BaseDir, tpl.Push.Token})
+	visit(tpl.Push.Include)
+	visit(tpl.Push.Exclude)
+
+	var result []string
+	for _, k := range lintSortedKeys(tpl.Variables) {
+		if _, ok := used[k]; !ok {
+			result = append(result, fmt.Sprintf(
+				"Variable '%s' isn't used anywhere in the template.", k))
+		}
+	}
+
+	return result
+}
+
+// lintOverrides warns about the provisioner overrides that don't change
+// anything.
+func lintOverrides(tpl *template.Template) []string {
+	var result []string
+	for i, p := range tpl.Provisioners {
+		names := make([]string, 0, len(p.Override))
+		for name := range p.Override {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prefix := fmt.Sprintf(
+				"The override of provisioner %d (%s) for '%s'", i+1, p.Type, name)
+
+			if _, ok := tpl.Builders[name]; !ok {
+				result = append(result, prefix+" doesn't match any builder.")
+				continue
+			}
+
+			if p.Skip(name) {
+				result = append(result, prefix+
+					" is never used, the provisioner doesn't run for that build.")
+				continue
+			}
+
+			override, _ := p.Override[name].(map[string]interface{})
+			changed := false
+			for k, v := range override {
+				if !reflect.DeepEqual(p.Config[k], v) {
+					changed = true
+					break
+				}
+			}
+			if !changed {
+				result = append(result, prefix+" doesn't change any setting.")
+			}
+		}
+	}
+
+	return result
+}
+
+// lintDeprecated warns about the settings that packer fix would rewrite.
+// Only JSON templates are checked, since fix only reads JSON.
+func lintDeprecated(tpl *template.Template) []string {
+	var input map[string]interface{}
+	if err := json.Unmarshal(tpl.RawContents, &input); err != nil {
+		log.Printf("Not checking for deprecated settings: %s", err)
+		return nil
+	}
+
+	var result []string
+	for _, name := range fix.FixerOrder {
+		fixer := fix.Fixers[name]
+
+		// The fixers are allowed to modify their input
+		before, err := lintGeneric(input)
+		if err != nil {
+			log.Printf("Not checking for deprecated settings: %s", err)
+			return result
+		}
+
+		output, err := fixer.Fix(input)
+		if err != nil {
+			log.Printf("Fixer %s failed: %s", name, err)
+			return result
+		}
+
+		after, err := lintGeneric(output)
+		if err != nil {
+			log.Printf("Not checking for deprecated settings: %s", err)
+			return result
+		}
+
+		if !reflect.DeepEqual(before, after) {
+			result = append(result, fmt.Sprintf(
+				"The template uses deprecated settings that `packer fix` "+
+					"rewrites (%s): %s", name, fixer.Synopsis()))
+		}
+
+		input = output
+	}
+
+	return result
+}
+
+// lintGeneric returns a copy of the template with the generic types of
+// JSON, since the fixers leave values of their own types in it, and
+// without the sections that are empty.
+func lintGeneric(input map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return nil, err
+	}
+
+	// Some fixers set the sections they look at even if the template
+	// doesn't have them, which doesn't change the template.
+	for k, v := range result {
+		if list, ok := v.([]interface{}); v == nil || (ok && len(list) == 0) {
+			delete(result, k)
+		}
+	}
+
+	return result, nil
+}
+
+// lintSecrets warns about the builder settings for credentials that are
+// written in the template, rather than read from user variables.
+func lintSecrets(tpl *template.Template) []string {
+	var result []string
+	for _, name := range lintSortedKeys(tpl.Builders) {
+		b := tpl.Builders[name]
+
+		keys := make([]string, 0, len(b.Config))
+		for k := range b.Config {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v, ok := b.Config[k].(string)
+			if !ok || v == "" || strings.Contains(v, "{{") || !isSecretKey(k) {
+				continue
+			}
+
+			result = append(result, fmt.Sprintf(
+				"Builder '%s' has a hardcoded value for '%s'. Use a sensitive "+
+					"user variable instead, so the secret isn't stored in the "+
+					"template or shown in the output.", name, k))
+		}
+	}
+
+	return result
+}
+
+// isSecretKey returns true if the setting is a credential.
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range []string{"password", "secret", "token"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	for _, s := range []string{"access_key", "api_key", "private_key"} {
+		if strings.HasSuffix(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lintShutdownCommand warns about the builders that stop the machine
+// forcibly because they have no shutdown_command.
+func lintShutdownCommand(tpl *template.Template) []string {
+	var result []string
+	for _, name := range lintSortedKeys(tpl.Builders) {
+		b := tpl.Builders[name]
+		if _, ok := lintShutdownBuilders[b.Type]; !ok {
+			continue
+		}
+		if comm, _ := b.Config["communicator"].(string); comm == "none" {
+			continue
+		}
+		if cmd, _ := b.Config["shutdown_command"].(string); cmd != "" {
+			continue
+		}
+
+		result = append(result, fmt.Sprintf(
+			"Builder '%s' (%s) has no shutdown_command, so the machine is "+
+				"stopped forcibly, which can lose data that isn't written "+
+				"to disk yet.", name, b.Type))
+	}
+
+	return result
+}
+
+// lintPostProcessorInputs warns about the post-processors that don't
+// accept the artifact of any build they run for.
+func lintPostProcessorInputs(tpl *template.Template) []string {
+	var result []string
+	for i, chain := range tpl.PostProcessors {
+		for j, p := range chain {
+			accepted, ok := lintPostProcessorAccepts[p.Type]
+			if !ok {
+				continue
+			}
+
+			// The inputs the post-processor gets, when they are known
+			inputs := make(map[string]struct{})
+			matched := false
+			for _, name := range lintSortedKeys(tpl.Builders) {
+				if p.Skip(name) {
+					continue
+				}
+
+				input := lintInput(tpl.Builders[name].Type, chain[:j], name)
+				if input == "" || input == "artifice" {
+					matched = true
+					break
+				}
+
+				inputs[input] = struct{}{}
+				for _, a := range accepted {
+					if input == a {
+						matched = true
+					}
+				}
+			}
+
+			if matched || len(inputs) == 0 {
+				continue
+			}
+
+			result = append(result, fmt.Sprintf(
+				"Post-processor %d.%d (%s) never gets an artifact it accepts. It "+
+					"gets artifacts of %s, but only accepts artifacts of %s.",
+				i+1, j+1, p.Type,
+				strings.Join(lintSortedKeys(inputs), ", "),
+				strings.Join(accepted, ", ")))
+		}
+	}
+
+	return result
+}
+
+// lintInput returns the type of the builder or post-processor whose
+// artifact the post-processor after the given ones gets in the build. It
+// is empty if it isn't known.
+func lintInput(builderType string, before []*template.PostProcessor, build string) string {
+	input := builderType
+	if _, ok := Builders[input]; !ok {
+		// Builders from plugins can create any artifact
+		input = ""
+	}
+
+	for _, p := range before {
+		if p.Skip(build) {
+			continue
+		}
+		if _, ok := lintPassThroughPostProcessors[p.Type]; ok {
+			continue
+		}
+		if _, ok := PostProcessors[p.Type]; !ok {
+			return ""
+		}
+
+		input = p.Type
+	}
+
+	return input
+}
+
+// lintSortedKeys returns the keys of a map with string keys in order.
+func lintSortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	result := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		result = append(result, k.String())
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/packer/template"
+)
+
+func TestLintTemplate(t *testing.T) {
+	tpl, err := template.ParseFile(filepath.Join(testFixture("validate-lint"), "template.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	warnings := make(map[string][]string)
+	for _, w := range lintTemplate(tpl) {
+		warnings[w.Check] = append(warnings[w.Check], w.Message)
+	}
+
+	expected := map[string][]string{
+		"unused-variable": {
+			"Variable 'unused' isn't used",
+		},
+		"override": {
+			"provisioner 1 (shell) for 'missing' doesn't match any builder",
+			"provisioner 1 (shell) for 'vbox' doesn't change any setting",
+			"provisioner 2 (file) for 'vbox' is never used",
+		},
+		"deprecated": {
+			"(iso-md5)",
+		},
+		"secret": {
+			"Builder 'vbox' has a hardcoded value for 'ssh_password'",
+		},
+		"shutdown-command": {
+			"Builder 'vbox' (virtualbox-iso) has no shutdown_command",
+		},
+		"post-processor-input": {
+			"Post-processor 1.1 (vsphere) never gets an artifact it accepts. " +
+				"It gets artifacts of docker, qemu, virtualbox-iso",
+		},
+	}
+
+	if !reflect.DeepEqual(lintSortedKeys(warnings), lintSortedKeys(expected)) {
+		t.Fatalf("bad: %#v", warnings)
+	}
+
+	for check, messages := range expected {
+		if len(warnings[check]) != len(messages) {
+			t.Fatalf("%s: bad: %#v", check, warnings[check])
+		}
+		for i, m := range messages {
+			if !strings.Contains(warnings[check][i], m) {
+				t.Fatalf("%s: expected %q in: %s", check, m, warnings[check][i])
+			}
+		}
+	}
+}
+
+func TestLintTemplate_clean(t *testing.T) {
+	tpl, err := template.ParseFile(filepath.Join(testFixture("validate"), "template.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if warnings := lintTemplate(tpl); len(warnings) > 0 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/mitchellh/packer/helper/flag-kv"
 	"github.com/mitchellh/packer/helper/flag-slice"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/template"
+	"github.com/mitchellh/packer/template/interpolate"
 )
 
 // FlagSetFlags is an enum to define what flags are present in the
@@ -20,6 +22,7 @@ const (
 	FlagSetNone        FlagSetFlags = 0
 	FlagSetBuildFilter FlagSetFlags = 1 << iota
 	FlagSetVars
+	FlagSetLogFormat
 )
 
 // Meta contains the meta-options and functionality that nearly every
@@ -30,10 +33,22 @@ type Meta struct {
 	Ui         packer.Ui
 	Version    string
 
+	// MachineReadable is true if -machine-readable was given, in which
+	// case Ui is already a MachineReadableUi.
+	MachineReadable bool
+
+	// LogFormat is the format of the output set with -log-format. It is
+	// empty for the usual output.
+	LogFormat string
+
 	// These are set by command-line flags
 	flagBuildExcept []string
 	flagBuildOnly   []string
 	flagVars        map[string]string
+
+	// flagVarFiles is the var-file that set each of the variables in
+	// flagVars. Variables set with -var aren't in it.
+	flagVarFiles map[string]string
 }
 
 // Core returns the core for the given template given the configured
@@ -42,7 +57,13 @@ func (m *Meta) Core(tpl *template.Template) (*packer.Core, error) {
 	// Copy the config so we don't modify it
 	config := *m.CoreConfig
 	config.Template = tpl
-	config.Variables = m.flagVars
+
+	// The core adds the defaults to its variables, which must not make
+	// them look like they were set on the command line.
+	config.Variables = make(map[string]string, len(m.flagVars))
+	for k, v := range m.flagVars {
+		config.Variables[k] = v
+	}
 
 	// Init the core
 	core, err := packer.NewCore(&config)
@@ -50,6 +71,10 @@ func (m *Meta) Core(tpl *template.Template) (*packer.Core, error) {
 		return nil, fmt.Errorf("Error initializing core: %s", err)
 	}
 
+	for _, w := range core.Warnings() {
+		m.Ui.Error(fmt.Sprintf("Warning: %s", w))
+	}
+
 	return core, nil
 }
 
@@ -117,8 +142,18 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 
 	// FlagSetVars tells us what variables to use
 	if fs&FlagSetVars != 0 {
-		f.Var((*kvflag.Flag)(&m.flagVars), "var", "")
-		f.Var((*kvflag.FlagJSON)(&m.flagVars), "var-file", "")
+		f.Var(&varsFlag{meta: m, value: func(v *map[string]string) flag.Value {
+			return (*kvflag.Flag)(v)
+		}}, "var", "")
+		f.Var(&varsFlag{meta: m, file: true, value: func(v *map[string]string) flag.Value {
+			return (*kvflag.FlagFile)(v)
+		}}, "var-file", "")
+	}
+
+	// FlagSetLogFormat tells us to enable the setting for the format of
+	// the output, which setupLogFormat applies.
+	if fs&FlagSetLogFormat != 0 {
+		f.StringVar(&m.LogFormat, "log-format", m.LogFormat, "")
 	}
 
 	// Create an io.Writer that writes to our Ui properly for errors.
@@ -137,9 +172,93 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 	return f
 }
 
+// setupLogFormat replaces the Ui with one that writes the output in the
+// format set with -log-format, if any.
+func (m *Meta) setupLogFormat() error {
+	switch m.LogFormat {
+	case "":
+		return nil
+	case "json":
+		m.Ui = &packer.JSONUi{
+			Writer: os.Stdout,
+		}
+	default:
+		return fmt.Errorf("Unknown log format: %s", m.LogFormat)
+	}
+
+	// Set this so that we don't get colored output in our machine-
+	// readable UI.
+	return os.Setenv("PACKER_NO_COLOR", "1")
+}
+
+// machineOutput returns true if the output is only meant for machines.
+func (m *Meta) machineOutput() bool {
+	return m.MachineReadable || m.LogFormat != ""
+}
+
 // ValidateFlags should be called after parsing flags to validate the
 // given flags
 func (m *Meta) ValidateFlags() error {
 	// TODO
 	return nil
 }
+
+// VariableSource returns where the value of the given user variable comes
+// from: "cli" for -var, "file" for -var-file along with the path of the
+// file, "env" for defaults that read environment variables and "default"
+// for other defaults.
+func (m *Meta) VariableSource(tpl *template.Template, name string) (string, string) {
+	if _, ok := m.flagVars[name]; ok {
+		if path, ok := m.flagVarFiles[name]; ok {
+			return "file", path
+		}
+
+		return "cli", ""
+	}
+
+	if v, ok := tpl.Variables[name]; ok {
+		if refs, err := interpolate.ReferencedEnvironmentVariables(v.Default); err == nil && len(refs) > 0 {
+			return "env", ""
+		}
+	}
+
+	return "default", ""
+}
+
+// varsFlag is a flag.Value that sets user variables with the flag.Value
+// that value returns, and records which variables a var-file set.
+type varsFlag struct {
+	meta  *Meta
+	file  bool
+	value func(*map[string]string) flag.Value
+}
+
+func (f *varsFlag) String() string {
+	return ""
+}
+
+func (f *varsFlag) Set(raw string) error {
+	var vars map[string]string
+	if err := f.value(&vars).Set(raw); err != nil {
+		return err
+	}
+
+	m := f.meta
+	if m.flagVars == nil {
+		m.flagVars = make(map[string]string)
+	}
+	if m.flagVarFiles == nil {
+		m.flagVarFiles = make(map[string]string)
+	}
+
+	for k, v := range vars {
+		m.flagVars[k] = v
+		if f.file {
+			m.flagVarFiles[k] = raw
+		} else {
+			delete(m.flagVarFiles, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/mitchellh/packer/packer/plugin"
+	packrpc "github.com/mitchellh/packer/packer/rpc"
+)
+
+// PluginInfo is a plugin that Packer discovered, either as a binary in one
+// of the plugin directories or the config file, or built into Packer.
+type PluginInfo struct {
+	// Type is the kind of component the plugin is used for: "builder",
+	// "post-processor" or "provisioner", or "plugin" for a plugin that
+	// serves several components and couldn't be used.
+	Type string
+
+	// Name is the name templates use for the component.
+	Name string
+
+	// Path is where the plugin binary was found. It is empty for plugins
+	// that are built into Packer.
+	Path string
+
+	// Client returns a client that starts the plugin.
+	Client func() *plugin.Client
+
+	// Err is the error that was found when the plugin was discovered, if
+	// it can't be used.
+	Err error
+}
+
+// PluginsCommand is the parent of the commands that show the plugins
+// Packer uses. By itself it only shows the help.
+type PluginsCommand struct {
+	Meta
+}
+
+func (c *PluginsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (*PluginsCommand) Help() string {
+	helpText := `
+Usage: packer plugins <subcommand> [options]
+
+  Shows the plugins that Packer discovered. Plugins are binaries named
+  packer-builder-NAME, packer-provisioner-NAME or packer-post-processor-NAME,
+  or packer-plugin-NAME for plugins that serve several components, in the
+  directory of Packer, ~/.packer.d/plugins or the current directory, or
+  binaries configured in the config file.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*PluginsCommand) Synopsis() string {
+	return "show the plugins Packer discovered"
+}
+
+// PluginsListCommand lists the discovered plugins, checking that each
+// plugin binary speaks the API version of Packer.
+type PluginsListCommand struct {
+	Meta
+
+	// Plugins returns the plugins Packer discovered.
+	Plugins func() []*PluginInfo
+}
+
+func (c *PluginsListCommand) Run(args []string) int {
+	var flagInternal bool
+	flags := c.Meta.FlagSet("plugins list", FlagSetNone)
+	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	flags.BoolVar(&flagInternal, "internal", false, "internal")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// Plugins that serve several components are only started once
+	type result struct {
+		manifest *packrpc.PluginManifest
+		err      error
+	}
+	results := make(map[string]result)
+
+	failed := 0
+	for _, p := range c.Plugins() {
+		if p.Path == "" {
+			if !flagInternal {
+				continue
+			}
+
+			c.Ui.Machine("plugin", p.Type, p.Name, "", plugin.APIVersion, p.Type, "")
+			c.Ui.Say(fmt.Sprintf("%s %s: built into Packer", p.Type, p.Name))
+			continue
+		}
+
+		c.Ui.Say(fmt.Sprintf("%s %s: %s", p.Type, p.Name, p.Path))
+
+		r, ok := results[p.Path]
+		if p.Err != nil {
+			r, ok = result{err: p.Err}, true
+		}
+		if !ok {
+			client := p.Client()
+			r.manifest, r.err = client.Manifest()
+			client.Kill()
+			results[p.Path] = r
+		}
+
+		manifest, err := r.manifest, r.err
+		switch err {
+		case nil:
+			var components []string
+			for _, component := range manifest.Components {
+				components = append(components,
+					strings.TrimSpace(component.Type+" "+component.Name))
+			}
+
+			c.Ui.Machine("plugin", p.Type, p.Name, p.Path, manifest.APIVersion,
+				strings.Join(components, ","), "")
+			c.Ui.Say(fmt.Sprintf("  API version %s, provides: %s",
+				manifest.APIVersion, strings.Join(components, ", ")))
+		case plugin.ErrNoManifest:
+			// The handshake succeeded, so the API version is the same
+			c.Ui.Machine("plugin", p.Type, p.Name, p.Path, plugin.APIVersion, "", "")
+			c.Ui.Say(fmt.Sprintf(
+				"  API version %s, built with an older version of Packer that "+
+					"doesn't describe its components", plugin.APIVersion))
+		default:
+			failed++
+			c.Ui.Machine("plugin", p.Type, p.Name, p.Path, "", "", err.Error())
+			c.Ui.Error(fmt.Sprintf("  Error: %s", err))
+		}
+	}
+
+	if failed > 0 {
+		c.Ui.Error(fmt.Sprintf("\n%d plugins can't be used.", failed))
+		return 1
+	}
+
+	return 0
+}
+
+func (*PluginsListCommand) Help() string {
+	helpText := `
+Usage: packer plugins list [options]
+
+  Lists the plugin binaries that Packer discovered, and starts each of them
+  to check that it speaks the plugin API version of this Packer and to show
+  the components it provides. The exit status is non-zero if any plugin
+  can't be used.
+
+  A plugin that is discovered under the same name as a plugin built into
+  Packer replaces it.
+
+Options:
+
+  -internal          Also list the plugins built into Packer
+  -machine-readable  Machine-readable output
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (*PluginsListCommand) Synopsis() string {
+	return "list the discovered plugins"
+}
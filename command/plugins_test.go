@@ -0,0 +1,192 @@
+package command
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/packer/plugin"
+)
+
+func testPluginClient(name string) func() *plugin.Client {
+	return func() *plugin.Client {
+		cmd := exec.Command(os.Args[0], "-test.run=TestPluginsHelperProcess", "--", name)
+		cmd.Env = []string{"PACKER_WANT_PLUGINS_HELPER=1"}
+		return plugin.NewClient(&plugin.ClientConfig{Cmd: cmd})
+	}
+}
+
+// This is not a real test. This is a plugin started by the tests.
+func TestPluginsHelperProcess(*testing.T) {
+	if os.Getenv("PACKER_WANT_PLUGINS_HELPER") != "1" {
+		return
+	}
+
+	defer os.Exit(0)
+
+	switch os.Args[len(os.Args)-1] {
+	case "builder":
+		server, err := plugin.Server()
+		if err != nil {
+			os.Exit(1)
+		}
+		server.RegisterBuilder(new(packer.MockBuilder))
+		server.Serve()
+	case "suite":
+		server, err := plugin.Server()
+		if err != nil {
+			os.Exit(1)
+		}
+		server.RegisterNamedBuilder("one", new(packer.MockBuilder))
+		server.RegisterNamedProvisioner("one", new(packer.MockProvisioner))
+		server.Serve()
+	case "old-version":
+		os.Stdout.WriteString("3|tcp|:1234\n")
+		<-make(chan struct{})
+	}
+}
+
+func TestPluginsList(t *testing.T) {
+	c := &PluginsListCommand{
+		Meta: testMeta(t),
+		Plugins: func() []*PluginInfo {
+			return []*PluginInfo{
+				{Type: "builder", Name: "dummy"},
+				{
+					Type:   "builder",
+					Name:   "foo",
+					Path:   "/plugins/packer-builder-foo",
+					Client: testPluginClient("builder"),
+				},
+			}
+		},
+	}
+
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	if strings.Contains(out, "dummy") {
+		t.Fatalf("internal plugins shouldn't be listed: %s", out)
+	}
+	if !strings.Contains(out, "builder foo: /plugins/packer-builder-foo") {
+		t.Fatalf("bad: %s", out)
+	}
+	if !strings.Contains(out, "API version "+plugin.APIVersion+", provides: builder") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestPluginsList_internal(t *testing.T) {
+	c := &PluginsListCommand{
+		Meta: testMeta(t),
+		Plugins: func() []*PluginInfo {
+			return []*PluginInfo{
+				{Type: "builder", Name: "dummy"},
+			}
+		},
+	}
+
+	if code := c.Run([]string{"-internal"}); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	if !strings.Contains(out, "builder dummy: built into Packer") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestPluginsList_versionMismatch(t *testing.T) {
+	c := &PluginsListCommand{
+		Meta: testMeta(t),
+		Plugins: func() []*PluginInfo {
+			return []*PluginInfo{
+				{
+					Type:   "provisioner",
+					Name:   "old",
+					Path:   "/plugins/packer-provisioner-old",
+					Client: testPluginClient("old-version"),
+				},
+			}
+		},
+	}
+
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	_, errOut := outputCommand(t, c.Meta)
+	if !strings.Contains(errOut, "speaks version 3") {
+		t.Fatalf("bad: %s", errOut)
+	}
+}
+
+func TestPluginsList_components(t *testing.T) {
+	c := &PluginsListCommand{
+		Meta: testMeta(t),
+		Plugins: func() []*PluginInfo {
+			return []*PluginInfo{
+				{
+					Type:   "builder",
+					Name:   "one",
+					Path:   "/plugins/packer-plugin-suite",
+					Client: testPluginClient("suite"),
+				},
+				{
+					Type: "provisioner",
+					Name: "one",
+					Path: "/plugins/packer-plugin-suite",
+					Client: func() *plugin.Client {
+						t.Fatal("the plugin should only be started once")
+						return nil
+					},
+				},
+			}
+		},
+	}
+
+	if code := c.Run(nil); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	out, _ := outputCommand(t, c.Meta)
+	if !strings.Contains(out, "provisioner one: /plugins/packer-plugin-suite") {
+		t.Fatalf("bad: %s", out)
+	}
+	if !strings.Contains(out, "provides: builder one, provisioner one") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestPluginsList_failed(t *testing.T) {
+	c := &PluginsListCommand{
+		Meta: testMeta(t),
+		Plugins: func() []*PluginInfo {
+			return []*PluginInfo{
+				{
+					Type: "plugin",
+					Name: "suite",
+					Path: "/plugins/packer-plugin-suite",
+					Err:  errors.New("timeout reading the manifest"),
+				},
+			}
+		},
+	}
+
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	out, errOut := outputCommand(t, c.Meta)
+	if !strings.Contains(out, "plugin suite: /plugins/packer-plugin-suite") {
+		t.Fatalf("bad: %s", out)
+	}
+	if !strings.Contains(errOut, "timeout reading the manifest") {
+		t.Fatalf("bad: %s", errOut)
+	}
+}
@@ -11,7 +11,6 @@ import (
 
 	"github.com/hashicorp/atlas-go/archive"
 	"github.com/hashicorp/atlas-go/v1"
-	"github.com/mitchellh/packer/helper/flag-kv"
 	"github.com/mitchellh/packer/template"
 )
 
@@ -191,13 +190,8 @@ func (c *PushCommand) Run(args []string) int {
 
 	// Collect the variables from CLI args and any var files
 	uploadOpts.Vars = make(map[string]string)
-	if vs := flags.Lookup("var"); vs != nil {
-		f := vs.Value.(*kvflag.Flag)
-		vars := map[string]string(*f)
-
-		for k, v := range vars {
-			uploadOpts.Vars[k] = v
-		}
+	for k, v := range c.Meta.flagVars {
+		uploadOpts.Vars[k] = v
 	}
 
 	// Add the upload metadata
@@ -291,7 +285,7 @@ Options:
 
   -var 'key=value'         Variable for templates, can be used multiple times.
 
-  -var-file=path           JSON file containing user variables.
+  -var-file=path           JSON, YAML or HCL file containing user variables.
 `
 
 	return strings.TrimSpace(helpText)
@@ -14,9 +14,10 @@ type ValidateCommand struct {
 }
 
 func (c *ValidateCommand) Run(args []string) int {
-	var cfgSyntaxOnly bool
+	var cfgLint, cfgSyntaxOnly bool
 	flags := c.Meta.FlagSet("validate", FlagSetBuildFilter|FlagSetVars)
 	flags.Usage = func() { c.Ui.Say(c.Help()) }
+	flags.BoolVar(&cfgLint, "lint", false, "lint")
 	flags.BoolVar(&cfgSyntaxOnly, "syntax-only", false, "check syntax only")
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -35,6 +36,12 @@ func (c *ValidateCommand) Run(args []string) int {
 		return 1
 	}
 
+	// The lint checks only need the template, so they also run with
+	// -syntax-only
+	if cfgLint {
+		c.lint(tpl)
+	}
+
 	// If we're only checking syntax, then we're done already
 	if cfgSyntaxOnly {
 		c.Ui.Say("Syntax-only check passed. Everything looks okay.")
@@ -66,9 +73,13 @@ func (c *ValidateCommand) Run(args []string) int {
 		builds = append(builds, b)
 	}
 
-	// Check the configuration of all builds
+	// Check the configuration of all builds. The artifacts of the builds
+	// they depend on don't exist yet, so placeholders stand in for them.
 	for _, b := range builds {
 		log.Printf("Preparing build: %s", b.Name())
+		if deps := core.BuildDependencies(b.Name()); len(deps) > 0 {
+			b.SetBuildArtifacts(placeholderArtifacts(deps))
+		}
 		warns, err := b.Prepare()
 		if len(warns) > 0 {
 			warnings[b.Name()] = warns
@@ -110,6 +121,22 @@ func (c *ValidateCommand) Run(args []string) int {
 	return 0
 }
 
+// lint outputs the lint warnings for the template.
+func (c *ValidateCommand) lint(tpl *template.Template) {
+	warnings := lintTemplate(tpl)
+	if len(warnings) == 0 {
+		c.Ui.Say("Lint found no problems.\n")
+		return
+	}
+
+	c.Ui.Say("Lint found things that are legal, but likely to be a problem:\n")
+	for _, w := range warnings {
+		c.Ui.Machine("lint-warning", w.Check, w.Message)
+		c.Ui.Say(fmt.Sprintf("* [%s] %s", w.Check, w.Message))
+	}
+	c.Ui.Say("")
+}
+
 func (*ValidateCommand) Help() string {
 	helpText := `
 Usage: packer validate [options] TEMPLATE
@@ -121,13 +148,21 @@ Usage: packer validate [options] TEMPLATE
   with a non-zero exit status. If it is valid, it will exit with a zero
   exit status.
 
+  With -lint, it also warns about things that are legal but likely to be
+  a problem: unused variables, provisioner overrides that don't change
+  anything, deprecated settings that "packer fix" rewrites, hardcoded
+  credentials in builders, builders without a shutdown_command, and
+  post-processors that never get an artifact they accept. Lint warnings
+  don't change the exit status.
+
 Options:
 
+  -lint                  Also warn about likely problems in the template.
   -syntax-only           Only check syntax. Do not verify config of the template.
   -except=foo,bar,baz    Validate all builds other than these
   -only=foo,bar,baz      Validate only these builds
   -var 'key=value'       Variable for templates, can be used multiple times.
-  -var-file=path         JSON file containing user variables.
+  -var-file=path         JSON, YAML or HCL file containing user variables.
 `
 
 	return strings.TrimSpace(helpText)
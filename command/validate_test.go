@@ -2,6 +2,7 @@ package command
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -20,6 +21,19 @@ func TestValidateCommandOKVersion(t *testing.T) {
 	}
 }
 
+func TestValidateCommandDependsOnArtifact(t *testing.T) {
+	c := &ValidateCommand{
+		Meta: testMetaFile(t),
+	}
+	args := []string{
+		filepath.Join(testFixture("build-depends-on"), "template.json"),
+	}
+
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+}
+
 func TestValidateCommandBadVersion(t *testing.T) {
 	c := &ValidateCommand{
 		Meta: testMetaFile(t),
@@ -42,3 +56,24 @@ func TestValidateCommandBadVersion(t *testing.T) {
 	}
 	t.Log(stdout)
 }
+
+func TestValidateCommandLint(t *testing.T) {
+	c := &ValidateCommand{
+		Meta: testMetaFile(t),
+	}
+	args := []string{
+		"-lint",
+		"-syntax-only",
+		filepath.Join(testFixture("validate-lint"), "template.json"),
+	}
+
+	// Lint warnings don't fail the validation
+	if code := c.Run(args); code != 0 {
+		fatalCommand(t, c.Meta)
+	}
+
+	stdout, _ := outputCommand(t, c.Meta)
+	if !strings.Contains(stdout, "* [unused-variable] Variable 'unused' isn't used") {
+		t.Fatalf("bad: %s", stdout)
+	}
+}
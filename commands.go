@@ -16,6 +16,10 @@ var Commands map[string]cli.CommandFactory
 // before the CLI is started.
 var CommandMeta *command.Meta
 
+// CommandPlugins returns the plugins that were discovered. This must be
+// written before the CLI is started.
+var CommandPlugins func() []*command.PluginInfo
+
 const ErrorPrefix = "e:"
 const OutputPrefix = "o:"
 
@@ -27,6 +31,36 @@ func init() {
 			}, nil
 		},
 
+		"cache": func() (cli.Command, error) {
+			return &command.CacheCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache clear": func() (cli.Command, error) {
+			return &command.CacheClearCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache list": func() (cli.Command, error) {
+			return &command.CacheListCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache prune": func() (cli.Command, error) {
+			return &command.CachePruneCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"cache verify": func() (cli.Command, error) {
+			return &command.CacheVerifyCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
 		"fix": func() (cli.Command, error) {
 			return &command.FixCommand{
 				Meta: *CommandMeta,
@@ -39,6 +73,19 @@ func init() {
 			}, nil
 		},
 
+		"plugins": func() (cli.Command, error) {
+			return &command.PluginsCommand{
+				Meta: *CommandMeta,
+			}, nil
+		},
+
+		"plugins list": func() (cli.Command, error) {
+			return &command.PluginsListCommand{
+				Meta:    *CommandMeta,
+				Plugins: CommandPlugins,
+			}, nil
+		},
+
 		"push": func() (cli.Command, error) {
 			return &command.PushCommand{
 				Meta: *CommandMeta,
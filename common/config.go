@@ -118,7 +118,7 @@ func DownloadableURL(original string) (string, error) {
 	}
 
 	// Verify that the scheme is something we support in our common downloader.
-	supported := []string{"file", "http", "https"}
+	supported := []string{"file", "ftp", "http", "https", "s3", "scp", "sftp"}
 	found := false
 	for _, s := range supported {
 		if url.Scheme == s {
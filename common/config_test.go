@@ -45,7 +45,7 @@ func TestDownloadableURL(t *testing.T) {
 	}
 
 	// Invalid: unsupported scheme
-	_, err = DownloadableURL("ftp://host.com/path")
+	_, err = DownloadableURL("gopher://host.com/path")
 	if err == nil {
 		t.Fatal("expected err")
 	}
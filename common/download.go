@@ -2,20 +2,28 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DownloadConfig is the configuration given to instantiate a new
@@ -47,12 +55,37 @@ type DownloadConfig struct {
 	// What to use for the user agent for HTTP requests. If set to "", use the
 	// default user agent provided by Go.
 	UserAgent string
+
+	// Retries is how many times a failed download is retried. Each retry
+	// resumes where the download stopped. RetryBackoff is how long to wait
+	// before the first retry, which doubles after every retry.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// Connections is how many connections HTTP downloads use in parallel.
+	// The file is downloaded over one connection if it is 1 or less.
+	Connections int
+
+	// BandwidthLimit is the most bytes per second to download. It is
+	// unlimited if zero.
+	BandwidthLimit int64
+
+	// Proxy is the URL of the proxy for HTTP downloads. The proxy is taken
+	// from the environment if it is blank. CAFile is a file of PEM encoded
+	// certificates that are trusted in addition to the system's.
+	Proxy  string
+	CAFile string
 }
 
 // A DownloadClient helps download, verify checksums, etc.
 type DownloadClient struct {
 	config     *DownloadConfig
 	downloader Downloader
+
+	// l protects downloader, which Cancel reads while Get runs.
+	l          sync.Mutex
+	cancelOnce sync.Once
+	cancelCh   chan struct{}
 }
 
 // HashForType returns the Hash implementation for the given string
@@ -76,13 +109,25 @@ func HashForType(t string) hash.Hash {
 // configuration.
 func NewDownloadClient(c *DownloadConfig) *DownloadClient {
 	if c.DownloaderMap == nil {
+		httpDownloader := &HTTPDownloader{
+			userAgent:      c.UserAgent,
+			connections:    c.Connections,
+			bandwidthLimit: c.BandwidthLimit,
+			proxy:          c.Proxy,
+			caFile:         c.CAFile,
+		}
+
 		c.DownloaderMap = map[string]Downloader{
-			"http":  &HTTPDownloader{userAgent: c.UserAgent},
-			"https": &HTTPDownloader{userAgent: c.UserAgent},
+			"ftp":   &FTPDownloader{bandwidthLimit: c.BandwidthLimit},
+			"http":  httpDownloader,
+			"https": httpDownloader,
+			"s3":    &S3Downloader{bandwidthLimit: c.BandwidthLimit},
+			"scp":   &SCPDownloader{bandwidthLimit: c.BandwidthLimit},
+			"sftp":  &SFTPDownloader{bandwidthLimit: c.BandwidthLimit},
 		}
 	}
 
-	return &DownloadClient{config: c}
+	return &DownloadClient{config: c, cancelCh: make(chan struct{})}
 }
 
 // A downloader is responsible for actually taking a remote URL and
@@ -94,8 +139,22 @@ type Downloader interface {
 	Total() uint
 }
 
+// ErrDownloadCancelled is returned by Get when the download is cancelled.
+var ErrDownloadCancelled = errors.New("download cancelled")
+
+// Cancel cancels the download. A download in progress is cancelled by its
+// downloader, and a download waiting to retry returns ErrDownloadCancelled.
 func (d *DownloadClient) Cancel() {
-	// TODO(mitchellh): Implement
+	d.cancelOnce.Do(func() {
+		close(d.cancelCh)
+	})
+
+	d.l.Lock()
+	downloader := d.downloader
+	d.l.Unlock()
+	if downloader != nil {
+		downloader.Cancel()
+	}
 }
 
 func (d *DownloadClient) Get() (string, error) {
@@ -110,7 +169,7 @@ func (d *DownloadClient) Get() (string, error) {
 		return "", err
 	}
 
-	log.Printf("Parsed URL: %#v", u)
+	log.Printf("Parsed URL: %s", RedactURL(u))
 
 	// Files when we don't copy the file are special cased.
 	var f *os.File
@@ -142,22 +201,58 @@ func (d *DownloadClient) Get() (string, error) {
 	} else {
 		finalPath = d.config.TargetPath
 
-		var ok bool
-		d.downloader, ok = d.config.DownloaderMap[u.Scheme]
+		downloader, ok := d.config.DownloaderMap[u.Scheme]
 		if !ok {
 			return "", fmt.Errorf("No downloader for scheme: %s", u.Scheme)
 		}
+		d.l.Lock()
+		d.downloader = downloader
+		d.l.Unlock()
+
+		// Otherwise, download using the downloader. The file is downloaded
+		// next to the target first, so an interrupted download can be
+		// resumed and is never mistaken for the complete file.
+		partPath := finalPath + ".part"
+		backoff := d.config.RetryBackoff
+		for attempt := 0; ; attempt++ {
+			select {
+			case <-d.cancelCh:
+				return "", ErrDownloadCancelled
+			default:
+			}
+
+			f, err = os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, os.FileMode(0666))
+			if err != nil {
+				return "", err
+			}
+
+			log.Printf("[DEBUG] Downloading: %s", RedactURL(u))
+			err = downloader.Download(f, u)
+			f.Close()
+			if err == nil || attempt >= d.config.Retries {
+				break
+			}
 
-		// Otherwise, download using the downloader.
-		f, err = os.OpenFile(finalPath, os.O_RDWR|os.O_CREATE, os.FileMode(0666))
+			log.Printf("Download failed, retrying in %s: %s", backoff, err)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-d.cancelCh:
+				timer.Stop()
+				return "", ErrDownloadCancelled
+			}
+			backoff *= 2
+		}
 		if err != nil {
+			select {
+			case <-d.cancelCh:
+				return "", ErrDownloadCancelled
+			default:
+			}
 			return "", err
 		}
 
-		log.Printf("[DEBUG] Downloading: %s", u.String())
-		err = d.downloader.Download(f, u)
-		f.Close()
-		if err != nil {
+		if err := os.Rename(partPath, finalPath); err != nil {
 			return "", err
 		}
 	}
@@ -182,7 +277,7 @@ func (d *DownloadClient) Get() (string, error) {
 
 // PercentProgress returns the download progress as a percentage.
 func (d *DownloadClient) PercentProgress() int {
-	if d.downloader == nil {
+	if d.downloader == nil || d.downloader.Total() == 0 {
 		return -1
 	}
 
@@ -208,28 +303,66 @@ func (d *DownloadClient) VerifyChecksum(path string) (bool, error) {
 	return bytes.Compare(d.config.Hash.Sum(nil), d.config.Checksum) == 0, nil
 }
 
+// RedactURL returns the URL as a string with the password, if any, left
+// out so that it can be logged.
+func RedactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
+
 // HTTPDownloader is an implementation of Downloader that downloads
 // files over HTTP.
+//
+// If the file already has data, the download resumes after it when the
+// server supports range requests. With several connections the rest of the
+// file is downloaded in chunks in parallel.
 type HTTPDownloader struct {
-	progress  uint
-	total     uint
-	userAgent string
+	downloadProgress
+	downloadCanceller
+
+	userAgent      string
+	connections    int
+	bandwidthLimit int64
+	proxy          string
+	caFile         string
 }
 
-func (*HTTPDownloader) Cancel() {
-	// TODO(mitchellh): Implement
-}
+// minChunkSize is the smallest chunk that is downloaded over its own
+// connection.
+var minChunkSize int64 = 1 << 20
+
+// errFileChanged is returned when the file changed on the server during a
+// download in chunks.
+var errFileChanged = errors.New("the file changed during the download")
 
 func (d *HTTPDownloader) Download(dst *os.File, src *url.URL) error {
-	log.Printf("Starting download: %s", src.String())
+	log.Printf("Starting download: %s", RedactURL(src))
 
-	// Seek to the beginning by default
-	if _, err := dst.Seek(0, 0); err != nil {
+	// Reset our progress
+	d.reset(0, 0)
+
+	httpClient, err := d.httpClient()
+	if err != nil {
 		return err
 	}
 
-	// Reset our progress
-	d.progress = 0
+	// Cancel cancels the requests of the download
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer d.finish()
+	if err := d.closeOnCancel(cancelCloser(cancel)); err != nil {
+		return err
+	}
+
+	limiter := &rateLimiter{limit: d.bandwidthLimit}
 
 	// Make the request. We first make a HEAD request so we can check
 	// if the server supports range queries. If the server/URL doesn't
@@ -238,65 +371,427 @@ func (d *HTTPDownloader) Download(dst *os.File, src *url.URL) error {
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 
 	if d.userAgent != "" {
 		req.Header.Set("User-Agent", d.userAgent)
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-		},
-	}
-
+	var offset, size int64
+	var validator string
 	resp, err := httpClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
 	if err == nil && (resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		// If the HEAD request succeeded, then attempt to set the range
-		// query if we can.
+		// If the HEAD request succeeded, then attempt to resume after the
+		// data that is already there if we can.
 		if resp.Header.Get("Accept-Ranges") == "bytes" {
 			if fi, err := dst.Stat(); err == nil {
-				if _, err = dst.Seek(0, os.SEEK_END); err == nil {
-					req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
-					d.progress = uint(fi.Size())
+				offset = fi.Size()
+
+				// The data was written before the file last changed
+				modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+				if offset > 0 && err == nil && fi.ModTime().Before(modified) {
+					log.Printf("File changed since the partial download, starting over")
+					offset = 0
 				}
 			}
+
+			size = resp.ContentLength
+			validator = ifRangeValidator(resp.Header)
+		}
+	}
+
+	if size > 0 && offset > size {
+		log.Printf("Partial download is larger than the file, starting over")
+		offset = 0
+	}
+
+	if size > 0 && offset == size {
+		log.Printf("Partial download is already complete")
+		d.reset(size, size)
+		return nil
+	}
+
+	if d.connections > 1 && size > 0 && size-offset >= 2*minChunkSize {
+		if err := dst.Truncate(offset); err != nil {
+			return err
 		}
+
+		return d.downloadChunks(ctx, httpClient, limiter, dst, src, offset, size, validator)
 	}
 
-	// Set the request to GET now, and redo the query to download
+	// Set the request to GET now, and redo the query to download. The
+	// server sends the whole file instead of the rest of it if the file
+	// changed since the HEAD request.
 	req.Method = "GET"
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
 
 	resp, err = httpClient.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		log.Printf("Resuming download at byte %d", offset)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial download doesn't fit the file anymore. Start over
+		// so the next attempt downloads the whole file.
+		dst.Truncate(0)
+		return fmt.Errorf("%s: %s", src, resp.Status)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%s: %s", src, resp.Status)
+	default:
+		// The server sent the whole file
+		offset = 0
+	}
 
-	d.total = d.progress + uint(resp.ContentLength)
-	var buffer [4096]byte
-	for {
-		n, err := resp.Body.Read(buffer[:])
-		if err != nil && err != io.EOF {
-			return err
+	if err := dst.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := dst.Seek(offset, 0); err != nil {
+		return err
+	}
+
+	total := int64(0)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	d.reset(offset, total)
+
+	_, err = d.copy(&offsetWriter{dst, offset}, resp.Body, limiter)
+	return err
+}
+
+// downloadChunks downloads the file from offset to size in chunks, each
+// over its own connection. If a chunk fails, the file is truncated after
+// the data that was downloaded without gaps so the download can resume,
+// or entirely if the file changed.
+func (d *HTTPDownloader) downloadChunks(
+	ctx context.Context, httpClient *http.Client, limiter *rateLimiter,
+	dst *os.File, src *url.URL, offset, size int64, validator string) error {
+	n := int64(d.connections)
+	chunkSize := (size - offset + n - 1) / n
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	var starts, ends []int64
+	for start := offset; start < size; start += chunkSize {
+		end := start + chunkSize
+		if end > size {
+			end = size
 		}
 
-		d.progress += uint(n)
+		starts = append(starts, start)
+		ends = append(ends, end)
+	}
+
+	log.Printf("Downloading %d bytes in %d chunks", size-offset, len(starts))
+	d.reset(offset, size)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	written := make([]int64, len(starts))
+	errs := make([]error, len(starts))
+	var wg sync.WaitGroup
+	for i := range starts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
 
-		if _, werr := dst.Write(buffer[:n]); werr != nil {
-			return werr
+			written[i], errs[i] = d.downloadChunk(
+				ctx, httpClient, limiter, dst, src, starts[i], ends[i], validator)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			continue
 		}
 
-		if err == io.EOF {
-			break
+		// Keep the data up to the first gap so the next attempt resumes
+		// from there.
+		complete := offset
+		for j := range starts {
+			complete += written[j]
+			if written[j] < ends[j]-starts[j] {
+				break
+			}
 		}
+		for _, e := range errs {
+			if e == errFileChanged {
+				complete = 0
+			}
+		}
+		if terr := dst.Truncate(complete); terr != nil {
+			log.Printf("Error truncating partial download: %s", terr)
+		}
+
+		return fmt.Errorf("chunk %d: %s", i+1, err)
 	}
 
 	return nil
 }
 
-func (d *HTTPDownloader) Progress() uint {
-	return d.progress
+func (d *HTTPDownloader) downloadChunk(
+	ctx context.Context, httpClient *http.Client, limiter *rateLimiter,
+	dst *os.File, src *url.URL, start, end int64, validator string) (int64, error) {
+	req, err := http.NewRequest("GET", src.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && validator != "" {
+		return 0, errFileChanged
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("%s: %s", src, resp.Status)
+	}
+
+	return d.copy(&offsetWriter{dst, start}, io.LimitReader(resp.Body, end-start), limiter)
+}
+
+// ifRangeValidator returns the value of an If-Range header for ranges of
+// the file, or an empty string if the file can't be matched. Weak ETags
+// can't be used in If-Range headers.
+func ifRangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return h.Get("Last-Modified")
+}
+
+// httpClient returns the client to download with, which uses the
+// configured proxy and CA certificates.
+func (d *HTTPDownloader) httpClient() (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+
+	if d.proxy != "" {
+		proxyURL, err := url.Parse(d.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing proxy URL: %s", err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if d.caFile != "" {
+		pem, err := ioutil.ReadFile(d.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA file: %s", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA file: %s", d.caFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// downloadCanceller implements Cancel for downloaders by closing the
+// connections of the download in progress. Once cancelled, downloads fail
+// as soon as they register a connection.
+type downloadCanceller struct {
+	l         sync.Mutex
+	closers   []io.Closer
+	cancelled bool
+}
+
+func (c *downloadCanceller) Cancel() {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.cancelled = true
+	for _, closer := range c.closers {
+		closer.Close()
+	}
+	c.closers = nil
+}
+
+// closeOnCancel registers a connection to be closed by Cancel. It closes
+// the connection and returns ErrDownloadCancelled if the download was
+// already cancelled.
+func (c *downloadCanceller) closeOnCancel(closer io.Closer) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.cancelled {
+		closer.Close()
+		return ErrDownloadCancelled
+	}
+
+	c.closers = append(c.closers, closer)
+	return nil
+}
+
+// finish forgets the connections of a download that has ended.
+func (c *downloadCanceller) finish() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.closers = nil
+}
+
+// cancelCloser cancels a context when it is closed, so that Cancel can
+// cancel the requests made with it.
+type cancelCloser context.CancelFunc
+
+func (c cancelCloser) Close() error {
+	c()
+	return nil
 }
 
-func (d *HTTPDownloader) Total() uint {
-	return d.total
+// downloadProgress keeps track of the progress of a download for the
+// Progress and Total methods of Downloader. It is safe to use from several
+// goroutines.
+type downloadProgress struct {
+	// These are accessed atomically, so they are first to be aligned
+	progress uint64
+	total    uint64
+}
+
+func (p *downloadProgress) Progress() uint {
+	return uint(atomic.LoadUint64(&p.progress))
+}
+
+func (p *downloadProgress) Total() uint {
+	return uint(atomic.LoadUint64(&p.total))
+}
+
+// reset sets the progress and the total size of the download. The total
+// is zero if it isn't known.
+func (p *downloadProgress) reset(progress, total int64) {
+	atomic.StoreUint64(&p.progress, uint64(progress))
+	atomic.StoreUint64(&p.total, uint64(total))
+}
+
+// copy copies the data from src to dst while keeping track of the progress
+// and limiting the bandwidth.
+func (p *downloadProgress) copy(dst io.Writer, src io.Reader, limiter *rateLimiter) (int64, error) {
+	var written int64
+	var buffer [32 * 1024]byte
+	for {
+		n, err := src.Read(buffer[:])
+		if n > 0 {
+			if _, werr := dst.Write(buffer[:n]); werr != nil {
+				return written, werr
+			}
+
+			written += int64(n)
+			atomic.AddUint64(&p.progress, uint64(n))
+			limiter.wait(n)
+		}
+
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// resumeOffset returns where a download into the file continues. The file
+// is emptied if it doesn't fit a file of the given size, which is zero if
+// it isn't known.
+func resumeOffset(dst *os.File, size int64) (int64, error) {
+	fi, err := dst.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := fi.Size()
+	if size > 0 && offset > size {
+		log.Printf("Partial download is larger than the file, starting over")
+		offset = 0
+	}
+
+	if err := dst.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := dst.Seek(offset, 0); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// offsetWriter writes to a file starting at an offset, so several
+// writers can write to different parts of the file at once.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// rateLimiter limits the bandwidth of a download, shared by all of its
+// connections. A limit of zero is unlimited.
+type rateLimiter struct {
+	limit int64
+
+	l     sync.Mutex
+	start time.Time
+	n     int64
+}
+
+// wait blocks until n more bytes can be transferred within the limit.
+func (r *rateLimiter) wait(n int) {
+	if r.limit <= 0 {
+		return
+	}
+
+	r.l.Lock()
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	r.n += int64(n)
+	due := r.start.Add(time.Duration(float64(r.n) / float64(r.limit) * float64(time.Second)))
+	r.l.Unlock()
+
+	if wait := due.Sub(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
 }
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/template/interpolate"
+)
+
+// DownloadOptions contains the configuration for how files such as ISOs
+// are downloaded. See DownloadConfig for what each setting does.
+type DownloadOptions struct {
+	Retries        int           `mapstructure:"download_retries"`
+	RetryBackoff   time.Duration `mapstructure:"download_retry_backoff"`
+	Connections    int           `mapstructure:"download_connections"`
+	BandwidthLimit string        `mapstructure:"download_bandwidth_limit"`
+	Proxy          string        `mapstructure:"download_proxy"`
+	CAFile         string        `mapstructure:"download_ca_file"`
+
+	bandwidthLimit int64
+}
+
+func (c *DownloadOptions) Prepare(ctx *interpolate.Context) []error {
+	var errs []error
+
+	if c.Retries < 0 {
+		errs = append(errs, errors.New("download_retries must not be negative"))
+	}
+
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = 5 * time.Second
+	} else if c.RetryBackoff < 0 {
+		errs = append(errs, errors.New("download_retry_backoff must not be negative"))
+	}
+
+	if c.Connections < 0 {
+		errs = append(errs, errors.New("download_connections must not be negative"))
+	}
+
+	if c.BandwidthLimit != "" {
+		limit, err := packer.ParseByteSize(c.BandwidthLimit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing download_bandwidth_limit: %s", err))
+		}
+		c.bandwidthLimit = limit
+	}
+
+	if c.Proxy != "" {
+		if _, err := url.Parse(c.Proxy); err != nil {
+			errs = append(errs, fmt.Errorf("Error parsing download_proxy: %s", err))
+		}
+	}
+
+	if c.CAFile != "" {
+		if _, err := os.Stat(c.CAFile); err != nil {
+			errs = append(errs, fmt.Errorf("download_ca_file is invalid: %s", err))
+		}
+	}
+
+	return errs
+}
+
+// configure applies the options to the configuration of a download.
+func (c *DownloadOptions) configure(config *DownloadConfig) {
+	config.Retries = c.Retries
+	config.RetryBackoff = c.RetryBackoff
+	config.Connections = c.Connections
+	config.BandwidthLimit = c.bandwidthLimit
+	config.Proxy = c.Proxy
+	config.CAFile = c.CAFile
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownloadOptionsPrepare(t *testing.T) {
+	var c DownloadOptions
+	if errs := c.Prepare(nil); len(errs) > 0 {
+		t.Fatalf("bad: %#v", errs)
+	}
+	if c.RetryBackoff != 5*time.Second {
+		t.Fatalf("bad: %s", c.RetryBackoff)
+	}
+
+	c = DownloadOptions{
+		Retries:        3,
+		Connections:    4,
+		BandwidthLimit: "10MB",
+		Proxy:          "http://proxy.example.com:3128",
+	}
+	if errs := c.Prepare(nil); len(errs) > 0 {
+		t.Fatalf("bad: %#v", errs)
+	}
+
+	var config DownloadConfig
+	c.configure(&config)
+	if config.Retries != 3 || config.Connections != 4 {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.BandwidthLimit != 10*1024*1024 {
+		t.Fatalf("bad: %d", config.BandwidthLimit)
+	}
+	if config.Proxy != "http://proxy.example.com:3128" {
+		t.Fatalf("bad: %s", config.Proxy)
+	}
+}
+
+func TestDownloadOptionsPrepare_bad(t *testing.T) {
+	cases := []DownloadOptions{
+		{Retries: -1},
+		{RetryBackoff: -1},
+		{Connections: -1},
+		{BandwidthLimit: "fast"},
+		{CAFile: "/nonexistent/ca.pem"},
+	}
+
+	for _, c := range cases {
+		if errs := c.Prepare(nil); len(errs) == 0 {
+			t.Fatalf("should error: %#v", c)
+		}
+	}
+}
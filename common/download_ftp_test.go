@@ -0,0 +1,175 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testFTPServer starts a minimal FTP server that serves testDownloadData
+// as "pub/file.iso" to the user "packer" with the password "secret".
+// EPSV is only supported if epsv is true.
+func testFTPServer(t *testing.T, epsv bool) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go testFTPServe(conn, epsv)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func testFTPServe(conn net.Conn, epsv bool) {
+	defer conn.Close()
+
+	var data net.Listener
+	var offset int
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "220 Welcome\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		arg := ""
+		if len(parts) > 1 {
+			arg = parts[1]
+		}
+
+		switch parts[0] {
+		case "USER":
+			fmt.Fprintf(conn, "331 Password required\r\n")
+		case "PASS":
+			if arg != "secret" {
+				fmt.Fprintf(conn, "530 Login incorrect\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "230 Logged in\r\n")
+		case "TYPE":
+			fmt.Fprintf(conn, "200 Type set\r\n")
+		case "SIZE":
+			if arg != "pub/file.iso" {
+				fmt.Fprintf(conn, "550 No such file\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "213 %d\r\n", len(testDownloadData))
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			fmt.Fprintf(conn, "350 Restarting at %d\r\n", offset)
+		case "EPSV", "PASV":
+			if parts[0] == "EPSV" && !epsv {
+				fmt.Fprintf(conn, "502 Not implemented\r\n")
+				continue
+			}
+
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return
+			}
+			port := data.Addr().(*net.TCPAddr).Port
+			if parts[0] == "EPSV" {
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", port)
+			} else {
+				fmt.Fprintf(conn, "227 Entering Passive Mode (10,0,0,1,%d,%d)\r\n", port>>8, port&0xff)
+			}
+		case "RETR":
+			if arg != "pub/file.iso" {
+				fmt.Fprintf(conn, "550 No such file\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "150 Opening data connection\r\n")
+			dataConn, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			dataConn.Write(testDownloadData[offset:])
+			dataConn.Close()
+			fmt.Fprintf(conn, "226 Transfer complete\r\n")
+		case "QUIT":
+			fmt.Fprintf(conn, "221 Goodbye\r\n")
+			return
+		default:
+			fmt.Fprintf(conn, "502 Not implemented\r\n")
+		}
+	}
+}
+
+func TestFTPDownloader_Impl(t *testing.T) {
+	var _ Downloader = new(FTPDownloader)
+}
+
+func TestFTPDownloader(t *testing.T) {
+	addr, closeFn := testFTPServer(t, true)
+	defer closeFn()
+
+	testDownloadGet(t, &DownloadConfig{
+		Url: fmt.Sprintf("ftp://packer:secret@%s/pub/file.iso", addr),
+	})
+}
+
+func TestFTPDownloader_pasv(t *testing.T) {
+	addr, closeFn := testFTPServer(t, false)
+	defer closeFn()
+
+	testDownloadGet(t, &DownloadConfig{
+		Url: fmt.Sprintf("ftp://packer:secret@%s/pub/file.iso", addr),
+	})
+}
+
+func TestFTPDownloader_resume(t *testing.T) {
+	addr, closeFn := testFTPServer(t, true)
+	defer closeFn()
+
+	f := testDownloadPartial(t, testDownloadData[:1000])
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	d := new(FTPDownloader)
+	u, _ := url.Parse(fmt.Sprintf("ftp://packer:secret@%s/pub/file.iso", addr))
+	if err := d.Download(f, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testDownloadCheckPartial(t, f)
+	if d.Progress() != uint(len(testDownloadData)) || d.Total() != d.Progress() {
+		t.Fatalf("bad: %d/%d", d.Progress(), d.Total())
+	}
+}
+
+func TestFTPDownloader_bad(t *testing.T) {
+	addr, closeFn := testFTPServer(t, true)
+	defer closeFn()
+
+	cases := []string{
+		fmt.Sprintf("ftp://packer:wrong@%s/pub/file.iso", addr),
+		fmt.Sprintf("ftp://packer:secret@%s/pub/other.iso", addr),
+	}
+	for _, tc := range cases {
+		f := testDownloadPartial(t, nil)
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		u, _ := url.Parse(tc)
+		if err := new(FTPDownloader).Download(f, u); err == nil {
+			t.Fatalf("should error: %s", tc)
+		}
+	}
+}
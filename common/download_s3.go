@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Downloader is an implementation of Downloader that downloads files
+// from Amazon S3 or an S3 compatible object store such as MinIO.
+//
+// URLs look like s3://bucket/path/to/file. The query parameters "region"
+// and "endpoint" select the region and the address of an S3 compatible
+// store. Credentials are taken from the environment, the shared
+// credentials file or the instance role, like the Amazon builders do.
+type S3Downloader struct {
+	downloadProgress
+	downloadCanceller
+
+	bandwidthLimit int64
+}
+
+func (d *S3Downloader) Download(dst *os.File, src *url.URL) error {
+	log.Printf("Starting download: %s", RedactURL(src))
+	d.reset(0, 0)
+
+	bucket := src.Host
+	key := strings.TrimPrefix(src.Path, "/")
+	if bucket == "" || key == "" {
+		return fmt.Errorf("S3 URL must have a bucket and a key: %s", RedactURL(src))
+	}
+
+	config := aws.NewConfig()
+	query := src.Query()
+	if region := query.Get("region"); region != "" {
+		config = config.WithRegion(region)
+	}
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		// Stores other than S3 rarely support buckets as host names
+		config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String("us-east-1")
+	}
+	svc := s3.New(sess)
+
+	head, err := svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", RedactURL(src), err)
+	}
+	size := aws.Int64Value(head.ContentLength)
+
+	offset, err := resumeOffset(dst, size)
+	if err != nil {
+		return err
+	}
+
+	d.reset(offset, size)
+	if offset == size {
+		return nil
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if offset > 0 {
+		log.Printf("Resuming download at byte %d", offset)
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := svc.GetObject(input)
+	if err != nil {
+		return fmt.Errorf("Error downloading %s: %s", RedactURL(src), err)
+	}
+	defer resp.Body.Close()
+
+	defer d.finish()
+	if err := d.closeOnCancel(resp.Body); err != nil {
+		return err
+	}
+
+	_, err = d.copy(dst, resp.Body, &rateLimiter{limit: d.bandwidthLimit})
+	return err
+}
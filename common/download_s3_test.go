@@ -0,0 +1,97 @@
+package common
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// testS3Server is a stand-in for an S3 compatible store that serves
+// testDownloadData as the object "bucket/file.iso".
+func testS3Server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/file.iso" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") == "" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		http.ServeContent(rw, r, "file.iso", time.Time{}, bytes.NewReader(testDownloadData))
+	}))
+}
+
+func testS3Credentials(t *testing.T) func() {
+	old := map[string]string{}
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "packer",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	} {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestS3Downloader_Impl(t *testing.T) {
+	var _ Downloader = new(S3Downloader)
+}
+
+func TestS3Downloader(t *testing.T) {
+	defer testS3Credentials(t)()
+
+	ts := testS3Server(t)
+	defer ts.Close()
+
+	u := "s3://bucket/file.iso?region=us-east-1&endpoint=" + url.QueryEscape(ts.URL)
+	testDownloadGet(t, &DownloadConfig{Url: u})
+}
+
+func TestS3Downloader_resume(t *testing.T) {
+	defer testS3Credentials(t)()
+
+	ts := testS3Server(t)
+	defer ts.Close()
+
+	f := testDownloadPartial(t, testDownloadData[:1000])
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	d := new(S3Downloader)
+	u, _ := url.Parse("s3://bucket/file.iso?endpoint=" + url.QueryEscape(ts.URL))
+	if err := d.Download(f, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testDownloadCheckPartial(t, f)
+	if d.Progress() != uint(len(testDownloadData)) || d.Total() != d.Progress() {
+		t.Fatalf("bad: %d/%d", d.Progress(), d.Total())
+	}
+}
+
+func TestS3Downloader_notFound(t *testing.T) {
+	defer testS3Credentials(t)()
+
+	ts := testS3Server(t)
+	defer ts.Close()
+
+	f := testDownloadPartial(t, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	u, _ := url.Parse("s3://bucket/other.iso?endpoint=" + url.QueryEscape(ts.URL))
+	if err := new(S3Downloader).Download(f, u); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,286 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer starts an SSH server that accepts the password "secret"
+// and serves the local filesystem over SFTP and SCP. Its host key is added
+// to the known_hosts file in a temporary HOME. It returns the address of
+// the server.
+func testSSHServer(t *testing.T) (string, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "packer" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("bad password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go testSSHServe(conn, config)
+		}
+	}()
+
+	home, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Mkdir(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	line := fmt.Sprintf("[127.0.0.1]:%d %s",
+		l.Addr().(*net.TCPAddr).Port, ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	if err := ioutil.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+
+	return l.Addr().String(), func() {
+		l.Close()
+		os.Setenv("HOME", oldHome)
+		os.RemoveAll(home)
+	}
+}
+
+func testSSHServe(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// The payload of both requests is a single string
+				var payload string
+				if len(req.Payload) > 4 {
+					payload = string(req.Payload[4:])
+				}
+
+				switch {
+				case req.Type == "subsystem" && payload == "sftp":
+					req.Reply(true, nil)
+					server, err := sftp.NewServer(channel, channel)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					return
+				case req.Type == "exec" && strings.HasPrefix(payload, "scp -f "):
+					req.Reply(true, nil)
+					path := strings.Trim(strings.TrimPrefix(payload, "scp -f "), "'")
+					status := testSCPSource(channel, path)
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+// testSCPSource is the sending side of the SCP protocol.
+func testSCPSource(channel ssh.Channel, path string) uint32 {
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(channel, "\x01scp: %s: No such file or directory\n", path)
+		return 1
+	}
+
+	fmt.Fprintf(channel, "C0644 %d %s\n", len(data), "file.iso")
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+	channel.Write(data)
+	channel.Write([]byte{0})
+	if _, err := io.ReadFull(channel, ack); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+func testSSHFile(t *testing.T) string {
+	f, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(testDownloadData); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return f.Name()
+}
+
+func TestSFTPDownloader_Impl(t *testing.T) {
+	var _ Downloader = new(SFTPDownloader)
+	var _ Downloader = new(SCPDownloader)
+}
+
+func TestSFTPDownloader(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	path := testSSHFile(t)
+	defer os.Remove(path)
+
+	testDownloadGet(t, &DownloadConfig{
+		Url: fmt.Sprintf("sftp://packer:secret@%s%s", addr, path),
+	})
+}
+
+func TestSFTPDownloader_resume(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	path := testSSHFile(t)
+	defer os.Remove(path)
+
+	f := testDownloadPartial(t, testDownloadData[:1000])
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	d := new(SFTPDownloader)
+	u, _ := url.Parse(fmt.Sprintf("sftp://packer:secret@%s%s", addr, path))
+	if err := d.Download(f, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testDownloadCheckPartial(t, f)
+	if d.Progress() != uint(len(testDownloadData)) || d.Total() != d.Progress() {
+		t.Fatalf("bad: %d/%d", d.Progress(), d.Total())
+	}
+}
+
+func TestSFTPDownloader_badPassword(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	f := testDownloadPartial(t, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	u, _ := url.Parse(fmt.Sprintf("sftp://packer:wrong@%s/file.iso", addr))
+	if err := new(SFTPDownloader).Download(f, u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestSFTPDownloader_unknownHost(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	if err := os.Remove(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f := testDownloadPartial(t, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	u, _ := url.Parse(fmt.Sprintf("sftp://packer:secret@%s/file.iso", addr))
+	err := new(SFTPDownloader).Download(f, u)
+	if err == nil || !strings.Contains(err.Error(), "no host key") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSFTPDownloader_cancel(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	path := testSSHFile(t)
+	defer os.Remove(path)
+
+	f := testDownloadPartial(t, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	d := new(SFTPDownloader)
+	d.Cancel()
+
+	u, _ := url.Parse(fmt.Sprintf("sftp://packer:secret@%s%s", addr, path))
+	if err := d.Download(f, u); err != ErrDownloadCancelled {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSCPDownloader(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	path := testSSHFile(t)
+	defer os.Remove(path)
+
+	testDownloadGet(t, &DownloadConfig{
+		Url: fmt.Sprintf("scp://packer:secret@%s%s", addr, path),
+	})
+}
+
+func TestSCPDownloader_notFound(t *testing.T) {
+	addr, closeFn := testSSHServer(t)
+	defer closeFn()
+
+	f := testDownloadPartial(t, nil)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	u, _ := url.Parse(fmt.Sprintf("scp://packer:secret@%s/nonexistent/file.iso", addr))
+	err := new(SCPDownloader).Download(f, u)
+	if err == nil || !strings.Contains(err.Error(), "No such file") {
+		t.Fatalf("bad: %s", err)
+	}
+}
@@ -0,0 +1,206 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// bsdChecksumRe matches the lines of BSD-style checksum files, such as
+// "SHA256 (file.iso) = 0123abcd".
+var bsdChecksumRe = regexp.MustCompile(`^(\w+) ?\((.+)\) ?= ?(\S+)$`)
+
+// checksumSizes are the lengths of the hex encoded checksums of each type.
+var checksumSizes = map[string]int{
+	"md5":    32,
+	"sha1":   40,
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// parseChecksumFile finds the checksum of a file in the contents of a
+// checksum file, such as a SHA256SUMS file. Both the GNU style of
+// "<checksum> [*]<file>" and the BSD style of "<TYPE> (<file>) = <checksum>"
+// are supported, and files can have several entries.
+//
+// Entries are matched by the base name of the file. Checksum files can
+// list several types of checksums for the same file, so of the matching
+// entries the first one with the length of the checksum type is used, or
+// else the first one.
+func parseChecksumFile(r io.Reader, checksumType string, names []string) (string, error) {
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[name] = struct{}{}
+	}
+
+	var matches []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var name, checksum string
+		if m := bsdChecksumRe.FindStringSubmatch(line); m != nil {
+			// The type of BSD style entries is known, so skip other types
+			if !strings.EqualFold(m[1], checksumType) {
+				continue
+			}
+
+			name, checksum = m[2], m[3]
+		} else {
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) < 2 {
+				continue
+			}
+
+			// The name is after a space for text mode or an asterisk for
+			// binary mode.
+			checksum = parts[0]
+			name = strings.TrimLeft(parts[1], " ")
+			name = strings.TrimPrefix(name, "*")
+		}
+
+		if _, ok := wanted[path.Base(filepath.ToSlash(name))]; ok {
+			matches = append(matches, checksum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "", fmt.Errorf("No checksum for %q found", names[0])
+	}
+
+	for _, checksum := range matches {
+		if len(checksum) == checksumSizes[checksumType] {
+			return checksum, nil
+		}
+	}
+
+	return matches[0], nil
+}
+
+// fetchChecksumFile returns the contents of a checksum file or its
+// signature, downloading it if needed.
+func fetchChecksumFile(rawURL string, options *DownloadOptions) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing checksum: %s", err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		p := u.Path
+		if u.Scheme == "" {
+			p = rawURL
+		}
+		if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			p = strings.TrimLeft(p, "/")
+		}
+
+		return ioutil.ReadFile(p)
+	}
+
+	downloadURL, err := DownloadableURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing checksum url: %s: %s", rawURL, err)
+	}
+
+	tf, err := ioutil.TempFile("", "packer-checksum")
+	if err != nil {
+		return nil, err
+	}
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	// The download is written next to the file first, and left there if
+	// it fails
+	defer os.Remove(tf.Name() + ".part")
+
+	config := &DownloadConfig{
+		Url:        downloadURL,
+		TargetPath: tf.Name(),
+		UserAgent:  "Packer",
+	}
+	options.configure(config)
+
+	if _, err := NewDownloadClient(config).Get(); err != nil {
+		return nil, fmt.Errorf("Error getting checksum from url: %s: %s", rawURL, err)
+	}
+
+	return ioutil.ReadFile(tf.Name())
+}
+
+// verifyChecksumSignature checks the signature of a checksum file with the
+// keys in the keyring. If the signature is empty the checksum file must be
+// clearsigned, and the signed text of it is returned. Otherwise the
+// checksum file is returned as is.
+func verifyChecksumSignature(keyring string, data, signature []byte) ([]byte, error) {
+	keys, err := readKeyring(keyring)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading keyring %s: %s", keyring, err)
+	}
+
+	if len(signature) == 0 {
+		// Only the signed text can be trusted, whatever comes before or
+		// after it isn't covered by the signature.
+		block, _ := clearsign.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("The checksum file isn't clearsigned, set iso_checksum_signature_url for a detached signature.")
+		}
+
+		data = block.Plaintext
+		_, err = openpgp.CheckDetachedSignature(
+			keys, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	} else if isArmored(signature) {
+		_, err = openpgp.CheckArmoredDetachedSignature(
+			keys, bytes.NewReader(data), bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(
+			keys, bytes.NewReader(data), bytes.NewReader(signature))
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"The signature of the checksum file is invalid or not signed by a key in %s: %s",
+			keyring, err)
+	}
+	log.Printf("Checksum signature is valid")
+
+	return data, nil
+}
+
+// readKeyring reads the keys of a keyring, which can be ASCII armored like
+// exported public keys, or binary.
+func readKeyring(path string) (openpgp.EntityList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isArmored(data) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// isArmored reports whether the OpenPGP data is ASCII armored.
+func isArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP"))
+}
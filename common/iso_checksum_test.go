@@ -0,0 +1,199 @@
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testChecksumFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("test-fixtures", "checksums", name))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return data
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	contents := `
+# Checksums of the release
+SHA1 (the-OS.iso) = a94a8fe5ccb19ba61c4c0873d391e987982fbbd3
+SHA256 (other.iso) = 0000
+SHA256 (the-OS.iso) = 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+5d41402abc4b2a76b9719d911017c592  the-OS.iso
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 *images/the-OS.iso
+8843d7f92416211de9ebb963ff4ce28125932878  the-OS-2.iso
+`
+
+	cases := []struct {
+		Type     string
+		Names    []string
+		Expected string
+	}{
+		{"sha256", []string{"the-OS.iso"}, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha1", []string{"the-OS.iso"}, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"},
+		{"md5", []string{"the-OS.iso"}, "5d41402abc4b2a76b9719d911017c592"},
+		{"sha1", []string{"missing.iso", "the-OS-2.iso"}, "8843d7f92416211de9ebb963ff4ce28125932878"},
+		{"sha512", []string{"the-OS.iso"}, "5d41402abc4b2a76b9719d911017c592"},
+	}
+
+	for _, tc := range cases {
+		checksum, err := parseChecksumFile(strings.NewReader(contents), tc.Type, tc.Names)
+		if err != nil {
+			t.Fatalf("%s %v: err: %s", tc.Type, tc.Names, err)
+		}
+		if checksum != tc.Expected {
+			t.Fatalf("%s %v: bad: %s", tc.Type, tc.Names, checksum)
+		}
+	}
+
+	if _, err := parseChecksumFile(strings.NewReader(contents), "sha256", []string{"missing.iso"}); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestVerifyChecksumSignature(t *testing.T) {
+	keyring := filepath.Join("test-fixtures", "checksums", "keyring.gpg")
+	armoredKeyring := filepath.Join("test-fixtures", "checksums", "keyring.asc")
+	sums := testChecksumFixture(t, "SHA256SUMS")
+
+	// Detached signature
+	data, err := verifyChecksumSignature(keyring, sums, testChecksumFixture(t, "SHA256SUMS.gpg"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != string(sums) {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// Clearsigned, with an armored keyring
+	data, err = verifyChecksumSignature(armoredKeyring, testChecksumFixture(t, "SHA256SUMS.asc"), nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != string(sums) {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// Only the signed text of a clearsigned file is returned
+	appended := append(testChecksumFixture(t, "SHA256SUMS.asc"), "0000  the-OS.iso\n"...)
+	data, err = verifyChecksumSignature(keyring, appended, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != string(sums) {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// Tampered checksums
+	tampered := []byte(strings.Replace(string(sums), "5d41402a", "00000000", 1))
+	if _, err := verifyChecksumSignature(keyring, tampered, testChecksumFixture(t, "SHA256SUMS.gpg")); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Tampered clearsigned checksums
+	tampered = []byte(strings.Replace(string(testChecksumFixture(t, "SHA256SUMS.asc")), "5d41402a", "00000000", 1))
+	if _, err := verifyChecksumSignature(keyring, tampered, nil); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Not signed at all
+	if _, err := verifyChecksumSignature(keyring, sums, nil); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestFetchChecksumFile_failed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", dir)
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	if _, err := fetchChecksumFile(ts.URL+"/SHA256SUMS", &DownloadOptions{}); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Nothing is left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(files) > 0 {
+		t.Fatalf("bad: %s", files[0].Name())
+	}
+}
+
+func TestISOConfigPrepare_ISOChecksumSignature(t *testing.T) {
+	fixtures, err := filepath.Abs(filepath.Join("test-fixtures", "checksums"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Detached signature
+	i := testISOConfig()
+	i.ISOChecksum = ""
+	i.ISOChecksumType = "sha256"
+	i.ISOChecksumURL = "file://" + filepath.ToSlash(filepath.Join(fixtures, "SHA256SUMS"))
+	i.ISOChecksumSignatureURL = "file://" + filepath.ToSlash(filepath.Join(fixtures, "SHA256SUMS.gpg"))
+	i.ISOChecksumKeyring = filepath.Join(fixtures, "keyring.gpg")
+	if _, errs := i.Prepare(nil); len(errs) > 0 {
+		t.Fatalf("should not have error: %s", errs)
+	}
+	if i.ISOChecksum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("bad: %s", i.ISOChecksum)
+	}
+
+	// Clearsigned
+	i = testISOConfig()
+	i.ISOChecksum = ""
+	i.ISOChecksumType = "md5"
+	i.ISOChecksumURL = "file://" + filepath.ToSlash(filepath.Join(fixtures, "SHA256SUMS.asc"))
+	i.ISOChecksumKeyring = filepath.Join(fixtures, "keyring.asc")
+	if _, errs := i.Prepare(nil); len(errs) > 0 {
+		t.Fatalf("should not have error: %s", errs)
+	}
+	if i.ISOChecksum != "5d41402abc4b2a76b9719d911017c592" {
+		t.Fatalf("bad: %s", i.ISOChecksum)
+	}
+
+	// Signature of another file
+	i = testISOConfig()
+	i.ISOChecksum = ""
+	i.ISOChecksumType = "sha256"
+	i.ISOChecksumURL = "file://" + filepath.ToSlash(filepath.Join(fixtures, "SHA256SUMS.asc"))
+	i.ISOChecksumSignatureURL = "file://" + filepath.ToSlash(filepath.Join(fixtures, "SHA256SUMS.gpg"))
+	i.ISOChecksumKeyring = filepath.Join(fixtures, "keyring.gpg")
+	if _, errs := i.Prepare(nil); len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+}
+
+func TestISOConfigPrepare_ISOChecksumKeyring(t *testing.T) {
+	// Signature without a keyring
+	i := testISOConfig()
+	i.ISOChecksumURL = "file:///not_read"
+	i.ISOChecksumSignatureURL = "file:///not_read.gpg"
+	if _, errs := i.Prepare(nil); len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+
+	// Keyring that doesn't exist
+	i = testISOConfig()
+	i.ISOChecksumURL = "file:///not_read"
+	i.ISOChecksumKeyring = filepath.Join("test-fixtures", "checksums", "missing.gpg")
+	if _, errs := i.Prepare(nil); len(errs) == 0 {
+		t.Fatal("should have error")
+	}
+}
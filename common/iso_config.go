@@ -1,14 +1,11 @@
 package common
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
-	"runtime"
+	"path"
 	"strings"
 
 	"github.com/mitchellh/packer/template/interpolate"
@@ -16,16 +13,24 @@ import (
 
 // ISOConfig contains configuration for downloading ISO images.
 type ISOConfig struct {
-	ISOChecksum     string   `mapstructure:"iso_checksum"`
-	ISOChecksumURL  string   `mapstructure:"iso_checksum_url"`
-	ISOChecksumType string   `mapstructure:"iso_checksum_type"`
+	ISOChecksum     string `mapstructure:"iso_checksum"`
+	ISOChecksumURL  string `mapstructure:"iso_checksum_url"`
+	ISOChecksumType string `mapstructure:"iso_checksum_type"`
+
+	ISOChecksumSignatureURL string `mapstructure:"iso_checksum_signature_url"`
+	ISOChecksumKeyring      string `mapstructure:"iso_checksum_keyring"`
+
 	ISOUrls         []string `mapstructure:"iso_urls"`
 	TargetPath      string   `mapstructure:"iso_target_path"`
 	TargetExtension string   `mapstructure:"iso_target_extension"`
 	RawSingleISOUrl string   `mapstructure:"iso_url"`
+
+	DownloadOptions `mapstructure:",squash"`
 }
 
 func (c *ISOConfig) Prepare(ctx *interpolate.Context) (warnings []string, errs []error) {
+	errs = append(errs, c.DownloadOptions.Prepare(ctx)...)
+
 	if c.RawSingleISOUrl == "" && len(c.ISOUrls) == 0 {
 		errs = append(
 			errs, errors.New("One of iso_url or iso_urls must be specified."))
@@ -57,52 +62,13 @@ func (c *ISOConfig) Prepare(ctx *interpolate.Context) (warnings []string, errs [
 
 				// If iso_checksum has no value use iso_checksum_url instead.
 				if c.ISOChecksum == "" {
-					u, err := url.Parse(c.ISOChecksumURL)
+					checksum, err := c.checksumFromURL()
 					if err != nil {
-						errs = append(errs,
-							fmt.Errorf("Error parsing checksum: %s", err))
-						return warnings, errs
-					}
-					switch u.Scheme {
-					case "http", "https":
-						res, err := http.Get(c.ISOChecksumURL)
-						c.ISOChecksum = ""
-						if err != nil {
-							errs = append(errs,
-								fmt.Errorf("Error getting checksum from url: %s", c.ISOChecksumURL))
-							return warnings, errs
-						}
-						defer res.Body.Close()
-						err = c.parseCheckSumFile(bufio.NewReader(res.Body))
-						if err != nil {
-							errs = append(errs, err)
-							return warnings, errs
-						}
-					case "file":
-						path := u.Path
-
-						if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
-							path = strings.TrimLeft(path, "/")
-						}
-
-						file, err := os.Open(path)
-						if err != nil {
-							errs = append(errs, err)
-							return warnings, errs
-						}
-						err = c.parseCheckSumFile(bufio.NewReader(file))
-						if err != nil {
-							errs = append(errs, err)
-							return warnings, errs
-						}
-
-					case "":
-						break
-					default:
-						errs = append(errs,
-							fmt.Errorf("Error parsing checksum url: %s, scheme not supported: %s", c.ISOChecksumURL, u.Scheme))
+						errs = append(errs, err)
 						return warnings, errs
 					}
+
+					c.ISOChecksum = checksum
 				}
 			}
 		}
@@ -110,6 +76,18 @@ func (c *ISOConfig) Prepare(ctx *interpolate.Context) (warnings []string, errs [
 
 	c.ISOChecksum = strings.ToLower(c.ISOChecksum)
 
+	if c.ISOChecksumKeyring != "" {
+		if c.ISOChecksumURL == "" {
+			errs = append(errs, errors.New(
+				"iso_checksum_keyring can only be used with iso_checksum_url"))
+		} else if _, err := os.Stat(c.ISOChecksumKeyring); err != nil {
+			errs = append(errs, fmt.Errorf("iso_checksum_keyring is invalid: %s", err))
+		}
+	} else if c.ISOChecksumSignatureURL != "" {
+		errs = append(errs, errors.New(
+			"iso_checksum_keyring must be set to verify iso_checksum_signature_url"))
+	}
+
 	for i, url := range c.ISOUrls {
 		url, err := DownloadableURL(url)
 		if err != nil {
@@ -135,34 +113,48 @@ func (c *ISOConfig) Prepare(ctx *interpolate.Context) (warnings []string, errs [
 	return warnings, errs
 }
 
-func (c *ISOConfig) parseCheckSumFile(rd *bufio.Reader) error {
-	errNotFound := fmt.Errorf("No checksum for %q found at: %s", filepath.Base(c.ISOUrls[0]), c.ISOChecksumURL)
-	for {
-		line, err := rd.ReadString('\n')
-		if err != nil && line == "" {
-			break
+// checksumFromURL finds the checksum of the ISO in the checksum file at
+// iso_checksum_url, after verifying its signature if a keyring is set.
+func (c *ISOConfig) checksumFromURL() (string, error) {
+	// The keyring must be valid before the checksum file can be trusted
+	if c.ISOChecksumKeyring != "" {
+		if _, err := os.Stat(c.ISOChecksumKeyring); err != nil {
+			return "", fmt.Errorf("iso_checksum_keyring is invalid: %s", err)
 		}
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
-		if strings.ToLower(parts[0]) == c.ISOChecksumType {
-			// BSD-style checksum
-			if parts[1] == fmt.Sprintf("(%s)", filepath.Base(c.ISOUrls[0])) {
-				c.ISOChecksum = parts[3]
-				return nil
-			}
-		} else {
-			// Standard checksum
-			if parts[1][0] == '*' {
-				// Binary mode
-				parts[1] = parts[1][1:]
-			}
-			if parts[1] == filepath.Base(c.ISOUrls[0]) {
-				c.ISOChecksum = parts[0]
-				return nil
+	} else if c.ISOChecksumSignatureURL != "" {
+		return "", errors.New(
+			"iso_checksum_keyring must be set to verify iso_checksum_signature_url")
+	}
+
+	data, err := fetchChecksumFile(c.ISOChecksumURL, &c.DownloadOptions)
+	if err != nil {
+		return "", err
+	}
+
+	if c.ISOChecksumKeyring != "" {
+		var signature []byte
+		if c.ISOChecksumSignatureURL != "" {
+			signature, err = fetchChecksumFile(c.ISOChecksumSignatureURL, &c.DownloadOptions)
+			if err != nil {
+				return "", err
 			}
 		}
+
+		data, err = verifyChecksumSignature(c.ISOChecksumKeyring, data, signature)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	names := make([]string, len(c.ISOUrls))
+	for i, u := range c.ISOUrls {
+		names[i] = path.Base(strings.SplitN(u, "?", 2)[0])
 	}
-	return errNotFound
+
+	checksum, err := parseChecksumFile(bytes.NewReader(data), c.ISOChecksumType, names)
+	if err != nil {
+		return "", fmt.Errorf("%s at: %s", err, c.ISOChecksumURL)
+	}
+
+	return checksum, nil
 }
@@ -0,0 +1,421 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common/sensitive"
+	"github.com/mitchellh/packer/packer"
+)
+
+// CheckpointDirEnvVar is the environment variable that can be set to
+// change the directory that build checkpoints are written to. By default
+// checkpoints are stored in "packer_checkpoints" in the current directory.
+const CheckpointDirEnvVar = "PACKER_CHECKPOINT_DIR"
+
+// StepRerunOnResume can be implemented by steps whose results only live
+// in memory (open connections, running servers) and therefore must run
+// again when a build is resumed from a checkpoint, even if they completed
+// during the previous run.
+type StepRerunOnResume interface {
+	RerunOnResume() bool
+}
+
+// CheckpointPath returns the path of the checkpoint file used for the
+// build with the given name.
+func CheckpointPath(buildName string) string {
+	dir := os.Getenv(CheckpointDirEnvVar)
+	if dir == "" {
+		dir = "packer_checkpoints"
+	}
+
+	return filepath.Join(dir, buildName+".json")
+}
+
+// NewResumableRunner returns a multistep.Runner that behaves like the one
+// returned by NewRunnerWithPauseFn, but that additionally supports the
+// -resume command line argument.
+//
+// When resuming is enabled a checkpoint of the serializable values in the
+// state bag is written after every completed step. If a step fails, cleanup
+// is skipped so the VM and output directory stay around, and the next run
+// with -resume restores the state and continues at the failed step.
+func NewResumableRunner(steps []multistep.Step, config PackerConfig, ui packer.Ui, state multistep.StateBag) multistep.Runner {
+	if !config.PackerResume {
+		return NewRunnerWithPauseFn(steps, config, ui, state)
+	}
+
+	cp := &checkpoint{
+		path:  CheckpointPath(config.PackerBuildName),
+		ui:    ui,
+		steps: make([]string, len(steps)),
+	}
+	wrapped := make([]multistep.Step, len(steps))
+	for i, step := range steps {
+		cp.steps[i] = typeName(step)
+		wrapped[i] = &checkpointStep{step: step, index: i, checkpoint: cp}
+	}
+
+	return &resumeRunner{
+		Runner:     NewRunnerWithPauseFn(wrapped, config, ui, state),
+		checkpoint: cp,
+		wrapped:    wrapped,
+	}
+}
+
+// resumeRunner restores the state bag from a checkpoint before running
+// the wrapped runner and removes the checkpoint once the steps completed
+// or were cancelled.
+type resumeRunner struct {
+	multistep.Runner
+
+	checkpoint *checkpoint
+	wrapped    []multistep.Step
+}
+
+func (r *resumeRunner) Run(state multistep.StateBag) {
+	cp := r.checkpoint
+	recording := &recordingStateBag{StateBag: state, keys: make(map[string]struct{})}
+	cp.state = recording
+
+	start, err := cp.restore(recording)
+	if err != nil {
+		cp.ui.Error(fmt.Sprintf("Ignoring unusable checkpoint: %s", err))
+		start = 0
+	}
+	if start > 0 {
+		cp.ui.Say(fmt.Sprintf("Resuming build from checkpoint at step %q", cp.steps[start]))
+	}
+
+	for i, step := range r.wrapped {
+		step := step.(*checkpointStep)
+		step.skip = i < start
+		if rerun, ok := step.step.(StepRerunOnResume); ok && rerun.RerunOnResume() {
+			step.skip = false
+		}
+	}
+
+	r.Runner.Run(recording)
+
+	if cp.isHalted() {
+		cp.ui.Say(fmt.Sprintf(
+			"Build state was kept for resuming. Run again with -resume to continue, checkpoint: %s",
+			cp.path))
+		return
+	}
+
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing checkpoint %s: %s", cp.path, err)
+	}
+}
+
+// checkpointStep wraps a step so that a checkpoint is written after it
+// completes, and so that it can be skipped when resuming.
+type checkpointStep struct {
+	step       multistep.Step
+	index      int
+	checkpoint *checkpoint
+	skip       bool
+}
+
+func (s *checkpointStep) Run(state multistep.StateBag) multistep.StepAction {
+	if s.skip {
+		log.Printf("Skipping step %q, completed in a previous run", s.checkpoint.steps[s.index])
+		return multistep.ActionContinue
+	}
+
+	action := s.step.Run(state)
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return action
+	}
+
+	completed := s.index + 1
+	if action == multistep.ActionHalt {
+		completed = s.index
+	}
+	s.checkpoint.setHalted(action == multistep.ActionHalt)
+
+	if err := s.checkpoint.save(completed); err != nil {
+		s.checkpoint.ui.Error(fmt.Sprintf("Error writing checkpoint: %s", err))
+	}
+
+	return action
+}
+
+func (s *checkpointStep) Cleanup(state multistep.StateBag) {
+	if s.checkpoint.isHalted() {
+		log.Printf("Not cleaning up step %q, keeping it for resume", s.checkpoint.steps[s.index])
+		return
+	}
+
+	s.step.Cleanup(state)
+}
+
+// checkpoint tracks the progress of a resumable run and persists it to
+// disk as JSON.
+type checkpoint struct {
+	path  string
+	ui    packer.Ui
+	steps []string
+	state *recordingStateBag
+
+	halted bool
+	l      sync.Mutex
+}
+
+type checkpointFile struct {
+	Steps     []string                   `json:"steps"`
+	Completed int                        `json:"completed"`
+	State     map[string]checkpointValue `json:"state"`
+}
+
+func (c *checkpoint) setHalted(v bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.halted = v
+}
+
+func (c *checkpoint) isHalted() bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.halted
+}
+
+// save writes the checkpoint file recording that the given number of
+// steps have completed.
+func (c *checkpoint) save(completed int) error {
+	file := checkpointFile{
+		Steps:     c.steps,
+		Completed: completed,
+		State:     make(map[string]checkpointValue),
+	}
+
+	for _, k := range c.state.Keys() {
+		if k == multistep.StateCancelled || k == multistep.StateHalted {
+			continue
+		}
+
+		// Credentials are never written to disk, they are put in the
+		// state again by the steps that run on resume
+		value := c.state.Get(k)
+		if checkpointSecretKey(k) || containsSensitive(value) {
+			log.Printf("Not writing %q to the checkpoint, it may be sensitive", k)
+			continue
+		}
+
+		v, ok := encodeCheckpointValue(value)
+		if !ok {
+			continue
+		}
+
+		file.State[k] = v
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that an interrupted write never
+	// leaves a truncated checkpoint behind.
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// restore loads the checkpoint file, if any, into the state bag and
+// returns the index of the step to continue at. Values already present
+// in the state bag take precedence over the ones from the checkpoint.
+func (c *checkpoint) restore(state multistep.StateBag) (int, error) {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var file checkpointFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return 0, fmt.Errorf("%s: %s", c.path, err)
+	}
+
+	if !reflect.DeepEqual(file.Steps, c.steps) {
+		return 0, fmt.Errorf("%s: steps of the build changed since the checkpoint was written", c.path)
+	}
+
+	if file.Completed < 0 || file.Completed >= len(c.steps) {
+		return 0, nil
+	}
+
+	for k, raw := range file.State {
+		if _, ok := state.GetOk(k); ok {
+			continue
+		}
+
+		v, err := raw.decode()
+		if err != nil {
+			return 0, fmt.Errorf("%s: key %q: %s", c.path, k, err)
+		}
+
+		state.Put(k, v)
+	}
+
+	return file.Completed, nil
+}
+
+// checkpointSecretKey returns true if the state bag key looks like it
+// holds a credential.
+func checkpointSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range []string{"password", "secret", "token", "private_key"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsSensitive returns true if the state bag value contains a value
+// registered as sensitive.
+func containsSensitive(v interface{}) bool {
+	var values []string
+	switch v := v.(type) {
+	case string:
+		values = []string{v}
+	case []string:
+		values = v
+	case map[string]string:
+		for k, s := range v {
+			values = append(values, k, s)
+		}
+	}
+
+	for _, s := range values {
+		if sensitive.Redact(s) != s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkpointValue is a state bag value along with its Go type, so that
+// it can be restored with the exact type the steps expect.
+type checkpointValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// encodeCheckpointValue encodes v if it is one of the types that can be
+// serialized into a checkpoint.
+func encodeCheckpointValue(v interface{}) (checkpointValue, bool) {
+	var typ string
+	switch v.(type) {
+	case string:
+		typ = "string"
+	case bool:
+		typ = "bool"
+	case int:
+		typ = "int"
+	case int64:
+		typ = "int64"
+	case uint:
+		typ = "uint"
+	case uint64:
+		typ = "uint64"
+	case float64:
+		typ = "float64"
+	case []string:
+		typ = "[]string"
+	case map[string]string:
+		typ = "map[string]string"
+	default:
+		return checkpointValue{}, false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return checkpointValue{}, false
+	}
+
+	return checkpointValue{Type: typ, Value: data}, true
+}
+
+func (v checkpointValue) decode() (interface{}, error) {
+	var result interface{}
+	switch v.Type {
+	case "string":
+		result = new(string)
+	case "bool":
+		result = new(bool)
+	case "int":
+		result = new(int)
+	case "int64":
+		result = new(int64)
+	case "uint":
+		result = new(uint)
+	case "uint64":
+		result = new(uint64)
+	case "float64":
+		result = new(float64)
+	case "[]string":
+		result = new([]string)
+	case "map[string]string":
+		result = new(map[string]string)
+	default:
+		return nil, fmt.Errorf("unknown type %q", v.Type)
+	}
+
+	if err := json.Unmarshal(v.Value, result); err != nil {
+		return nil, err
+	}
+
+	return reflect.ValueOf(result).Elem().Interface(), nil
+}
+
+// recordingStateBag is a multistep.StateBag that remembers every key that
+// was put into it, since the StateBag interface has no way to list keys.
+type recordingStateBag struct {
+	multistep.StateBag
+
+	keys map[string]struct{}
+	l    sync.Mutex
+}
+
+func (b *recordingStateBag) Put(k string, v interface{}) {
+	b.l.Lock()
+	b.keys[k] = struct{}{}
+	b.l.Unlock()
+
+	b.StateBag.Put(k, v)
+}
+
+// Keys returns the keys that were put into the state bag.
+func (b *recordingStateBag) Keys() []string {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	result := make([]string, 0, len(b.keys))
+	for k := range b.keys {
+		result = append(result, k)
+	}
+
+	return result
+}
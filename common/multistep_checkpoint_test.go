@@ -0,0 +1,236 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/common/sensitive"
+	"github.com/mitchellh/packer/packer"
+)
+
+type testCheckpointStep struct {
+	halt   bool
+	rerun  bool
+	put    map[string]interface{}
+	ran    bool
+	closed bool
+}
+
+func (s *testCheckpointStep) Run(state multistep.StateBag) multistep.StepAction {
+	s.ran = true
+	for k, v := range s.put {
+		state.Put(k, v)
+	}
+	if s.halt {
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *testCheckpointStep) Cleanup(multistep.StateBag) {
+	s.closed = true
+}
+
+func (s *testCheckpointStep) RerunOnResume() bool {
+	return s.rerun
+}
+
+func testCheckpointDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	old := os.Getenv(CheckpointDirEnvVar)
+	os.Setenv(CheckpointDirEnvVar, dir)
+	return func() {
+		os.Setenv(CheckpointDirEnvVar, old)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewResumableRunner_disabled(t *testing.T) {
+	config := PackerConfig{PackerBuildName: "test"}
+	runner := NewResumableRunner(nil, config, testCheckpointUi(), new(multistep.BasicStateBag))
+	if _, ok := runner.(*resumeRunner); ok {
+		t.Fatal("should not be resumable")
+	}
+}
+
+func TestNewResumableRunner(t *testing.T) {
+	defer testCheckpointDir(t)()
+
+	config := PackerConfig{PackerBuildName: "test", PackerResume: true}
+	ui := testCheckpointUi()
+
+	// First run fails at the third step
+	steps := []*testCheckpointStep{
+		{put: map[string]interface{}{"port": uint(2222), "path": "foo"}},
+		{rerun: true},
+		{halt: true},
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", ui)
+	NewResumableRunner(testCheckpointSteps(steps), config, ui, state).Run(state)
+
+	for i, s := range steps {
+		if !s.ran {
+			t.Fatalf("step %d should run", i)
+		}
+		if s.closed {
+			t.Fatalf("step %d should not be cleaned up", i)
+		}
+	}
+	if _, err := os.Stat(CheckpointPath("test")); err != nil {
+		t.Fatalf("checkpoint should exist: %s", err)
+	}
+
+	// Second run resumes at the third step
+	steps = []*testCheckpointStep{
+		{},
+		{rerun: true},
+		{},
+	}
+	state = new(multistep.BasicStateBag)
+	state.Put("ui", ui)
+	NewResumableRunner(testCheckpointSteps(steps), config, ui, state).Run(state)
+
+	if steps[0].ran {
+		t.Fatal("completed step should be skipped")
+	}
+	if !steps[1].ran || !steps[2].ran {
+		t.Fatal("steps should run")
+	}
+	if v, ok := state.Get("port").(uint); !ok || v != 2222 {
+		t.Fatalf("bad: %#v", state.Get("port"))
+	}
+	if v := state.Get("path"); v != "foo" {
+		t.Fatalf("bad: %#v", v)
+	}
+	for i, s := range steps {
+		if !s.closed {
+			t.Fatalf("step %d should be cleaned up", i)
+		}
+	}
+	if _, err := os.Stat(CheckpointPath("test")); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint should be removed: %s", err)
+	}
+}
+
+func TestNewResumableRunner_secrets(t *testing.T) {
+	defer testCheckpointDir(t)()
+
+	sensitive.Add("checkpoint-test-secret")
+
+	config := PackerConfig{PackerBuildName: "test", PackerResume: true}
+	ui := testCheckpointUi()
+
+	steps := []*testCheckpointStep{
+		{put: map[string]interface{}{
+			"path":          "foo",
+			"ssh_password":  "hunter2",
+			"command":       "echo checkpoint-test-secret",
+			"winrm_options": []string{"checkpoint-test-secret"},
+		}},
+		{halt: true},
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", ui)
+	NewResumableRunner(testCheckpointSteps(steps), config, ui, state).Run(state)
+
+	fi, err := os.Stat(CheckpointPath("test"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+
+	contents, err := ioutil.ReadFile(CheckpointPath("test"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(contents), `"path"`) {
+		t.Fatalf("bad: %s", contents)
+	}
+	for _, s := range []string{"hunter2", "checkpoint-test-secret"} {
+		if strings.Contains(string(contents), s) {
+			t.Fatalf("%s should not be written: %s", s, contents)
+		}
+	}
+}
+
+func TestNewResumableRunner_changedSteps(t *testing.T) {
+	defer testCheckpointDir(t)()
+
+	config := PackerConfig{PackerBuildName: "test", PackerResume: true}
+	ui := testCheckpointUi()
+
+	steps := []*testCheckpointStep{{}, {halt: true}}
+	state := new(multistep.BasicStateBag)
+	NewResumableRunner(testCheckpointSteps(steps), config, ui, state).Run(state)
+
+	// A different list of steps must start over
+	steps = []*testCheckpointStep{{}, {}, {}}
+	state = new(multistep.BasicStateBag)
+	NewResumableRunner(testCheckpointSteps(steps), config, ui, state).Run(state)
+	for i, s := range steps {
+		if !s.ran {
+			t.Fatalf("step %d should run", i)
+		}
+	}
+}
+
+func TestCheckpointValue(t *testing.T) {
+	values := []interface{}{
+		"foo",
+		true,
+		int(-1),
+		int64(2),
+		uint(3),
+		uint64(4),
+		float64(1.5),
+		[]string{"a", "b"},
+		map[string]string{"a": "b"},
+	}
+
+	for _, v := range values {
+		encoded, ok := encodeCheckpointValue(v)
+		if !ok {
+			t.Fatalf("should encode: %#v", v)
+		}
+
+		decoded, err := encoded.decode()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			t.Fatalf("bad: %#v != %#v", decoded, v)
+		}
+	}
+
+	if _, ok := encodeCheckpointValue(new(packer.MockArtifact)); ok {
+		t.Fatal("should not encode")
+	}
+}
+
+func testCheckpointUi() packer.Ui {
+	return &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+}
+
+func testCheckpointSteps(steps []*testCheckpointStep) []multistep.Step {
+	result := make([]multistep.Step, len(steps))
+	for i, s := range steps {
+		result[i] = s
+	}
+	return result
+}
@@ -13,6 +13,16 @@ import (
 )
 
 func newRunner(steps []multistep.Step, config PackerConfig, ui packer.Ui) (multistep.Runner, multistep.DebugPauseFn) {
+	// Wrap the steps in a new slice, the caller may still hold on to the
+	// steps it passed in.
+	names := make([]string, len(steps))
+	wrapped := make([]multistep.Step, len(steps))
+	for i, step := range steps {
+		names[i] = typeName(step)
+		wrapped[i] = &machineStep{step, names[i], ui}
+	}
+	steps = wrapped
+
 	switch config.PackerOnError {
 	case "", "cleanup":
 	case "abort":
@@ -27,7 +37,15 @@ func newRunner(steps []multistep.Step, config PackerConfig, ui packer.Ui) (multi
 
 	if config.PackerDebug {
 		pauseFn := MultistepDebugFn(ui)
-		return &multistep.DebugRunner{Steps: steps, PauseFn: pauseFn}, pauseFn
+
+		// The pause steps are inserted here instead of using a
+		// multistep.DebugRunner so that they are named after the original
+		// steps rather than after the wrappers above.
+		debugSteps := make([]multistep.Step, 0, len(steps)*2)
+		for i, step := range steps {
+			debugSteps = append(debugSteps, step, &debugPauseStep{names[i], pauseFn})
+		}
+		return &multistep.BasicRunner{Steps: debugSteps}, pauseFn
 	} else {
 		return &multistep.BasicRunner{Steps: steps}, nil
 	}
@@ -52,10 +70,71 @@ func NewRunnerWithPauseFn(steps []multistep.Step, config PackerConfig, ui packer
 	return runner
 }
 
+// StepNames returns the names of the steps, which are the names the
+// runners use for them in the step-start and step-finish machine-readable
+// output. Builders can use it to implement packer.BuilderPlanner.
+func StepNames(steps []multistep.Step) []string {
+	result := make([]string, len(steps))
+	for i, step := range steps {
+		result[i] = typeName(step)
+	}
+
+	return result
+}
+
 func typeName(i interface{}) string {
+	// Name wrapped steps after the step they wrap
+	switch s := i.(type) {
+	case *checkpointStep:
+		return typeName(s.step)
+	case *machineStep:
+		return s.name
+	}
+
 	return reflect.Indirect(reflect.ValueOf(i)).Type().Name()
 }
 
+// machineStep emits machine-readable events when the wrapped step starts
+// and finishes.
+type machineStep struct {
+	step multistep.Step
+	name string
+	ui   packer.Ui
+}
+
+func (s *machineStep) Run(state multistep.StateBag) multistep.StepAction {
+	s.ui.Machine("step-start", s.name)
+
+	start := time.Now()
+	action := s.step.Run(state)
+
+	result := "continue"
+	if action == multistep.ActionHalt {
+		result = "halt"
+	}
+	s.ui.Machine("step-finish", s.name, packer.MachineDuration(time.Since(start)), result)
+
+	return action
+}
+
+func (s *machineStep) Cleanup(state multistep.StateBag) {
+	s.step.Cleanup(state)
+}
+
+type debugPauseStep struct {
+	name    string
+	pauseFn multistep.DebugPauseFn
+}
+
+func (s *debugPauseStep) Run(state multistep.StateBag) multistep.StepAction {
+	s.pauseFn(multistep.DebugLocationAfterRun, s.name, state)
+	return multistep.ActionContinue
+}
+
+func (s *debugPauseStep) Cleanup(state multistep.StateBag) {
+	s.pauseFn(multistep.DebugLocationBeforeCleanup, s.name, state)
+}
+
 type abortStep struct {
 	step multistep.Step
 	ui   packer.Ui
@@ -9,5 +9,6 @@ type PackerConfig struct {
 	PackerDebug       bool              `mapstructure:"packer_debug"`
 	PackerForce       bool              `mapstructure:"packer_force"`
 	PackerOnError     string            `mapstructure:"packer_on_error"`
+	PackerResume      bool              `mapstructure:"packer_resume"`
 	PackerUserVars    map[string]string `mapstructure:"packer_user_variables"`
 }
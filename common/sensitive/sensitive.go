@@ -0,0 +1,177 @@
+// Package sensitive keeps track of values, such as passwords and keys, that
+// must never be shown to the user or written to the logs. Values are
+// registered when they are read, for example by the secret interpolation
+// functions, and every Ui and the log output redact them.
+package sensitive
+
+import (
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask is what sensitive values are replaced with.
+const Mask = "<sensitive>"
+
+// MinLength is the length below which values aren't redacted. Masking a
+// value of a character or two would mangle unrelated output without
+// hiding anything.
+const MinLength = 4
+
+var (
+	lock     sync.RWMutex
+	values   = make(map[string]struct{})
+	replacer *strings.Replacer
+)
+
+// Add marks the given value as sensitive. Each line of a value that spans
+// multiple lines is marked as well, since output is often split into
+// lines and prefixed. Values and lines shorter than MinLength are skipped
+// with a warning in the logs, and false is returned so that the caller
+// can warn the user that they will be shown.
+func Add(v string) bool {
+	if strings.TrimSpace(v) == "" {
+		return true
+	}
+
+	add := []string{v}
+	if strings.Contains(v, "\n") {
+		for _, line := range strings.Split(v, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				add = append(add, line)
+			}
+		}
+	}
+
+	skipped := 0
+	lock.Lock()
+	for _, v := range add {
+		if len(v) < MinLength {
+			skipped++
+			continue
+		}
+
+		values[v] = struct{}{}
+	}
+	replacer = nil
+	lock.Unlock()
+
+	// Logged without the lock since the log output is redacted
+	if skipped > 0 {
+		log.Printf("[WARN] A sensitive value shorter than %d characters "+
+			"can't be redacted from the output", MinLength)
+	}
+
+	return skipped == 0
+}
+
+// Values returns all the values marked as sensitive.
+func Values() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	result := make([]string, 0, len(values))
+	for v := range values {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Redact replaces all the sensitive values in the string with Mask.
+func Redact(s string) string {
+	lock.RLock()
+	r := replacer
+	empty := len(values) == 0
+	lock.RUnlock()
+
+	if empty {
+		return s
+	}
+
+	if r == nil {
+		r = newReplacer()
+	}
+
+	return r.Replace(s)
+}
+
+// RedactAll returns a copy of the strings with each of them redacted.
+func RedactAll(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	result := make([]string, len(s))
+	for i, v := range s {
+		result[i] = Redact(v)
+	}
+
+	return result
+}
+
+func newReplacer() *strings.Replacer {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if replacer != nil {
+		return replacer
+	}
+
+	// Longer values go first so that a value containing another one is
+	// replaced entirely.
+	vs := make([]string, 0, len(values))
+	for v := range values {
+		vs = append(vs, v)
+	}
+	sort.Sort(byLength(vs))
+
+	oldnew := make([]string, 0, len(vs)*2)
+	for _, v := range vs {
+		oldnew = append(oldnew, v, Mask)
+	}
+
+	replacer = strings.NewReplacer(oldnew...)
+	return replacer
+}
+
+// byLength sorts the longest strings first.
+type byLength []string
+
+func (s byLength) Len() int      { return len(s) }
+func (s byLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) > len(s[j])
+	}
+	return s[i] < s[j]
+}
+
+// reset forgets all the sensitive values. It is only used by tests.
+func reset() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	values = make(map[string]struct{})
+	replacer = nil
+}
+
+// Writer is an io.Writer that redacts sensitive values from everything
+// written to it before passing it on. Each write is redacted on its own,
+// so values are only caught if they are written in a single call, which
+// is the case for the log package.
+type Writer struct {
+	W io.Writer
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	redacted := Redact(string(p))
+	if _, err := io.WriteString(w.W, redacted); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
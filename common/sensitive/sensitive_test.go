@@ -0,0 +1,100 @@
+package sensitive
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	defer reset()
+
+	Add("")
+	Add("  ")
+	Add("secret")
+	Add("secretive")
+	Add("-----BEGIN KEY-----\nabc123\n-----END KEY-----\n")
+
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"nothing here", "nothing here"},
+		{"the secret is out", "the <sensitive> is out"},
+		{"very secretive", "very <sensitive>"},
+		{
+			"key: -----BEGIN KEY-----\nabc123\n-----END KEY-----\n",
+			"key: <sensitive>",
+		},
+		{"==> build: abc123", "==> build: <sensitive>"},
+	}
+
+	for _, tc := range cases {
+		actual := Redact(tc.Input)
+		if actual != tc.Expected {
+			t.Fatalf("%q: bad: %q", tc.Input, actual)
+		}
+	}
+}
+
+func TestAdd_short(t *testing.T) {
+	defer reset()
+
+	if Add("abc") {
+		t.Fatal("should not redact a short value")
+	}
+	if Add("long value\nab\n") {
+		t.Fatal("should not redact a short line")
+	}
+	if !Add("long value") {
+		t.Fatal("should redact a long value")
+	}
+	if v := Values(); !reflect.DeepEqual(v, []string{"long value", "long value\nab\n"}) {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if actual := Redact("abcdef ab"); actual != "abcdef ab" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+func TestRedactAll(t *testing.T) {
+	defer reset()
+
+	Add("foobar")
+	actual := RedactAll([]string{"foobar", "bar"})
+	expected := []string{Mask, "bar"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestValues(t *testing.T) {
+	defer reset()
+
+	Add("bbbb")
+	Add("aaaa")
+	Add("aaaa")
+	if v := Values(); !reflect.DeepEqual(v, []string{"aaaa", "bbbb"}) {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	defer reset()
+
+	Add("password")
+
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	n, err := w.Write([]byte("the password is hunter2\n"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 24 {
+		t.Fatalf("bad: %d", n)
+	}
+	if buf.String() != "the <sensitive> is hunter2\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
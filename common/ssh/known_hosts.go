@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrHostKeyRevoked is returned by CheckKnownHosts if the key is
+	// marked as revoked.
+	ErrHostKeyRevoked = errors.New("the host key is revoked")
+
+	// ErrHostKeyChanged is returned by CheckKnownHosts if there are keys
+	// for the server, but the key isn't one of them.
+	ErrHostKeyChanged = errors.New("the host key doesn't match")
+
+	// ErrHostKeyUnknown is returned by CheckKnownHosts if there are no
+	// keys for the server.
+	ErrHostKeyUnknown = errors.New("the host is unknown")
+)
+
+// CheckKnownHosts checks the key of the server at the address against
+// the contents of a known_hosts file. It returns nil if the key is one of
+// the keys for the server, ErrHostKeyRevoked, ErrHostKeyChanged or
+// ErrHostKeyUnknown if it isn't, or the error reading the contents.
+// Revoked keys are rejected even if other entries have them.
+func CheckKnownHosts(contents []byte, address string, key ssh.PublicKey) error {
+	name := KnownHostsName(address)
+
+	known, trusted := false, false
+	for rest := contents; ; {
+		marker, hosts, hostKey, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rest = next
+
+		if marker == "cert-authority" || !KnownHostsMatch(hosts, name) {
+			continue
+		}
+
+		same := bytes.Equal(hostKey.Marshal(), key.Marshal())
+		if marker == "revoked" {
+			if same {
+				return ErrHostKeyRevoked
+			}
+			continue
+		}
+
+		known = true
+		if same {
+			trusted = true
+		}
+	}
+
+	switch {
+	case trusted:
+		return nil
+	case known:
+		return ErrHostKeyChanged
+	default:
+		return ErrHostKeyUnknown
+	}
+}
+
+// KnownHostsName returns the name of the server at the address in a
+// known_hosts file. The port is only part of the name if it isn't 22.
+func KnownHostsName(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	if port == "22" {
+		return host
+	}
+
+	return fmt.Sprintf("[%s]:%s", host, port)
+}
+
+// KnownHostsMatch returns true if the name matches the patterns of a
+// known_hosts entry. The patterns can be hashed, have the wildcards * and
+// ?, and be negated with !, as in OpenSSH.
+func KnownHostsMatch(patterns []string, name string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		if negated {
+			p = p[1:]
+		}
+
+		var ok bool
+		if strings.HasPrefix(p, "|1|") {
+			ok = knownHostsHashMatch(p, name)
+		} else {
+			ok = wildcardMatch(strings.ToLower(p), strings.ToLower(name))
+		}
+
+		if ok && negated {
+			return false
+		}
+		if ok {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// knownHostsHashMatch returns true if the hashed host name is the name.
+func knownHostsHashMatch(hashed string, name string) bool {
+	parts := strings.Split(hashed, "|")
+	if len(parts) != 4 {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// wildcardMatch returns true if the string matches the pattern, where *
+// matches any number of characters and ? matches exactly one.
+func wildcardMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+
+	return len(s) == 0
+}
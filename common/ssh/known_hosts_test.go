@@ -0,0 +1,98 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return key
+}
+
+func TestCheckKnownHosts(t *testing.T) {
+	key := testHostKey(t)
+	other := testHostKey(t)
+	authorized := func(k ssh.PublicKey) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+	}
+
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[10.0.0.5]:2222"))
+	hashed := fmt.Sprintf("|1|%s|%s",
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	contents := []byte(fmt.Sprintf(
+		"# comment\n"+
+			"example.com,10.0.0.1 %s\n"+
+			"[example.com]:2222 %s\n"+
+			"%s %s\n"+
+			"*.example.org,!bad.example.org %s\n"+
+			"@revoked revoked.example.org %s\n"+
+			"revoked.example.org %s\n",
+		authorized(other),
+		authorized(key),
+		hashed, authorized(key),
+		authorized(key),
+		authorized(key),
+		authorized(key)))
+
+	cases := []struct {
+		Address  string
+		Expected error
+	}{
+		{"example.com:2222", nil},
+		{"10.0.0.5:2222", nil},
+		{"host.example.org:22", nil},
+		{"example.com:22", ErrHostKeyChanged},
+		{"10.0.0.1:22", ErrHostKeyChanged},
+		{"10.0.0.5:22", ErrHostKeyUnknown},
+		{"bad.example.org:22", ErrHostKeyUnknown},
+		{"revoked.example.org:22", ErrHostKeyRevoked},
+		{"unknown.example.com:22", ErrHostKeyUnknown},
+	}
+	for _, tc := range cases {
+		if err := CheckKnownHosts(contents, tc.Address, key); err != tc.Expected {
+			t.Fatalf("%s: bad: %v", tc.Address, err)
+		}
+	}
+
+	if err := CheckKnownHosts([]byte("example.com bad"), "example.com:22", key); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestKnownHostsName(t *testing.T) {
+	cases := map[string]string{
+		"example.com:22":   "example.com",
+		"example.com:2222": "[example.com]:2222",
+		"[::1]:22":         "::1",
+		"[::1]:2222":       "[::1]:2222",
+		"example.com":      "example.com",
+	}
+	for input, expected := range cases {
+		if actual := KnownHostsName(input); actual != expected {
+			t.Fatalf("%s: bad: %s", input, actual)
+		}
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/mitchellh/multistep"
@@ -16,8 +20,9 @@ import (
 // progress reporting, interrupt handling, etc.
 //
 // Uses:
-//   cache packer.Cache
-//   ui    packer.Ui
+//
+//	cache packer.Cache
+//	ui    packer.Ui
 type StepDownload struct {
 	// The checksum and the type of the checksum for the download
 	Checksum     string
@@ -43,6 +48,10 @@ type StepDownload struct {
 	// extension on the URL is used. Otherwise, this will be forced
 	// on the downloaded file for every URL.
 	Extension string
+
+	// Options configures how the file is downloaded, such as retries and
+	// the number of connections.
+	Options DownloadOptions
 }
 
 func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
@@ -61,16 +70,38 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 
 	ui.Say(fmt.Sprintf("Downloading or copying %s", s.Description))
 
-	var finalPath string
+	// Files with a checksum are cached by their checksum, so the file is
+	// only downloaded once no matter which URL it comes from, and a file
+	// that changed at its URL isn't reused.
+	var finalPath, checksumKey, checksumPath string
+	if s.TargetPath == "" && checksum != nil {
+		checksumKey = s.checksumCacheKey()
+		log.Printf("Acquiring lock to download: %s", checksumKey)
+		checksumPath = cache.Lock(checksumKey)
+		defer cache.Unlock(checksumKey)
+
+		finalPath = s.findCached(cache, checksumKey, checksumPath, checksum)
+		if finalPath != "" {
+			ui.Message(fmt.Sprintf("Using cached file: %s", finalPath))
+		}
+	}
+
 	for _, url := range s.Url {
+		if finalPath != "" {
+			break
+		}
+
 		ui.Message(fmt.Sprintf("Downloading or copying: %s", url))
 
+		cacheKey := checksumKey
 		targetPath := s.TargetPath
-		if targetPath == "" {
+		if checksumKey != "" {
+			targetPath = checksumPath
+		} else if targetPath == "" {
 			// Determine a cache key. This is normally just the URL but
 			// if we force a certain extension we hash the URL and add
 			// the extension to force it.
-			cacheKey := url
+			cacheKey = url
 			if s.Extension != "" {
 				hash := sha1.Sum([]byte(url))
 				cacheKey = fmt.Sprintf(
@@ -90,12 +121,25 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 			Checksum:   checksum,
 			UserAgent:  "Packer",
 		}
+		s.Options.configure(config)
 
 		path, err, retry := s.download(config, state)
 		if err != nil {
 			ui.Message(fmt.Sprintf("Error downloading: %s", err))
 		}
 
+		// Let the cache know where the file came from, so it can be
+		// listed and verified later.
+		if err == nil && cacheKey != "" {
+			if d, ok := cache.(packer.CacheDescriber); ok {
+				d.Describe(cacheKey, packer.CacheInfo{
+					Source:       url,
+					ChecksumType: s.ChecksumType,
+					Checksum:     s.Checksum,
+				})
+			}
+		}
+
 		if !retry {
 			return multistep.ActionHalt
 		}
@@ -119,6 +163,58 @@ func (s *StepDownload) Run(state multistep.StateBag) multistep.StepAction {
 
 func (s *StepDownload) Cleanup(multistep.StateBag) {}
 
+// checksumCacheKey returns the cache key of the file based on its
+// checksum. The extension is the forced extension, or else the extension
+// of the first URL.
+func (s *StepDownload) checksumCacheKey() string {
+	ext := ""
+	if s.Extension != "" {
+		ext = "." + s.Extension
+	} else if len(s.Url) > 0 {
+		if u, err := url.Parse(s.Url[0]); err == nil {
+			ext = path.Ext(u.Path)
+		}
+	}
+
+	return fmt.Sprintf("%s:%s%s",
+		strings.ToLower(s.ChecksumType), strings.ToLower(s.Checksum), ext)
+}
+
+// findCached returns the path of a copy of the file that matches the
+// checksum, either in the cache or in a read-only secondary cache. It
+// returns "" if there is none. A file in the cache that doesn't match is
+// removed so it is downloaded again.
+func (s *StepDownload) findCached(cache packer.Cache, key, cachePath string, checksum []byte) string {
+	paths := []string{cachePath}
+	if f, ok := cache.(packer.CacheFinder); ok {
+		paths = append(paths, f.Find(key)...)
+	}
+
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+
+		d := NewDownloadClient(&DownloadConfig{
+			Hash:     HashForType(s.ChecksumType),
+			Checksum: checksum,
+		})
+		if ok, err := d.VerifyChecksum(p); err != nil || !ok {
+			log.Printf("Cached file doesn't match checksum: %s", p)
+			if p == cachePath {
+				if err := os.Remove(p); err != nil {
+					log.Printf("Error removing cached file: %s", err)
+				}
+			}
+			continue
+		}
+
+		return p
+	}
+
+	return ""
+}
+
 func (s *StepDownload) download(config *DownloadConfig, state multistep.StateBag) (string, error, bool) {
 	var path string
 	ui := state.Get("ui").(packer.Ui)
@@ -150,6 +246,7 @@ func (s *StepDownload) download(config *DownloadConfig, state multistep.StateBag
 		case <-time.After(1 * time.Second):
 			if _, ok := state.GetOk(multistep.StateCancelled); ok {
 				ui.Say("Interrupt received. Cancelling download...")
+				download.Cancel()
 				return "", nil, false
 			}
 		}
@@ -1,8 +1,14 @@
 package common
 
 import (
-	"github.com/mitchellh/multistep"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
 )
 
 func TestStepDownload_Impl(t *testing.T) {
@@ -12,3 +18,129 @@ func TestStepDownload_Impl(t *testing.T) {
 		t.Fatalf("download should be a step")
 	}
 }
+
+func TestStepDownload_checksumCacheKey(t *testing.T) {
+	a := &StepDownload{
+		Checksum:     "ABCD",
+		ChecksumType: "sha256",
+		Url:          []string{"http://a.example.com/foo.iso?x=y"},
+	}
+	b := &StepDownload{
+		Checksum:     "abcd",
+		ChecksumType: "sha256",
+		Url:          []string{"http://b.example.com/bar/foo.iso"},
+	}
+
+	if a.checksumCacheKey() != "sha256:abcd.iso" {
+		t.Fatalf("bad: %s", a.checksumCacheKey())
+	}
+	if a.checksumCacheKey() != b.checksumCacheKey() {
+		t.Fatalf("bad: %s != %s", a.checksumCacheKey(), b.checksumCacheKey())
+	}
+
+	b.Extension = "img"
+	if b.checksumCacheKey() != "sha256:abcd.img" {
+		t.Fatalf("bad: %s", b.checksumCacheKey())
+	}
+}
+
+func testStepDownloadState(t *testing.T, cache packer.Cache) multistep.StateBag {
+	state := new(multistep.BasicStateBag)
+	state.Put("cache", cache)
+	state.Put("ui", &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	})
+	return state
+}
+
+func TestStepDownload_secondaryCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	secondaryDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(secondaryDir)
+
+	// The URL doesn't exist, so the file can only come from the cache
+	step := &StepDownload{
+		Checksum:     "acbd18db4cc2f85cedef654fccc4a4d8",
+		ChecksumType: "md5",
+		Description:  "ISO",
+		ResultKey:    "iso_path",
+		Url:          []string{"file:///nonexistent/foo.iso"},
+	}
+
+	secondary := &packer.FileCache{CacheDir: secondaryDir}
+	path := secondary.Lock(step.checksumCacheKey())
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	secondary.Unlock(step.checksumCacheKey())
+
+	cache := &packer.FileCache{
+		CacheDir:      cacheDir,
+		SecondaryDirs: []string{secondaryDir},
+	}
+	state := testStepDownloadState(t, cache)
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", state.Get("error"))
+	}
+	if state.Get("iso_path").(string) != path {
+		t.Fatalf("bad: %s", state.Get("iso_path"))
+	}
+
+	// A file that doesn't match the checksum isn't used
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state = testStepDownloadState(t, cache)
+	if action := step.Run(state); action != multistep.ActionHalt {
+		t.Fatal("should halt")
+	}
+}
+
+func TestStepDownload_verifyCached(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	source := filepath.Join(cacheDir, "source.iso")
+	if err := ioutil.WriteFile(source, []byte("foo"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	step := &StepDownload{
+		Checksum:     "acbd18db4cc2f85cedef654fccc4a4d8",
+		ChecksumType: "md5",
+		Description:  "ISO",
+		ResultKey:    "iso_path",
+		Url:          []string{"file://" + filepath.ToSlash(source)},
+	}
+
+	// A corrupt file in the cache is removed instead of being used
+	cache := &packer.FileCache{CacheDir: filepath.Join(cacheDir, "cache")}
+	path := cache.Lock(step.checksumCacheKey())
+	if err := ioutil.WriteFile(path, []byte("bar"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cache.Unlock(step.checksumCacheKey())
+
+	state := testStepDownloadState(t, cache)
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", state.Get("error"))
+	}
+	if state.Get("iso_path").(string) != source {
+		t.Fatalf("bad: %s", state.Get("iso_path"))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("cached file should be removed: %s", err)
+	}
+}
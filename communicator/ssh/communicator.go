@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/packer/packer"
@@ -26,11 +27,41 @@ import (
 // out period is 1 minute. You can change it with Config.HandshakeTimeout.
 var ErrHandshakeTimeout = fmt.Errorf("Timeout during SSH handshake")
 
+// reconnectRetryInterval is how long to wait between attempts to
+// reconnect.
+var reconnectRetryInterval = 5 * time.Second
+
+// brokenCheckTimeout is how long to wait for the connection to close after
+// an operation failed, to tell if it failed because the connection was
+// lost.
+var brokenCheckTimeout = 1 * time.Second
+
+// errNoRetry is returned by an operation run by retryBroken when it can't
+// be run again.
+var errNoRetry = errors.New("operation can't be retried")
+
 type comm struct {
 	client  *ssh.Client
 	config  *Config
 	conn    net.Conn
 	address string
+
+	// l is held while the connection is replaced, and protects client,
+	// closed and generation. closed is closed when the connection of
+	// client ends, and generation counts the connections.
+	l          sync.Mutex
+	closed     chan struct{}
+	generation int
+	stats      ReconnectStats
+
+	// agent is the local SSH agent, which is connected to once, and
+	// agentAuth authenticates with its keys when reconnecting.
+	agent     agent.Agent
+	agentAuth ssh.AuthMethod
+
+	// hostKey is the key of the server from the last handshake
+	hostKey     ssh.PublicKey
+	hostKeyLock sync.Mutex
 }
 
 // Config is the structure used to configure the SSH communicator.
@@ -55,6 +86,38 @@ type Config struct {
 
 	// UseSftp, if true, sftp will be used instead of scp for file transfers
 	UseSftp bool
+
+	// KeepAliveInterval is how often keepalive requests are sent to the
+	// server while connected. Zero disables them.
+	KeepAliveInterval time.Duration
+
+	// KeepAliveCountMax is the number of keepalive requests in a row that
+	// can go unanswered before the connection is closed. Defaults to 3.
+	KeepAliveCountMax int
+
+	// ReconnectTimeout is how long to keep trying to reconnect when the
+	// connection is lost, for example while the machine reboots. Zero
+	// means to try once.
+	ReconnectTimeout time.Duration
+
+	// Reconnected, if not nil, is called after the connection was lost
+	// and established again. It must not use the communicator.
+	Reconnected func(ReconnectStats)
+}
+
+// ReconnectStats are the numbers about the reconnects of a communicator.
+type ReconnectStats struct {
+	// Reconnects is the number of times the connection was established
+	// again after it was lost.
+	Reconnects int
+
+	// Attempts is the number of attempts the last reconnect took.
+	Attempts int
+
+	// Downtime is how long the last reconnect took, and TotalDowntime is
+	// how long all of them took.
+	Downtime      time.Duration
+	TotalDowntime time.Duration
 }
 
 // Creates a new packer.Communicator implementation over SSH. This takes
@@ -74,32 +137,17 @@ func New(address string, config *Config) (result *comm, err error) {
 	return
 }
 
+// Start starts the command. If the connection is lost before the command
+// starts, it is started again after reconnecting. A command that is
+// running when the connection is lost can't be resumed, it exits with
+// packer.CmdDisconnect.
 func (c *comm) Start(cmd *packer.RemoteCmd) (err error) {
-	session, err := c.newSession()
-	if err != nil {
-		return
-	}
-
-	// Setup our session
-	session.Stdin = cmd.Stdin
-	session.Stdout = cmd.Stdout
-	session.Stderr = cmd.Stderr
-
-	if c.config.Pty {
-		// Request a PTY
-		termModes := ssh.TerminalModes{
-			ssh.ECHO:          0,     // do not echo
-			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
-			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
-		}
-
-		if err = session.RequestPty("xterm", 40, 80, termModes); err != nil {
-			return
-		}
-	}
-
-	log.Printf("starting remote command: %s", cmd.Command)
-	err = session.Start(cmd.Command + "\n")
+	var session *ssh.Session
+	err = c.retryBroken("start", func() error {
+		var err error
+		session, err = c.startSession(cmd)
+		return err
+	})
 	if err != nil {
 		return
 	}
@@ -128,25 +176,79 @@ func (c *comm) Start(cmd *packer.RemoteCmd) (err error) {
 	return
 }
 
-func (c *comm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
-	if c.config.UseSftp {
-		return c.sftpUploadSession(path, input, fi)
-	} else {
-		return c.scpUploadSession(path, input, fi)
+// startSession opens a session and starts the command in it.
+func (c *comm) startSession(cmd *packer.RemoteCmd) (*ssh.Session, error) {
+	session, err := c.newSession()
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup our session
+	session.Stdin = cmd.Stdin
+	session.Stdout = cmd.Stdout
+	session.Stderr = cmd.Stderr
+
+	if c.config.Pty {
+		// Request a PTY
+		termModes := ssh.TerminalModes{
+			ssh.ECHO:          0,     // do not echo
+			ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+			ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+		}
+
+		if err := session.RequestPty("xterm", 40, 80, termModes); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	log.Printf("starting remote command: %s", cmd.Command)
+	if err := session.Start(cmd.Command + "\n"); err != nil {
+		session.Close()
+		return nil, err
 	}
+
+	return session, nil
+}
+
+// Upload uploads the input. If the connection is lost, the upload is
+// retried after reconnecting if none of the input was read yet or the
+// input can seek back to where it started.
+func (c *comm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	r := &countingReader{Reader: input}
+	rewind := r.rewinder()
+	return c.retryBroken("upload", func() error {
+		if err := rewind(); err != nil {
+			return err
+		}
+
+		if c.config.UseSftp {
+			return c.sftpUploadSession(path, r, fi)
+		} else {
+			return c.scpUploadSession(path, r, fi)
+		}
+	})
 }
 
 func (c *comm) UploadDir(dst string, src string, excl []string) error {
 	log.Printf("Upload dir '%s' to '%s'", src, dst)
-	if c.config.UseSftp {
-		return c.sftpUploadDirSession(dst, src, excl)
-	} else {
-		return c.scpUploadDirSession(dst, src, excl)
-	}
+	return c.retryBroken("upload", func() error {
+		if c.config.UseSftp {
+			return c.sftpUploadDirSession(dst, src, excl)
+		} else {
+			return c.scpUploadDirSession(dst, src, excl)
+		}
+	})
 }
 
 func (c *comm) DownloadDir(src string, dst string, excl []string) error {
 	log.Printf("Download dir '%s' to '%s'", src, dst)
+	return c.retryBroken("download", func() error {
+		return c.downloadDir(src, dst, excl)
+	})
+}
+
+func (c *comm) downloadDir(src string, dst string, excl []string) error {
 	scpFunc := func(w io.Writer, stdoutR *bufio.Reader) error {
 		dirStack := []string{dst}
 		for {
@@ -217,35 +319,140 @@ func (c *comm) DownloadDir(src string, dst string, excl []string) error {
 	return c.scpSession("scp -vrf "+src, scpFunc)
 }
 
+// Download downloads to the output. If the connection is lost, the
+// download is retried after reconnecting if nothing was written to the
+// output yet or the output can be truncated, like a file.
 func (c *comm) Download(path string, output io.Writer) error {
-	if c.config.UseSftp {
-		return c.sftpDownloadSession(path, output)
+	w := &countingWriter{Writer: output}
+	rewind := w.rewinder()
+	return c.retryBroken("download", func() error {
+		if err := rewind(); err != nil {
+			return err
+		}
+
+		if c.config.UseSftp {
+			return c.sftpDownloadSession(path, w)
+		}
+		return c.scpDownloadSession(path, w)
+	})
+}
+
+// retryBroken runs the operation, and runs it again once if it failed
+// because the connection was lost. The operation is expected to open new
+// sessions, which reconnect. The operation can return errNoRetry to give
+// up on retrying.
+func (c *comm) retryBroken(name string, op func() error) error {
+	c.l.Lock()
+	generation := c.generation
+	c.l.Unlock()
+
+	err := op()
+	if err == nil || !c.lostConnection(generation) {
+		return err
+	}
+
+	log.Printf("[INFO] %s failed because the connection was lost, retrying: %s", name, err)
+	if retryErr := op(); retryErr != errNoRetry {
+		return retryErr
+	}
+
+	return err
+}
+
+// lostConnection returns true if the connection was lost since the given
+// generation of the connection: either it was replaced, or the current
+// connection closes soon.
+func (c *comm) lostConnection(generation int) bool {
+	c.l.Lock()
+	replaced := c.generation != generation
+	closed := c.closed
+	c.l.Unlock()
+
+	if replaced || closed == nil {
+		return true
+	}
+
+	select {
+	case <-closed:
+		return true
+	case <-time.After(brokenCheckTimeout):
+		return false
 	}
-	return c.scpDownloadSession(path, output)
 }
 
-func (c *comm) newSession() (session *ssh.Session, err error) {
+func (c *comm) newSession() (*ssh.Session, error) {
 	log.Println("opening new ssh session")
-	if c.client == nil {
-		err = errors.New("client not available")
-	} else {
-		session, err = c.client.NewSession()
+	c.l.Lock()
+	client := c.client
+	c.l.Unlock()
+
+	if client != nil {
+		session, err := client.NewSession()
+		if err == nil {
+			return session, nil
+		}
+
+		log.Printf("ssh session open error: '%s', attempting reconnect", err)
 	}
 
+	client, err := c.reconnectBroken(client)
 	if err != nil {
-		log.Printf("ssh session open error: '%s', attempting reconnect", err)
-		if err := c.reconnect(); err != nil {
-			return nil, err
-		}
+		return nil, err
+	}
 
-		if c.client == nil {
+	return client.NewSession()
+}
+
+// reconnectBroken replaces the connection of the client that broke, and
+// returns the client of the new connection. Sessions that find the same
+// connection broken at the same time share the new one. When the server
+// is gone, for example while the machine reboots, it keeps trying until
+// the reconnect timeout.
+func (c *comm) reconnectBroken(broken *ssh.Client) (*ssh.Client, error) {
+	c.l.Lock()
+
+	// Another session may have reconnected already
+	if c.client != nil && c.client != broken {
+		client := c.client
+		c.l.Unlock()
+		return client, nil
+	}
+
+	start := time.Now()
+	attempts := 0
+	for {
+		attempts++
+		err := c.reconnect()
+		if err == nil && c.client == nil {
 			err = errors.New("client not available")
-		} else {
-			session, err = c.client.NewSession()
 		}
+		if err == nil {
+			break
+		}
+
+		if time.Since(start) >= c.config.ReconnectTimeout {
+			c.l.Unlock()
+			return nil, err
+		}
+
+		log.Printf("reconnect attempt %d failed, trying again: %s", attempts, err)
+		time.Sleep(reconnectRetryInterval)
 	}
 
-	return session, nil
+	c.stats.Reconnects++
+	c.stats.Attempts = attempts
+	c.stats.Downtime = time.Since(start)
+	c.stats.TotalDowntime += c.stats.Downtime
+	stats := c.stats
+	client := c.client
+	c.l.Unlock()
+
+	log.Printf("reconnected after %d attempts in %s", attempts, stats.Downtime)
+	if c.config.Reconnected != nil {
+		c.config.Reconnected(stats)
+	}
+
+	return client, nil
 }
 
 func (c *comm) reconnect() (err error) {
@@ -289,8 +496,27 @@ func (c *comm) reconnect() (err error) {
 	var sshChan <-chan ssh.NewChannel
 	var req <-chan *ssh.Request
 
+	// Wrap the host key callback so we know the key of the server
+	sshConfig := *c.config.SSHConfig
+	if c.agentAuth != nil {
+		sshConfig.Auth = append(
+			append([]ssh.AuthMethod(nil), sshConfig.Auth...), c.agentAuth)
+	}
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if c.config.SSHConfig.HostKeyCallback != nil {
+			if err := c.config.SSHConfig.HostKeyCallback(hostname, remote, key); err != nil {
+				return err
+			}
+		}
+
+		c.hostKeyLock.Lock()
+		defer c.hostKeyLock.Unlock()
+		c.hostKey = key
+		return nil
+	}
+
 	go func() {
-		sshConn, sshChan, req, err = ssh.NewClientConn(c.conn, c.address, c.config.SSHConfig)
+		sshConn, sshChan, req, err = ssh.NewClientConn(c.conn, c.address, &sshConfig)
 		close(connectionEstablished)
 	}()
 
@@ -315,12 +541,90 @@ func (c *comm) reconnect() (err error) {
 	log.Printf("handshake complete!")
 	if sshConn != nil {
 		c.client = ssh.NewClient(sshConn, sshChan, req)
+		c.generation++
+
+		closed := make(chan struct{})
+		c.closed = closed
+		go func(client *ssh.Client) {
+			client.Wait()
+			close(closed)
+		}(c.client)
+
+		if c.config.KeepAliveInterval > 0 {
+			go c.keepAlive(c.client, closed)
+		}
 	}
 	c.connectToAgent()
 
 	return
 }
 
+// keepAlive sends keepalive requests on the connection of the client until
+// the connection is closed, which closes closed, so that idle connections
+// aren't dropped by firewalls and NATs. The connection is closed if the
+// server stops answering, so that the next session reconnects rather than
+// hanging.
+func (c *comm) keepAlive(client *ssh.Client, closed <-chan struct{}) {
+	countMax := c.config.KeepAliveCountMax
+	if countMax <= 0 {
+		countMax = 3
+	}
+
+	ticker := time.NewTicker(c.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	// Only one request is sent at a time, so a hanging one counts as
+	// unanswered on every tick until it returns.
+	replies := make(chan error, 1)
+	pending := false
+	missed := 0
+	for {
+		select {
+		case <-closed:
+			return
+		case err := <-replies:
+			pending = false
+			if err != nil {
+				log.Printf("[DEBUG] stopping keepalives: %s", err)
+				return
+			}
+
+			// Any reply, even a failure, means the server is there
+			missed = 0
+			continue
+		case <-ticker.C:
+		}
+
+		if pending {
+			missed++
+			if missed >= countMax {
+				log.Printf("[WARN] no reply to %d keepalives, closing the connection", missed)
+				client.Close()
+				return
+			}
+			continue
+		}
+
+		pending = true
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replies <- err
+		}()
+	}
+}
+
+// HostKey implements packer.HostKeyCommunicator.
+func (c *comm) HostKey() string {
+	c.hostKeyLock.Lock()
+	defer c.hostKeyLock.Unlock()
+
+	if c.hostKey == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(c.hostKey)))
+}
+
 func (c *comm) connectToAgent() {
 	if c.client == nil {
 		return
@@ -331,35 +635,31 @@ func (c *comm) connectToAgent() {
 		return
 	}
 
-	// open connection to the local agent
-	socketLocation := os.Getenv("SSH_AUTH_SOCK")
-	if socketLocation == "" {
-		log.Printf("[INFO] no local agent socket, will not connect agent")
-		return
-	}
-	agentConn, err := net.Dial("unix", socketLocation)
-	if err != nil {
-		log.Printf("[ERROR] could not connect to local agent socket: %s", socketLocation)
-		return
-	}
+	// The local agent is connected to once, and its keys are used to
+	// authenticate when reconnecting.
+	if c.agent == nil {
+		socketLocation := os.Getenv("SSH_AUTH_SOCK")
+		if socketLocation == "" {
+			log.Printf("[INFO] no local agent socket, will not connect agent")
+			return
+		}
+		agentConn, err := net.Dial("unix", socketLocation)
+		if err != nil {
+			log.Printf("[ERROR] could not connect to local agent socket: %s", socketLocation)
+			return
+		}
 
-	// create agent and add in auth
-	forwardingAgent := agent.NewClient(agentConn)
-	if forwardingAgent == nil {
-		log.Printf("[ERROR] Could not create agent client")
-		agentConn.Close()
-		return
+		c.agent = agent.NewClient(agentConn)
+		c.agentAuth = ssh.PublicKeysCallback(c.agent.Signers)
 	}
 
-	// add callback for forwarding agent to SSH config
-	// XXX - might want to handle reconnects appending multiple callbacks
-	auth := ssh.PublicKeysCallback(forwardingAgent.Signers)
-	c.config.SSHConfig.Auth = append(c.config.SSHConfig.Auth, auth)
-	agent.ForwardToAgent(c.client, forwardingAgent)
+	agent.ForwardToAgent(c.client, c.agent)
 
-	// Setup a session to request agent forwarding
-	session, err := c.newSession()
+	// Setup a session to request agent forwarding. The lock of the
+	// connection may be held here, so this can't use newSession.
+	session, err := c.client.NewSession()
 	if err != nil {
+		log.Printf("[ERROR] could not open a session for agent forwarding: %s", err)
 		return
 	}
 	defer session.Close()
@@ -901,3 +1201,106 @@ func scpUploadDir(root string, fs []os.FileInfo, w io.Writer, r *bufio.Reader) e
 
 	return nil
 }
+
+// countingReader counts the bytes read from the reader, so that an upload
+// can tell if it can be retried.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// rewinder returns a function to call before every attempt to upload. It
+// seeks the reader back to where the first attempt started, or returns
+// errNoRetry if that isn't possible.
+func (r *countingReader) rewinder() func() error {
+	seeker, canSeek := r.Reader.(io.Seeker)
+	var start int64
+	first := true
+	return func() error {
+		if first {
+			first = false
+			if canSeek {
+				offset, err := seeker.Seek(0, 1)
+				if err != nil {
+					canSeek = false
+				}
+				start = offset
+			}
+			return nil
+		}
+
+		if r.n == 0 {
+			return nil
+		}
+		if !canSeek {
+			return errNoRetry
+		}
+		if _, err := seeker.Seek(start, 0); err != nil {
+			return errNoRetry
+		}
+		r.n = 0
+		return nil
+	}
+}
+
+// truncater is implemented by outputs that can be truncated, like files.
+type truncater interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// countingWriter counts the bytes written to the writer, so that a
+// download can tell if it can be retried.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// rewinder returns a function to call before every attempt to download.
+// It truncates the writer back to where the first attempt started, or
+// returns errNoRetry if that isn't possible.
+func (w *countingWriter) rewinder() func() error {
+	t, canTruncate := w.Writer.(truncater)
+	var start int64
+	first := true
+	return func() error {
+		if first {
+			first = false
+			if canTruncate {
+				offset, err := t.Seek(0, 1)
+				if err != nil {
+					canTruncate = false
+				}
+				start = offset
+			}
+			return nil
+		}
+
+		if w.n == 0 {
+			return nil
+		}
+		if !canTruncate {
+			return errNoRetry
+		}
+		if err := t.Truncate(start); err != nil {
+			return errNoRetry
+		}
+		if _, err := t.Seek(start, 0); err != nil {
+			return errNoRetry
+		}
+		w.n = 0
+		return nil
+	}
+}
@@ -3,14 +3,21 @@
 package ssh
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/mitchellh/packer/packer"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 // private key for mock server
@@ -222,3 +229,553 @@ func TestHandshakeTimeout(t *testing.T) {
 		t.Fatalf("Expected handshake timeout, got: %s", err)
 	}
 }
+
+func TestHostKey(t *testing.T) {
+	var seen ssh.PublicKey
+	clientConfig := &ssh.ClientConfig{
+		User: "user",
+		Auth: []ssh.AuthMethod{
+			ssh.Password("pass"),
+		},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			seen = key
+			return nil
+		},
+	}
+
+	address := newMockLineServer(t)
+	conn := func() (net.Conn, error) {
+		return net.Dial("tcp", address)
+	}
+
+	config := &Config{
+		Connection: conn,
+		SSHConfig:  clientConfig,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	if seen == nil {
+		t.Fatal("the host key callback should be called")
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(testServerPrivateKey))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if actual := client.HostKey(); actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestHostKey_rejected(t *testing.T) {
+	clientConfig := &ssh.ClientConfig{
+		User: "user",
+		Auth: []ssh.AuthMethod{
+			ssh.Password("pass"),
+		},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return fmt.Errorf("rejected")
+		},
+	}
+
+	address := newMockLineServer(t)
+	conn := func() (net.Conn, error) {
+		return net.Dial("tcp", address)
+	}
+
+	config := &Config{
+		Connection: conn,
+		SSHConfig:  clientConfig,
+	}
+
+	if _, err := New(address, config); err == nil {
+		t.Fatal("should have had an error connecting")
+	}
+}
+
+// newMockExecServer starts a server that accepts any number of connections
+// and runs every command successfully. Global requests are only answered
+// if answerRequests is true.
+func newMockExecServer(t *testing.T, answerRequests bool) (string, chan ssh.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	conns := make(chan ssh.Conn, 10)
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			conn, chans, reqs, err := ssh.NewServerConn(c, serverConfig)
+			if err != nil {
+				t.Logf("Handshaking error: %v", err)
+				continue
+			}
+			conns <- conn
+
+			if answerRequests {
+				go ssh.DiscardRequests(reqs)
+			}
+			go func() {
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+
+					go func() {
+						defer channel.Close()
+						for req := range requests {
+							req.Reply(req.Type == "exec", nil)
+							if req.Type == "exec" {
+								channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+								return
+							}
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String(), conns
+}
+
+func TestReconnect(t *testing.T) {
+	address, conns := newMockExecServer(t, true)
+
+	var reconnects []ReconnectStats
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent: true,
+		Reconnected: func(stats ReconnectStats) {
+			reconnects = append(reconnects, stats)
+		},
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// The server drops the connection
+	(<-conns).Close()
+	time.Sleep(100 * time.Millisecond)
+
+	cmd := &packer.RemoteCmd{Command: "echo foo"}
+	if err := cmd.StartWithUi(client, &packer.BasicUi{Reader: new(bytes.Buffer), Writer: new(bytes.Buffer)}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cmd.ExitStatus != 0 {
+		t.Fatalf("bad: %d", cmd.ExitStatus)
+	}
+
+	if len(reconnects) != 1 {
+		t.Fatalf("bad: %#v", reconnects)
+	}
+	if reconnects[0].Reconnects != 1 || reconnects[0].Attempts != 1 {
+		t.Fatalf("bad: %#v", reconnects[0])
+	}
+}
+
+func TestReconnect_concurrent(t *testing.T) {
+	address, conns := newMockExecServer(t, true)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent: true,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	(<-conns).Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// All the sessions share the one new connection
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			session, err := client.newSession()
+			if err == nil {
+				session.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	<-conns
+	select {
+	case <-conns:
+		t.Fatal("should only reconnect once")
+	default:
+	}
+	if client.stats.Reconnects != 1 {
+		t.Fatalf("bad: %#v", client.stats)
+	}
+}
+
+func TestReconnect_timeout(t *testing.T) {
+	defer func(d time.Duration) { reconnectRetryInterval = d }(reconnectRetryInterval)
+	reconnectRetryInterval = 10 * time.Millisecond
+
+	address, conns := newMockExecServer(t, true)
+
+	attempts := 0
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			attempts++
+			if attempts > 1 && attempts < 4 {
+				return nil, fmt.Errorf("connection refused")
+			}
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent:     true,
+		ReconnectTimeout: time.Minute,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	(<-conns).Close()
+	time.Sleep(100 * time.Millisecond)
+
+	session, err := client.newSession()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	session.Close()
+
+	if client.stats.Attempts != 3 {
+		t.Fatalf("bad: %#v", client.stats)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	address, conns := newMockExecServer(t, false)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent:      true,
+		KeepAliveInterval: 10 * time.Millisecond,
+		KeepAliveCountMax: 2,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+	conn := <-conns
+
+	// The server never answers, so the connection is closed
+	done := make(chan error)
+	go func() {
+		done <- conn.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection should be closed")
+	}
+
+	// The next session reconnects
+	session, err := client.newSession()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	session.Close()
+}
+
+// newMockSCPServer starts a server that receives a file with scp, and sends
+// its contents on the returned channel. The server drops the first
+// connection once it received the contents.
+func newMockSCPServer(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	uploads := make(chan string, 10)
+	go func() {
+		defer l.Close()
+		for first := true; ; first = false {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			conn, chans, reqs, err := ssh.NewServerConn(c, serverConfig)
+			if err != nil {
+				t.Logf("Handshaking error: %v", err)
+				continue
+			}
+			go ssh.DiscardRequests(reqs)
+
+			go func(drop bool) {
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+
+					go func() {
+						defer channel.Close()
+						for req := range requests {
+							req.Reply(req.Type == "exec", nil)
+							if req.Type != "exec" {
+								continue
+							}
+
+							// Receive the file like scp -t
+							r := bufio.NewReader(channel)
+							var mode string
+							var size int64
+							line, _ := r.ReadString('\n')
+							fmt.Sscanf(line, "%6s %d ", &mode, &size)
+							channel.Write([]byte("\x00"))
+							data := make([]byte, size)
+							io.ReadFull(r, data)
+							if drop {
+								conn.Close()
+								return
+							}
+							r.ReadByte()
+							channel.Write([]byte("\x00"))
+							uploads <- string(data)
+
+							channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+							return
+						}
+					}()
+				}
+			}(first)
+		}
+	}()
+
+	return l.Addr().String(), uploads
+}
+
+func TestUpload_reconnect(t *testing.T) {
+	address, uploads := newMockSCPServer(t)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent: true,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// The upload is sent again after the first connection was dropped
+	fi := os.FileInfo(testFileInfo(3))
+	if err := client.Upload("/tmp/foo", bytes.NewReader([]byte("foo")), &fi); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := <-uploads; actual != "foo" {
+		t.Fatalf("bad: %q", actual)
+	}
+	if client.stats.Reconnects != 1 {
+		t.Fatalf("bad: %#v", client.stats)
+	}
+}
+
+func TestUpload_reconnectNotSeekable(t *testing.T) {
+	address, _ := newMockSCPServer(t)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent: true,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	// Input that was partly read already can't be sent again
+	fi := os.FileInfo(testFileInfo(3))
+	input := struct{ io.Reader }{strings.NewReader("foo")}
+	if err := client.Upload("/tmp/foo", input, &fi); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestReconnect_agentAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		keyring := agent.NewKeyring()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, c)
+		}
+	}()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", socket)
+
+	address, conns := newMockExecServer(t, true)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+	if client.agentAuth == nil {
+		t.Fatal("should use the agent")
+	}
+
+	for i := 0; i < 2; i++ {
+		(<-conns).Close()
+		time.Sleep(100 * time.Millisecond)
+
+		session, err := client.newSession()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		session.Close()
+	}
+
+	// The auth methods of the config aren't added to on reconnects
+	if len(config.SSHConfig.Auth) != 1 {
+		t.Fatalf("bad: %#v", config.SSHConfig.Auth)
+	}
+}
+
+func TestKeepAlive_closed(t *testing.T) {
+	address, conns := newMockExecServer(t, true)
+
+	config := &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig: &ssh.ClientConfig{
+			User: "user",
+			Auth: []ssh.AuthMethod{
+				ssh.Password("pass"),
+			},
+		},
+		DisableAgent:      true,
+		KeepAliveInterval: time.Hour,
+	}
+
+	client, err := New(address, config)
+	if err != nil {
+		t.Fatalf("error connecting to SSH: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.keepAlive(client.client, client.closed)
+		close(done)
+	}()
+
+	// The keepalives stop when the server drops the connection
+	(<-conns).Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the keepalives should stop")
+	}
+}
+
+// testFileInfo is the os.FileInfo of a regular file of the given size.
+type testFileInfo int64
+
+func (fi testFileInfo) Name() string       { return "foo" }
+func (fi testFileInfo) Size() int64        { return int64(fi) }
+func (fi testFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi testFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi testFileInfo) IsDir() bool        { return false }
+func (fi testFileInfo) Sys() interface{}   { return nil }
@@ -66,3 +66,137 @@ func (c *bastionConn) Close() error {
 	c.Conn.Close()
 	return c.Bastion.Close()
 }
+
+// Hop is an SSH server that connections are made through, like a bastion
+// host.
+type Hop struct {
+	// Address is the host and port of the server.
+	Address string
+
+	// Config is the configuration to connect to the server with.
+	Config *ssh.ClientConfig
+}
+
+// ChainDialer returns a function that connects to addresses through the
+// hops, in order. The first hop is reached with dial, or directly if it is
+// nil, and each hop after it through the one before it. Without hops, the
+// function is dial itself.
+func ChainDialer(
+	dial func(network, addr string) (net.Conn, error),
+	hops []Hop) func(network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = func(network, addr string) (net.Conn, error) {
+			return ConnectFunc(network, addr)()
+		}
+	}
+
+	if len(hops) == 0 {
+		return dial
+	}
+
+	return func(network, addr string) (net.Conn, error) {
+		c, err := dial("tcp", hops[0].Address)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Error connecting to bastion %s: %s", hops[0].Address, err)
+		}
+
+		var clients []*ssh.Client
+		closeAll := func() {
+			for i := len(clients) - 1; i >= 0; i-- {
+				clients[i].Close()
+			}
+		}
+
+		for i, hop := range hops {
+			client, err := hopClient(c, hop)
+			if err != nil {
+				c.Close()
+				closeAll()
+				return nil, fmt.Errorf(
+					"Error connecting to bastion %s: %s", hop.Address, err)
+			}
+			clients = append(clients, client)
+
+			nextNetwork, next := network, addr
+			if i < len(hops)-1 {
+				nextNetwork, next = "tcp", hops[i+1].Address
+			}
+
+			c, err = client.Dial(nextNetwork, next)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf(
+					"Error connecting to %s through bastion %s: %s",
+					next, hop.Address, err)
+			}
+		}
+
+		return &chainConn{Conn: c, clients: clients}, nil
+	}
+}
+
+// hopTimeout is how long the SSH handshake with a hop may take.
+var hopTimeout = 15 * time.Second
+
+// hopClient makes an SSH client of the connection to the hop. Deadlines
+// can't be set on the connections through the hops before it, so the
+// handshake is abandoned with a timer instead, for servers that accept
+// connections but never answer.
+func hopClient(c net.Conn, hop Hop) (*ssh.Client, error) {
+	type result struct {
+		client *ssh.Client
+		err    error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		sshConn, chans, reqs, err := ssh.NewClientConn(c, hop.Address, hop.Config)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		done <- result{client: ssh.NewClient(sshConn, chans, reqs)}
+	}()
+
+	timer := time.NewTimer(hopTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.client, r.err
+	case <-timer.C:
+		// Closing the connection ends the handshake
+		c.Close()
+		return nil, fmt.Errorf("timeout after %s", hopTimeout)
+	}
+}
+
+// ChainConnectFunc is a convenience method for returning a function that
+// connects to a host through the hops, as ChainDialer does.
+func ChainConnectFunc(
+	dial func(network, addr string) (net.Conn, error),
+	hops []Hop,
+	proto string,
+	addr string) func() (net.Conn, error) {
+	dialer := ChainDialer(dial, hops)
+	return func() (net.Conn, error) {
+		return dialer(proto, addr)
+	}
+}
+
+// chainConn is a connection through hops, which are closed with it.
+type chainConn struct {
+	net.Conn
+	clients []*ssh.Client
+}
+
+func (c *chainConn) Close() error {
+	err := c.Conn.Close()
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		c.clients[i].Close()
+	}
+
+	return err
+}
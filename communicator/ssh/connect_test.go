@@ -0,0 +1,314 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// mockJumpServer is an SSH server that forwards connections, like a
+// bastion host.
+type mockJumpServer struct {
+	Address string
+
+	l         sync.Mutex
+	forwarded []string
+	open      int
+}
+
+func (s *mockJumpServer) Forwarded() ([]string, int) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]string(nil), s.forwarded...), s.open
+}
+
+func newMockJumpServer(t *testing.T, user string) *mockJumpServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == "pass" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %q", c.User())
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	s := &mockJumpServer{Address: l.Addr().String()}
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(t, c, config)
+		}
+	}()
+
+	return s
+}
+
+func (s *mockJumpServer) serve(t *testing.T, c net.Conn, config *ssh.ServerConfig) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		t.Logf("Handshaking error: %v", err)
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	s.l.Lock()
+	s.open++
+	s.l.Unlock()
+	defer func() {
+		s.l.Lock()
+		s.open--
+		s.l.Unlock()
+	}()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+			continue
+		}
+
+		var payload struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+
+		s.l.Lock()
+		s.forwarded = append(s.forwarded, addr)
+		s.l.Unlock()
+
+		go func() {
+			defer target.Close()
+			defer channel.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+// newMockEchoServer starts a server that sends back what it reads.
+func newMockEchoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func testHop(address, user string) Hop {
+	return Hop{
+		Address: address,
+		Config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		},
+	}
+}
+
+func TestChainConnectFunc(t *testing.T) {
+	first := newMockJumpServer(t, "first")
+	second := newMockJumpServer(t, "second")
+	target := newMockEchoServer(t)
+
+	var dialed []string
+	dial := func(network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return net.Dial(network, addr)
+	}
+
+	hops := []Hop{
+		testHop(first.Address, "first"),
+		testHop(second.Address, "second"),
+	}
+	c, err := ChainConnectFunc(dial, hops, "tcp", target)()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("bad: %s", buf)
+	}
+
+	if len(dialed) != 1 || dialed[0] != first.Address {
+		t.Fatalf("bad: %#v", dialed)
+	}
+	if forwarded, _ := first.Forwarded(); len(forwarded) != 1 || forwarded[0] != second.Address {
+		t.Fatalf("bad: %#v", forwarded)
+	}
+	if forwarded, _ := second.Forwarded(); len(forwarded) != 1 || forwarded[0] != target {
+		t.Fatalf("bad: %#v", forwarded)
+	}
+
+	// Closing the connection closes the connections to the hops
+	if err := c.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := 0; ; i++ {
+		_, open := first.Forwarded()
+		if open == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("bad: %d", open)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestChainConnectFunc_failed(t *testing.T) {
+	first := newMockJumpServer(t, "first")
+	second := newMockJumpServer(t, "second")
+
+	// The second hop rejects the credentials
+	hops := []Hop{
+		testHop(first.Address, "first"),
+		testHop(second.Address, "wrong"),
+	}
+	_, err := ChainConnectFunc(nil, hops, "tcp", newMockEchoServer(t))()
+	if err == nil {
+		t.Fatal("should fail")
+	}
+	if !strings.Contains(err.Error(), second.Address) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestChainConnectFunc_timeout(t *testing.T) {
+	defer func(d time.Duration) { hopTimeout = d }(hopTimeout)
+	hopTimeout = 200 * time.Millisecond
+
+	first := newMockJumpServer(t, "first")
+
+	// The second hop accepts connections but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	hops := []Hop{
+		testHop(first.Address, "first"),
+		testHop(l.Addr().String(), "second"),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ChainConnectFunc(nil, hops, "tcp", newMockEchoServer(t))()
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("should fail")
+		}
+		if !strings.Contains(err.Error(), l.Addr().String()) {
+			t.Fatalf("bad: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("should time out")
+	}
+
+	// The connection to the first hop is closed
+	for i := 0; ; i++ {
+		_, open := first.Forwarded()
+		if open == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("bad: %d", open)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestChainDialer_noHops(t *testing.T) {
+	target := newMockEchoServer(t)
+
+	c, err := ChainDialer(nil, nil)("tcp", target)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c.Close()
+}
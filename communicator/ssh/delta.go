@@ -0,0 +1,495 @@
+package ssh
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/packer/packer"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// deltaFile is a file of a directory that is uploaded.
+type deltaFile struct {
+	// Path is the path of the file in the directory, with slashes.
+	Path string
+
+	// LocalPath is the path of the file on this machine.
+	LocalPath string
+
+	Info     os.FileInfo
+	Checksum string
+}
+
+// remoteFile is what is known about a file on the machine.
+type remoteFile struct {
+	Size     int64
+	ModTime  int64
+	Checksum string
+}
+
+// UploadDirDelta uploads the files of the directory that differ from the
+// ones on the machine. Listing the files on the machine needs find, and
+// sha256sum or shasum for checksums, or stat for modification times.
+// Without them all the files are uploaded. Compressing needs tar and gzip.
+func (c *comm) UploadDirDelta(dst string, src string, excl []string, opts *packer.UploadDirOptions) (*packer.UploadDirResult, error) {
+	if opts == nil {
+		opts = new(packer.UploadDirOptions)
+	}
+	log.Printf("Upload dir '%s' to '%s' (compare: %q, compress: %t)",
+		src, dst, opts.Compare, opts.Compress)
+
+	// The directory itself is created in the destination unless there is
+	// a trailing slash, as with UploadDir.
+	root := filepath.ToSlash(dst)
+	if !strings.HasSuffix(src, "/") {
+		root = path.Join(root, filepath.Base(src))
+	}
+
+	files, err := deltaFiles(src, excl, opts.Compare == "checksum")
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []deltaFile
+	switch opts.Compare {
+	case "":
+		changed = files
+	case "checksum", "mtime":
+		remote, err := c.remoteFiles(root, opts.Compare)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if deltaChanged(f, remote[f.Path], opts.Compare) {
+				changed = append(changed, f)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown comparison: %s", opts.Compare)
+	}
+
+	result := &packer.UploadDirResult{
+		Files:    len(files),
+		Uploaded: len(changed),
+	}
+	for _, f := range changed {
+		result.Bytes += f.Info.Size()
+	}
+
+	log.Printf("Uploading %d of %d files (%d bytes)",
+		result.Uploaded, result.Files, result.Bytes)
+	if len(changed) == 0 {
+		return result, nil
+	}
+
+	err = c.retryBroken("upload", func() error {
+		switch {
+		case opts.Compress:
+			return c.tarUploadFiles(root, changed)
+		case c.config.UseSftp:
+			return c.sftpUploadFiles(root, changed)
+		default:
+			return c.scpUploadFiles(root, changed)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// deltaChanged returns true if the file differs from the one on the
+// machine, which is nil if there isn't one.
+func deltaChanged(f deltaFile, remote *remoteFile, compare string) bool {
+	if remote == nil {
+		return true
+	}
+
+	if compare == "checksum" {
+		return f.Checksum != remote.Checksum
+	}
+
+	return f.Info.Size() != remote.Size || f.Info.ModTime().Unix() != remote.ModTime
+}
+
+// deltaFiles returns the files of the directory, in order, except the
+// excluded ones. Symlinks are followed, as UploadDir does.
+func deltaFiles(src string, excl []string, checksums bool) ([]deltaFile, error) {
+	var result []deltaFile
+	var walk func(localPath, rel string) error
+	walk = func(localPath, rel string) error {
+		entries, err := ioutil.ReadDir(localPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			p := path.Join(rel, entry.Name())
+			if deltaExcluded(p, excl) {
+				log.Printf("[DEBUG] Not uploading excluded '%s'", p)
+				continue
+			}
+
+			lp := filepath.Join(localPath, entry.Name())
+			fi, err := os.Stat(lp)
+			if err != nil {
+				return err
+			}
+
+			if fi.IsDir() {
+				if err := walk(lp, p); err != nil {
+					return err
+				}
+				continue
+			}
+
+			f := deltaFile{Path: p, LocalPath: lp, Info: fi}
+			if checksums {
+				if f.Checksum, err = fileChecksum(lp); err != nil {
+					return err
+				}
+			}
+			result = append(result, f)
+		}
+
+		return nil
+	}
+
+	if err := walk(src, ""); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// deltaExcluded returns true if the path, or its name, matches one of the
+// patterns.
+func deltaExcluded(p string, excl []string) bool {
+	for _, pattern := range excl {
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(p)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileChecksum returns the SHA-256 sum of the file, in hex.
+func fileChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteFiles returns the files in the directory on the machine, by their
+// paths in it. It is empty if the directory doesn't exist or the files
+// can't be listed.
+func (c *comm) remoteFiles(root string, compare string) (map[string]*remoteFile, error) {
+	script := "cd " + shellQuote(root) + " 2>/dev/null || exit 0\n"
+	if compare == "checksum" {
+		script += "if command -v sha256sum >/dev/null 2>&1; then " +
+			"find . -type f -exec sha256sum {} +; " +
+			"else find . -type f -exec shasum -a 256 {} +; fi\n"
+	} else {
+		script += "find . -type f -exec stat -c '%s %Y %n' {} + 2>/dev/null || " +
+			"find . -type f -exec stat -f '%z %m %N' {} +\n"
+	}
+
+	session, err := c.newSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	// Servers that only allow SFTP can't run the script either
+	result := make(map[string]*remoteFile)
+	if err := session.Run(script); err != nil {
+		log.Printf("[WARN] Can't list the files in '%s', uploading all of them: %s: %s",
+			root, err, stderr.String())
+		return result, nil
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var p string
+		f := new(remoteFile)
+		if compare == "checksum" {
+			// The name follows two spaces, or a space and a * in binary mode
+			if len(line) < 66 || line[64] != ' ' {
+				continue
+			}
+			f.Checksum, p = line[:64], line[66:]
+		} else {
+			parts := strings.SplitN(line, " ", 3)
+			if len(parts) != 3 {
+				continue
+			}
+
+			var err error
+			if f.Size, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+				continue
+			}
+			if f.ModTime, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+				continue
+			}
+			p = parts[2]
+		}
+
+		result[strings.TrimPrefix(p, "./")] = f
+	}
+
+	log.Printf("[DEBUG] %d files in '%s' on the machine", len(result), root)
+	return result, scanner.Err()
+}
+
+// deltaDirs returns the directories of the files, parents first.
+func deltaDirs(files []deltaFile) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, f := range files {
+		var dirs []string
+		for d := path.Dir(f.Path); d != "." && !seen[d]; d = path.Dir(d) {
+			seen[d] = true
+			dirs = append(dirs, d)
+		}
+
+		for i := len(dirs) - 1; i >= 0; i-- {
+			result = append(result, dirs[i])
+		}
+	}
+
+	return result
+}
+
+// tarUploadFiles sends the files to the directory on the machine as a
+// gzipped tar archive.
+func (c *comm) tarUploadFiles(root string, files []deltaFile) error {
+	session, err := c.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stderr := new(bytes.Buffer)
+	session.Stderr = stderr
+
+	cmd := fmt.Sprintf("mkdir -p %s && tar -xzf - -C %s", shellQuote(root), shellQuote(root))
+	log.Printf("Starting remote tar process: %s", cmd)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	writeErr := writeTarGz(stdin, files)
+	stdin.Close()
+
+	if err := session.Wait(); err != nil {
+		if exitErr, ok := err.(*ssh.ExitError); ok && exitErr.ExitStatus() == 127 {
+			return errors.New(
+				"tar failed to start. This usually means that tar or gzip is\n" +
+					"not installed on the remote system.")
+		}
+
+		return fmt.Errorf("Error extracting files: %s: %s", err, stderr.String())
+	}
+
+	return writeErr
+}
+
+// writeTarGz writes the files as a gzipped tar archive. The directories
+// aren't in it, tar creates the ones that are missing, so that the mode
+// and time of the directories that exist on the machine are kept.
+func writeTarGz(w io.Writer, files []deltaFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		// The time is truncated like stat does, since tar would round it
+		hdr := &tar.Header{
+			Name:     f.Path,
+			Mode:     int64(f.Info.Mode().Perm()),
+			Size:     f.Info.Size(),
+			ModTime:  f.Info.ModTime().Truncate(time.Second),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if err := copyFile(tw, f); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// copyFile writes the contents of the file, which must still be as big as
+// it was.
+func copyFile(w io.Writer, f deltaFile) error {
+	r, err := os.Open(f.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.CopyN(w, r, f.Info.Size())
+	return err
+}
+
+// scpUploadFiles uploads the files to the directory on the machine with
+// SCP, keeping their modification times.
+func (c *comm) scpUploadFiles(root string, files []deltaFile) error {
+	scpFunc := func(w io.Writer, r *bufio.Reader) error {
+		var stack []string
+		for _, f := range files {
+			dirs := strings.Split(path.Dir(f.Path), "/")
+			if dirs[0] == "." {
+				dirs = nil
+			}
+
+			// Leave the directories the file isn't in, and enter the ones
+			// it is in
+			common := 0
+			for common < len(stack) && common < len(dirs) && stack[common] == dirs[common] {
+				common++
+			}
+			for len(stack) > common {
+				fmt.Fprintln(w, "E")
+				if err := checkSCPStatus(r); err != nil {
+					return err
+				}
+				stack = stack[:len(stack)-1]
+			}
+			for _, d := range dirs[common:] {
+				fmt.Fprintln(w, "D0755 0", d)
+				if err := checkSCPStatus(r); err != nil {
+					return err
+				}
+				stack = append(stack, d)
+			}
+
+			mtime := f.Info.ModTime().Unix()
+			fmt.Fprintf(w, "T%d 0 %d 0\n", mtime, mtime)
+			if err := checkSCPStatus(r); err != nil {
+				return err
+			}
+
+			in, err := os.Open(f.LocalPath)
+			if err != nil {
+				return err
+			}
+			err = scpUploadFile(path.Base(f.Path), in, w, r, &f.Info)
+			in.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		for range stack {
+			fmt.Fprintln(w, "E")
+			if err := checkSCPStatus(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return c.scpSession(
+		fmt.Sprintf("mkdir -p %s && scp -prt %s", shellQuote(root), shellQuote(root)),
+		scpFunc)
+}
+
+// sftpUploadFiles uploads the files to the directory on the machine with
+// SFTP, keeping their modification times.
+func (c *comm) sftpUploadFiles(root string, files []deltaFile) error {
+	sftpFunc := func(client *sftp.Client) error {
+		// Create the directories, including the root and its parents
+		var dirs []string
+		for d := root; d != "/" && d != "."; d = path.Dir(d) {
+			dirs = append([]string{d}, dirs...)
+		}
+		for _, d := range deltaDirs(files) {
+			dirs = append(dirs, path.Join(root, d))
+		}
+		for _, d := range dirs {
+			if err := client.Mkdir(d); err != nil {
+				if fi, statErr := client.Stat(d); statErr != nil || !fi.IsDir() {
+					return err
+				}
+			}
+		}
+
+		for _, f := range files {
+			dst := path.Join(root, f.Path)
+			in, err := os.Open(f.LocalPath)
+			if err != nil {
+				return err
+			}
+			err = sftpUploadFile(dst, in, client, &f.Info)
+			in.Close()
+			if err != nil {
+				return err
+			}
+
+			if err := client.Chtimes(dst, f.Info.ModTime(), f.Info.ModTime()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return c.sftpSession(sftpFunc)
+}
+
+// shellQuote quotes the string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
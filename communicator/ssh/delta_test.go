@@ -0,0 +1,324 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/packer/packer"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// newMockShellServer starts an SSH server that runs the commands it gets
+// on this machine, and has an SFTP subsystem.
+func newMockShellServer(t *testing.T) string {
+	for _, name := range []string{"sh", "scp", "tar", "gzip", "find", "sha256sum", "stat"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s isn't available", name)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for connection: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				conn, chans, reqs, err := ssh.NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				go ssh.DiscardRequests(reqs)
+
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+
+					go serveMockShell(channel, requests)
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serveMockShell(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+
+			cmd := exec.Command("sh", "-c", payload.Command)
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			stdin, _ := cmd.StdinPipe()
+			go func() {
+				io.Copy(stdin, channel)
+				stdin.Close()
+			}()
+
+			status := 0
+			if err := cmd.Run(); err != nil {
+				status = 1
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					status = exitStatus(exitErr)
+				}
+			}
+
+			channel.SendRequest("exit-status", false,
+				ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		case "subsystem":
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel, channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func exitStatus(err *exec.ExitError) int {
+	if status, ok := err.Sys().(interface {
+		ExitStatus() int
+	}); ok {
+		return status.ExitStatus()
+	}
+
+	return 1
+}
+
+func testDeltaDir(t *testing.T) string {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	files := map[string]string{
+		"a.txt":            "a",
+		"sub/b.txt":        "bb",
+		"sub/deep/c.txt":   "ccc",
+		"sub/skip.log":     "log",
+		"with space/d.txt": "dddd",
+	}
+	old := time.Now().Add(-time.Hour)
+	for name, contents := range files {
+		p := filepath.Join(td, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0640); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	return td
+}
+
+func TestUploadDirDelta(t *testing.T) {
+	address := newMockShellServer(t)
+
+	for _, useSftp := range []bool{false, true} {
+		for _, compress := range []bool{false, true} {
+			for _, compare := range []string{"checksum", "mtime"} {
+				name := fmt.Sprintf("sftp=%t compress=%t compare=%s", useSftp, compress, compare)
+				testUploadDirDelta(t, name, address, useSftp, &packer.UploadDirOptions{
+					Compare:  compare,
+					Compress: compress,
+				})
+			}
+		}
+	}
+}
+
+func testUploadDirDelta(t *testing.T, name string, address string, useSftp bool, opts *packer.UploadDirOptions) {
+	src := testDeltaDir(t)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	c, err := New(address, &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig:    &ssh.ClientConfig{User: "user"},
+		DisableAgent: true,
+		UseSftp:      useSftp,
+	})
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+
+	upload := func(expected int) {
+		result, err := c.UploadDirDelta(dst, src, []string{"*.log"}, opts)
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if result.Files != 4 || result.Uploaded != expected {
+			t.Fatalf("%s: bad: %#v", name, result)
+		}
+	}
+
+	// Everything is uploaded the first time, and nothing the second
+	upload(4)
+	upload(0)
+
+	root := filepath.Join(dst, filepath.Base(src))
+	contents, err := ioutil.ReadFile(filepath.Join(root, "sub", "deep", "c.txt"))
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	if string(contents) != "ccc" {
+		t.Fatalf("%s: bad: %s", name, contents)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "skip.log")); !os.IsNotExist(err) {
+		t.Fatalf("%s: should exclude: %v", name, err)
+	}
+	fi, err := os.Stat(filepath.Join(root, "a.txt"))
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("%s: bad: %s", name, fi.Mode())
+	}
+
+	// The directories that exist on the machine are kept as they are
+	dir := filepath.Join(root, "with space")
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+
+	// A changed file is uploaded again
+	changed := filepath.Join(src, "with space", "d.txt")
+	if err := ioutil.WriteFile(changed, []byte("changed"), 0640); err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	upload(1)
+
+	contents, err = ioutil.ReadFile(filepath.Join(root, "with space", "d.txt"))
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	if string(contents) != "changed" {
+		t.Fatalf("%s: bad: %s", name, contents)
+	}
+	if opts.Compress {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if fi.Mode().Perm() != 0700 {
+			t.Fatalf("%s: bad: %s", name, fi.Mode())
+		}
+	}
+
+	// So is a file that was changed on the machine
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("b"), 0640); err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	upload(1)
+}
+
+func TestUploadDirDelta_all(t *testing.T) {
+	address := newMockShellServer(t)
+	src := testDeltaDir(t)
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dst)
+
+	c, err := New(address, &Config{
+		Connection: func() (net.Conn, error) {
+			return net.Dial("tcp", address)
+		},
+		SSHConfig:    &ssh.ClientConfig{User: "user"},
+		DisableAgent: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Without a comparison, the files are always uploaded, and the
+	// trailing slash uploads the contents of the directory
+	for i := 0; i < 2; i++ {
+		result, err := c.UploadDirDelta(dst, src+"/", nil, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if result.Files != 5 || result.Uploaded != 5 || result.Bytes != 13 {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "sub", "skip.log")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestDeltaExcluded(t *testing.T) {
+	cases := []struct {
+		Path     string
+		Patterns []string
+		Excluded bool
+	}{
+		{"a.txt", nil, false},
+		{"sub/skip.log", []string{"*.log"}, true},
+		{"sub/skip.log", []string{"sub/*"}, true},
+		{"sub", []string{"/sub/"}, true},
+		{"sub/skip.log", []string{"other/*"}, false},
+		{".git", []string{".git"}, true},
+	}
+	for _, tc := range cases {
+		if actual := deltaExcluded(tc.Path, tc.Patterns); actual != tc.Excluded {
+			t.Fatalf("%s %v: bad: %t", tc.Path, tc.Patterns, actual)
+		}
+	}
+}
@@ -38,8 +38,8 @@ func New(config *Config) (*Communicator, error) {
 	// Create the client
 	params := *winrm.DefaultParameters
 
-	if config.TransportDecorator != nil {
-		params.TransportDecorator = config.TransportDecorator
+	if decorator := config.transportDecorator(); decorator != nil {
+		params.TransportDecorator = decorator
 	}
 
 	params.Timeout = formatDuration(config.Timeout)
@@ -156,6 +156,6 @@ func (c *Communicator) newCopyClient() (*winrmcp.Winrmcp, error) {
 		Insecure:              c.config.Insecure,
 		OperationTimeout:      c.config.Timeout,
 		MaxOperationsPerShell: 15, // lowest common denominator
-		TransportDecorator:    c.config.TransportDecorator,
+		TransportDecorator:    c.config.transportDecorator(),
 	})
 }
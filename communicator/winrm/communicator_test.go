@@ -3,6 +3,9 @@ package winrm
 import (
 	"bytes"
 	"io"
+	"net"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -92,3 +95,57 @@ func TestUpload(t *testing.T) {
 		t.Fatalf("error uploading file: %s", err)
 	}
 }
+
+func TestDial(t *testing.T) {
+	wrm := newMockWinRMServer(t)
+	defer wrm.Close()
+
+	// The machine is only reachable through the dial function
+	var l sync.Mutex
+	var dialed []string
+	c, err := New(&Config{
+		Host:     "winrm.invalid",
+		Port:     wrm.Port,
+		Username: "user",
+		Password: "pass",
+		Timeout:  30 * time.Second,
+		Dial: func(network, addr string) (net.Conn, error) {
+			l.Lock()
+			dialed = append(dialed, addr)
+			l.Unlock()
+			return net.Dial(network, net.JoinHostPort(wrm.Host, strconv.Itoa(wrm.Port)))
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating communicator: %s", err)
+	}
+
+	var cmd packer.RemoteCmd
+	stdout := new(bytes.Buffer)
+	cmd.Command = "echo foo"
+	cmd.Stdout = stdout
+	if err := c.Start(&cmd); err != nil {
+		t.Fatalf("error executing remote command: %s", err)
+	}
+	cmd.Wait()
+	if stdout.String() != "foo" {
+		t.Fatalf("bad command response: expected %q, got %q", "foo", stdout.String())
+	}
+
+	err = c.Upload("C:/Temp/packer.cmd", bytes.NewReader([]byte("something")), nil)
+	if err != nil {
+		t.Fatalf("error uploading file: %s", err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if len(dialed) == 0 {
+		t.Fatal("should dial")
+	}
+	expected := net.JoinHostPort("winrm.invalid", strconv.Itoa(wrm.Port))
+	for _, addr := range dialed {
+		if addr != expected {
+			t.Fatalf("bad: %s", addr)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package winrm
 
 import (
+	"net"
 	"time"
 
 	"github.com/masterzen/winrm"
@@ -16,4 +17,9 @@ type Config struct {
 	Https              bool
 	Insecure           bool
 	TransportDecorator func() winrm.Transporter
+
+	// Dial, if set, makes the connections to the machine, for example
+	// through a proxy or SSH bastion hosts. It replaces the
+	// TransportDecorator.
+	Dial func(network, addr string) (net.Conn, error)
 }
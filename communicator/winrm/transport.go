@@ -0,0 +1,102 @@
+package winrm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/masterzen/winrm"
+	"github.com/masterzen/winrm/soap"
+)
+
+// transportDecorator returns the transport for the WinRM clients of the
+// configuration, or nil for the default one.
+func (c *Config) transportDecorator() func() winrm.Transporter {
+	if c.Dial == nil {
+		return c.TransportDecorator
+	}
+
+	return func() winrm.Transporter {
+		return &dialTransport{
+			dial:     c.Dial,
+			username: c.Username,
+			password: c.Password,
+		}
+	}
+}
+
+// dialTransport is a winrm.Transporter that makes its connections with a
+// dial function. The winrm package doesn't give the address and the
+// credentials of a client to other transports, so they are kept here.
+type dialTransport struct {
+	dial     func(network, addr string) (net.Conn, error)
+	username string
+	password string
+
+	url       string
+	transport http.RoundTripper
+}
+
+func (t *dialTransport) Transport(endpoint *winrm.Endpoint) error {
+	scheme := "http"
+	if endpoint.HTTPS {
+		scheme = "https"
+	}
+	t.url = fmt.Sprintf("%s://%s:%d/wsman", scheme, endpoint.Host, endpoint.Port)
+
+	transport := &http.Transport{
+		Dial: t.dial,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: endpoint.Insecure,
+		},
+		ResponseHeaderTimeout: endpoint.Timeout,
+	}
+
+	if len(endpoint.CACert) > 0 {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(endpoint.CACert) {
+			return fmt.Errorf("Unable to read certificates")
+		}
+
+		transport.TLSClientConfig.RootCAs = certPool
+	}
+
+	t.transport = transport
+	return nil
+}
+
+func (t *dialTransport) Post(client *winrm.Client, request *soap.SoapMessage) (string, error) {
+	httpClient := &http.Client{Transport: t.transport}
+
+	req, err := http.NewRequest("POST", t.url, strings.NewReader(request.String()))
+	if err != nil {
+		return "", fmt.Errorf("impossible to create http request %s", err)
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.SetBasicAuth(t.username, t.password)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unknown error %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("http response error: %d - %s", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("http error %d: %s", resp.StatusCode, body)
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/soap+xml") {
+		return "", fmt.Errorf("http response error: %d - invalid content type", resp.StatusCode)
+	}
+
+	return string(body), nil
+}
@@ -9,18 +9,24 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/kardianos/osext"
 	"github.com/mitchellh/packer/command"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/packer/plugin"
+	packrpc "github.com/mitchellh/packer/packer/rpc"
 )
 
 // PACKERSPACE is used to represent the spaces that separate args for a command
 // without being confused with spaces in the path to the command itself.
 const PACKERSPACE = "-PACKERSPACE-"
 
+// PACKERCOMPONENT separates the path to a plugin that serves several
+// components from the name of the component to use.
+const PACKERCOMPONENT = "-PACKERCOMPONENT-"
+
 type config struct {
 	DisableCheckpoint          bool `json:"disable_checkpoint"`
 	DisableCheckpointSignature bool `json:"disable_checkpoint_signature"`
@@ -30,6 +36,12 @@ type config struct {
 	Builders       map[string]string
 	PostProcessors map[string]string `json:"post-processors"`
 	Provisioners   map[string]string
+
+	// manifests caches the manifests of plugins that serve several
+	// components. pluginErrors are the errors reading the manifests of
+	// the plugins that couldn't be used, by the path of the plugin.
+	manifests    *pluginManifestCache
+	pluginErrors map[string]error
 }
 
 // Decodes configuration in JSON format from the given io.Reader into
@@ -53,6 +65,18 @@ func (c *config) Discover() error {
 		return nil
 	}
 
+	// The manifests of plugins are cached next to the plugins directory
+	var manifestsPath string
+	if dir, err := packer.ConfigDir(); err == nil {
+		manifestsPath = filepath.Join(dir, "plugin_manifests.json")
+	}
+	c.manifests = loadPluginManifestCache(manifestsPath)
+	defer func() {
+		if err := c.manifests.Save(); err != nil {
+			log.Printf("[WARN] Error saving plugin manifest cache: %s", err)
+		}
+	}()
+
 	// First, look in the same directory as the executable.
 	exePath, err := osext.Executable()
 	if err != nil {
@@ -94,7 +118,7 @@ func (c *config) LoadBuilder(name string) (packer.Builder, error) {
 	bin, ok := c.Builders[name]
 	if !ok {
 		log.Printf("Builder not found: %s\n", name)
-		return nil, nil
+		return nil, c.pluginsErr()
 	}
 
 	return c.pluginClient(bin).Builder()
@@ -114,7 +138,7 @@ func (c *config) LoadPostProcessor(name string) (packer.PostProcessor, error) {
 	bin, ok := c.PostProcessors[name]
 	if !ok {
 		log.Printf("Post-processor not found: %s", name)
-		return nil, nil
+		return nil, c.pluginsErr()
 	}
 
 	return c.pluginClient(bin).PostProcessor()
@@ -127,12 +151,90 @@ func (c *config) LoadProvisioner(name string) (packer.Provisioner, error) {
 	bin, ok := c.Provisioners[name]
 	if !ok {
 		log.Printf("Provisioner not found: %s\n", name)
-		return nil, nil
+		return nil, c.pluginsErr()
 	}
 
 	return c.pluginClient(bin).Provisioner()
 }
 
+// pluginsErr returns an error for a component that wasn't found if there
+// are plugins that couldn't be used, since one of them may serve it.
+func (c *config) pluginsErr() error {
+	if len(c.pluginErrors) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(c.pluginErrors))
+	for path := range c.pluginErrors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	errs := make([]string, len(paths))
+	for i, path := range paths {
+		errs[i] = fmt.Sprintf("%s: %s", path, c.pluginErrors[path])
+	}
+
+	return fmt.Errorf(
+		"not found, and plugins that may serve it can't be used: %s",
+		strings.Join(errs, "; "))
+}
+
+// Plugins returns the plugins that were discovered, sorted by type and
+// name, for the plugins command. Plugins that serve several components
+// and couldn't be used come first, with their error.
+func (c *config) Plugins() []*command.PluginInfo {
+	var result []*command.PluginInfo
+
+	paths := make([]string, 0, len(c.pluginErrors))
+	for path := range c.pluginErrors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		result = append(result, &command.PluginInfo{
+			Type: "plugin",
+			Name: pluginName(path, "packer-plugin-"),
+			Path: path,
+			Err:  c.pluginErrors[path],
+		})
+	}
+	for _, kind := range []struct {
+		Type    string
+		Plugins map[string]string
+	}{
+		{"builder", c.Builders},
+		{"post-processor", c.PostProcessors},
+		{"provisioner", c.Provisioners},
+	} {
+		names := make([]string, 0, len(kind.Plugins))
+		for name := range kind.Plugins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			path := kind.Plugins[name]
+			info := &command.PluginInfo{
+				Type: kind.Type,
+				Name: name,
+				Client: func() *plugin.Client {
+					return c.pluginClient(path)
+				},
+			}
+
+			// Internal plugins are run as "packer plugin NAME"
+			if !strings.Contains(path, PACKERSPACE) {
+				info.Path = strings.SplitN(path, PACKERCOMPONENT, 2)[0]
+			}
+
+			result = append(result, info)
+		}
+	}
+
+	return result
+}
+
 func (c *config) discover(path string) error {
 	var err error
 
@@ -143,6 +245,13 @@ func (c *config) discover(path string) error {
 		}
 	}
 
+	// Plugins that serve several components come first, so that plugins
+	// that serve just one in the same directory override them.
+	err = c.discoverMulti(filepath.Join(path, "packer-plugin-*"))
+	if err != nil {
+		return err
+	}
+
 	err = c.discoverSingle(
 		filepath.Join(path, "packer-builder-*"), &c.Builders)
 	if err != nil {
@@ -188,13 +297,7 @@ func (c *config) discoverSingle(glob string, m *map[string]string) error {
 			continue
 		}
 
-		// If the filename has a ".", trim up to there
-		if idx := strings.Index(file, "."); idx >= 0 {
-			file = file[:idx]
-		}
-
-		// Look for foo-bar-baz. The plugin name is "baz"
-		plugin := file[len(prefix):]
+		plugin := pluginName(match, prefix)
 		log.Printf("[DEBUG] Discovered plugin: %s = %s", plugin, match)
 		(*m)[plugin] = match
 	}
@@ -202,6 +305,109 @@ func (c *config) discoverSingle(glob string, m *map[string]string) error {
 	return nil
 }
 
+// discoverMulti discovers plugins that serve several components. Each of
+// them is started to read the manifest of the components it serves,
+// unless the manifest is cached.
+func (c *config) discoverMulti(glob string) error {
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range []*map[string]string{
+		&c.Builders, &c.PostProcessors, &c.Provisioners} {
+		if *m == nil {
+			*m = make(map[string]string)
+		}
+	}
+
+	for _, match := range matches {
+		if runtime.GOOS == "windows" && strings.ToLower(filepath.Ext(match)) != ".exe" {
+			log.Printf(
+				"[DEBUG] Ignoring plugin match %s, no exe extension",
+				match)
+			continue
+		}
+
+		manifest, err := c.pluginManifest(match)
+		if err != nil {
+			// A broken plugin shouldn't break Packer, it is reported by
+			// the plugins command and when a template uses it.
+			log.Printf("[ERR] Error reading manifest of plugin %s: %s", match, err)
+			if c.pluginErrors == nil {
+				c.pluginErrors = make(map[string]error)
+			}
+			c.pluginErrors[match] = err
+			continue
+		}
+
+		for _, component := range manifest.Components {
+			var m map[string]string
+			switch component.Type {
+			case "builder":
+				m = c.Builders
+			case "post-processor":
+				m = c.PostProcessors
+			case "provisioner":
+				m = c.Provisioners
+			default:
+				continue
+			}
+
+			// A component without a name is named after the plugin
+			name, path := component.Name, match+PACKERCOMPONENT+component.Name
+			if name == "" {
+				name, path = pluginName(match, "packer-plugin-"), match
+			}
+
+			log.Printf("[DEBUG] Discovered plugin: %s = %s (%s)",
+				name, match, component.Type)
+			m[name] = path
+		}
+	}
+
+	return nil
+}
+
+// pluginManifest returns the manifest of the plugin at path, from the
+// cache if the plugin didn't change.
+func (c *config) pluginManifest(path string) (*packrpc.PluginManifest, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.manifests == nil {
+		c.manifests = loadPluginManifestCache("")
+	}
+	if manifest := c.manifests.Get(path, fi); manifest != nil {
+		log.Printf("[DEBUG] Using cached manifest of plugin %s", path)
+		return manifest, nil
+	}
+
+	manifest, err := readPluginManifest(c.pluginClient(path))
+	if err != nil {
+		return nil, err
+	}
+
+	c.manifests.Put(path, fi, manifest)
+	return manifest, nil
+}
+
+// pluginName returns the name of the plugin at path, which is the file
+// name after the prefix, without any extension.
+func pluginName(path, prefix string) string {
+	file := filepath.Base(path)
+
+	// If the filename has a ".", trim up to there
+	if idx := strings.Index(file, "."); idx >= 0 {
+		file = file[:idx]
+	}
+
+	// Look for foo-bar-baz. The plugin name is "baz"
+	return file[len(prefix):]
+}
+
 func (c *config) discoverInternal() error {
 	// Get the packer binary path
 	packerPath, err := osext.Executable()
@@ -243,6 +449,13 @@ func (c *config) discoverInternal() error {
 }
 
 func (c *config) pluginClient(path string) *plugin.Client {
+	// Plugins that serve several components are given with the component
+	var component string
+	if idx := strings.Index(path, PACKERCOMPONENT); idx >= 0 {
+		component = path[idx+len(PACKERCOMPONENT):]
+		path = path[:idx]
+	}
+
 	originalPath := path
 
 	// First attempt to find the executable by consulting the PATH.
@@ -280,5 +493,6 @@ func (c *config) pluginClient(path string) *plugin.Client {
 	config.Managed = true
 	config.MinPort = c.PluginMinPort
 	config.MaxPort = c.PluginMaxPort
+	config.Component = component
 	return plugin.NewClient(&config)
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	packrpc "github.com/mitchellh/packer/packer/rpc"
+)
+
+func TestConfigDiscover_hangingPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the plugin is a shell script")
+	}
+
+	defer func(old time.Duration) { pluginManifestTimeout = old }(pluginManifestTimeout)
+	pluginManifestTimeout = 200 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "packer-plugin-hang")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var c config
+	start := time.Now()
+	if err := c.discover(dir); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if time.Since(start) > 30*time.Second {
+		t.Fatal("discovery waited for the plugin")
+	}
+
+	if err := c.pluginErrors[path]; err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	_, err = c.LoadBuilder("missing")
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	plugins := c.Plugins()
+	if len(plugins) != 1 || plugins[0].Path != path || plugins[0].Err == nil {
+		t.Fatalf("bad: %#v", plugins)
+	}
+}
+
+func TestConfigLoadBuilder_notFound(t *testing.T) {
+	var c config
+	builder, err := c.LoadBuilder("missing")
+	if builder != nil || err != nil {
+		t.Fatalf("bad: %#v %v", builder, err)
+	}
+}
+
+func TestPluginManifestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	plugin := filepath.Join(dir, "packer-plugin-suite")
+	if err := ioutil.WriteFile(plugin, []byte("one"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(plugin)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	manifest := &packrpc.PluginManifest{
+		APIVersion: "4",
+		Components: []packrpc.PluginComponent{{Type: "builder", Name: "one"}},
+	}
+
+	path := filepath.Join(dir, "plugin_manifests.json")
+	c := loadPluginManifestCache(path)
+	if c.Get(plugin, fi) != nil {
+		t.Fatal("should not be cached")
+	}
+	c.Put(plugin, fi, manifest)
+	c.Put(filepath.Join(dir, "packer-plugin-removed"), fi, manifest)
+	if err := c.Save(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c = loadPluginManifestCache(path)
+	actual := c.Get(plugin, fi)
+	if actual == nil || len(actual.Components) != 1 || actual.Components[0].Name != "one" {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The plugin that wasn't seen is dropped
+	c = loadPluginManifestCache(path)
+	if len(c.entries) != 1 {
+		t.Fatalf("bad: %#v", c.entries)
+	}
+
+	// A changed plugin is started again
+	if err := ioutil.WriteFile(plugin, []byte("changed"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err = os.Stat(plugin)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Get(plugin, fi) != nil {
+		t.Fatal("should not use the manifest of a changed plugin")
+	}
+}
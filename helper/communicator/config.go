@@ -32,6 +32,20 @@ type Config struct {
 	SSHBastionPassword    string        `mapstructure:"ssh_bastion_password"`
 	SSHBastionPrivateKey  string        `mapstructure:"ssh_bastion_private_key_file"`
 	SSHFileTransferMethod string        `mapstructure:"ssh_file_transfer_method"`
+	SSHHostKey            string        `mapstructure:"ssh_host_key"`
+	SSHKnownHostsFile     string        `mapstructure:"ssh_known_hosts_file"`
+	SSHTrustOnFirstUse    bool          `mapstructure:"ssh_trust_on_first_use"`
+	SSHKeepAliveInterval  time.Duration `mapstructure:"ssh_keep_alive_interval"`
+	SSHReconnectTimeout   time.Duration `mapstructure:"ssh_reconnect_timeout"`
+
+	SSHAuthMethods                 []string `mapstructure:"ssh_auth_methods"`
+	SSHCertificateFile             string   `mapstructure:"ssh_certificate_file"`
+	SSHPrivateKeyPassphrase        string   `mapstructure:"ssh_private_key_passphrase"`
+	SSHBastionAuthMethods          []string `mapstructure:"ssh_bastion_auth_methods"`
+	SSHBastionCertificateFile      string   `mapstructure:"ssh_bastion_certificate_file"`
+	SSHBastionPrivateKeyPassphrase string   `mapstructure:"ssh_bastion_private_key_passphrase"`
+	SSHJumpHosts                   []string `mapstructure:"ssh_jump_hosts"`
+	SSHProxy                       string   `mapstructure:"ssh_proxy"`
 
 	// WinRM
 	WinRMUser               string        `mapstructure:"winrm_username"`
@@ -42,6 +56,9 @@ type Config struct {
 	WinRMUseSSL             bool          `mapstructure:"winrm_use_ssl"`
 	WinRMInsecure           bool          `mapstructure:"winrm_insecure"`
 	WinRMTransportDecorator func() winrm.Transporter
+
+	WinRMJumpHosts []string `mapstructure:"winrm_jump_hosts"`
+	WinRMProxy     string   `mapstructure:"winrm_proxy"`
 }
 
 // Port returns the port that will be used for access based on config.
@@ -129,14 +146,36 @@ func (c *Config) prepareSSH(ctx *interpolate.Context) []error {
 		c.SSHHandshakeAttempts = 10
 	}
 
-	if c.SSHBastionHost != "" {
-		if c.SSHBastionPort == 0 {
-			c.SSHBastionPort = 22
-		}
+	// Negative values turn these off
+	if c.SSHKeepAliveInterval == 0 {
+		c.SSHKeepAliveInterval = 5 * time.Second
+	} else if c.SSHKeepAliveInterval < 0 {
+		c.SSHKeepAliveInterval = 0
+	}
 
-		if c.SSHBastionPrivateKey == "" && c.SSHPrivateKey != "" {
-			c.SSHBastionPrivateKey = c.SSHPrivateKey
-		}
+	if c.SSHReconnectTimeout == 0 {
+		c.SSHReconnectTimeout = 5 * time.Minute
+	} else if c.SSHReconnectTimeout < 0 {
+		c.SSHReconnectTimeout = 0
+	}
+
+	if c.SSHBastionHost != "" && c.SSHBastionPort == 0 {
+		c.SSHBastionPort = 22
+	}
+
+	if len(c.SSHJumpHosts) > 0 && c.SSHBastionUsername == "" {
+		c.SSHBastionUsername = c.SSHUsername
+	}
+
+	if c.SSHBastionHost != "" || len(c.SSHJumpHosts) > 0 {
+		c.prepareSSHBastion()
+	}
+
+	// The builder chooses the methods, unless they need settings that
+	// only Packer knows about
+	if len(c.SSHAuthMethods) == 0 &&
+		(c.SSHCertificateFile != "" || c.SSHPrivateKeyPassphrase != "") {
+		c.SSHAuthMethods = defaultSSHAuthMethods(c.targetSSHAuth(nil), c.SSHAgentAuth)
 	}
 
 	if c.SSHFileTransferMethod == "" {
@@ -153,16 +192,56 @@ func (c *Config) prepareSSH(ctx *interpolate.Context) []error {
 		if _, err := os.Stat(c.SSHPrivateKey); err != nil {
 			errs = append(errs, fmt.Errorf(
 				"ssh_private_key_file is invalid: %s", err))
-		} else if _, err := SSHFileSigner(c.SSHPrivateKey); err != nil {
+		} else if _, err := sshFileSigner(c.SSHPrivateKey, c.SSHPrivateKeyPassphrase); err != nil {
 			errs = append(errs, fmt.Errorf(
 				"ssh_private_key_file is invalid: %s", err))
 		}
 	}
 
-	if c.SSHBastionHost != "" {
-		if c.SSHBastionPassword == "" && c.SSHBastionPrivateKey == "" {
+	errs = append(errs, validateSSHAuthMethods("ssh", c.targetSSHAuth(nil))...)
+	if es := validateSSHCertificate("ssh", c.targetSSHAuth(nil)); len(es) > 0 {
+		errs = append(errs, es...)
+	}
+
+	if c.SSHBastionHost != "" && len(c.SSHJumpHosts) > 0 {
+		errs = append(errs, errors.New(
+			"only one of ssh_bastion_host or ssh_jump_hosts can be specified"))
+	}
+
+	errs = append(errs, validateSSHJumpHosts(
+		"ssh_jump_hosts", c.SSHJumpHosts, c.SSHBastionUsername)...)
+	if c.SSHBastionHost != "" || len(c.SSHJumpHosts) > 0 {
+		errs = append(errs, c.validateSSHBastion()...)
+	}
+
+	if _, err := proxyDialer(c.SSHProxy); err != nil {
+		errs = append(errs, fmt.Errorf("ssh_proxy is invalid: %s", err))
+	}
+
+	if c.SSHHostKey != "" {
+		if err := validateSSHHostKey(c.SSHHostKey); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_host_key is invalid: %s", err))
+		}
+
+		if c.SSHKnownHostsFile != "" {
+			errs = append(errs, errors.New(
+				"only one of ssh_host_key or ssh_known_hosts_file can be specified"))
+		}
+
+		if c.SSHTrustOnFirstUse {
 			errs = append(errs, errors.New(
-				"ssh_bastion_password or ssh_bastion_private_key_file must be specified"))
+				"ssh_trust_on_first_use can't be used with ssh_host_key"))
+		}
+	}
+
+	if c.SSHKnownHostsFile != "" {
+		// The file is created when trusting on first use
+		if _, err := os.Stat(c.SSHKnownHostsFile); err != nil && !(os.IsNotExist(err) && c.SSHTrustOnFirstUse) {
+			errs = append(errs, fmt.Errorf(
+				"ssh_known_hosts_file is invalid: %s", err))
+		} else if err := validateKnownHostsFile(c.SSHKnownHostsFile); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"ssh_known_hosts_file is invalid: %s", err))
 		}
 	}
 
@@ -186,10 +265,71 @@ func (c *Config) prepareWinRM(ctx *interpolate.Context) []error {
 		c.WinRMTimeout = 30 * time.Minute
 	}
 
+	if len(c.WinRMJumpHosts) > 0 {
+		c.prepareSSHBastion()
+	}
+
 	var errs []error
 	if c.WinRMUser == "" {
 		errs = append(errs, errors.New("winrm_username must be specified."))
 	}
 
+	errs = append(errs, validateSSHJumpHosts(
+		"winrm_jump_hosts", c.WinRMJumpHosts, c.SSHBastionUsername)...)
+	if len(c.WinRMJumpHosts) > 0 {
+		errs = append(errs, c.validateSSHBastion()...)
+
+		if c.SSHKnownHostsFile != "" {
+			if err := validateKnownHostsFile(c.SSHKnownHostsFile); err != nil {
+				errs = append(errs, fmt.Errorf(
+					"ssh_known_hosts_file is invalid: %s", err))
+			}
+		}
+	}
+
+	if _, err := proxyDialer(c.WinRMProxy); err != nil {
+		errs = append(errs, fmt.Errorf("winrm_proxy is invalid: %s", err))
+	}
+
+	return errs
+}
+
+// prepareSSHBastion sets the defaults of the settings for the bastion
+// hosts.
+func (c *Config) prepareSSHBastion() {
+	if c.SSHBastionPrivateKey == "" && c.SSHPrivateKey != "" {
+		c.SSHBastionPrivateKey = c.SSHPrivateKey
+		if c.SSHBastionCertificateFile == "" {
+			c.SSHBastionCertificateFile = c.SSHCertificateFile
+		}
+		if c.SSHBastionPrivateKeyPassphrase == "" {
+			c.SSHBastionPrivateKeyPassphrase = c.SSHPrivateKeyPassphrase
+		}
+	}
+
+	// The methods are chosen like the ones of the builder otherwise
+	if len(c.SSHBastionAuthMethods) == 0 &&
+		(c.SSHBastionCertificateFile != "" || c.SSHBastionPrivateKeyPassphrase != "") {
+		c.SSHBastionAuthMethods = defaultSSHAuthMethods(
+			c.bastionSSHAuth(nil), !c.SSHDisableAgent)
+	}
+}
+
+// validateSSHBastion returns an error for each setting of the bastion
+// hosts that is invalid.
+func (c *Config) validateSSHBastion() []error {
+	var errs []error
+	if c.SSHBastionPassword == "" && c.SSHBastionPrivateKey == "" &&
+		len(c.SSHBastionAuthMethods) == 0 {
+		errs = append(errs, errors.New(
+			"ssh_bastion_password, ssh_bastion_private_key_file or "+
+				"ssh_bastion_auth_methods must be specified"))
+	}
+
+	errs = append(errs, validateSSHAuthMethods("ssh_bastion", c.bastionSSHAuth(nil))...)
+	if es := validateSSHCertificate("ssh_bastion", c.bastionSSHAuth(nil)); len(es) > 0 {
+		errs = append(errs, es...)
+	}
+
 	return errs
 }
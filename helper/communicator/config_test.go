@@ -2,6 +2,7 @@ package communicator
 
 import (
 	"testing"
+	"time"
 
 	"github.com/mitchellh/packer/template/interpolate"
 )
@@ -114,3 +115,77 @@ func TestConfig_winrm(t *testing.T) {
 func testContext(t *testing.T) *interpolate.Context {
 	return nil
 }
+
+func TestConfig_sshHostKey(t *testing.T) {
+	c := testConfig()
+	c.SSHHostKey = "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	c = testConfig()
+	c.SSHHostKey = "foo"
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	c = testConfig()
+	c.SSHHostKey = "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	c.SSHTrustOnFirstUse = true
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestConfig_sshKnownHostsFile(t *testing.T) {
+	c := testConfig()
+	c.SSHKnownHostsFile = "test-fixtures/known_hosts"
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	c = testConfig()
+	c.SSHKnownHostsFile = "test-fixtures/known_hosts"
+	c.SSHHostKey = "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	// The file must exist, unless the keys are trusted on first use
+	c = testConfig()
+	c.SSHKnownHostsFile = "test-fixtures/i-dont-exist"
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	c = testConfig()
+	c.SSHKnownHostsFile = "test-fixtures/i-dont-exist"
+	c.SSHTrustOnFirstUse = true
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestConfig_sshKeepAlive(t *testing.T) {
+	c := testConfig()
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if c.SSHKeepAliveInterval != 5*time.Second {
+		t.Fatalf("bad: %s", c.SSHKeepAliveInterval)
+	}
+	if c.SSHReconnectTimeout != 5*time.Minute {
+		t.Fatalf("bad: %s", c.SSHReconnectTimeout)
+	}
+
+	// Negative values turn them off
+	c = testConfig()
+	c.SSHKeepAliveInterval = -1
+	c.SSHReconnectTimeout = -1
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if c.SSHKeepAliveInterval != 0 || c.SSHReconnectTimeout != 0 {
+		t.Fatalf("bad: %#v", c)
+	}
+}
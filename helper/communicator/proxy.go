@@ -0,0 +1,243 @@
+package communicator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// proxyTimeout is how long connecting through a proxy can take, including
+// the handshake with the proxy.
+const proxyTimeout = 15 * time.Second
+
+// proxyDialer returns a function that connects to addresses through the
+// proxy at the URL, or nil if the URL is empty. The proxy is a SOCKS5
+// proxy (socks5://) or an HTTP proxy that supports CONNECT (http://), and
+// the URL can have a user name and password for it.
+func proxyDialer(rawURL string) (func(network, addr string) (net.Conn, error), error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("the proxy URL '%s' has no host", rawURL)
+	}
+
+	var port string
+	var dial func(c net.Conn, u *url.URL, addr string) (net.Conn, error)
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		port, dial = "1080", socks5Connect
+	case "http":
+		port, dial = "80", httpConnect
+	default:
+		return nil, fmt.Errorf(
+			"the proxy URL scheme '%s' isn't supported, valid schemes: socks5, http",
+			u.Scheme)
+	}
+
+	proxyAddr := u.Host
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil {
+		proxyAddr = net.JoinHostPort(proxyAddr, port)
+	}
+
+	return func(network, addr string) (net.Conn, error) {
+		c, err := net.DialTimeout("tcp", proxyAddr, proxyTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("Error connecting to proxy %s: %s", proxyAddr, err)
+		}
+
+		c.SetDeadline(time.Now().Add(proxyTimeout))
+		result, err := dial(c, u, addr)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf(
+				"Error connecting to %s through proxy %s: %s", addr, proxyAddr, err)
+		}
+		c.SetDeadline(time.Time{})
+
+		return result, nil
+	}, nil
+}
+
+// socks5Replies are the messages for the errors a SOCKS5 proxy can reply
+// with.
+var socks5Replies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 proxy on the connection to connect to the
+// address, as in RFC 1928. Host names are resolved by the proxy.
+func socks5Connect(c net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("bad port '%s'", portStr)
+	}
+
+	// Offer no authentication, or a user name and password if we have
+	// them, as in RFC 1929
+	methods := []byte{0}
+	if u.User != nil {
+		methods = append(methods, 2)
+	}
+	if _, err := c.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return nil, err
+	}
+	if buf[0] != 5 {
+		return nil, errors.New("it isn't a SOCKS5 proxy")
+	}
+
+	switch buf[1] {
+	case 0:
+	case 2:
+		if u.User == nil {
+			return nil, errors.New("the proxy needs a user name and password")
+		}
+
+		username := u.User.Username()
+		password, _ := u.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return nil, errors.New("the user name and password can be at most 255 bytes")
+		}
+
+		req := []byte{1, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := c.Write(req); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return nil, err
+		}
+		if buf[1] != 0 {
+			return nil, errors.New("the proxy rejected the user name and password")
+		}
+	default:
+		return nil, errors.New("the proxy doesn't support any offered authentication method")
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(req, 1)
+		req = append(req, ip.To4()...)
+	} else if ip != nil {
+		req = append(req, 4)
+		req = append(req, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("the host name '%s' is too long", host)
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		return nil, err
+	}
+	if reply[1] != 0 {
+		message, ok := socks5Replies[reply[1]]
+		if !ok {
+			message = fmt.Sprintf("unknown error %d", reply[1])
+		}
+		return nil, errors.New(message)
+	}
+
+	// Skip the address the proxy connected from
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(c, reply[:1]); err != nil {
+			return nil, err
+		}
+		skip = int(reply[0])
+	default:
+		return nil, fmt.Errorf("unknown address type %d", reply[3])
+	}
+	if _, err := io.ReadFull(c, make([]byte, skip+2)); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// httpConnect asks the HTTP proxy on the connection to connect to the
+// address with the CONNECT method.
+func httpConnect(c net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("the proxy replied %s", resp.Status)
+	}
+
+	// Servers such as SSH talk first, so the reader can already have
+	// some of what they sent.
+	return &bufferedConn{Conn: c, r: br}, nil
+}
+
+// bufferedConn is a connection that is read through a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,355 @@
+package communicator
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testProxy is a proxy server that records the addresses it connects to.
+type testProxy struct {
+	Address string
+
+	l         sync.Mutex
+	connected []string
+}
+
+func (p *testProxy) Connected() []string {
+	p.l.Lock()
+	defer p.l.Unlock()
+	return append([]string(nil), p.connected...)
+}
+
+func (p *testProxy) connect(c net.Conn, addr string) (net.Conn, error) {
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.l.Lock()
+	p.connected = append(p.connected, addr)
+	p.l.Unlock()
+
+	return target, nil
+}
+
+// testProxyServer starts a proxy server that handles each connection with
+// the function.
+func testProxyServer(t *testing.T, handle func(p *testProxy, c net.Conn)) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := &testProxy{Address: l.Addr().String()}
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go handle(p, c)
+		}
+	}()
+
+	return p
+}
+
+// pipe copies between the connections until either is closed.
+func pipe(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	go io.Copy(a, b)
+	io.Copy(b, a)
+}
+
+// testSOCKS5Server starts a SOCKS5 proxy that needs the user name and
+// password, if the user name isn't empty.
+func testSOCKS5Server(t *testing.T, username, password string) *testProxy {
+	return testProxyServer(t, func(p *testProxy, c net.Conn) {
+		buf := make([]byte, 262)
+		if _, err := io.ReadFull(c, buf[:2]); err != nil {
+			c.Close()
+			return
+		}
+		methods := buf[2 : 2+buf[1]]
+		if _, err := io.ReadFull(c, methods); err != nil {
+			c.Close()
+			return
+		}
+
+		method := byte(0)
+		if username != "" {
+			method = 0xff
+			for _, m := range methods {
+				if m == 2 {
+					method = 2
+				}
+			}
+		}
+		c.Write([]byte{5, method})
+
+		switch method {
+		case 0xff:
+			c.Close()
+			return
+		case 2:
+			io.ReadFull(c, buf[:2])
+			user := make([]byte, buf[1])
+			io.ReadFull(c, user)
+			io.ReadFull(c, buf[:1])
+			pass := make([]byte, buf[0])
+			io.ReadFull(c, pass)
+			if string(user) != username || string(pass) != password {
+				c.Write([]byte{1, 1})
+				c.Close()
+				return
+			}
+			c.Write([]byte{1, 0})
+		}
+
+		if _, err := io.ReadFull(c, buf[:4]); err != nil {
+			c.Close()
+			return
+		}
+
+		var host string
+		switch buf[3] {
+		case 1:
+			io.ReadFull(c, buf[:net.IPv4len])
+			host = net.IP(buf[:net.IPv4len]).String()
+		case 3:
+			io.ReadFull(c, buf[:1])
+			name := make([]byte, buf[0])
+			io.ReadFull(c, name)
+			host = string(name)
+		}
+		io.ReadFull(c, buf[:2])
+		port := binary.BigEndian.Uint16(buf[:2])
+
+		target, err := p.connect(c, net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			c.Close()
+			return
+		}
+
+		c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		pipe(c, target)
+	})
+}
+
+// testHTTPProxyServer starts an HTTP proxy that supports CONNECT and needs
+// the user name and password, if the user name isn't empty.
+func testHTTPProxyServer(t *testing.T, username, password string) *testProxy {
+	return testProxyServer(t, func(p *testProxy, c net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(c))
+		if err != nil || req.Method != "CONNECT" {
+			c.Close()
+			return
+		}
+
+		if username != "" {
+			expected := "Basic " + base64.StdEncoding.EncodeToString(
+				[]byte(username+":"+password))
+			if req.Header.Get("Proxy-Authorization") != expected {
+				io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+				c.Close()
+				return
+			}
+		}
+
+		target, err := p.connect(c, req.Host)
+		if err != nil {
+			io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			c.Close()
+			return
+		}
+
+		// Servers that talk first are sent to right after the reply
+		io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+		pipe(c, target)
+	})
+}
+
+// testEchoServer starts a server that greets and then sends back what it
+// reads, like servers that talk first.
+func testEchoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				io.WriteString(c, "hello\n")
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// testEcho checks that the connection is to an echo server.
+func testEcho(t *testing.T, c net.Conn) {
+	r := bufio.NewReader(c)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if line != "hello\n" {
+		t.Fatalf("bad: %q", line)
+	}
+
+	if _, err := io.WriteString(c, "ping\n"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	line, err = r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if line != "ping\n" {
+		t.Fatalf("bad: %q", line)
+	}
+}
+
+func TestProxyDialer(t *testing.T) {
+	target := testEchoServer(t)
+
+	cases := []struct {
+		Name  string
+		Proxy *testProxy
+		URL   func(p *testProxy) string
+		Valid bool
+	}{
+		{
+			"socks5",
+			testSOCKS5Server(t, "", ""),
+			func(p *testProxy) string { return "socks5://" + p.Address },
+			true,
+		},
+		{
+			"socks5 with password",
+			testSOCKS5Server(t, "user", "pass"),
+			func(p *testProxy) string { return "socks5://user:pass@" + p.Address },
+			true,
+		},
+		{
+			"socks5 with the wrong password",
+			testSOCKS5Server(t, "user", "pass"),
+			func(p *testProxy) string { return "socks5://user:wrong@" + p.Address },
+			false,
+		},
+		{
+			"socks5 without a password",
+			testSOCKS5Server(t, "user", "pass"),
+			func(p *testProxy) string { return "socks5://" + p.Address },
+			false,
+		},
+		{
+			"http",
+			testHTTPProxyServer(t, "", ""),
+			func(p *testProxy) string { return "http://" + p.Address },
+			true,
+		},
+		{
+			"http with password",
+			testHTTPProxyServer(t, "user", "pass"),
+			func(p *testProxy) string { return "http://user:pass@" + p.Address },
+			true,
+		},
+		{
+			"http with the wrong password",
+			testHTTPProxyServer(t, "user", "pass"),
+			func(p *testProxy) string { return "http://user:wrong@" + p.Address },
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		dial, err := proxyDialer(tc.URL(tc.Proxy))
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		c, err := dial("tcp", target)
+		if !tc.Valid {
+			if err == nil {
+				c.Close()
+				t.Fatalf("%s: should fail", tc.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		testEcho(t, c)
+		c.Close()
+
+		connected := tc.Proxy.Connected()
+		if len(connected) != 1 || connected[0] != target {
+			t.Fatalf("%s: bad: %#v", tc.Name, connected)
+		}
+	}
+}
+
+func TestProxyDialer_hostName(t *testing.T) {
+	target := testEchoServer(t)
+	_, port, _ := net.SplitHostPort(target)
+
+	// Host names are resolved by the proxy
+	p := testSOCKS5Server(t, "", "")
+	dial, err := proxyDialer("socks5://" + p.Address)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c, err := dial("tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer c.Close()
+	testEcho(t, c)
+
+	if connected := p.Connected(); len(connected) != 1 || !strings.HasPrefix(connected[0], "localhost:") {
+		t.Fatalf("bad: %#v", connected)
+	}
+}
+
+func TestProxyDialer_invalid(t *testing.T) {
+	cases := []string{
+		"socks4://proxy:1080",
+		"https://proxy:3128",
+		"proxy:3128",
+		"http://",
+		"http://proxy:%%",
+	}
+	for _, tc := range cases {
+		if _, err := proxyDialer(tc); err == nil {
+			t.Fatalf("%s: should be invalid", tc)
+		}
+	}
+
+	if dial, err := proxyDialer(""); dial != nil || err != nil {
+		t.Fatalf("bad: %v", err)
+	}
+}
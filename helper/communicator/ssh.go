@@ -11,6 +11,13 @@ import (
 
 // SSHFileSigner returns an ssh.Signer for a key file.
 func SSHFileSigner(path string) (ssh.Signer, error) {
+	return sshFileSigner(path, "")
+}
+
+// sshFileSigner returns an ssh.Signer for a key file that is encrypted
+// with the passphrase, if it isn't empty. Keys encrypted in the PEM and
+// the OpenSSH formats are supported.
+func sshFileSigner(path string, passphrase string) (ssh.Signer, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -23,19 +30,27 @@ func SSHFileSigner(path string) (ssh.Signer, error) {
 	}
 
 	// We parse the private key on our own first so that we can
-	// show a nicer error if the private key has a password.
+	// show a nicer error if the private key isn't there.
 	block, _ := pem.Decode(keyBytes)
 	if block == nil {
 		return nil, fmt.Errorf(
 			"Failed to read key '%s': no key found", path)
 	}
-	if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
-		return nil, fmt.Errorf(
-			"Failed to read key '%s': password protected keys are\n"+
-				"not supported. Please decrypt the key prior to use.", path)
-	}
 
 	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		if passphrase == "" {
+			return nil, fmt.Errorf(
+				"Failed to read key '%s': password protected keys need\n"+
+					"a passphrase to decrypt them.", path)
+		}
+
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Failed to decrypt key '%s': %s", path, err)
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Error setting up SSH config: %s", err)
 	}
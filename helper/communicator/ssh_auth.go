@@ -0,0 +1,319 @@
+package communicator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/mitchellh/packer/packer"
+	"github.com/xanzy/ssh-agent"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshAuthMethods are the names of the authentication methods that can be
+// in ssh_auth_methods.
+var sshAuthMethods = []string{"publickey", "agent", "password", "keyboard-interactive"}
+
+// sshAuth is the configuration to authenticate with an SSH server using
+// methods in an order that is configured.
+type sshAuth struct {
+	// Methods are the names of the methods to use, in order.
+	Methods []string
+
+	Password        string
+	PrivateKeyFile  string
+	Passphrase      string
+	CertificateFile string
+
+	// Ui asks the questions of keyboard-interactive authentication that
+	// the password doesn't answer.
+	Ui packer.Ui
+}
+
+// targetSSHAuth returns the authentication configuration for the machine.
+func (c *Config) targetSSHAuth(ui packer.Ui) *sshAuth {
+	return &sshAuth{
+		Methods:         c.SSHAuthMethods,
+		Password:        c.SSHPassword,
+		PrivateKeyFile:  c.SSHPrivateKey,
+		Passphrase:      c.SSHPrivateKeyPassphrase,
+		CertificateFile: c.SSHCertificateFile,
+		Ui:              ui,
+	}
+}
+
+// bastionSSHAuth returns the authentication configuration for the bastion
+// host.
+func (c *Config) bastionSSHAuth(ui packer.Ui) *sshAuth {
+	return &sshAuth{
+		Methods:         c.SSHBastionAuthMethods,
+		Password:        c.SSHBastionPassword,
+		PrivateKeyFile:  c.SSHBastionPrivateKey,
+		Passphrase:      c.SSHBastionPrivateKeyPassphrase,
+		CertificateFile: c.SSHBastionCertificateFile,
+		Ui:              ui,
+	}
+}
+
+// AuthMethods returns the methods for the configuration.
+//
+// The SSH client tries each method only once by its name, so the keys of
+// the "publickey" and "agent" methods are all offered by a single method,
+// in the place of the first of them.
+func (a *sshAuth) AuthMethods() ([]gossh.AuthMethod, error) {
+	var result []gossh.AuthMethod
+	var signers []gossh.Signer
+	publicKeys := false
+	for _, m := range a.Methods {
+		switch m {
+		case "publickey", "agent":
+			var s []gossh.Signer
+			var err error
+			if m == "publickey" {
+				s, err = a.fileSigners()
+			} else {
+				s, err = a.agentSigners()
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if !publicKeys {
+				publicKeys = true
+				result = append(result, gossh.PublicKeysCallback(func() ([]gossh.Signer, error) {
+					// This sees the keys of the methods after this one
+					return signers, nil
+				}))
+			}
+			signers = append(signers, s...)
+		case "password":
+			result = append(result, gossh.Password(a.Password))
+		case "keyboard-interactive":
+			result = append(result, gossh.KeyboardInteractive(a.challenge))
+		default:
+			return nil, fmt.Errorf("unknown SSH authentication method: %s", m)
+		}
+	}
+
+	return result, nil
+}
+
+// uses returns true if the method is one of the methods.
+func (a *sshAuth) uses(method string) bool {
+	for _, m := range a.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileSigners returns the keys of the private key file. If there is a
+// certificate, the key is offered with it first.
+func (a *sshAuth) fileSigners() ([]gossh.Signer, error) {
+	if a.PrivateKeyFile == "" {
+		return nil, nil
+	}
+
+	signer, err := sshFileSigner(a.PrivateKeyFile, a.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.CertificateFile == "" {
+		return []gossh.Signer{signer}, nil
+	}
+
+	certSigner, err := sshCertSigner(a.CertificateFile, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return []gossh.Signer{certSigner, signer}, nil
+}
+
+// agentSigners returns the keys of the SSH agent. Agents for hardware
+// keys often don't hold the certificates of their keys, so the certificate
+// is added to the key of the agent that it's for.
+func (a *sshAuth) agentSigners() ([]gossh.Signer, error) {
+	if !sshagent.Available() {
+		log.Println("[DEBUG] Not using the SSH agent, SSH_AUTH_SOCK isn't set.")
+		return nil, nil
+	}
+
+	agent, _, err := sshagent.New()
+	if err != nil {
+		log.Printf("[WARN] Not using the SSH agent: %s", err)
+		return nil, nil
+	}
+
+	signers, err := agent.Signers()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the keys of the SSH agent: %s", err)
+	}
+
+	if a.CertificateFile == "" {
+		return signers, nil
+	}
+
+	var result []gossh.Signer
+	for _, s := range signers {
+		if certSigner, err := sshCertSigner(a.CertificateFile, s); err == nil {
+			result = append(result, certSigner)
+		}
+	}
+
+	return append(result, signers...), nil
+}
+
+// challenge answers the questions of keyboard-interactive authentication.
+// Questions for a password get the password, if there is one, and the
+// others, such as for one-time codes, are asked through the Ui.
+func (a *sshAuth) challenge(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	log.Printf("Keyboard interactive challenge for %s: %s", user, instruction)
+
+	answers := make([]string, len(questions))
+	for i, q := range questions {
+		log.Printf("-- Question %d: %s", i+1, q)
+		if a.Password != "" && strings.Contains(strings.ToLower(q), "password") {
+			answers[i] = a.Password
+			continue
+		}
+
+		if a.Ui == nil {
+			return nil, fmt.Errorf("can't answer SSH question: %s", q)
+		}
+
+		prompt := q
+		if instruction != "" {
+			prompt = fmt.Sprintf("%s\n%s", instruction, q)
+		}
+
+		answer, err := a.Ui.Ask(prompt)
+		if err != nil {
+			return nil, err
+		}
+		answers[i] = answer
+	}
+
+	return answers, nil
+}
+
+// sshCertSigner returns a signer for the certificate in the file, which
+// must be for the key of the signer.
+func sshCertSigner(path string, signer gossh.Signer) (gossh.Signer, error) {
+	cert, err := readSSHCertificate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+		return nil, fmt.Errorf(
+			"The certificate in '%s' isn't for the private key.", path)
+	}
+
+	return gossh.NewCertSigner(cert, signer)
+}
+
+// readSSHCertificate reads a user certificate, such as the one that
+// ssh-keygen -s writes.
+func readSSHCertificate(path string) (*gossh.Certificate, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := gossh.ParseAuthorizedKey(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read certificate '%s': %s", path, err)
+	}
+
+	cert, ok := key.(*gossh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf(
+			"Failed to read certificate '%s': it's a public key, not a certificate", path)
+	}
+	if cert.CertType != gossh.UserCert {
+		return nil, fmt.Errorf(
+			"Failed to read certificate '%s': it's not a user certificate", path)
+	}
+
+	return cert, nil
+}
+
+// validateSSHAuthMethods returns an error for each method that is unknown
+// or can't be used with the settings.
+func validateSSHAuthMethods(prefix string, a *sshAuth) []error {
+	var errs []error
+	known := &sshAuth{Methods: sshAuthMethods}
+	for _, m := range a.Methods {
+		if !known.uses(m) {
+			errs = append(errs, fmt.Errorf(
+				"%s_auth_methods: unknown method '%s', valid methods: %s",
+				prefix, m, strings.Join(sshAuthMethods, ", ")))
+			continue
+		}
+
+		if m == "publickey" && a.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Errorf(
+				"%s_auth_methods: publickey needs a private key file", prefix))
+		}
+		if m == "password" && a.Password == "" {
+			errs = append(errs, fmt.Errorf(
+				"%s_auth_methods: password needs a password", prefix))
+		}
+	}
+
+	return errs
+}
+
+// validateSSHCertificate returns an error if the certificate can't be read
+// or used with the methods.
+func validateSSHCertificate(prefix string, a *sshAuth) []error {
+	if a.CertificateFile == "" {
+		return nil
+	}
+
+	var errs []error
+	cert, err := readSSHCertificate(a.CertificateFile)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s_certificate_file is invalid: %s", prefix, err))
+	}
+
+	if !a.uses("publickey") && !a.uses("agent") {
+		errs = append(errs, fmt.Errorf(
+			"%s_certificate_file needs the publickey or agent authentication method",
+			prefix))
+	}
+
+	// The certificate of an agent key can only be checked when connecting
+	if cert != nil && a.PrivateKeyFile != "" && !a.uses("agent") {
+		signer, err := sshFileSigner(a.PrivateKeyFile, a.Passphrase)
+		if err == nil && !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) {
+			errs = append(errs, fmt.Errorf(
+				"%s_certificate_file isn't for the private key", prefix))
+		}
+	}
+
+	return errs
+}
+
+// defaultSSHAuthMethods returns the methods to use when they aren't
+// configured, from the settings that are.
+func defaultSSHAuthMethods(a *sshAuth, agent bool) []string {
+	var result []string
+	if a.PrivateKeyFile != "" {
+		result = append(result, "publickey")
+	}
+	if agent {
+		result = append(result, "agent")
+	}
+	if a.Password != "" {
+		result = append(result, "password", "keyboard-interactive")
+	}
+
+	return result
+}
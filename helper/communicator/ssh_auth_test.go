@@ -0,0 +1,379 @@
+package communicator
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/packer/packer"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testSSHKeyFile writes a new private key to a file, encrypted with the
+// passphrase if it isn't empty.
+func testSSHKeyFile(t *testing.T, passphrase string) (string, gossh.Signer) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	block := &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}
+	if passphrase != "" {
+		block, err = x509.EncryptPEMBlock(
+			rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tf.Close()
+	if err := pem.Encode(tf, block); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return tf.Name(), signer
+}
+
+// testSSHCertificateFile writes a user certificate for the key, signed by
+// the CA, to a file.
+func testSSHCertificateFile(t *testing.T, key gossh.PublicKey, ca gossh.Signer) string {
+	cert := &gossh.Certificate{
+		Key:             key,
+		CertType:        gossh.UserCert,
+		KeyId:           "packer",
+		ValidPrincipals: []string{"packer"},
+		ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tf.Close()
+	if _, err := tf.Write(gossh.MarshalAuthorizedKey(cert)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return tf.Name()
+}
+
+// testSSHAuthServer starts a server that accepts certificates signed by
+// the CA, if there is one, or a keyboard-interactive one-time code, if
+// there is one, and returns its address.
+func testSSHAuthServer(t *testing.T, ca gossh.PublicKey, code string) string {
+	hostKeyFile, hostKey := testSSHKeyFile(t, "")
+	os.Remove(hostKeyFile)
+
+	checker := &gossh.CertChecker{
+		IsUserAuthority: func(auth gossh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.Marshal())
+		},
+	}
+
+	config := &gossh.ServerConfig{}
+	if ca != nil {
+		config.PublicKeyCallback = func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if _, ok := key.(*gossh.Certificate); !ok {
+				return nil, errors.New("only certificates are accepted")
+			}
+			return checker.Authenticate(conn, key)
+		}
+	}
+	if code != "" {
+		config.KeyboardInteractiveCallback = func(conn gossh.ConnMetadata, client gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+			answers, err := client("packer", "", []string{"Verification code:"}, []bool{true})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != code {
+				return nil, errors.New("wrong code")
+			}
+			return nil, nil
+		}
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				conn, chans, reqs, err := gossh.NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				go gossh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					newChannel.Reject(gossh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestSSHAuth_certificate(t *testing.T) {
+	caFile, ca := testSSHKeyFile(t, "")
+	os.Remove(caFile)
+	keyFile, key := testSSHKeyFile(t, "secret")
+	defer os.Remove(keyFile)
+	certFile := testSSHCertificateFile(t, key.PublicKey(), ca)
+	defer os.Remove(certFile)
+
+	address := testSSHAuthServer(t, ca.PublicKey(), "")
+
+	a := &sshAuth{
+		Methods:         []string{"password", "publickey"},
+		Password:        "password",
+		PrivateKeyFile:  keyFile,
+		Passphrase:      "secret",
+		CertificateFile: certFile,
+	}
+
+	auth, err := a.AuthMethods()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(auth) != 2 {
+		t.Fatalf("bad: %#v", auth)
+	}
+
+	client, err := gossh.Dial("tcp", address, &gossh.ClientConfig{
+		User:            "packer",
+		Auth:            auth,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client.Close()
+
+	// Without the certificate, the key isn't accepted
+	a.CertificateFile = ""
+	auth, err = a.AuthMethods()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = gossh.Dial("tcp", address, &gossh.ClientConfig{
+		User:            "packer",
+		Auth:            auth,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Fatal("should fail without the certificate")
+	}
+}
+
+func TestSSHAuth_keyboardInteractive(t *testing.T) {
+	address := testSSHAuthServer(t, nil, "123456")
+
+	ui := &packer.BasicUi{
+		Reader: bytes.NewBufferString("123456\n"),
+		Writer: new(bytes.Buffer),
+	}
+	a := &sshAuth{
+		Methods: []string{"keyboard-interactive"},
+		Ui:      ui,
+	}
+
+	auth, err := a.AuthMethods()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client, err := gossh.Dial("tcp", address, &gossh.ClientConfig{
+		User:            "packer",
+		Auth:            auth,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client.Close()
+}
+
+func TestSSHAuth_publicKeysOnce(t *testing.T) {
+	keyFile, _ := testSSHKeyFile(t, "")
+	defer os.Remove(keyFile)
+
+	a := &sshAuth{
+		Methods:        []string{"agent", "password", "publickey"},
+		Password:       "password",
+		PrivateKeyFile: keyFile,
+	}
+
+	auth, err := a.AuthMethods()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(auth) != 2 {
+		t.Fatalf("bad: %#v", auth)
+	}
+}
+
+func TestSSHAuth_challenge(t *testing.T) {
+	ui := &packer.BasicUi{
+		Reader: bytes.NewBufferString("654321\n"),
+		Writer: new(bytes.Buffer),
+	}
+	a := &sshAuth{Password: "secret", Ui: ui}
+
+	answers, err := a.challenge("packer", "", []string{"Password:", "Verification code:"}, []bool{false, true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(answers) != 2 || answers[0] != "secret" || answers[1] != "654321" {
+		t.Fatalf("bad: %#v", answers)
+	}
+
+	a.Ui = nil
+	if _, err := a.challenge("packer", "", []string{"Verification code:"}, []bool{true}); err == nil {
+		t.Fatal("should fail without a Ui")
+	}
+}
+
+func TestSSHFileSigner_passphrase(t *testing.T) {
+	keyFile, key := testSSHKeyFile(t, "secret")
+	defer os.Remove(keyFile)
+
+	if _, err := SSHFileSigner(keyFile); err == nil {
+		t.Fatal("should need the passphrase")
+	}
+	if _, err := sshFileSigner(keyFile, "wrong"); err == nil {
+		t.Fatal("should fail with the wrong passphrase")
+	}
+
+	signer, err := sshFileSigner(keyFile, "secret")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), key.PublicKey().Marshal()) {
+		t.Fatal("should be the same key")
+	}
+}
+
+func TestSSHFileSigner_openSSHPassphrase(t *testing.T) {
+	keyFile := filepath.Join("test-fixtures", "encrypted_openssh_key")
+
+	if _, err := SSHFileSigner(keyFile); err == nil {
+		t.Fatal("should need the passphrase")
+	}
+	if _, err := sshFileSigner(keyFile, "wrong"); err == nil {
+		t.Fatal("should fail with the wrong passphrase")
+	}
+
+	signer, err := sshFileSigner(keyFile, "secret")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(keyFile + ".pub")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	key, _, _, _, err := gossh.ParseAuthorizedKey(contents)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), key.Marshal()) {
+		t.Fatal("should be the same key")
+	}
+}
+
+func TestConfig_sshAuthMethods(t *testing.T) {
+	keyFile, key := testSSHKeyFile(t, "secret")
+	defer os.Remove(keyFile)
+	caFile, ca := testSSHKeyFile(t, "")
+	os.Remove(caFile)
+	certFile := testSSHCertificateFile(t, key.PublicKey(), ca)
+	defer os.Remove(certFile)
+
+	// The certificate and passphrase choose the methods
+	c := testConfig()
+	c.SSHPrivateKey = keyFile
+	c.SSHPrivateKeyPassphrase = "secret"
+	c.SSHCertificateFile = certFile
+	c.SSHBastionHost = "bastion"
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(c.SSHAuthMethods) != 1 || c.SSHAuthMethods[0] != "publickey" {
+		t.Fatalf("bad: %#v", c.SSHAuthMethods)
+	}
+	if c.SSHBastionCertificateFile != certFile || c.SSHBastionPrivateKeyPassphrase != "secret" {
+		t.Fatalf("bad: %#v", c)
+	}
+	if len(c.SSHBastionAuthMethods) != 2 {
+		t.Fatalf("bad: %#v", c.SSHBastionAuthMethods)
+	}
+
+	cases := []struct {
+		Methods []string
+		Errs    int
+	}{
+		{[]string{"keyboard-interactive"}, 1}, // the certificate isn't used
+		{[]string{"agent", "keyboard-interactive"}, 0},
+		{[]string{"publickey", "foo"}, 1},
+		{[]string{"publickey", "password"}, 1},
+	}
+	for _, tc := range cases {
+		c := testConfig()
+		c.SSHPrivateKey = keyFile
+		c.SSHPrivateKeyPassphrase = "secret"
+		c.SSHCertificateFile = certFile
+		c.SSHAuthMethods = tc.Methods
+		if err := c.Prepare(testContext(t)); len(err) != tc.Errs {
+			t.Fatalf("%#v: bad: %#v", tc.Methods, err)
+		}
+	}
+
+	// A certificate for another key
+	otherFile, other := testSSHKeyFile(t, "")
+	os.Remove(otherFile)
+	otherCertFile := testSSHCertificateFile(t, other.PublicKey(), ca)
+	defer os.Remove(otherCertFile)
+
+	c = testConfig()
+	c.SSHPrivateKey = keyFile
+	c.SSHPrivateKeyPassphrase = "secret"
+	c.SSHCertificateFile = otherCertFile
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
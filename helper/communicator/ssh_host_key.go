@@ -0,0 +1,230 @@
+package communicator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	commonssh "github.com/mitchellh/packer/common/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshHostKeyChecker verifies the host keys of the SSH servers that are
+// connected to. Its Check method is meant for ssh.ClientConfig.
+type sshHostKeyChecker struct {
+	// HostKey is the key the server must have, as a public key in the
+	// authorized_keys format or as a fingerprint.
+	HostKey string
+
+	// KnownHostsFile is the path of a known_hosts file with the keys
+	// of the servers.
+	KnownHostsFile string
+
+	// TrustOnFirstUse, if true, accepts the key of a server the first
+	// time it's seen. With a KnownHostsFile the key is added to the file,
+	// otherwise it's only trusted for the rest of the build.
+	TrustOnFirstUse bool
+
+	l      sync.Mutex
+	pinned ssh.PublicKey
+	err    error
+}
+
+// newSSHHostKeyChecker returns a checker for the host keys of the machine
+// with the settings in the configuration. The key that was seen on an
+// earlier connection in the build is trusted when trusting on first use.
+func newSSHHostKeyChecker(c *Config, pinned string) *sshHostKeyChecker {
+	result := &sshHostKeyChecker{
+		HostKey:         c.SSHHostKey,
+		KnownHostsFile:  c.SSHKnownHostsFile,
+		TrustOnFirstUse: c.SSHTrustOnFirstUse,
+	}
+
+	if pinned != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+		if err != nil {
+			log.Printf("[WARN] Ignoring the host key from earlier in the build: %s", err)
+		} else {
+			result.pinned = key
+		}
+	}
+
+	return result
+}
+
+// Check verifies the key of the server at the address.
+func (c *sshHostKeyChecker) Check(address string, remote net.Addr, key ssh.PublicKey) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	err := c.check(address, key)
+	if err != nil {
+		c.err = err
+	}
+
+	return err
+}
+
+// Err returns the error of the last key that was rejected, if any. Keys
+// that are rejected won't become valid by trying again, unlike most
+// errors when connecting.
+func (c *sshHostKeyChecker) Err() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.err
+}
+
+func (c *sshHostKeyChecker) check(address string, key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+	switch {
+	case c.HostKey != "":
+		if !sshHostKeyMatches(c.HostKey, key) {
+			return fmt.Errorf(
+				"The host key of %s (%s) doesn't match ssh_host_key.",
+				address, fingerprint)
+		}
+	case c.KnownHostsFile != "":
+		return c.checkKnownHosts(address, key)
+	case c.TrustOnFirstUse:
+		if c.pinned == nil {
+			log.Printf("[INFO] Trusting the host key of %s on first use: %s",
+				address, fingerprint)
+			c.pinned = key
+			return nil
+		}
+
+		if !bytes.Equal(c.pinned.Marshal(), key.Marshal()) {
+			return fmt.Errorf(
+				"The host key of %s changed during the build. It was %s and "+
+					"is now %s.",
+				address, ssh.FingerprintSHA256(c.pinned), fingerprint)
+		}
+	default:
+		log.Printf("[DEBUG] Not verifying the host key of %s: %s",
+			address, fingerprint)
+	}
+
+	return nil
+}
+
+func (c *sshHostKeyChecker) checkKnownHosts(address string, key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	contents, err := ioutil.ReadFile(c.KnownHostsFile)
+	if err != nil && !(os.IsNotExist(err) && c.TrustOnFirstUse) {
+		return fmt.Errorf("Error reading ssh_known_hosts_file: %s", err)
+	}
+
+	switch err := commonssh.CheckKnownHosts(contents, address, key); err {
+	case nil:
+		return nil
+	case commonssh.ErrHostKeyRevoked:
+		return fmt.Errorf(
+			"The host key of %s (%s) is revoked in %s.",
+			address, fingerprint, c.KnownHostsFile)
+	case commonssh.ErrHostKeyChanged:
+		return fmt.Errorf(
+			"The host key of %s (%s) doesn't match the keys for it in %s. "+
+				"If the key of the machine changed, remove the old one from the file.",
+			address, fingerprint, c.KnownHostsFile)
+	case commonssh.ErrHostKeyUnknown:
+		if !c.TrustOnFirstUse {
+			return fmt.Errorf(
+				"There is no host key for %s in %s.", address, c.KnownHostsFile)
+		}
+	default:
+		return fmt.Errorf("Error reading ssh_known_hosts_file: %s", err)
+	}
+
+	log.Printf("[INFO] Adding the host key of %s to %s: %s",
+		address, c.KnownHostsFile, fingerprint)
+	f, err := os.OpenFile(
+		c.KnownHostsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Error adding host key to ssh_known_hosts_file: %s", err)
+	}
+	defer f.Close()
+
+	line := fmt.Sprintf("%s %s", commonssh.KnownHostsName(address), ssh.MarshalAuthorizedKey(key))
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("Error adding host key to ssh_known_hosts_file: %s", err)
+	}
+
+	return nil
+}
+
+// sshHostKeyMatches returns true if the key is the host key, which is a
+// public key in the authorized_keys format, or a SHA256 or MD5 fingerprint
+// as shown by ssh-keygen -l.
+func sshHostKeyMatches(hostKey string, key ssh.PublicKey) bool {
+	hostKey = strings.TrimSpace(hostKey)
+	switch {
+	case strings.HasPrefix(hostKey, "SHA256:"):
+		return strings.TrimRight(hostKey, "=") == ssh.FingerprintSHA256(key)
+	case strings.HasPrefix(hostKey, "MD5:"):
+		return strings.ToLower(hostKey[4:]) == ssh.FingerprintLegacyMD5(key)
+	}
+
+	expected, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(expected.Marshal(), key.Marshal())
+}
+
+// validateSSHHostKey returns an error if the host key isn't a public key
+// or fingerprint that sshHostKeyMatches understands.
+func validateSSHHostKey(hostKey string) error {
+	hostKey = strings.TrimSpace(hostKey)
+	switch {
+	case strings.HasPrefix(hostKey, "SHA256:"):
+		if _, err := base64.RawStdEncoding.DecodeString(
+			strings.TrimRight(hostKey[7:], "=")); err != nil {
+			return fmt.Errorf("bad SHA256 fingerprint: %s", err)
+		}
+		return nil
+	case strings.HasPrefix(hostKey, "MD5:"):
+		if len(strings.Split(hostKey[4:], ":")) != 16 {
+			return fmt.Errorf("bad MD5 fingerprint")
+		}
+		return nil
+	}
+
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey)); err != nil {
+		return fmt.Errorf(
+			"it must be a public key or a key fingerprint: %s", err)
+	}
+
+	return nil
+}
+
+// validateKnownHostsFile returns an error if the file isn't a valid
+// known_hosts file. A file that doesn't exist is valid.
+func validateKnownHostsFile(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for rest := contents; ; {
+		_, _, _, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rest = next
+	}
+}
@@ -0,0 +1,200 @@
+package communicator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return key
+}
+
+func testAuthorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func testKnownHostsFile(t *testing.T, contents string) string {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tf.Close()
+
+	if _, err := tf.WriteString(contents); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return tf.Name()
+}
+
+func TestSSHHostKeyChecker_hostKey(t *testing.T) {
+	key := testHostKey(t)
+	other := testHostKey(t)
+
+	cases := []string{
+		testAuthorizedKey(key),
+		testAuthorizedKey(key) + " root@example\n",
+		ssh.FingerprintSHA256(key),
+		"MD5:" + ssh.FingerprintLegacyMD5(key),
+	}
+	for _, tc := range cases {
+		if err := validateSSHHostKey(tc); err != nil {
+			t.Fatalf("%s: err: %s", tc, err)
+		}
+
+		c := &sshHostKeyChecker{HostKey: tc}
+		if err := c.Check("example.com:22", nil, key); err != nil {
+			t.Fatalf("%s: err: %s", tc, err)
+		}
+		if err := c.Check("example.com:22", nil, other); err == nil {
+			t.Fatalf("%s: should reject other keys", tc)
+		}
+		if c.Err() == nil {
+			t.Fatalf("%s: should record the error", tc)
+		}
+	}
+}
+
+func TestSSHHostKeyChecker_knownHosts(t *testing.T) {
+	key := testHostKey(t)
+	other := testHostKey(t)
+
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[10.0.0.5]:2222"))
+	hashed := fmt.Sprintf("|1|%s|%s",
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	path := testKnownHostsFile(t, fmt.Sprintf(
+		"# comment\n"+
+			"example.com,10.0.0.1 %s\n"+
+			"[example.com]:2222 %s\n"+
+			"%s %s\n"+
+			"*.example.org,!bad.example.org %s\n"+
+			"@revoked revoked.example.org %s\n",
+		testAuthorizedKey(other),
+		testAuthorizedKey(key),
+		hashed, testAuthorizedKey(key),
+		testAuthorizedKey(key),
+		testAuthorizedKey(key)))
+	defer os.Remove(path)
+
+	if err := validateKnownHostsFile(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Address string
+		Valid   bool
+	}{
+		{"example.com:2222", true},
+		{"10.0.0.5:2222", true},
+		{"host.example.org:22", true},
+		{"example.com:22", false},
+		{"10.0.0.1:22", false},
+		{"10.0.0.5:22", false},
+		{"bad.example.org:22", false},
+		{"revoked.example.org:22", false},
+		{"unknown.example.com:22", false},
+	}
+	for _, tc := range cases {
+		c := &sshHostKeyChecker{KnownHostsFile: path}
+		err := c.Check(tc.Address, nil, key)
+		if (err == nil) != tc.Valid {
+			t.Fatalf("%s: bad: %v", tc.Address, err)
+		}
+	}
+}
+
+func TestSSHHostKeyChecker_trustOnFirstUse(t *testing.T) {
+	key := testHostKey(t)
+	other := testHostKey(t)
+
+	c := &sshHostKeyChecker{TrustOnFirstUse: true}
+	if err := c.Check("example.com:22", nil, key); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Check("example.com:22", nil, key); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Check("example.com:22", nil, other); err == nil {
+		t.Fatal("should reject a changed key")
+	}
+
+	// The key from earlier in the build is trusted
+	c = newSSHHostKeyChecker(&Config{SSHTrustOnFirstUse: true}, testAuthorizedKey(key))
+	if err := c.Check("example.com:22", nil, other); err == nil {
+		t.Fatal("should reject a changed key")
+	}
+}
+
+func TestSSHHostKeyChecker_trustOnFirstUseKnownHosts(t *testing.T) {
+	key := testHostKey(t)
+	other := testHostKey(t)
+
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "known_hosts")
+
+	c := &sshHostKeyChecker{KnownHostsFile: path, TrustOnFirstUse: true}
+	if err := c.Check("example.com:2222", nil, key); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := fmt.Sprintf("[example.com]:2222 %s\n", testAuthorizedKey(key))
+	if string(contents) != expected {
+		t.Fatalf("bad: %s", contents)
+	}
+
+	// Known keys are never replaced
+	c = &sshHostKeyChecker{KnownHostsFile: path, TrustOnFirstUse: true}
+	if err := c.Check("example.com:2222", nil, key); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Check("example.com:2222", nil, other); err == nil {
+		t.Fatal("should reject a changed key")
+	}
+}
+
+func TestValidateSSHHostKey_invalid(t *testing.T) {
+	cases := []string{
+		"foo",
+		"ssh-rsa notbase64",
+		"MD5:aa:bb",
+	}
+	for _, tc := range cases {
+		if err := validateSSHHostKey(tc); err == nil {
+			t.Fatalf("%s: should be invalid", tc)
+		}
+	}
+}
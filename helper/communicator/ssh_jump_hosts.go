@@ -0,0 +1,133 @@
+package communicator
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/packer/communicator/ssh"
+	"github.com/mitchellh/packer/packer"
+)
+
+// parseSSHJumpHost parses a host of ssh_jump_hosts or winrm_jump_hosts,
+// which is [user@]host[:port], into the user, if any, and the address.
+func parseSSHJumpHost(s string) (string, string, error) {
+	var user string
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		user, s = s[:i], s[i+1:]
+	}
+
+	host, port := s, "22"
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host, port = h, p
+	} else if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		host = s[1 : len(s)-1]
+	}
+
+	if host == "" {
+		return "", "", fmt.Errorf("'%s' has no host", s)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", "", fmt.Errorf("'%s' has a bad port", s)
+	}
+
+	return user, net.JoinHostPort(host, port), nil
+}
+
+// validateSSHJumpHosts returns an error for each jump host that can't be
+// parsed or has no user to connect as.
+func validateSSHJumpHosts(name string, hosts []string, defaultUser string) []error {
+	var errs []error
+	for _, h := range hosts {
+		user, _, err := parseSSHJumpHost(h)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s is invalid: %s", name, err))
+			continue
+		}
+
+		if user == "" && defaultUser == "" {
+			errs = append(errs, fmt.Errorf(
+				"%s: '%s' has no user and ssh_bastion_username isn't set", name, h))
+		}
+	}
+
+	return errs
+}
+
+// sshHops returns the SSH servers that connections to the machine are made
+// through, in order, and the checkers of their host keys. The servers
+// authenticate with the bastion settings, and only a known_hosts file can
+// have their keys.
+func (c *Config) sshHops(ui packer.Ui) ([]ssh.Hop, []*sshHostKeyChecker, error) {
+	var hosts []string
+	switch c.Type {
+	case "ssh":
+		hosts = c.SSHJumpHosts
+		if c.SSHBastionHost != "" {
+			hosts = []string{net.JoinHostPort(
+				c.SSHBastionHost, strconv.Itoa(c.SSHBastionPort))}
+		}
+	case "winrm":
+		hosts = c.WinRMJumpHosts
+	}
+
+	if len(hosts) == 0 {
+		return nil, nil, nil
+	}
+
+	conf, err := sshBastionConfig(c, ui)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hops := make([]ssh.Hop, 0, len(hosts))
+	checkers := make([]*sshHostKeyChecker, 0, len(hosts))
+	for _, h := range hosts {
+		user, address, err := parseSSHJumpHost(h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Each host is trusted on first use separately
+		checker := &sshHostKeyChecker{
+			KnownHostsFile:  c.SSHKnownHostsFile,
+			TrustOnFirstUse: c.SSHTrustOnFirstUse,
+		}
+		checkers = append(checkers, checker)
+
+		hopConf := *conf
+		if user != "" {
+			hopConf.User = user
+		}
+		hopConf.HostKeyCallback = checker.Check
+
+		hops = append(hops, ssh.Hop{Address: address, Config: &hopConf})
+	}
+
+	return hops, checkers, nil
+}
+
+// sshHostKeyErr returns the first error of the checkers, if any.
+func sshHostKeyErr(checkers []*sshHostKeyChecker) error {
+	for _, c := range checkers {
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// proxy returns the function that connects to the machine, or to the
+// first jump host, through the proxy. It is nil without a proxy.
+func (c *Config) proxy() (func(network, addr string) (net.Conn, error), error) {
+	switch c.Type {
+	case "ssh":
+		return proxyDialer(c.SSHProxy)
+	case "winrm":
+		return proxyDialer(c.WinRMProxy)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,262 @@
+package communicator
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mitchellh/packer/communicator/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testSSHJumpServer starts an SSH server that forwards connections, like a
+// bastion host, for the user with the password "pass".
+func testSSHJumpServer(t *testing.T, user string) string {
+	hostKeyFile, hostKey := testSSHKeyFile(t, "")
+	os.Remove(hostKeyFile)
+
+	config := &gossh.ServerConfig{
+		PasswordCallback: func(c gossh.ConnMetadata, pass []byte) (*gossh.Permissions, error) {
+			if c.User() != user || string(pass) != "pass" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				conn, chans, reqs, err := gossh.NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				go gossh.DiscardRequests(reqs)
+
+				for newChannel := range chans {
+					var payload struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					if newChannel.ChannelType() != "direct-tcpip" ||
+						gossh.Unmarshal(newChannel.ExtraData(), &payload) != nil {
+						newChannel.Reject(gossh.Prohibited, "only direct-tcpip")
+						continue
+					}
+
+					target, err := net.Dial("tcp", net.JoinHostPort(
+						payload.Host, strconv.Itoa(int(payload.Port))))
+					if err != nil {
+						newChannel.Reject(gossh.ConnectionFailed, err.Error())
+						continue
+					}
+
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go gossh.DiscardRequests(requests)
+
+					go func() {
+						defer target.Close()
+						defer channel.Close()
+						go io.Copy(target, channel)
+						io.Copy(channel, target)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestParseSSHJumpHost(t *testing.T) {
+	cases := []struct {
+		Input   string
+		User    string
+		Address string
+	}{
+		{"bastion", "", "bastion:22"},
+		{"bastion:2222", "", "bastion:2222"},
+		{"admin@bastion", "admin", "bastion:22"},
+		{"admin@bastion:2222", "admin", "bastion:2222"},
+		{"me@example.com@bastion", "me@example.com", "bastion:22"},
+		{"[::1]", "", "[::1]:22"},
+		{"admin@[::1]:2222", "admin", "[::1]:2222"},
+	}
+	for _, tc := range cases {
+		user, address, err := parseSSHJumpHost(tc.Input)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if user != tc.User || address != tc.Address {
+			t.Fatalf("%s: bad: %s %s", tc.Input, user, address)
+		}
+	}
+
+	for _, tc := range []string{"", "admin@", "bastion:foo", "bastion:0"} {
+		if _, _, err := parseSSHJumpHost(tc); err == nil {
+			t.Fatalf("%s: should be invalid", tc)
+		}
+	}
+}
+
+func TestConfig_sshJumpHosts(t *testing.T) {
+	c := testConfig()
+	c.SSHJumpHosts = []string{"first", "admin@second:2222"}
+	c.SSHBastionPassword = "pass"
+	c.SSHProxy = "socks5://proxy"
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if c.SSHBastionUsername != c.SSHUsername {
+		t.Fatalf("bad: %s", c.SSHBastionUsername)
+	}
+
+	cases := []func(c *Config){
+		// No credentials
+		func(c *Config) { c.SSHBastionPassword = "" },
+		// Both kinds of bastions
+		func(c *Config) { c.SSHBastionHost = "bastion" },
+		// A bad host
+		func(c *Config) { c.SSHJumpHosts = []string{"first:foo"} },
+		// A bad proxy
+		func(c *Config) { c.SSHProxy = "socks4://proxy" },
+	}
+	for i, tc := range cases {
+		c := testConfig()
+		c.SSHJumpHosts = []string{"first", "admin@second:2222"}
+		c.SSHBastionPassword = "pass"
+		tc(c)
+		if err := c.Prepare(testContext(t)); len(err) != 1 {
+			t.Fatalf("%d: bad: %#v", i, err)
+		}
+	}
+}
+
+func TestConfig_winrmJumpHosts(t *testing.T) {
+	c := &Config{
+		Type:               "winrm",
+		WinRMUser:          "Administrator",
+		WinRMJumpHosts:     []string{"admin@first", "second"},
+		WinRMProxy:         "http://proxy:3128",
+		SSHBastionUsername: "admin",
+		SSHBastionPassword: "pass",
+	}
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	// The hosts need a user to connect as
+	c.SSHBastionUsername = ""
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	c.SSHBastionUsername = "admin"
+	c.WinRMProxy = "ftp://proxy"
+	if err := c.Prepare(testContext(t)); len(err) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestConfig_sshHops(t *testing.T) {
+	first := testSSHJumpServer(t, "first")
+	second := testSSHJumpServer(t, "second")
+	target := testEchoServer(t)
+	proxy := testSOCKS5Server(t, "user", "pass")
+
+	c := testConfig()
+	c.SSHJumpHosts = []string{"first@" + first, second}
+	c.SSHBastionUsername = "second"
+	c.SSHBastionPassword = "pass"
+	c.SSHDisableAgent = true
+	c.SSHTrustOnFirstUse = true
+	c.SSHProxy = "socks5://user:pass@" + proxy.Address
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	dial, err := c.proxy()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	hops, checkers, err := c.sshHops(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(hops) != 2 || len(checkers) != 2 {
+		t.Fatalf("bad: %#v", hops)
+	}
+
+	conn, err := ssh.ChainConnectFunc(dial, hops, "tcp", target)()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testEcho(t, conn)
+	conn.Close()
+
+	// Only the first host is connected to through the proxy
+	if connected := proxy.Connected(); len(connected) != 1 || connected[0] != first {
+		t.Fatalf("bad: %#v", connected)
+	}
+
+	// Each host's key was trusted on first use
+	for _, checker := range checkers {
+		if checker.pinned == nil {
+			t.Fatal("should trust the key")
+		}
+	}
+	if sshHostKeyErr(checkers) != nil {
+		t.Fatalf("err: %s", sshHostKeyErr(checkers))
+	}
+}
+
+func TestConfig_sshHopsHostKeys(t *testing.T) {
+	first := testSSHJumpServer(t, "first")
+
+	// The key of the host isn't in the file
+	path := testKnownHostsFile(t, "")
+	defer os.Remove(path)
+
+	c := testConfig()
+	c.SSHJumpHosts = []string{"first@" + first}
+	c.SSHBastionPassword = "pass"
+	c.SSHDisableAgent = true
+	c.SSHKnownHostsFile = path
+	if err := c.Prepare(testContext(t)); len(err) > 0 {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	hops, checkers, err := c.sshHops(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ssh.ChainConnectFunc(nil, hops, "tcp", testEchoServer(t))(); err == nil {
+		t.Fatal("should reject the host key")
+	}
+	if sshHostKeyErr(checkers) == nil {
+		t.Fatal("should record the error")
+	}
+}
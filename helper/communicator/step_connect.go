@@ -87,6 +87,12 @@ func (s *StepConnect) Run(state multistep.StateBag) multistep.StepAction {
 	return s.substep.Run(state)
 }
 
+// RerunOnResume always returns true since the connected communicator
+// can't be restored from a checkpoint.
+func (s *StepConnect) RerunOnResume() bool {
+	return true
+}
+
 func (s *StepConnect) Cleanup(state multistep.StateBag) {
 	if s.substep != nil {
 		s.substep.Cleanup(state)
@@ -4,8 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/multistep"
@@ -25,6 +26,9 @@ type StepConnectSSH struct {
 	Host      func(multistep.StateBag) (string, error)
 	SSHConfig func(multistep.StateBag) (*gossh.ClientConfig, error)
 	SSHPort   func(multistep.StateBag) (int, error)
+
+	l     sync.Mutex
+	stats ssh.ReconnectStats
 }
 
 func (s *StepConnectSSH) Run(state multistep.StateBag) multistep.StepAction {
@@ -57,6 +61,14 @@ WaitLoop:
 
 			ui.Say("Connected to SSH!")
 			state.Put("communicator", comm)
+
+			// Record the host key so later steps and provisioners can
+			// connect to the machine with strict host key checking.
+			if hk, ok := comm.(packer.HostKeyCommunicator); ok {
+				if key := hk.HostKey(); key != "" {
+					state.Put("ssh_host_key", key)
+				}
+			}
 			break WaitLoop
 		case <-timeout:
 			err := fmt.Errorf("Timeout waiting for SSH.")
@@ -78,29 +90,59 @@ WaitLoop:
 	return multistep.ActionContinue
 }
 
-func (s *StepConnectSSH) Cleanup(multistep.StateBag) {
+func (s *StepConnectSSH) Cleanup(state multistep.StateBag) {
+	s.l.Lock()
+	stats := s.stats
+	s.l.Unlock()
+
+	if stats.Reconnects == 0 {
+		return
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	ui.Say(fmt.Sprintf(
+		"SSH reconnected %d times during the build, and was down for %s in total.",
+		stats.Reconnects, stats.TotalDowntime))
+	ui.Machine("ssh-reconnects",
+		strconv.Itoa(stats.Reconnects),
+		strconv.FormatFloat(stats.TotalDowntime.Seconds(), 'f', -1, 64))
+}
+
+// reconnected reports that the SSH connection was established again.
+func (s *StepConnectSSH) reconnected(ui packer.Ui, stats ssh.ReconnectStats) {
+	s.l.Lock()
+	s.stats = stats
+	s.l.Unlock()
+
+	ui.Say(fmt.Sprintf(
+		"Reconnected to SSH after %s (%d attempts).",
+		stats.Downtime, stats.Attempts))
+	ui.Machine("ssh-reconnect",
+		strconv.Itoa(stats.Attempts),
+		strconv.FormatFloat(stats.Downtime.Seconds(), 'f', -1, 64))
 }
 
 func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan struct{}) (packer.Communicator, error) {
-	// Determine if we're using a bastion host, and if so, retrieve
-	// that configuration. This configuration doesn't change so we
-	// do this one before entering the retry loop.
-	var bProto, bAddr string
-	var bConf *gossh.ClientConfig
-	if s.Config.SSHBastionHost != "" {
-		// The protocol is hardcoded for now, but may be configurable one day
-		bProto = "tcp"
-		bAddr = fmt.Sprintf(
-			"%s:%d", s.Config.SSHBastionHost, s.Config.SSHBastionPort)
-
-		conf, err := sshBastionConfig(s.Config)
-		if err != nil {
-			log.Printf("[ERROR] Error calling sshBastionConfig: %v", err)
-			return nil, fmt.Errorf("Error configuring bastion: %s", err)
-		}
-		bConf = conf
+	ui := state.Get("ui").(packer.Ui)
+
+	// Determine if we're connecting through a proxy or bastion hosts, and
+	// if so, retrieve that configuration. This configuration doesn't
+	// change so we do this one before entering the retry loop.
+	proxy, err := s.Config.proxy()
+	if err != nil {
+		return nil, fmt.Errorf("Error configuring proxy: %s", err)
+	}
+
+	hops, bHostKeys, err := s.Config.sshHops(ui)
+	if err != nil {
+		log.Printf("[ERROR] Error configuring bastion hosts: %v", err)
+		return nil, fmt.Errorf("Error configuring bastion: %s", err)
 	}
 
+	// The key that was trusted on first use is kept for the whole build
+	pinned, _ := state.Get("ssh_host_key").(string)
+	hostKeys := newSSHHostKeyChecker(s.Config, pinned)
+
 	handshakeAttempts := 0
 
 	var comm packer.Communicator
@@ -133,26 +175,26 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 		}
 
 		// Retrieve the SSH configuration
-		sshConfig, err := s.SSHConfig(state)
+		sshConfig, err := s.sshConfig(state, ui)
 		if err != nil {
 			log.Printf("[DEBUG] Error getting SSH config: %s", err)
 			continue
 		}
+		if sshConfig.HostKeyCallback == nil {
+			sshConfig.HostKeyCallback = hostKeys.Check
+		}
 
-		// Attempt to connect to SSH port
-		var connFunc func() (net.Conn, error)
+		// Attempt to connect to SSH port, through the proxy and bastion
+		// hosts if there are any
 		address := fmt.Sprintf("%s:%d", host, port)
-		if bAddr != "" {
-			// We're using a bastion host, so use the bastion connfunc
-			connFunc = ssh.BastionConnectFunc(
-				bProto, bAddr, bConf, "tcp", address)
-		} else {
-			// No bastion host, connect directly
-			connFunc = ssh.ConnectFunc("tcp", address)
-		}
+		connFunc := ssh.ChainConnectFunc(proxy, hops, "tcp", address)
 
 		nc, err := connFunc()
 		if err != nil {
+			if err := sshHostKeyErr(bHostKeys); err != nil {
+				return nil, err
+			}
+
 			log.Printf("[DEBUG] TCP connection to SSH ip/port failed: %s", err)
 			continue
 		}
@@ -165,6 +207,12 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 			Pty:          s.Config.SSHPty,
 			DisableAgent: s.Config.SSHDisableAgent,
 			UseSftp:      s.Config.SSHFileTransferMethod == "sftp",
+
+			KeepAliveInterval: s.Config.SSHKeepAliveInterval,
+			ReconnectTimeout:  s.Config.SSHReconnectTimeout,
+			Reconnected: func(stats ssh.ReconnectStats) {
+				s.reconnected(ui, stats)
+			},
 		}
 
 		log.Println("[INFO] Attempting SSH connection...")
@@ -172,6 +220,11 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 		if err != nil {
 			log.Printf("[DEBUG] SSH handshake err: %s", err)
 
+			// Trying again doesn't help if the host key was rejected
+			if err := hostKeys.Err(); err != nil {
+				return nil, err
+			}
+
 			// Only count this as an attempt if we were able to attempt
 			// to authenticate. Note this is very brittle since it depends
 			// on the string of the error... but I don't see any other way.
@@ -197,7 +250,37 @@ func (s *StepConnectSSH) waitForSSH(state multistep.StateBag, cancel <-chan stru
 	return comm, nil
 }
 
-func sshBastionConfig(config *Config) (*gossh.ClientConfig, error) {
+// sshConfig returns the configuration for connecting to the machine. The
+// builder chooses how to authenticate, unless the methods are configured.
+func (s *StepConnectSSH) sshConfig(state multistep.StateBag, ui packer.Ui) (*gossh.ClientConfig, error) {
+	if len(s.Config.SSHAuthMethods) == 0 {
+		return s.SSHConfig(state)
+	}
+
+	auth, err := s.Config.targetSSHAuth(ui).AuthMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	return &gossh.ClientConfig{
+		User: s.Config.SSHUsername,
+		Auth: auth,
+	}, nil
+}
+
+func sshBastionConfig(config *Config, ui packer.Ui) (*gossh.ClientConfig, error) {
+	if len(config.SSHBastionAuthMethods) > 0 {
+		auth, err := config.bastionSSHAuth(ui).AuthMethods()
+		if err != nil {
+			return nil, err
+		}
+
+		return &gossh.ClientConfig{
+			User: config.SSHBastionUsername,
+			Auth: auth,
+		}, nil
+	}
+
 	var auth []gossh.AuthMethod
 
 	if !config.SSHDisableAgent {
@@ -135,7 +135,7 @@ func TestSSHBastionConfig(t *testing.T) {
 				defered := c.fn()
 				defer defered()
 			}
-			bConf, err := sshBastionConfig(c.in)
+			bConf, err := sshBastionConfig(c.in, nil)
 			if err != nil {
 				if err.Error() != c.errStr {
 					t.Errorf("want error %v, got %q", c.errStr, err)
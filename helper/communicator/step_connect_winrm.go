@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"time"
 
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/communicator/ssh"
 	"github.com/mitchellh/packer/communicator/winrm"
 	"github.com/mitchellh/packer/packer"
 )
@@ -82,6 +84,30 @@ func (s *StepConnectWinRM) Cleanup(multistep.StateBag) {
 }
 
 func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan struct{}) (packer.Communicator, error) {
+	ui := state.Get("ui").(packer.Ui)
+
+	// Connections through a proxy or SSH bastion hosts are made with a
+	// transport of our own, so they can't have the builder's.
+	proxy, err := s.Config.proxy()
+	if err != nil {
+		return nil, fmt.Errorf("Error configuring proxy: %s", err)
+	}
+
+	hops, bHostKeys, err := s.Config.sshHops(ui)
+	if err != nil {
+		return nil, fmt.Errorf("Error configuring bastion: %s", err)
+	}
+
+	var dial func(network, addr string) (net.Conn, error)
+	if proxy != nil || len(hops) > 0 {
+		if s.Config.WinRMTransportDecorator != nil {
+			return nil, errors.New(
+				"winrm_proxy and winrm_jump_hosts can't be used with this builder")
+		}
+
+		dial = ssh.ChainDialer(proxy, hops)
+	}
+
 	var comm packer.Communicator
 	for {
 		select {
@@ -133,9 +159,16 @@ func (s *StepConnectWinRM) waitForWinRM(state multistep.StateBag, cancel <-chan
 			Https:              s.Config.WinRMUseSSL,
 			Insecure:           s.Config.WinRMInsecure,
 			TransportDecorator: s.Config.WinRMTransportDecorator,
+			Dial:               dial,
 		})
 		if err != nil {
 			log.Printf("[ERROR] WinRM connection err: %s", err)
+
+			// Trying again doesn't help if a host key was rejected
+			if err := sshHostKeyErr(bHostKeys); err != nil {
+				return nil, err
+			}
+
 			continue
 		}
 
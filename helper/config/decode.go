@@ -46,6 +46,7 @@ func Decode(target interface{}, config *DecodeOpts, raws ...interface{}) error {
 			config.InterpolateContext.BuildType = ctx.BuildType
 			config.InterpolateContext.TemplatePath = ctx.TemplatePath
 			config.InterpolateContext.UserVariables = ctx.UserVariables
+			config.InterpolateContext.BuildArtifacts = ctx.BuildArtifacts
 		}
 		ctx = config.InterpolateContext
 
@@ -108,10 +109,11 @@ func Decode(target interface{}, config *DecodeOpts, raws ...interface{}) error {
 // detecting things like user variables from the raw configuration params.
 func DetectContext(raws ...interface{}) (*interpolate.Context, error) {
 	var s struct {
-		BuildName    string            `mapstructure:"packer_build_name"`
-		BuildType    string            `mapstructure:"packer_builder_type"`
-		TemplatePath string            `mapstructure:"packer_template_path"`
-		Vars         map[string]string `mapstructure:"packer_user_variables"`
+		BuildName      string                       `mapstructure:"packer_build_name"`
+		BuildType      string                       `mapstructure:"packer_builder_type"`
+		TemplatePath   string                       `mapstructure:"packer_template_path"`
+		Vars           map[string]string            `mapstructure:"packer_user_variables"`
+		BuildArtifacts map[string]map[string]string `mapstructure:"packer_build_artifacts"`
 	}
 
 	for _, r := range raws {
@@ -121,10 +123,11 @@ func DetectContext(raws ...interface{}) (*interpolate.Context, error) {
 	}
 
 	return &interpolate.Context{
-		BuildName:     s.BuildName,
-		BuildType:     s.BuildType,
-		TemplatePath:  s.TemplatePath,
-		UserVariables: s.Vars,
+		BuildName:      s.BuildName,
+		BuildType:      s.BuildType,
+		TemplatePath:   s.TemplatePath,
+		UserVariables:  s.Vars,
+		BuildArtifacts: s.BuildArtifacts,
 	}, nil
 }
 
@@ -51,6 +51,23 @@ func TestDecode(t *testing.T) {
 			nil,
 		},
 
+		"build artifacts": {
+			[]interface{}{
+				map[string]interface{}{
+					"name": "{{build `base` `id`}}",
+				},
+				map[string]interface{}{
+					"packer_build_artifacts": map[string]map[string]string{
+						"base": {"id": "image:1"},
+					},
+				},
+			},
+			&Target{
+				Name: "image:1",
+			},
+			nil,
+		},
+
 		"filter": {
 			[]interface{}{
 				map[string]interface{}{
@@ -0,0 +1,93 @@
+package kvflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/mitchellh/packer/template"
+	"github.com/mitchellh/packer/template/hcl"
+)
+
+// FlagFile is a flag.Value implementation for parsing user variables
+// from the command-line using variable files. The format is determined by
+// the extension of the file: ".yml" and ".yaml" files are YAML, ".hcl"
+// files are HCL and anything else is JSON. Values that aren't strings are
+// converted with template.VariableValue, and null values are empty.
+type FlagFile map[string]string
+
+func (v *FlagFile) String() string {
+	return ""
+}
+
+func (v *FlagFile) Set(raw string) error {
+	contents, err := ioutil.ReadFile(raw)
+	if err != nil {
+		return err
+	}
+
+	vars, err := parseVarFile(raw, contents)
+	if err != nil {
+		return fmt.Errorf(
+			"Error reading variables in '%s': %s", raw, err)
+	}
+
+	if *v == nil {
+		*v = make(map[string]string)
+	}
+
+	// Go through the keys in order so the errors are stable
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		// Null values have always been read as empty strings
+		if vars[k] == nil {
+			(*v)[k] = ""
+			continue
+		}
+
+		value, err := template.VariableValue(vars[k])
+		if err != nil {
+			return fmt.Errorf(
+				"Error reading variables in '%s': %s: %s", raw, k, err)
+		}
+
+		(*v)[k] = value
+	}
+
+	return nil
+}
+
+func parseVarFile(path string, contents []byte) (map[string]interface{}, error) {
+	var result interface{}
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		var err error
+		result, err = parseYAML(contents)
+		if err != nil {
+			return nil, err
+		}
+	case ".hcl":
+		return hcl.Decode(contents)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(contents))
+		dec.UseNumber()
+		if err := dec.Decode(&result); err != nil {
+			return nil, err
+		}
+	}
+
+	vars, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("variables must be a mapping of names to values")
+	}
+
+	return vars, nil
+}
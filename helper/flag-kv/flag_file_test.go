@@ -0,0 +1,89 @@
+package kvflag
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlagFile_impl(t *testing.T) {
+	var _ flag.Value = new(FlagFile)
+}
+
+func TestFlagFile(t *testing.T) {
+	cases := []struct {
+		Input   string
+		Initial map[string]string
+		Output  map[string]string
+		Error   bool
+	}{
+		{
+			"basic.json",
+			map[string]string{"foo": "bar"},
+			map[string]string{"foo": "bar", "key": "value"},
+			false,
+		},
+
+		{
+			"typed.json",
+			nil,
+			map[string]string{
+				"key":     "value",
+				"count":   "12345678901234567890",
+				"enabled": "true",
+				"tags":    `["a","b"]`,
+				"empty":   "",
+			},
+			false,
+		},
+
+		{
+			"typed.yml",
+			nil,
+			map[string]string{
+				"key":     "value",
+				"count":   "3",
+				"enabled": "true",
+				"tags":    `["a","b"]`,
+			},
+			false,
+		},
+
+		{
+			"typed.hcl",
+			nil,
+			map[string]string{
+				"key":     "value",
+				"count":   "3",
+				"enabled": "true",
+				"tags":    `["a","b"]`,
+			},
+			false,
+		},
+
+		{
+			"list.yml",
+			nil,
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		f := new(FlagFile)
+		if tc.Initial != nil {
+			f = (*FlagFile)(&tc.Initial)
+		}
+
+		err := f.Set(filepath.Join("./test-fixtures", tc.Input))
+		if (err != nil) != tc.Error {
+			t.Fatalf("bad error. Input: %#v\n\n%s", tc.Input, err)
+		}
+
+		actual := map[string]string(*f)
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("bad: %s: %#v", tc.Input, actual)
+		}
+	}
+}
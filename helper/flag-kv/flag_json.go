@@ -8,6 +8,8 @@ import (
 
 // FlagJSON is a flag.Value implementation for parsing user variables
 // from the command-line using JSON files.
+//
+// Deprecated: Use FlagFile, which reads JSON, YAML and HCL files.
 type FlagJSON map[string]string
 
 func (v *FlagJSON) String() string {
@@ -0,0 +1,4 @@
+key     = "value"
+count   = 3
+enabled = true
+tags    = ["a", "b"]
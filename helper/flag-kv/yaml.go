@@ -0,0 +1,59 @@
+package kvflag
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// parseYAML parses a YAML document into the same generic structure that
+// encoding/json produces, except that integers are ints. Duplicate keys
+// are an error.
+func parseYAML(src []byte) (interface{}, error) {
+	var result interface{}
+	if err := yaml.UnmarshalStrict(src, &result); err != nil {
+		return nil, err
+	}
+
+	return yamlValue(result)
+}
+
+// yamlValue converts the maps with interface{} keys that the YAML decoder
+// produces into maps with string keys.
+func yamlValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, raw := range v {
+			var key string
+			switch k := k.(type) {
+			case string:
+				key = k
+			case bool, int, float64:
+				key = fmt.Sprint(k)
+			default:
+				return nil, fmt.Errorf("unsupported key: %#v", k)
+			}
+
+			value, err := yamlValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+
+			result[key] = value
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, raw := range v {
+			var err error
+			result[i], err = yamlValue(raw)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
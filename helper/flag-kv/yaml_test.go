@@ -0,0 +1,112 @@
+package kvflag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	src := `
+# A comment
+string: hello world # trailing comment
+quoted: "a \"b\" # c"
+single: 'it''s'
+int: 42
+float: 1.5
+bool: false
+nothing: ~
+hex: 0x1F
+url: http://example.com/#anchor
+empty:
+flow: [a, "b, c", 3]
+flow_map: {a: 1, b: [x, z]}
+nested:
+  key: value
+  deeper:
+    list:
+      - one
+      - two
+same_indent_list:
+- a
+- b
+objects:
+  - name: foo
+    size: 1
+  - name: bar
+    size: 2
+literal: |
+  line one
+    line two
+
+folded: >-
+  folded
+  text
+
+  new paragraph
+`
+
+	actual, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"string":   "hello world",
+		"quoted":   `a "b" # c`,
+		"single":   "it's",
+		"int":      42,
+		"float":    1.5,
+		"bool":     false,
+		"nothing":  nil,
+		"hex":      31,
+		"url":      "http://example.com/#anchor",
+		"empty":    nil,
+		"flow":     []interface{}{"a", "b, c", 3},
+		"flow_map": map[string]interface{}{"a": 1, "b": []interface{}{"x", "z"}},
+		"nested": map[string]interface{}{
+			"key": "value",
+			"deeper": map[string]interface{}{
+				"list": []interface{}{"one", "two"},
+			},
+		},
+		"same_indent_list": []interface{}{"a", "b"},
+		"objects": []interface{}{
+			map[string]interface{}{"name": "foo", "size": 1},
+			map[string]interface{}{"name": "bar", "size": 2},
+		},
+		"literal": "line one\n  line two\n",
+		"folded":  "folded text\nnew paragraph",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad:\n\n%#v\n\n%#v", actual, expected)
+	}
+}
+
+func TestParseYAML_errors(t *testing.T) {
+	cases := []struct {
+		Src string
+		Err string
+	}{
+		{"a: 1\n  b: 2", "line 2"},
+		{"a: 1\na: 2", "already set"},
+		{"a: b: c", "mapping values are not allowed"},
+		{"a:\n\tb: 1", "cannot start any token"},
+		{"a: [1, 2", "did not find expected"},
+		{"a: \"foo", "found unexpected end of stream"},
+		{"a: *ref", "unknown anchor"},
+		{"? [a]\n: b", "invalid map key"},
+		{"~: b", "unsupported key"},
+	}
+
+	for _, tc := range cases {
+		_, err := parseYAML([]byte(tc.Src))
+		if err == nil {
+			t.Fatalf("%q: should error", tc.Src)
+		}
+		if !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%q: bad error: %s", tc.Src, err)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/mitchellh/cli"
 	"github.com/mitchellh/packer/command"
+	"github.com/mitchellh/packer/common/sensitive"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/packer/plugin"
 	"github.com/mitchellh/packer/version"
@@ -111,7 +112,9 @@ func wrappedMain() int {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 	}
 
-	log.SetOutput(os.Stderr)
+	// Sensitive values, such as secrets read by the template, never make
+	// it to the logs.
+	log.SetOutput(&sensitive.Writer{W: os.Stderr})
 
 	log.Printf("[INFO] Packer version: %s", version.FormattedVersion())
 	log.Printf("Packer Target OS/Arch: %s %s", runtime.GOOS, runtime.GOARCH)
@@ -147,6 +150,27 @@ func wrappedMain() int {
 	log.Printf("Setting cache directory: %s", cacheDir)
 	cache := &packer.FileCache{CacheDir: cacheDir}
 
+	if v := os.Getenv("PACKER_CACHE_SECONDARY_DIR"); v != "" {
+		cache.SecondaryDirs = filepath.SplitList(v)
+		log.Printf("Setting secondary cache directories: %v", cache.SecondaryDirs)
+	}
+
+	if v := os.Getenv("PACKER_CACHE_MAX_SIZE"); v != "" {
+		cache.MaxSize, err = packer.ParseByteSize(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing PACKER_CACHE_MAX_SIZE: %s\n", err)
+			return 1
+		}
+	}
+
+	if v := os.Getenv("PACKER_CACHE_MAX_AGE"); v != "" {
+		cache.MaxAge, err = time.ParseDuration(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing PACKER_CACHE_MAX_AGE: %s\n", err)
+			return 1
+		}
+	}
+
 	// Determine if we're in machine-readable mode by mucking around with
 	// the arguments...
 	args, machineReadable := extractMachineReadable(os.Args[1:])
@@ -183,9 +207,11 @@ func wrappedMain() int {
 			},
 			Version: version.Version,
 		},
-		Cache: cache,
-		Ui:    ui,
+		Cache:           cache,
+		Ui:              ui,
+		MachineReadable: machineReadable,
 	}
+	CommandPlugins = config.Plugins
 
 	//setupSignalHandlers(env)
 
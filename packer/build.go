@@ -1,9 +1,13 @@
 package packer
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -30,6 +34,15 @@ const (
 	// - "ask" - ask the user
 	OnErrorConfigKey = "packer_on_error"
 
+	// This is the key in configurations that is set to "true" when builds
+	// should checkpoint their progress and resume from a previous failure.
+	ResumeConfigKey = "packer_resume"
+
+	// This key contains a map[string]map[string]string with the values of
+	// the artifacts of the builds that this build depends on, keyed by
+	// build name. See ArtifactVariables.
+	BuildArtifactsConfigKey = "packer_build_artifacts"
+
 	// TemplatePathKey is the path to the template that configured this build
 	TemplatePathKey = "packer_template_path"
 
@@ -79,6 +92,42 @@ type Build interface {
 	// - "abort" - exit without cleanup
 	// - "ask" - ask the user
 	SetOnError(string)
+
+	// SetResume will enable/disable resuming builds. Builders that support
+	// it checkpoint their progress after each step, keep their resources
+	// around on failure and continue at the failed step on the next run.
+	SetResume(bool)
+
+	// SetBuildArtifacts sets the values of the artifacts of the builds
+	// that this build depends on, keyed by build name, as returned by
+	// ArtifactVariables. They are available to the configuration through
+	// the "build" template function. This must be called prior to
+	// Prepare.
+	SetBuildArtifacts(map[string]map[string]string)
+}
+
+// ArtifactVariables returns the values of the last artifact of a build,
+// which is the one from the end of the post-processor chains if there are
+// any, for the "build" template function of the builds that depend on it:
+//
+//	id         - The ID of the artifact
+//	builder_id - The ID of the builder or post-processor that made it
+//	files      - The files of the artifact, separated by commas
+//	string     - The description of the artifact
+//
+// The result is nil if the build didn't produce an artifact.
+func ArtifactVariables(artifacts []Artifact) map[string]string {
+	if len(artifacts) == 0 {
+		return nil
+	}
+
+	a := artifacts[len(artifacts)-1]
+	return map[string]string{
+		"id":         a.Id(),
+		"builder_id": a.BuilderId(),
+		"files":      strings.Join(a.Files(), ","),
+		"string":     a.String(),
+	}
 }
 
 // A build struct represents a single build job, the result of which should
@@ -95,12 +144,16 @@ type coreBuild struct {
 	provisioners   []coreBuildProvisioner
 	templatePath   string
 	variables      map[string]string
+	buildArtifacts map[string]map[string]string
+	retry          *RetryPolicy
 
 	debug         bool
 	force         bool
 	onError       string
+	resume        bool
 	l             sync.Mutex
 	prepareCalled bool
+	cancelCh      chan struct{}
 }
 
 // Keeps track of the post-processor and the configuration of the
@@ -115,8 +168,10 @@ type coreBuildPostProcessor struct {
 // Keeps track of the provisioner and the configuration of the provisioner
 // within the build.
 type coreBuildProvisioner struct {
-	provisioner Provisioner
-	config      []interface{}
+	provisioner     Provisioner
+	config          []interface{}
+	provisionerType string
+	retry           *RetryPolicy
 }
 
 // Returns the name of the build.
@@ -143,9 +198,13 @@ func (b *coreBuild) Prepare() (warn []string, err error) {
 		DebugConfigKey:         b.debug,
 		ForceConfigKey:         b.force,
 		OnErrorConfigKey:       b.onError,
+		ResumeConfigKey:        b.resume,
 		TemplatePathKey:        b.templatePath,
 		UserVariablesConfigKey: b.variables,
 	}
+	if b.buildArtifacts != nil {
+		packerConfig[BuildArtifactsConfigKey] = b.buildArtifacts
+	}
 
 	// Prepare the builder
 	warn, err = b.builder.Prepare(b.builderConfig, packerConfig)
@@ -178,12 +237,42 @@ func (b *coreBuild) Prepare() (warn []string, err error) {
 	return
 }
 
+// BuildSteps returns the names of the steps that the builder of the build
+// would take, in order, without running them. Prepare must be called
+// first. The result is nil if the builder can't describe its steps.
+func BuildSteps(b Build) ([]string, error) {
+	cb, ok := b.(*coreBuild)
+	if !ok {
+		return nil, nil
+	}
+
+	if !cb.prepareCalled {
+		panic("Prepare must be called first")
+	}
+
+	if p, ok := cb.builder.(BuilderPlanner); ok {
+		return p.Plan()
+	}
+
+	return nil, nil
+}
+
 // Runs the actual build. Prepare must be called prior to running this.
 func (b *coreBuild) Run(originalUi Ui, cache Cache) ([]Artifact, error) {
 	if !b.prepareCalled {
 		panic("Prepare must be called first")
 	}
 
+	// Builds can be run without a Ui, in which case the output is
+	// discarded
+	if originalUi == nil {
+		originalUi = &BasicUi{
+			Reader:      new(bytes.Buffer),
+			Writer:      ioutil.Discard,
+			ErrorWriter: ioutil.Discard,
+		}
+	}
+
 	// Copy the hooks
 	hooks := make(map[string][]Hook)
 	for hookName, hookList := range b.hooks {
@@ -194,8 +283,12 @@ func (b *coreBuild) Run(originalUi Ui, cache Cache) ([]Artifact, error) {
 	// Add a hook for the provisioners if we have provisioners
 	if len(b.provisioners) > 0 {
 		provisioners := make([]Provisioner, len(b.provisioners))
+		provisionerTypes := make([]string, len(b.provisioners))
+		retries := make([]*RetryPolicy, len(b.provisioners))
 		for i, p := range b.provisioners {
 			provisioners[i] = p.provisioner
+			provisionerTypes[i] = p.provisionerType
+			retries[i] = p.retry
 		}
 
 		if _, ok := hooks[HookProvision]; !ok {
@@ -203,7 +296,9 @@ func (b *coreBuild) Run(originalUi Ui, cache Cache) ([]Artifact, error) {
 		}
 
 		hooks[HookProvision] = append(hooks[HookProvision], &ProvisionHook{
-			Provisioners: provisioners,
+			Provisioners:     provisioners,
+			ProvisionerTypes: provisionerTypes,
+			Retries:          retries,
 		})
 	}
 
@@ -216,8 +311,20 @@ func (b *coreBuild) Run(originalUi Ui, cache Cache) ([]Artifact, error) {
 		Ui:     originalUi,
 	}
 
-	log.Printf("Running builder: %s", b.builderType)
-	builderArtifact, err := b.builder.Run(builderUi, hook, cache)
+	cancelCh := make(chan struct{})
+	b.l.Lock()
+	b.cancelCh = cancelCh
+	b.l.Unlock()
+
+	// The builder, which runs the provisioners, is run again if it fails
+	// and the build has a retry policy.
+	var builderArtifact Artifact
+	err := b.retry.Run(builderUi, fmt.Sprintf("Build '%s'", b.name), cancelCh, func() error {
+		log.Printf("Running builder: %s", b.builderType)
+		var err error
+		builderArtifact, err = b.builder.Run(builderUi, hook, cache)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -242,17 +349,27 @@ PostProcessorRunSeqLoop:
 			}
 
 			builderUi.Say(fmt.Sprintf("Running post-processor: %s", corePP.processorType))
+			builderUi.Machine("post-processor-start", corePP.processorType)
+			start := time.Now()
 			artifact, keep, err := corePP.processor.PostProcess(ppUi, priorArtifact)
+			duration := MachineDuration(time.Since(start))
 			if err != nil {
+				builderUi.Machine("post-processor-finish",
+					corePP.processorType, duration, "error", err.Error())
 				errors = append(errors, fmt.Errorf("Post-processor failed: %s", err))
 				continue PostProcessorRunSeqLoop
 			}
 
 			if artifact == nil {
+				builderUi.Machine("post-processor-finish",
+					corePP.processorType, duration, "success", "")
 				log.Println("Nil artifact, halting post-processor chain.")
 				continue PostProcessorRunSeqLoop
 			}
 
+			builderUi.Machine("post-processor-finish",
+				corePP.processorType, duration, "success", artifact.Id())
+
 			keep = keep || corePP.keepInputArtifact
 			if i == 0 {
 				// This is the first post-processor. We handle deleting
@@ -328,7 +445,30 @@ func (b *coreBuild) SetOnError(val string) {
 	b.onError = val
 }
 
+func (b *coreBuild) SetResume(val bool) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.resume = val
+}
+
+func (b *coreBuild) SetBuildArtifacts(val map[string]map[string]string) {
+	if b.prepareCalled {
+		panic("prepare has already been called")
+	}
+
+	b.buildArtifacts = val
+}
+
 // Cancels the build if it is running.
 func (b *coreBuild) Cancel() {
+	b.l.Lock()
+	if b.cancelCh != nil {
+		close(b.cancelCh)
+		b.cancelCh = nil
+	}
+	b.l.Unlock()
+
 	b.builder.Cancel()
 }
@@ -15,7 +15,7 @@ func testBuild() *coreBuild {
 			"foo": {&MockHook{}},
 		},
 		provisioners: []coreBuildProvisioner{
-			{&MockProvisioner{}, []interface{}{42}},
+			{&MockProvisioner{}, []interface{}{42}, "test", nil},
 		},
 		postProcessors: [][]coreBuildPostProcessor{
 			{
@@ -34,6 +34,7 @@ func testDefaultPackerConfig() map[string]interface{} {
 		DebugConfigKey:         false,
 		ForceConfigKey:         false,
 		OnErrorConfigKey:       "cleanup",
+		ResumeConfigKey:        false,
 		TemplatePathKey:        "",
 		UserVariablesConfigKey: make(map[string]string),
 	}
@@ -118,6 +119,46 @@ func TestBuildPrepare_BuilderWarniings(t *testing.T) {
 	}
 }
 
+func TestBuildSteps(t *testing.T) {
+	expected := []string{"StepOne", "StepTwo"}
+
+	build := testBuild()
+	builder := build.builder.(*MockBuilder)
+	builder.PlanSteps = expected
+
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	steps, err := BuildSteps(build)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("bad: %#v", steps)
+	}
+	if builder.RunCalled {
+		t.Fatal("run should not be called")
+	}
+}
+
+func TestBuildSteps_notPlanner(t *testing.T) {
+	build := testBuild()
+	build.builder = struct{ Builder }{build.builder}
+
+	if _, err := build.Prepare(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	steps, err := BuildSteps(build)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if steps != nil {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
+
 func TestBuild_Prepare_Debug(t *testing.T) {
 	packerConfig := testDefaultPackerConfig()
 	packerConfig[DebugConfigKey] = true
@@ -353,6 +394,22 @@ func TestBuild_Run_Artifacts(t *testing.T) {
 	}
 }
 
+func TestBuild_RunRetry(t *testing.T) {
+	build := testBuild()
+	build.builder = &MockBuilder{RunErrResult: true}
+	build.retry = &RetryPolicy{MaxAttempts: 2}
+
+	build.Prepare()
+	_, err := build.Run(testUi(), &TestCache{})
+	merr, ok := err.(*MultiError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(merr.Errors) != 2 {
+		t.Fatalf("bad: %#v", merr.Errors)
+	}
+}
+
 func TestBuild_RunBeforePrepare(t *testing.T) {
 	defer func() {
 		p := recover()
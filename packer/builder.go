@@ -34,3 +34,12 @@ type Builder interface {
 	// the builder actually cancels and cleans up after itself.
 	Cancel()
 }
+
+// BuilderPlanner is implemented by builders that can describe what Run
+// would do without doing it.
+type BuilderPlanner interface {
+	// Plan returns the names of the steps that Run would take with the
+	// configuration from Prepare, in order. It must not have any side
+	// effects. A nil result means the steps can't be described.
+	Plan() ([]string, error)
+}
@@ -9,12 +9,14 @@ import (
 // methods were called on the builder. It is fairly basic.
 type MockBuilder struct {
 	ArtifactId      string
+	PlanSteps       []string
 	PrepareWarnings []string
 	RunErrResult    bool
 	RunNilResult    bool
 
 	PrepareCalled bool
 	PrepareConfig []interface{}
+	PlanCalled    bool
 	RunCalled     bool
 	RunCache      Cache
 	RunHook       Hook
@@ -28,6 +30,11 @@ func (tb *MockBuilder) Prepare(config ...interface{}) ([]string, error) {
 	return tb.PrepareWarnings, nil
 }
 
+func (tb *MockBuilder) Plan() ([]string, error) {
+	tb.PlanCalled = true
+	return tb.PlanSteps, nil
+}
+
 func (tb *MockBuilder) Run(ui Ui, h Hook, c Cache) (Artifact, error) {
 	tb.RunCalled = true
 	tb.RunHook = h
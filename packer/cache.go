@@ -3,11 +3,14 @@ package packer
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Cache implements a caching interface where files can be stored for
@@ -37,12 +40,60 @@ type Cache interface {
 	RUnlock(string)
 }
 
+// CacheInfo describes where a file in the cache came from.
+type CacheInfo struct {
+	// Source is where the file was downloaded from, usually a URL.
+	Source string
+
+	// The checksum of the file and its type, such as "sha256". The
+	// checksum is used to verify the file later on.
+	ChecksumType string
+	Checksum     string
+}
+
+// CacheDescriber is implemented by caches that keep track of where their
+// files came from.
+type CacheDescriber interface {
+	// Describe records the information about the file for the key. It
+	// should be called while the lock for the key is held.
+	Describe(key string, info CacheInfo)
+}
+
+// CacheFinder is implemented by caches that can be backed by read-only
+// secondary cache directories, such as a cache that is shared over the
+// network.
+type CacheFinder interface {
+	// Find returns the paths in the secondary cache directories where a
+	// file for the key exists, in the order the directories should be
+	// searched. The files must not be modified.
+	Find(key string) []string
+}
+
 // FileCache implements a Cache by caching the data directly to a cache
 // directory.
+//
+// The files are locked across processes as well, so several Packer
+// processes can share a cache directory. FileCache keeps an index of the
+// files it caches, see Entries.
 type FileCache struct {
 	CacheDir string
-	l        sync.Mutex
-	rw       map[string]*sync.RWMutex
+
+	// MaxSize is the size, in bytes, that the cache is kept under by
+	// removing the files that were used least recently. MaxAge is how long
+	// a file is kept after it was last used. Old files are removed after a
+	// file is written to the cache. Both are unlimited if zero.
+	MaxSize int64
+	MaxAge  time.Duration
+
+	// SecondaryDirs are cache directories that are only read from, see
+	// CacheFinder. Their files are named the same as in CacheDir.
+	SecondaryDirs []string
+
+	l     sync.Mutex
+	rw    map[string]*sync.RWMutex
+	files map[string][]*os.File
+
+	indexLock sync.Mutex
 }
 
 func (f *FileCache) Lock(key string) string {
@@ -50,11 +101,26 @@ func (f *FileCache) Lock(key string) string {
 	rw := f.rwLock(hashKey)
 	rw.Lock()
 
-	return f.cachePath(key, hashKey)
+	path := f.cachePath(key, hashKey)
+	f.lockFile(hashKey, true)
+	return path
 }
 
 func (f *FileCache) Unlock(key string) {
 	hashKey := f.hashKey(key)
+	path := f.cachePath(key, hashKey)
+	if err := f.record(key, path, nil); err != nil {
+		log.Printf("[ERR] Error updating cache index: %s", err)
+	}
+
+	// Make room for the file that was just written
+	if f.MaxSize > 0 || f.MaxAge > 0 {
+		if _, err := f.prune(f.MaxSize, f.MaxAge, filepath.Base(path)); err != nil {
+			log.Printf("[ERR] Error pruning cache: %s", err)
+		}
+	}
+
+	f.unlockFile(hashKey)
 	rw := f.rwLock(hashKey)
 	rw.Unlock()
 }
@@ -64,15 +130,48 @@ func (f *FileCache) RLock(key string) (string, bool) {
 	rw := f.rwLock(hashKey)
 	rw.RLock()
 
-	return f.cachePath(key, hashKey), true
+	path := f.cachePath(key, hashKey)
+	f.lockFile(hashKey, false)
+
+	if _, err := os.Stat(path); err == nil {
+		if err := f.record(key, path, nil); err != nil {
+			log.Printf("[ERR] Error updating cache index: %s", err)
+		}
+	}
+
+	return path, true
 }
 
 func (f *FileCache) RUnlock(key string) {
 	hashKey := f.hashKey(key)
+	f.unlockFile(hashKey)
 	rw := f.rwLock(hashKey)
 	rw.RUnlock()
 }
 
+// Describe implements CacheDescriber.
+func (f *FileCache) Describe(key string, info CacheInfo) {
+	path := f.cachePath(key, f.hashKey(key))
+	if err := f.record(key, path, &info); err != nil {
+		log.Printf("[ERR] Error updating cache index: %s", err)
+	}
+}
+
+// Find implements CacheFinder.
+func (f *FileCache) Find(key string) []string {
+	name := filepath.Base(f.cachePath(key, f.hashKey(key)))
+
+	var result []string
+	for _, dir := range f.SecondaryDirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			result = append(result, path)
+		}
+	}
+
+	return result
+}
+
 func (f *FileCache) cachePath(key string, hashKey string) string {
 	if endIndex := strings.Index(key, "?"); endIndex > -1 {
 		key = key[:endIndex]
@@ -118,3 +217,120 @@ func (f *FileCache) rwLock(hashKey string) *sync.RWMutex {
 	f.rw[hashKey] = &result
 	return &result
 }
+
+// lockFile takes the lock of the key that is shared with other processes.
+// Errors are only logged, since the lock within this process is still
+// held.
+func (f *FileCache) lockFile(hashKey string, exclusive bool) {
+	file, err := f.openLockFile(hashKey, exclusive, true)
+	if err != nil {
+		log.Printf("[ERR] Error locking cache lock file: %s", err)
+		return
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if f.files == nil {
+		f.files = make(map[string][]*os.File)
+	}
+	f.files[hashKey] = append(f.files[hashKey], file)
+}
+
+func (f *FileCache) unlockFile(hashKey string) {
+	f.l.Lock()
+	files := f.files[hashKey]
+	if len(files) == 0 {
+		f.l.Unlock()
+		return
+	}
+
+	file := files[len(files)-1]
+	f.files[hashKey] = files[:len(files)-1]
+	f.l.Unlock()
+
+	if err := releaseLockFile(file); err != nil {
+		log.Printf("[ERR] Error unlocking cache lock file: %s", err)
+	}
+}
+
+// openLockFile opens the lock file of the key and locks it. Lock files
+// are removed once they are unlocked by the last process using them, see
+// releaseLockFile, so the lock file is opened again if it was removed
+// while this process waited for the lock.
+func (f *FileCache) openLockFile(hashKey string, exclusive, block bool) (*os.File, error) {
+	path := f.lockPath(hashKey)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lockFile(file, exclusive, block); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if isCurrentFile(file) {
+			return file, nil
+		}
+
+		unlockFile(file)
+		file.Close()
+	}
+}
+
+// isCurrentFile returns false if the path the file was opened with was
+// removed or replaced since.
+func isCurrentFile(file *os.File) bool {
+	pathInfo, err := os.Stat(file.Name())
+	if os.IsNotExist(err) {
+		return false
+	}
+
+	info, fileErr := file.Stat()
+	if err != nil || fileErr != nil {
+		// It can't be told, so the file is used as it is
+		return true
+	}
+
+	return os.SameFile(info, pathInfo)
+}
+
+// lockPath is the path of the file that is locked to lock the key across
+// processes.
+func (f *FileCache) lockPath(hashKey string) string {
+	return filepath.Join(f.CacheDir, "."+hashKey+".lock")
+}
+
+// ParseByteSize parses a size in bytes, which may have a suffix of KB, MB,
+// GB or TB. The units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	v := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			multiplier = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,382 @@
+package packer
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrCacheEntryLocked is returned when removing a file from the cache
+// that is in use.
+var ErrCacheEntryLocked = errors.New("file is in use")
+
+// cacheIndexFile is the name of the index in the cache directory.
+const cacheIndexFile = ".index.json"
+
+// CacheEntry is what a FileCache knows about a file in the cache.
+type CacheEntry struct {
+	// File is the name of the file in the cache directory.
+	File string `json:"file"`
+
+	// Key is the key the file was cached with. It is blank for files that
+	// were cached before the index was kept.
+	Key string `json:"key,omitempty"`
+
+	// Source, ChecksumType and Checksum are the information given to
+	// Describe, if any.
+	Source       string `json:"source,omitempty"`
+	ChecksumType string `json:"checksum_type,omitempty"`
+	Checksum     string `json:"checksum,omitempty"`
+
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// cacheIndex is the format of the index file.
+type cacheIndex struct {
+	Entries map[string]*CacheEntry `json:"entries"`
+}
+
+// Entries returns the files in the cache sorted by the time they were last
+// used, most recent first. Files that aren't in the index are included as
+// well, using their modification time.
+func (f *FileCache) Entries() ([]*CacheEntry, error) {
+	var result []*CacheEntry
+	err := f.updateIndex(func(idx map[string]*CacheEntry) error {
+		for _, e := range idx {
+			entry := *e
+			result = append(result, &entry)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byLastUsed(result))
+	return result, nil
+}
+
+// Remove removes the file of the entry from the cache. It returns
+// ErrCacheEntryLocked if the file is in use, by this process or another.
+func (f *FileCache) Remove(e *CacheEntry) error {
+	file, err := f.openLockFile(cacheHashKey(e.File), true, false)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return err
+		}
+		return ErrCacheEntryLocked
+	}
+	defer releaseLockFile(file)
+
+	if err := os.RemoveAll(filepath.Join(f.CacheDir, e.File)); err != nil {
+		return err
+	}
+
+	return f.updateIndex(func(idx map[string]*CacheEntry) error {
+		delete(idx, e.File)
+		return nil
+	})
+}
+
+// Prune removes the files that weren't used within maxAge, then the files
+// that were used least recently until the cache is no larger than
+// maxSize. Files that are in use are kept. Either limit is ignored if it
+// is zero. The entries of the removed files are returned.
+func (f *FileCache) Prune(maxSize int64, maxAge time.Duration) ([]*CacheEntry, error) {
+	return f.prune(maxSize, maxAge, "")
+}
+
+func (f *FileCache) prune(maxSize int64, maxAge time.Duration, keep string) ([]*CacheEntry, error) {
+	entries, err := f.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	// Go from the least recently used file to the most recent
+	now := time.Now()
+	var removed []*CacheEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.File == keep {
+			continue
+		}
+
+		expired := maxAge > 0 && now.Sub(e.LastUsed) > maxAge
+		tooBig := maxSize > 0 && total > maxSize
+		if !expired && !tooBig {
+			continue
+		}
+
+		if err := f.Remove(e); err != nil {
+			if err != ErrCacheEntryLocked {
+				return removed, err
+			}
+
+			log.Printf("Not removing cached file in use: %s", e.File)
+			continue
+		}
+
+		log.Printf("Removed cached file: %s", e.File)
+		total -= e.Size
+		removed = append(removed, e)
+	}
+
+	return removed, nil
+}
+
+// Verify checks the file of the entry against its checksum. It returns an
+// error if the file is missing or doesn't match, and nil if the entry
+// doesn't have a checksum.
+func (f *FileCache) Verify(e *CacheEntry) error {
+	if e.Checksum == "" {
+		return nil
+	}
+
+	var h hash.Hash
+	switch strings.ToLower(e.ChecksumType) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported checksum type '%s'", e.ChecksumType)
+	}
+
+	file, err := os.Open(filepath.Join(f.CacheDir, e.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, e.Checksum) {
+		return fmt.Errorf("checksum is %s, expected %s", actual, e.Checksum)
+	}
+
+	return nil
+}
+
+// record updates the index entry of the file for the key after it was
+// used. The entry is removed if the file doesn't exist.
+func (f *FileCache) record(key, path string, info *CacheInfo) error {
+	name := filepath.Base(path)
+	size, err := cacheFileSize(path)
+	exists := err == nil
+
+	return f.updateIndex(func(idx map[string]*CacheEntry) error {
+		e, ok := idx[name]
+		if !ok {
+			if !exists && info == nil {
+				return nil
+			}
+
+			e = &CacheEntry{File: name}
+			idx[name] = e
+		}
+
+		e.Key = key
+		e.LastUsed = time.Now().UTC()
+		if exists {
+			e.Size = size
+		}
+		if info != nil {
+			e.Source = info.Source
+			e.ChecksumType = info.ChecksumType
+			e.Checksum = info.Checksum
+		} else if !exists {
+			delete(idx, name)
+		}
+
+		return nil
+	})
+}
+
+// updateIndex calls the function with the entries of the index while it is
+// locked, then writes the index back. The entries are brought up to date
+// with the files in the cache directory first.
+func (f *FileCache) updateIndex(fn func(map[string]*CacheEntry) error) error {
+	f.indexLock.Lock()
+	defer f.indexLock.Unlock()
+
+	if err := os.MkdirAll(f.CacheDir, 0755); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(
+		filepath.Join(f.CacheDir, ".index.lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock, true, true); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	idx, err := f.readIndex()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(idx); err != nil {
+		return err
+	}
+
+	return f.writeIndex(idx)
+}
+
+func (f *FileCache) readIndex() (map[string]*CacheEntry, error) {
+	var idx cacheIndex
+	contents, err := ioutil.ReadFile(filepath.Join(f.CacheDir, cacheIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(contents, &idx); err != nil {
+			// The index can be rebuilt from the files, so a broken index
+			// shouldn't stop anything.
+			log.Printf("[ERR] Ignoring broken cache index: %s", err)
+			idx.Entries = nil
+		}
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]*CacheEntry)
+	}
+
+	// Bring the index up to date with the files in the directory
+	infos, err := ioutil.ReadDir(f.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{}, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		found[name] = struct{}{}
+		if _, ok := idx.Entries[name]; ok {
+			continue
+		}
+
+		size, err := cacheFileSize(filepath.Join(f.CacheDir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		idx.Entries[name] = &CacheEntry{
+			File:     name,
+			Size:     size,
+			LastUsed: info.ModTime().UTC(),
+		}
+	}
+
+	for name := range idx.Entries {
+		if _, ok := found[name]; !ok {
+			delete(idx.Entries, name)
+		}
+	}
+
+	return idx.Entries, nil
+}
+
+func (f *FileCache) writeIndex(entries map[string]*CacheEntry) error {
+	contents, err := json.MarshalIndent(&cacheIndex{Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so the index is never half written
+	tmp, err := ioutil.TempFile(f.CacheDir, ".index")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(f.CacheDir, cacheIndexFile))
+}
+
+// cacheHashKey returns the hashed key of a file in the cache, which is
+// its name without the extension.
+func cacheHashKey(name string) string {
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i]
+	}
+
+	return name
+}
+
+// cacheFileSize returns the size of a file, or of all the files in a
+// directory.
+func cacheFileSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// byLastUsed sorts entries by the time they were last used, most recent
+// first.
+type byLastUsed []*CacheEntry
+
+func (s byLastUsed) Len() int      { return len(s) }
+func (s byLastUsed) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLastUsed) Less(i, j int) bool {
+	if !s[i].LastUsed.Equal(s[j].LastUsed) {
+		return s[i].LastUsed.After(s[j].LastUsed)
+	}
+	return s[i].File < s[j].File
+}
@@ -0,0 +1,48 @@
+// +build darwin freebsd linux netbsd openbsd
+
+package packer
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the file for this process. The lock is exclusive or
+// shared with other readers. If block is false, an error is returned
+// right away if the lock is held elsewhere.
+func lockFile(f *os.File, exclusive, block bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+
+	return syscall.Flock(int(f.Fd()), how)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// releaseLockFile unlocks and closes a lock file of the cache. The file is
+// removed if no other process holds the lock. Processes that wait for the
+// lock on the removed file notice once they get it, see openLockFile.
+func releaseLockFile(f *os.File) error {
+	defer f.Close()
+
+	if err := unlockFile(f); err != nil {
+		return err
+	}
+
+	// Nobody else holds the lock if it can be taken right away
+	if lockFile(f, true, false) == nil {
+		if isCurrentFile(f) {
+			os.Remove(f.Name())
+		}
+		unlockFile(f)
+	}
+
+	return nil
+}
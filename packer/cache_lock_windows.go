@@ -0,0 +1,64 @@
+// +build windows
+
+package packer
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32     = syscall.MustLoadDLL("kernel32.dll")
+	lockFileEx   = kernel32.MustFindProc("LockFileEx")
+	unlockFileEx = kernel32.MustFindProc("UnlockFileEx")
+)
+
+const (
+	LOCKFILE_FAIL_IMMEDIATELY = 0x1
+	LOCKFILE_EXCLUSIVE_LOCK   = 0x2
+)
+
+// lockFile locks the file for this process. The lock is exclusive or
+// shared with other readers. If block is false, an error is returned
+// right away if the lock is held elsewhere.
+func lockFile(f *os.File, exclusive, block bool) error {
+	var flags uintptr
+	if exclusive {
+		flags |= LOCKFILE_EXCLUSIVE_LOCK
+	}
+	if !block {
+		flags |= LOCKFILE_FAIL_IMMEDIATELY
+	}
+
+	var ol syscall.Overlapped
+	r, _, err := lockFileEx.Call(
+		f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := unlockFileEx.Call(
+		f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// releaseLockFile unlocks and closes a lock file of the cache, and removes
+// it. Removing the file fails while another process has it open, which
+// includes the processes that hold or wait for the lock.
+func releaseLockFile(f *os.File) error {
+	err := unlockFile(f)
+	f.Close()
+	os.Remove(f.Name())
+
+	return err
+}
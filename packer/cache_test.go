@@ -3,8 +3,12 @@ package packer
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type TestCache struct{}
@@ -80,3 +84,313 @@ func TestFileCache(t *testing.T) {
 		t.Fatalf("unknown data: %s", data)
 	}
 }
+
+func testFileCacheWrite(t *testing.T, cache *FileCache, key, data string) string {
+	path := cache.Lock(key)
+	defer cache.Unlock(key)
+
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatalf("error writing: %s", err)
+	}
+
+	return filepath.Base(path)
+}
+
+func TestFileCache_entries(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	// A file that was cached before the index existed
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, "old.iso"), []byte("old"), 0666); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cache := &FileCache{CacheDir: cacheDir}
+	path := cache.Lock("http://example.com/foo.iso")
+	if err := ioutil.WriteFile(path, []byte("data"), 0666); err != nil {
+		t.Fatalf("error writing: %s", err)
+	}
+	cache.Describe("http://example.com/foo.iso", CacheInfo{
+		Source:       "http://example.com/foo.iso",
+		ChecksumType: "sha256",
+		Checksum:     "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+	})
+	cache.Unlock("http://example.com/foo.iso")
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("bad: %#v", entries)
+	}
+
+	e := entries[0]
+	if e.File != filepath.Base(path) || e.Key != "http://example.com/foo.iso" || e.Size != 4 {
+		t.Fatalf("bad: %#v", e)
+	}
+	if e.Source != "http://example.com/foo.iso" || e.ChecksumType != "sha256" {
+		t.Fatalf("bad: %#v", e)
+	}
+	if err := cache.Verify(e); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if entries[1].File != "old.iso" || entries[1].Key != "" || entries[1].Size != 3 {
+		t.Fatalf("bad: %#v", entries[1])
+	}
+
+	// Corrupt the file
+	if err := ioutil.WriteFile(path, []byte("bad"), 0666); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := cache.Verify(e); err == nil {
+		t.Fatal("should error")
+	}
+
+	// A new cache with the same directory sees the same entries
+	other := &FileCache{CacheDir: cacheDir}
+	otherEntries, err := other.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(otherEntries) != 2 || otherEntries[0].Checksum != e.Checksum {
+		t.Fatalf("bad: %#v", otherEntries)
+	}
+}
+
+func TestFileCache_prune(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir}
+	a := testFileCacheWrite(t, cache, "a.iso", "aaaa")
+	time.Sleep(10 * time.Millisecond)
+	b := testFileCacheWrite(t, cache, "b.iso", "bbbb")
+	time.Sleep(10 * time.Millisecond)
+	c := testFileCacheWrite(t, cache, "c.iso", "cccc")
+
+	// Using a makes b the least recently used
+	time.Sleep(10 * time.Millisecond)
+	cache.RLock("a.iso")
+	cache.RUnlock("a.iso")
+
+	removed, err := cache.Prune(8, 0)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 1 || removed[0].File != b {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, b)); !os.IsNotExist(err) {
+		t.Fatalf("should be removed: %s", err)
+	}
+
+	// Files in use aren't removed
+	cache.RLock("c.iso")
+	removed, err = cache.Prune(0, time.Nanosecond)
+	cache.RUnlock("c.iso")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(removed) != 1 || removed[0].File != a {
+		t.Fatalf("bad: %#v", removed)
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 || entries[0].File != c {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
+
+func TestFileCache_maxSize(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir, MaxSize: 4}
+	a := testFileCacheWrite(t, cache, "a.iso", "aaaa")
+	time.Sleep(10 * time.Millisecond)
+	b := testFileCacheWrite(t, cache, "b.iso", "bbbb")
+
+	if _, err := os.Stat(filepath.Join(cacheDir, a)); !os.IsNotExist(err) {
+		t.Fatalf("should be removed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, b)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFileCache_removeLocked(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cache := &FileCache{CacheDir: cacheDir}
+	testFileCacheWrite(t, cache, "a.iso", "aaaa")
+
+	entries, err := cache.Entries()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Another cache stands in for another process
+	other := &FileCache{CacheDir: cacheDir}
+	other.RLock("a.iso")
+	if err := cache.Remove(entries[0]); err != ErrCacheEntryLocked {
+		t.Fatalf("bad: %#v", err)
+	}
+	other.RUnlock("a.iso")
+
+	if err := cache.Remove(entries[0]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestFileCache_lockFilesRemoved(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	lockFiles := func() []string {
+		matches, err := filepath.Glob(filepath.Join(cacheDir, ".*.lock"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var result []string
+		for _, m := range matches {
+			if filepath.Base(m) != ".index.lock" {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+
+	cache := &FileCache{CacheDir: cacheDir}
+	testFileCacheWrite(t, cache, "a.iso", "aaaa")
+	if files := lockFiles(); len(files) > 0 {
+		t.Fatalf("bad: %#v", files)
+	}
+
+	// The lock file stays while another process holds the lock
+	other := &FileCache{CacheDir: cacheDir}
+	cache.RLock("a.iso")
+	other.RLock("a.iso")
+	cache.RUnlock("a.iso")
+	if files := lockFiles(); len(files) != 1 {
+		t.Fatalf("bad: %#v", files)
+	}
+	other.RUnlock("a.iso")
+	if files := lockFiles(); len(files) > 0 {
+		t.Fatalf("bad: %#v", files)
+	}
+}
+
+func TestFileCache_lockExclusive(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	// Each cache stands in for another process, so that the lock files
+	// are removed and created again while others wait for them
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	holders := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache := &FileCache{CacheDir: cacheDir}
+			for j := 0; j < 25; j++ {
+				cache.Lock("a.iso")
+				l.Lock()
+				holders++
+				if holders > 1 {
+					t.Error("lock held more than once")
+				}
+				l.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				l.Lock()
+				holders--
+				l.Unlock()
+				cache.Unlock("a.iso")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFileCache_find(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	secondaryDir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(secondaryDir)
+
+	secondary := &FileCache{CacheDir: secondaryDir}
+	name := testFileCacheWrite(t, secondary, "foo.iso", "foo")
+
+	cache := &FileCache{
+		CacheDir:      cacheDir,
+		SecondaryDirs: []string{filepath.Join(cacheDir, "missing"), secondaryDir},
+	}
+	if paths := cache.Find("foo.iso"); !reflect.DeepEqual(paths, []string{filepath.Join(secondaryDir, name)}) {
+		t.Fatalf("bad: %#v", paths)
+	}
+	if paths := cache.Find("bar.iso"); len(paths) != 0 {
+		t.Fatalf("bad: %#v", paths)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output int64
+		Err    bool
+	}{
+		{"1024", 1024, false},
+		{"10B", 10, false},
+		{"2KB", 2048, false},
+		{"1.5 MB", 1572864, false},
+		{"20gb", 20 << 30, false},
+		{"1TB", 1 << 40, false},
+		{"lots", 0, true},
+		{"-1GB", 0, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseByteSize(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%s: bad: %d", tc.Input, actual)
+		}
+	}
+}
@@ -83,6 +83,60 @@ type Communicator interface {
 	DownloadDir(src string, dst string, exclude []string) error
 }
 
+// HostKeyCommunicator is implemented by communicators that know the host
+// key of the machine, so that others can connect to it with strict host
+// key checking.
+type HostKeyCommunicator interface {
+	// HostKey returns the public key of the machine in the
+	// authorized_keys format, or an empty string if it isn't known.
+	HostKey() string
+}
+
+// UploadDirOptions are the options of an upload of a directory that only
+// transfers the files that changed.
+type UploadDirOptions struct {
+	// Compare is how the files are compared with the ones on the machine:
+	// "checksum" compares their SHA-256 sums, and "mtime" compares their
+	// sizes and modification times. If it is empty, all the files are
+	// uploaded.
+	Compare string
+
+	// Compress, if true, sends the files as a single gzipped tar archive,
+	// which is faster for many small files.
+	Compress bool
+}
+
+// UploadDirResult is what an upload of a directory transferred.
+type UploadDirResult struct {
+	// Files is the number of files in the directory.
+	Files int
+
+	// Uploaded is the number of files that were uploaded, and Bytes their
+	// size.
+	Uploaded int
+	Bytes    int64
+}
+
+// DeltaCommunicator is implemented by communicators that can upload only
+// the files of a directory that changed. UploadDirDelta uses it when the
+// communicator has it.
+type DeltaCommunicator interface {
+	// UploadDirDelta uploads a directory like UploadDir, with the options.
+	// The result is nil if it isn't known what was uploaded.
+	UploadDirDelta(dst string, src string, exclude []string, opts *UploadDirOptions) (*UploadDirResult, error)
+}
+
+// UploadDirDelta uploads a directory with the options if the communicator
+// supports them, and with UploadDir otherwise, in which case the result is
+// nil.
+func UploadDirDelta(c Communicator, dst string, src string, exclude []string, opts *UploadDirOptions) (*UploadDirResult, error) {
+	if dc, ok := c.(DeltaCommunicator); ok {
+		return dc.UploadDirDelta(dst, src, exclude, opts)
+	}
+
+	return nil, c.UploadDir(dst, src, exclude)
+}
+
 // StartWithUi runs the remote command and streams the output to any
 // configured Writers for stdout/stderr, while also writing each line
 // as it comes to a Ui.
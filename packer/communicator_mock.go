@@ -24,6 +24,8 @@ type MockCommunicator struct {
 	UploadDirDst     string
 	UploadDirSrc     string
 	UploadDirExclude []string
+	UploadDirOptions *UploadDirOptions
+	UploadDirResult  *UploadDirResult
 
 	DownloadDirDst     string
 	DownloadDirSrc     string
@@ -32,6 +34,8 @@ type MockCommunicator struct {
 	DownloadCalled bool
 	DownloadPath   string
 	DownloadData   string
+
+	HostKeyData string
 }
 
 func (c *MockCommunicator) Start(rc *RemoteCmd) error {
@@ -95,6 +99,12 @@ func (c *MockCommunicator) UploadDir(dst string, src string, excl []string) erro
 	return nil
 }
 
+func (c *MockCommunicator) UploadDirDelta(dst string, src string, excl []string, opts *UploadDirOptions) (*UploadDirResult, error) {
+	c.UploadDirOptions = opts
+
+	return c.UploadDirResult, c.UploadDir(dst, src, excl)
+}
+
 func (c *MockCommunicator) Download(path string, w io.Writer) error {
 	c.DownloadCalled = true
 	c.DownloadPath = path
@@ -110,3 +120,7 @@ func (c *MockCommunicator) DownloadDir(src string, dst string, excl []string) er
 
 	return nil
 }
+
+func (c *MockCommunicator) HostKey() string {
+	return c.HostKeyData
+}
@@ -3,9 +3,12 @@ package packer
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-version"
+	"github.com/mitchellh/packer/common/sensitive"
 	"github.com/mitchellh/packer/template"
 	"github.com/mitchellh/packer/template/interpolate"
 )
@@ -19,6 +22,7 @@ type Core struct {
 	variables  map[string]string
 	builds     map[string]*template.Builder
 	version    string
+	warnings   []string
 }
 
 // CoreConfig is the structure for initializing a new Core. Once a CoreConfig
@@ -95,6 +99,61 @@ func (c *Core) BuildNames() []string {
 	return r
 }
 
+// BuildDependencies returns the names of the builds that must finish
+// successfully before the named build can start.
+func (c *Core) BuildDependencies(n string) []string {
+	b, ok := c.builds[n]
+	if !ok {
+		return nil
+	}
+
+	var result []string
+	for name, other := range c.builds {
+		for _, dep := range b.DependsOn {
+			if other.Name == dep {
+				result = append(result, name)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// BuildOrder orders the given build names so that every build comes after
+// the builds it depends on. Builds keep their relative order otherwise.
+// Dependencies that aren't in the list are ignored.
+func (c *Core) BuildOrder(names []string) []string {
+	wanted := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		wanted[n] = struct{}{}
+	}
+
+	result := make([]string, 0, len(names))
+	visited := make(map[string]struct{}, len(names))
+	var visit func(string)
+	visit = func(n string) {
+		if _, ok := visited[n]; ok {
+			return
+		}
+		visited[n] = struct{}{}
+
+		for _, dep := range c.BuildDependencies(n) {
+			if _, ok := wanted[dep]; ok {
+				visit(dep)
+			}
+		}
+
+		result = append(result, n)
+	}
+
+	for _, n := range names {
+		visit(n)
+	}
+
+	return result
+}
+
 // Build returns the Build object for the given name.
 func (c *Core) Build(n string) (Build, error) {
 	// Setup the builder
@@ -154,8 +213,10 @@ func (c *Core) Build(n string) (Build, error) {
 		}
 
 		provisioners = append(provisioners, coreBuildProvisioner{
-			provisioner: provisioner,
-			config:      config,
+			provisioner:     provisioner,
+			config:          config,
+			provisionerType: rawP.Type,
+			retry:           NewRetryPolicy(rawP.Retry),
 		})
 	}
 
@@ -208,9 +269,107 @@ func (c *Core) Build(n string) (Build, error) {
 		provisioners:   provisioners,
 		templatePath:   c.Template.Path,
 		variables:      c.variables,
+		retry:          NewRetryPolicy(c.Template.Retry),
 	}, nil
 }
 
+// ResolvedBuild is a build as it would be executed: its configuration
+// after user variables are interpolated, and the provisioners and
+// post-processors that run for it in order.
+type ResolvedBuild struct {
+	Name           string
+	Type           string
+	Config         map[string]interface{}
+	Provisioners   []*ResolvedProvisioner
+	PostProcessors [][]*ResolvedPostProcessor
+}
+
+// ResolvedProvisioner is a provisioner of a ResolvedBuild. Its Config
+// includes the override for the build.
+type ResolvedProvisioner struct {
+	Type        string
+	Config      map[string]interface{}
+	PauseBefore time.Duration
+}
+
+// ResolvedPostProcessor is a post-processor of a ResolvedBuild.
+type ResolvedPostProcessor struct {
+	Type              string
+	Config            map[string]interface{}
+	KeepInputArtifact bool
+}
+
+// Resolve returns the configuration of the given build without
+// initializing any of its components. Values that can only be interpolated
+// by the component, such as the data a builder passes to its boot command,
+// are left in their raw form.
+func (c *Core) Resolve(n string) (*ResolvedBuild, error) {
+	configBuilder, ok := c.builds[n]
+	if !ok {
+		return nil, fmt.Errorf("no such build found: %s", n)
+	}
+
+	// rawName is the uninterpolated name that we use for various lookups
+	rawName := configBuilder.Name
+
+	// Fields of the template data can only be interpolated by the
+	// component, so the data has none to make them fail.
+	ctx := c.Context()
+	ctx.Data = struct{}{}
+	ctx.BuildName = n
+	ctx.BuildType = configBuilder.Type
+
+	result := &ResolvedBuild{
+		Name:   n,
+		Type:   configBuilder.Type,
+		Config: resolveConfig(ctx, configBuilder.Config),
+	}
+
+	for _, rawP := range c.Template.Provisioners {
+		if rawP.Skip(rawName) {
+			continue
+		}
+
+		// The override replaces the keys it sets
+		config := make(map[string]interface{})
+		for k, v := range rawP.Config {
+			config[k] = v
+		}
+		if override, ok := rawP.Override[rawName].(map[string]interface{}); ok {
+			for k, v := range override {
+				config[k] = v
+			}
+		}
+
+		result.Provisioners = append(result.Provisioners, &ResolvedProvisioner{
+			Type:        rawP.Type,
+			Config:      resolveConfig(ctx, config),
+			PauseBefore: rawP.PauseBefore,
+		})
+	}
+
+	for _, rawPs := range c.Template.PostProcessors {
+		var current []*ResolvedPostProcessor
+		for _, rawP := range rawPs {
+			if rawP.Skip(rawName) {
+				continue
+			}
+
+			current = append(current, &ResolvedPostProcessor{
+				Type:              rawP.Type,
+				Config:            resolveConfig(ctx, rawP.Config),
+				KeepInputArtifact: rawP.KeepInputArtifact,
+			})
+		}
+
+		if len(current) > 0 {
+			result.PostProcessors = append(result.PostProcessors, current)
+		}
+	}
+
+	return result, nil
+}
+
 // Context returns an interpolation context.
 func (c *Core) Context() *interpolate.Context {
 	return &interpolate.Context{
@@ -252,14 +411,25 @@ func (c *Core) validate() error {
 		}
 	}
 
-	// Validate variables are set
+	// Validate variables are set and that the values are valid
 	var err error
 	for n, v := range c.Template.Variables {
-		if v.Required {
-			if _, ok := c.variables[n]; !ok {
+		value, ok := c.variables[n]
+		if !ok {
+			if v.Required {
 				err = multierror.Append(err, fmt.Errorf(
 					"required variable not set: %s", n))
 			}
+			continue
+		}
+
+		if v.Sensitive {
+			c.addSensitive(n, value)
+		}
+
+		if verr := v.ValidateValue(value); verr != nil {
+			err = multierror.Append(err, fmt.Errorf(
+				"variable %s: %s", n, verr))
 		}
 	}
 
@@ -270,25 +440,40 @@ func (c *Core) validate() error {
 	return err
 }
 
+// addSensitive redacts the value of the sensitive variable from the
+// output, and warns if it is too short to be redacted.
+func (c *Core) addSensitive(name, value string) {
+	if !sensitive.Add(value) {
+		c.warnings = append(c.warnings, fmt.Sprintf(
+			"The value of the sensitive variable '%s' is shorter than %d "+
+				"characters, so it can't be redacted and may be shown in the "+
+				"output and the logs.", name, sensitive.MinLength))
+	}
+}
+
+// Warnings returns the problems found with the template and variables
+// that don't stop the builds.
+func (c *Core) Warnings() []string {
+	return c.warnings
+}
+
 func (c *Core) init() error {
 	if c.variables == nil {
 		c.variables = make(map[string]string)
 	}
 
+	// Defaults can reference other variables, so they're interpolated in
+	// the order of their dependencies.
+	order, err := c.variableOrder()
+	if err != nil {
+		return err
+	}
+
 	// Go through the variables and interpolate the environment variables
 	ctx := c.Context()
 	ctx.EnableEnv = true
-	ctx.UserVariables = nil
-	for k, v := range c.Template.Variables {
-		// Ignore variables that are required
-		if v.Required {
-			continue
-		}
-
-		// Ignore variables that have a value
-		if _, ok := c.variables[k]; ok {
-			continue
-		}
+	for _, k := range order {
+		v := c.Template.Variables[k]
 
 		// Interpolate the default
 		def, err := interpolate.Render(v.Default, ctx)
@@ -298,6 +483,18 @@ func (c *Core) init() error {
 				k, err)
 		}
 
+		if v.Sensitive {
+			c.addSensitive(k, def)
+		}
+
+		// Defaults that are interpolated can only be checked now
+		if def != v.Default {
+			if err := v.ValidateValue(def); err != nil {
+				return fmt.Errorf(
+					"default value for '%s': %s", k, err)
+			}
+		}
+
 		c.variables[k] = def
 	}
 
@@ -308,3 +505,116 @@ func (c *Core) init() error {
 
 	return nil
 }
+
+// variableOrder returns the names of the variables whose defaults must be
+// interpolated, ordered so that the variables a default references come
+// before it.
+func (c *Core) variableOrder() ([]string, error) {
+	names := make([]string, 0, len(c.Template.Variables))
+	deps := make(map[string][]string)
+	for k, v := range c.Template.Variables {
+		// Required variables and variables that have a value have no
+		// default to interpolate.
+		if v.Required {
+			continue
+		}
+		if _, ok := c.variables[k]; ok {
+			continue
+		}
+
+		refs, err := interpolate.ReferencedUserVariables(v.Default)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error interpolating default value for '%s': %s", k, err)
+		}
+		for _, ref := range refs {
+			if _, ok := c.Template.Variables[ref]; !ok {
+				return nil, fmt.Errorf(
+					"default value for '%s' references undefined variable '%s'",
+					k, ref)
+			}
+		}
+
+		names = append(names, k)
+		deps[k] = refs
+	}
+	sort.Strings(names)
+
+	result := make([]string, 0, len(names))
+	visited := make(map[string]struct{})
+	var visit func(string, []string) error
+	visit = func(k string, stack []string) error {
+		for i, s := range stack {
+			if s == k {
+				cycle := append(stack[i:], k)
+				return fmt.Errorf(
+					"variable default cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		if _, ok := visited[k]; ok {
+			return nil
+		}
+
+		stack = append(stack, k)
+		for _, dep := range deps[k] {
+			if err := visit(dep, stack); err != nil {
+				return err
+			}
+		}
+
+		visited[k] = struct{}{}
+		if _, ok := deps[k]; ok {
+			result = append(result, k)
+		}
+		return nil
+	}
+
+	for _, k := range names {
+		if err := visit(k, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// resolveConfig returns a copy of the configuration with each string
+// interpolated. Strings that can't be interpolated in the given context are
+// kept as they are. A missing configuration is empty.
+func resolveConfig(ctx *interpolate.Context, config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return make(map[string]interface{})
+	}
+
+	return resolveValue(ctx, config).(map[string]interface{})
+}
+
+func resolveValue(ctx *interpolate.Context, raw interface{}) interface{} {
+	switch v := raw.(type) {
+	case string:
+		if result, err := interpolate.Render(v, ctx); err == nil {
+			return result
+		}
+		return v
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			result[k] = resolveValue(ctx, elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = resolveValue(ctx, elem)
+		}
+		return result
+	case []map[string]interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = resolveValue(ctx, elem)
+		}
+		return result
+	default:
+		return v
+	}
+}
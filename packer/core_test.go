@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mitchellh/packer/common/sensitive"
 	configHelper "github.com/mitchellh/packer/helper/config"
 	"github.com/mitchellh/packer/template"
 )
@@ -497,6 +500,38 @@ func TestCoreValidate(t *testing.T) {
 			map[string]string{"foo": "bar"},
 			true,
 		},
+
+		// Typed variables
+		{
+			"validate-typed-variable.json",
+			map[string]string{"region": "us-east-1", "env": "true"},
+			false,
+		},
+
+		{
+			"validate-typed-variable.json",
+			map[string]string{"region": "eu-west-1", "env": "true"},
+			true,
+		},
+
+		{
+			"validate-typed-variable.json",
+			map[string]string{"region": "us-east-1", "env": "true", "count": "many"},
+			true,
+		},
+
+		{
+			"validate-typed-variable.json",
+			map[string]string{"region": "us-east-1", "env": "true", "ami": "foo"},
+			true,
+		},
+
+		// Interpolated default isn't a bool
+		{
+			"validate-typed-variable.json",
+			map[string]string{"region": "us-east-1"},
+			true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -533,6 +568,77 @@ func testComponentFinder() *ComponentFinder {
 	}
 }
 
+func TestCoreResolve(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("resolve.json"))
+	core := TestCore(t, config)
+
+	build, err := core.Resolve("10-build")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &ResolvedBuild{
+		Name: "10-build",
+		Type: "test",
+		Config: map[string]interface{}{
+			"disk_size":    "10",
+			"boot_command": []interface{}{"http://{{ .HTTPIP }}/ks.cfg"},
+			"tags": map[string]interface{}{
+				"name": "10-build-test",
+			},
+		},
+		Provisioners: []*ResolvedProvisioner{
+			{
+				Type: "shell",
+				Config: map[string]interface{}{
+					"inline": []interface{}{"echo overridden"},
+				},
+				PauseBefore: 10 * time.Second,
+			},
+		},
+		PostProcessors: [][]*ResolvedPostProcessor{
+			{
+				{Type: "compress", Config: map[string]interface{}{}},
+			},
+			{
+				{
+					Type:              "upload",
+					Config:            map[string]interface{}{},
+					KeepInputArtifact: true,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(build.Config, expected.Config) {
+		t.Fatalf("bad: %#v", build.Config)
+	}
+	if !reflect.DeepEqual(build.Provisioners, expected.Provisioners) {
+		t.Fatalf("bad: %#v", build.Provisioners[0])
+	}
+	if !reflect.DeepEqual(build.PostProcessors, expected.PostProcessors) {
+		t.Fatalf("bad: %#v %#v", build.PostProcessors[0][0], build.PostProcessors[1][0])
+	}
+
+	build, err = core.Resolve("other")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(build.Provisioners) != 2 || build.Provisioners[1].Type != "file" {
+		t.Fatalf("bad: %#v", build.Provisioners)
+	}
+	if build.Provisioners[0].Config["inline"].([]interface{})[0] != "echo 10" {
+		t.Fatalf("bad: %#v", build.Provisioners[0].Config)
+	}
+	if len(build.PostProcessors) != 2 || build.PostProcessors[1][0].Type != "notify" {
+		t.Fatalf("bad: %#v", build.PostProcessors)
+	}
+
+	if _, err := core.Resolve("missing"); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func testCoreTemplate(t *testing.T, c *CoreConfig, p string) {
 	tpl, err := template.ParseFile(p)
 	if err != nil {
@@ -541,3 +647,159 @@ func testCoreTemplate(t *testing.T, c *CoreConfig, p string) {
 
 	c.Template = tpl
 }
+
+func TestCore_sensitiveVariables(t *testing.T) {
+	os.Setenv("PACKER_TEST_SENSITIVE", "core-test-token")
+	defer os.Setenv("PACKER_TEST_SENSITIVE", "")
+
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("sensitive-variable.json"))
+	config.Variables = map[string]string{"password": "core-test-password"}
+	if _, err := NewCore(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, v := range []string{"core-test-password", "core-test-token"} {
+		if sensitive.Redact(v) != sensitive.Mask {
+			t.Fatalf("%s should be sensitive", v)
+		}
+	}
+
+	if sensitive.Redact("core-test-user") != "core-test-user" {
+		t.Fatal("user should not be sensitive")
+	}
+}
+
+func TestCore_sensitiveVariablesShort(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("sensitive-variable.json"))
+	config.Variables = map[string]string{"password": "pin"}
+	core, err := NewCore(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	warnings := core.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'password'") {
+		t.Fatalf("bad: %#v", warnings)
+	}
+}
+
+func TestCore_variableDefaults(t *testing.T) {
+	cases := []struct {
+		Vars   map[string]string
+		Result map[string]string
+	}{
+		{
+			nil,
+			map[string]string{
+				"name":   "app-us-east-1a",
+				"prefix": "app",
+				"region": "us-east-1",
+				"zone":   "us-east-1a",
+			},
+		},
+
+		{
+			map[string]string{"region": "eu-west-1", "prefix": "web"},
+			map[string]string{
+				"name":   "web-eu-west-1a",
+				"prefix": "web",
+				"region": "eu-west-1",
+				"zone":   "eu-west-1a",
+			},
+		},
+
+		// A value that is set doesn't need the default's references
+		{
+			map[string]string{"zone": "b"},
+			map[string]string{
+				"name":   "app-b",
+				"prefix": "app",
+				"region": "us-east-1",
+				"zone":   "b",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		config := TestCoreConfig(t)
+		testCoreTemplate(t, config, fixtureDir("variable-defaults.json"))
+		config.Variables = tc.Vars
+		core, err := NewCore(config)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !reflect.DeepEqual(core.variables, tc.Result) {
+			t.Fatalf("bad: %#v\n\n%#v", tc.Vars, core.variables)
+		}
+	}
+}
+
+func TestCore_variableDefaultsBad(t *testing.T) {
+	cases := []struct {
+		File string
+		Err  string
+	}{
+		{
+			"variable-defaults-cycle.json",
+			"variable default cycle: a -> b -> c -> a",
+		},
+
+		{
+			"variable-defaults-undefined.json",
+			"default value for 'a' references undefined variable 'nope'",
+		},
+	}
+
+	for _, tc := range cases {
+		config := TestCoreConfig(t)
+		testCoreTemplate(t, config, fixtureDir(tc.File))
+		_, err := NewCore(config)
+		if err == nil {
+			t.Fatalf("%s: should error", tc.File)
+		}
+		if err.Error() != tc.Err {
+			t.Fatalf("%s: bad error: %s", tc.File, err)
+		}
+	}
+}
+
+func TestCoreBuildOrder(t *testing.T) {
+	config := TestCoreConfig(t)
+	testCoreTemplate(t, config, fixtureDir("build-depends-on.json"))
+	core := TestCore(t, config)
+
+	if deps := core.BuildDependencies("c"); !reflect.DeepEqual(deps, []string{"a-x", "b"}) {
+		t.Fatalf("bad: %#v", deps)
+	}
+
+	cases := []struct {
+		Input  []string
+		Output []string
+	}{
+		{
+			[]string{"a-x", "b", "c", "d"},
+			[]string{"b", "a-x", "c", "d"},
+		},
+
+		{
+			[]string{"d", "c", "b", "a-x"},
+			[]string{"d", "b", "a-x", "c"},
+		},
+
+		// Dependencies that aren't built are ignored
+		{
+			[]string{"c", "a-x"},
+			[]string{"a-x", "c"},
+		},
+	}
+
+	for _, tc := range cases {
+		actual := core.BuildOrder(tc.Input)
+		if !reflect.DeepEqual(actual, tc.Output) {
+			t.Fatalf("bad: %#v\n\n%#v", tc.Input, actual)
+		}
+	}
+}
@@ -19,6 +19,21 @@ func (b *cmdBuilder) Prepare(config ...interface{}) ([]string, error) {
 	return b.builder.Prepare(config...)
 }
 
+// Plan implements packer.BuilderPlanner.
+func (b *cmdBuilder) Plan() ([]string, error) {
+	defer func() {
+		r := recover()
+		b.checkExit(r, nil)
+	}()
+
+	p, ok := b.builder.(packer.BuilderPlanner)
+	if !ok {
+		return nil, nil
+	}
+
+	return p.Plan()
+}
+
 func (b *cmdBuilder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
 	defer func() {
 		r := recover()
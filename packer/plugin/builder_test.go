@@ -2,7 +2,10 @@ package plugin
 
 import (
 	"os/exec"
+	"reflect"
 	"testing"
+
+	"github.com/mitchellh/packer/packer"
 )
 
 func TestBuilder_NoExist(t *testing.T) {
@@ -24,3 +27,54 @@ func TestBuilder_Good(t *testing.T) {
 		t.Fatalf("should not have error: %s", err)
 	}
 }
+
+func TestBuilder_Component(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:       helperProcess("suite"),
+		Component: "two",
+	})
+	defer c.Kill()
+
+	b, err := c.Builder()
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	warns, err := b.Prepare()
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if len(warns) != 1 || warns[0] != "two" {
+		t.Fatalf("should use the builder named two: %#v", warns)
+	}
+}
+
+func TestBuilder_Plan(t *testing.T) {
+	c := NewClient(&ClientConfig{
+		Cmd:       helperProcess("suite"),
+		Component: "two",
+	})
+	defer c.Kill()
+
+	b, err := c.Builder()
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	p, ok := b.(packer.BuilderPlanner)
+	if !ok {
+		t.Fatal("should be a BuilderPlanner")
+	}
+
+	if _, err := b.Prepare(); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	steps, err := p.Plan()
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if !reflect.DeepEqual(steps, []string{"create", "provision"}) {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
@@ -31,13 +31,18 @@ var managedClients = make([]*Client, 0, 5)
 // RPC address, and returning various types of packer interface implementations
 // across the multi-process communication layer.
 type Client struct {
-	config      *ClientConfig
-	exited      bool
-	doneLogging chan struct{}
-	l           sync.Mutex
-	address     net.Addr
+	config       *ClientConfig
+	exited       bool
+	doneLogging  chan struct{}
+	l            sync.Mutex
+	address      net.Addr
+	capabilities []string
 }
 
+// ErrNoManifest is returned for plugins that are too old to serve a
+// manifest of their components.
+var ErrNoManifest = errors.New("plugin doesn't serve a manifest")
+
 // ClientConfig is the configuration used to initialize a new
 // plugin client. After being used to initialize a plugin client,
 // that configuration must not be modified again.
@@ -64,6 +69,11 @@ type ClientConfig struct {
 	// If non-nil, then the stderr of the client will be written to here
 	// (as well as the log).
 	Stderr io.Writer
+
+	// Component is the name of the component to use from a plugin that
+	// serves several components of the same type. It is empty for plugins
+	// that serve a single component.
+	Component string
 }
 
 // This makes sure all the managed subprocesses are killed and properly
@@ -135,7 +145,7 @@ func (c *Client) Builder() (packer.Builder, error) {
 		return nil, err
 	}
 
-	return &cmdBuilder{client.Builder(), c}, nil
+	return &cmdBuilder{client.NamedBuilder(c.config.Component), c}, nil
 }
 
 // Returns a hook implementation that is communicating over this
@@ -149,6 +159,36 @@ func (c *Client) Hook() (packer.Hook, error) {
 	return &cmdHook{client.Hook(), c}, nil
 }
 
+// Manifest returns the manifest of the plugin, which describes the API
+// version it speaks and the components it provides. If the client hasn't
+// been started, this will start it.
+//
+// A plugin serves a single connection, so the client can't be used for
+// anything else after reading the manifest.
+func (c *Client) Manifest() (*packrpc.PluginManifest, error) {
+	if _, err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	if !c.hasCapability(CapabilityManifest) {
+		return nil, ErrNoManifest
+	}
+
+	client, err := c.packrpcClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	manifest, err := client.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.APIVersion = APIVersion
+	return manifest, nil
+}
+
 // Returns a post-processor implementation that is communicating over
 // this client. If the client hasn't been started, this will start it.
 func (c *Client) PostProcessor() (packer.PostProcessor, error) {
@@ -157,7 +197,7 @@ func (c *Client) PostProcessor() (packer.PostProcessor, error) {
 		return nil, err
 	}
 
-	return &cmdPostProcessor{client.PostProcessor(), c}, nil
+	return &cmdPostProcessor{client.NamedPostProcessor(c.config.Component), c}, nil
 }
 
 // Returns a provisioner implementation that is communicating over this
@@ -168,7 +208,7 @@ func (c *Client) Provisioner() (packer.Provisioner, error) {
 		return nil, err
 	}
 
-	return &cmdProvisioner{client.Provisioner(), c}, nil
+	return &cmdProvisioner{client.NamedProvisioner(c.config.Component), c}, nil
 }
 
 // End the executing subprocess (if it is running) and perform any cleanup
@@ -210,6 +250,7 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		fmt.Sprintf("%s=%s", MagicCookieKey, MagicCookieValue),
 		fmt.Sprintf("PACKER_PLUGIN_MIN_PORT=%d", c.config.MinPort),
 		fmt.Sprintf("PACKER_PLUGIN_MAX_PORT=%d", c.config.MaxPort),
+		fmt.Sprintf("%s=%s", APIVersionKey, APIVersion),
 	}
 
 	stdout_r, stdout_w := io.Pipe()
@@ -310,7 +351,7 @@ func (c *Client) Start() (addr net.Addr, err error) {
 		// Trim the line and split by "|" in order to get the parts of
 		// the output.
 		line := strings.TrimSpace(string(lineBytes))
-		parts := strings.SplitN(line, "|", 3)
+		parts := strings.SplitN(line, "|", 4)
 		if len(parts) < 3 {
 			err = fmt.Errorf("Unrecognized remote plugin message: %s", line)
 			return
@@ -318,11 +359,20 @@ func (c *Client) Start() (addr net.Addr, err error) {
 
 		// Test the API version
 		if parts[0] != APIVersion {
-			err = fmt.Errorf("Incompatible API version with plugin. "+
-				"Plugin version: %s, Ours: %s", parts[0], APIVersion)
+			err = fmt.Errorf(
+				"Incompatible API version with plugin %s. The plugin speaks "+
+					"version %s, but this version of Packer speaks version %s. "+
+					"The plugin must be built against a version of Packer that "+
+					"speaks version %s.",
+				filepath.Base(cmd.Path), parts[0], APIVersion, APIVersion)
 			return
 		}
 
+		// Plugins that are too old to negotiate send no capabilities
+		if len(parts) > 3 && parts[3] != "" {
+			c.capabilities = strings.Split(parts[3], ",")
+		}
+
 		switch parts[1] {
 		case "tcp":
 			addr, err = net.ResolveTCPAddr("tcp", parts[2])
@@ -337,6 +387,21 @@ func (c *Client) Start() (addr net.Addr, err error) {
 	return
 }
 
+// hasCapability tells whether the plugin said it supports a capability
+// when it started.
+func (c *Client) hasCapability(capability string) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	for _, v := range c.capabilities {
+		if v == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Client) logStderr(r io.Reader) {
 	bufR := bufio.NewReader(r)
 	for {
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	packrpc "github.com/mitchellh/packer/packer/rpc"
 )
 
 func TestClient(t *testing.T) {
@@ -54,6 +57,35 @@ func TestClientStart_badVersion(t *testing.T) {
 	if err == nil {
 		t.Fatal("err should not be nil")
 	}
+	if !strings.Contains(err.Error(), "speaks version "+APIVersion+"1") {
+		t.Fatalf("error should name the plugin version: %s", err)
+	}
+}
+
+func TestClient_Manifest(t *testing.T) {
+	c := NewClient(&ClientConfig{Cmd: helperProcess("builder")})
+	defer c.Kill()
+
+	manifest, err := c.Manifest()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if manifest.APIVersion != APIVersion {
+		t.Fatalf("bad: %#v", manifest)
+	}
+	if len(manifest.Components) != 1 || manifest.Components[0].Type != "builder" {
+		t.Fatalf("bad: %#v", manifest.Components)
+	}
+}
+
+func TestClient_ManifestOld(t *testing.T) {
+	c := NewClient(&ClientConfig{Cmd: helperProcess("mock")})
+	defer c.Kill()
+
+	if _, err := c.Manifest(); err != ErrNoManifest {
+		t.Fatalf("err: %s", err)
+	}
 }
 
 func TestClient_Start_Timeout(t *testing.T) {
@@ -143,3 +175,22 @@ func TestClient_Stdin(t *testing.T) {
 		t.Fatal("process didn't exit cleanly")
 	}
 }
+
+func TestClient_ManifestComponents(t *testing.T) {
+	c := NewClient(&ClientConfig{Cmd: helperProcess("suite")})
+	defer c.Kill()
+
+	manifest, err := c.Manifest()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []packrpc.PluginComponent{
+		{Type: "builder", Name: "one"},
+		{Type: "builder", Name: "two"},
+		{Type: "provisioner", Name: "one"},
+	}
+	if !reflect.DeepEqual(manifest.Components, expected) {
+		t.Fatalf("bad: %#v", manifest.Components)
+	}
+}
@@ -90,6 +90,19 @@ func TestHelperProcess(*testing.T) {
 		}
 		server.RegisterProvisioner(new(packer.MockProvisioner))
 		server.Serve()
+	case "suite":
+		server, err := Server()
+		if err != nil {
+			log.Printf("[ERR] %s", err)
+			os.Exit(1)
+		}
+		server.RegisterNamedBuilder("one", new(packer.MockBuilder))
+		server.RegisterNamedBuilder("two", &packer.MockBuilder{
+			PrepareWarnings: []string{"two"},
+			PlanSteps:       []string{"create", "provision"},
+		})
+		server.RegisterNamedProvisioner("one", new(packer.MockProvisioner))
+		server.Serve()
 	case "start-timeout":
 		time.Sleep(1 * time.Minute)
 		os.Exit(1)
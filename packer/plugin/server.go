@@ -19,6 +19,7 @@ import (
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -36,6 +37,20 @@ const MagicCookieValue = "d602bf8f470bc67ca7faa0386276bbdd4330efaf76d1a219cb4d69
 // know how to speak it.
 const APIVersion = "4"
 
+// APIVersionKey is the environment variable that Packer sets to the API
+// version it speaks when it starts a plugin. Plugins only answer with
+// their capabilities when it is set, older versions of Packer don't
+// understand them.
+const APIVersionKey = "PACKER_PLUGIN_API_VERSION"
+
+// CapabilityManifest is the capability of serving the manifest of the
+// components a plugin provides.
+const CapabilityManifest = "manifest"
+
+// Capabilities are the optional features of the plugin protocol that this
+// side supports. They are sent along with the RPC address.
+var Capabilities = []string{CapabilityManifest}
+
 // Server waits for a connection to this plugin and returns a Packer
 // RPC server that you can use to register components and serve them.
 func Server() (*packrpc.Server, error) {
@@ -68,13 +83,25 @@ func Server() (*packrpc.Server, error) {
 	}
 	defer listener.Close()
 
+	// Packer checks the API version, but log a mismatch here too since
+	// this is where the plugin author will look.
+	coreVersion := os.Getenv(APIVersionKey)
+	if coreVersion != "" && coreVersion != APIVersion {
+		log.Printf("[ERR] Packer speaks plugin API version %s, but this plugin speaks %s",
+			coreVersion, APIVersion)
+	}
+
 	// Output the address to stdout
 	log.Printf("Plugin address: %s %s\n",
 		listener.Addr().Network(), listener.Addr().String())
-	fmt.Printf("%s|%s|%s\n",
+	handshake := fmt.Sprintf("%s|%s|%s",
 		APIVersion,
 		listener.Addr().Network(),
 		listener.Addr().String())
+	if coreVersion != "" {
+		handshake += "|" + strings.Join(Capabilities, ",")
+	}
+	fmt.Println(handshake)
 	os.Stdout.Sync()
 
 	// Accept a connection
@@ -32,8 +32,18 @@ type ProvisionHook struct {
 	// be prepared (by calling Prepare) at some earlier stage.
 	Provisioners []Provisioner
 
+	// The types of the provisioners, in the same order as Provisioners.
+	// These are only used to name the provisioners in machine-readable
+	// output and may be left empty.
+	ProvisionerTypes []string
+
+	// The retry policies of the provisioners, in the same order as
+	// Provisioners. Provisioners without a policy aren't retried.
+	Retries []*RetryPolicy
+
 	lock               sync.Mutex
 	runningProvisioner Provisioner
+	cancelCh           chan struct{}
 }
 
 // Runs the provisioners in order.
@@ -50,19 +60,54 @@ func (h *ProvisionHook) Run(name string, ui Ui, comm Communicator, data interfac
 				"then a communicator is required. Please fix this to continue.")
 	}
 
+	cancelCh := make(chan struct{})
+	h.lock.Lock()
+	h.cancelCh = cancelCh
+	h.lock.Unlock()
+
 	defer func() {
 		h.lock.Lock()
 		defer h.lock.Unlock()
 
 		h.runningProvisioner = nil
+		h.cancelCh = nil
 	}()
 
-	for _, p := range h.Provisioners {
+	for i, p := range h.Provisioners {
 		h.lock.Lock()
 		h.runningProvisioner = p
 		h.lock.Unlock()
 
-		if err := p.Provision(ui, comm); err != nil {
+		pType := fmt.Sprintf("provisioner-%d", i)
+		if i < len(h.ProvisionerTypes) {
+			pType = h.ProvisionerTypes[i]
+		}
+
+		var retry *RetryPolicy
+		if i < len(h.Retries) {
+			retry = h.Retries[i]
+		}
+
+		err := retry.Run(ui, pType, cancelCh, func() error {
+			if ui != nil {
+				ui.Machine("provisioner-start", pType)
+			}
+
+			start := time.Now()
+			err := p.Provision(ui, comm)
+
+			if ui != nil {
+				duration := MachineDuration(time.Since(start))
+				if err != nil {
+					ui.Machine("provisioner-finish", pType, duration, "error", err.Error())
+				} else {
+					ui.Machine("provisioner-finish", pType, duration, "success")
+				}
+			}
+
+			return err
+		})
+		if err != nil {
 			return err
 		}
 	}
@@ -75,6 +120,11 @@ func (h *ProvisionHook) Cancel() {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
+	if h.cancelCh != nil {
+		close(h.cancelCh)
+		h.cancelCh = nil
+	}
+
 	if h.runningProvisioner != nil {
 		h.runningProvisioner.Cancel()
 	}
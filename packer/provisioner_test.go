@@ -1,6 +1,7 @@
 package packer
 
 import (
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -97,6 +98,33 @@ func TestProvisionHook_cancel(t *testing.T) {
 	}
 }
 
+func TestProvisionHook_retry(t *testing.T) {
+	calls := 0
+	p := &MockProvisioner{
+		ProvFunc: func() error {
+			calls++
+			if calls < 2 {
+				return errors.New("ssh: handshake failed: EOF")
+			}
+			return nil
+		},
+	}
+
+	hook := &ProvisionHook{
+		Provisioners: []Provisioner{p},
+		Retries: []*RetryPolicy{
+			{MaxAttempts: 2, On: []string{"ssh"}},
+		},
+	}
+
+	if err := hook.Run("foo", testUi(), new(MockCommunicator), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if calls != 2 {
+		t.Fatalf("bad: %d", calls)
+	}
+}
+
 // TODO(mitchellh): Test that they're run in the proper order
 
 func TestPausedProvisioner_impl(t *testing.T) {
@@ -0,0 +1,183 @@
+package packer
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/packer/template"
+)
+
+// retryPatterns are the messages, in lowercase, that identify each class
+// of errors. Errors are matched by their message since most of them come
+// from plugins over RPC and lose their type.
+var retryPatterns = map[string][]string{
+	template.RetryOnAPI: {
+		"bad gateway",
+		"internal server error",
+		"internalerror",
+		"rate limit",
+		"requestlimitexceeded",
+		"service unavailable",
+		"serviceunavailable",
+		"throttl",
+		"too many requests",
+	},
+	template.RetryOnNetwork: {
+		"broken pipe",
+		"connection refused",
+		"connection reset",
+		"i/o timeout",
+		"network is unreachable",
+		"no route to host",
+		"no such host",
+		"tls handshake",
+		"unexpected eof",
+	},
+	// Only the SSH errors of connections that were cut or not accepted
+	// yet, such as while sshd starts. Errors like failed authentication
+	// or unknown host keys won't go away by trying again.
+	template.RetryOnSSH: {
+		"connection refused",
+		"connection reset",
+		"i/o timeout",
+		"ssh: disconnect",
+		"ssh: handshake failed: eof",
+		"ssh: handshake failed: read tcp",
+		"remote command exited without exit status",
+		"use of closed network connection",
+	},
+	template.RetryOnTimeout: {
+		"deadline exceeded",
+		"timed out",
+		"timeout",
+	},
+}
+
+// RetryPolicy re-runs an operation that failed, waiting longer between
+// each attempt, in the same way as common.Retry. It is configured by the
+// "retry" setting of templates and provisioners.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the operation is run in total.
+	// The operation is only run once if it is 1 or less.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. The wait is
+	// doubled after every attempt, up to MaxBackoff if it is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// On are the classes of errors that are retried. Any error is retried
+	// if it is empty.
+	On []string
+}
+
+// NewRetryPolicy creates the policy configured in a template. It returns
+// nil if the configuration is nil, and a nil policy never retries.
+func NewRetryPolicy(config *template.Retry) *RetryPolicy {
+	if config == nil {
+		return nil
+	}
+
+	return &RetryPolicy{
+		MaxAttempts: config.MaxAttempts,
+		Backoff:     config.Backoff,
+		MaxBackoff:  config.MaxBackoff,
+		On:          config.On,
+	}
+}
+
+// Retryable returns true if the error is in one of the classes of errors
+// that the policy retries.
+func (p *RetryPolicy) Retryable(err error) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.On) == 0 {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, class := range p.On {
+		if class == template.RetryOnAny {
+			return true
+		}
+
+		for _, pattern := range retryPatterns[class] {
+			if strings.Contains(msg, pattern) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Run calls f until it succeeds, fails with an error that isn't retried,
+// runs out of attempts or cancelCh is closed. Each failed attempt that is
+// retried is reported to the Ui under the given name.
+//
+// If f failed more than once, the error is a MultiError with the errors of
+// all the attempts. Otherwise it is the error returned by f.
+func (p *RetryPolicy) Run(ui Ui, name string, cancelCh <-chan struct{}, f func() error) error {
+	attempts := 1
+	var backoff time.Duration
+	if p != nil {
+		if p.MaxAttempts > 1 {
+			attempts = p.MaxAttempts
+		}
+		backoff = p.Backoff
+	}
+
+	var errs []error
+	var err error
+	for i := 1; ; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("attempt %d: %s", i, err))
+		if i >= attempts || !p.Retryable(err) || isClosed(cancelCh) {
+			break
+		}
+
+		log.Printf("%s failed on attempt %d of %d: %s", name, i, attempts, err)
+		if ui != nil {
+			ui.Error(fmt.Sprintf(
+				"%s failed (attempt %d of %d): %s", name, i, attempts, err))
+			ui.Say(fmt.Sprintf("Retrying %s in %s...", name, backoff))
+			ui.Machine("retry", name,
+				strconv.Itoa(i), strconv.Itoa(attempts), err.Error())
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-cancelCh:
+			return &MultiError{errs}
+		}
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+
+	if len(errs) == 1 {
+		return err
+	}
+
+	return &MultiError{errs}
+}
+
+// isClosed returns true if the channel is closed. A nil channel is never
+// closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
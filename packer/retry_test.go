@@ -0,0 +1,148 @@
+package packer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/packer/template"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	if p := NewRetryPolicy(nil); p != nil {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	p := NewRetryPolicy(&template.Retry{
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		On:          []string{"ssh"},
+	})
+	if p.MaxAttempts != 3 || p.Backoff != time.Second || len(p.On) != 1 {
+		t.Fatalf("bad: %#v", p)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	cases := []struct {
+		On     []string
+		Err    string
+		Result bool
+	}{
+		{nil, "anything", true},
+		{[]string{"any"}, "anything", true},
+		{[]string{"ssh"}, "ssh: handshake failed: EOF", true},
+		{[]string{"ssh"}, "ssh: handshake failed: read tcp 10.0.0.2:50000->10.0.0.1:22: read: connection reset by peer", true},
+		{[]string{"ssh"}, "wait: remote command exited without exit status or exit signal", true},
+		{[]string{"ssh"}, "ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]", false},
+		{[]string{"ssh"}, "ssh: handshake failed: knownhosts: key mismatch", false},
+		{[]string{"ssh"}, "ssh: subsystem request failed", false},
+		{[]string{"ssh"}, "Script exited with non-zero exit status: 1", false},
+		{[]string{"timeout"}, "Timeout waiting for SSH.", true},
+		{[]string{"network"}, "dial tcp 10.0.0.1:22: getsockopt: connection refused", true},
+		{[]string{"api"}, "RequestLimitExceeded: Request limit exceeded.", true},
+		{[]string{"api", "network"}, "Throttling: Rate exceeded", true},
+		{[]string{"api", "network"}, "ssh: unable to authenticate", false},
+	}
+
+	for _, tc := range cases {
+		p := &RetryPolicy{On: tc.On}
+		if actual := p.Retryable(errors.New(tc.Err)); actual != tc.Result {
+			t.Fatalf("bad: %#v %q: %v", tc.On, tc.Err, actual)
+		}
+	}
+
+	var p *RetryPolicy
+	if p.Retryable(errors.New("foo")) {
+		t.Fatal("nil policy should never retry")
+	}
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3}
+
+	// Succeeds on the last attempt
+	calls := 0
+	err := p.Run(testUi(), "test", nil, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("foo")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if calls != 3 {
+		t.Fatalf("bad: %d", calls)
+	}
+
+	// Fails every attempt
+	calls = 0
+	err = p.Run(testUi(), "test", nil, func() error {
+		calls++
+		return errors.New("foo")
+	})
+	if calls != 3 {
+		t.Fatalf("bad: %d", calls)
+	}
+	merr, ok := err.(*MultiError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(merr.Errors) != 3 || merr.Errors[2].Error() != "attempt 3: foo" {
+		t.Fatalf("bad: %#v", merr.Errors)
+	}
+}
+
+func TestRetryPolicyRun_notRetryable(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, On: []string{"ssh"}}
+
+	calls := 0
+	expected := errors.New("exit status 1")
+	err := p.Run(testUi(), "test", nil, func() error {
+		calls++
+		return expected
+	})
+	if calls != 1 {
+		t.Fatalf("bad: %d", calls)
+	}
+	if err != expected {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestRetryPolicyRun_nil(t *testing.T) {
+	var p *RetryPolicy
+
+	calls := 0
+	expected := errors.New("foo")
+	err := p.Run(nil, "test", nil, func() error {
+		calls++
+		return expected
+	})
+	if calls != 1 {
+		t.Fatalf("bad: %d", calls)
+	}
+	if err != expected {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestRetryPolicyRun_cancel(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+
+	cancelCh := make(chan struct{})
+	calls := 0
+	err := p.Run(testUi(), "test", cancelCh, func() error {
+		calls++
+		close(cancelCh)
+		return errors.New("foo")
+	})
+	if calls != 1 {
+		t.Fatalf("bad: %d", calls)
+	}
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
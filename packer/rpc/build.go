@@ -86,6 +86,18 @@ func (b *build) SetOnError(val string) {
 	}
 }
 
+func (b *build) SetResume(val bool) {
+	if err := b.client.Call("Build.SetResume", val, new(interface{})); err != nil {
+		panic(err)
+	}
+}
+
+func (b *build) SetBuildArtifacts(val map[string]map[string]string) {
+	if err := b.client.Call("Build.SetBuildArtifacts", val, new(interface{})); err != nil {
+		panic(err)
+	}
+}
+
 func (b *build) Cancel() {
 	if err := b.client.Call("Build.Cancel", new(interface{}), new(interface{})); err != nil {
 		panic(err)
@@ -146,6 +158,16 @@ func (b *BuildServer) SetOnError(val *string, reply *interface{}) error {
 	return nil
 }
 
+func (b *BuildServer) SetResume(val *bool, reply *interface{}) error {
+	b.build.SetResume(*val)
+	return nil
+}
+
+func (b *BuildServer) SetBuildArtifacts(val map[string]map[string]string, reply *interface{}) error {
+	b.build.SetBuildArtifacts(val)
+	return nil
+}
+
 func (b *BuildServer) Cancel(args *interface{}, reply *interface{}) error {
 	b.build.Cancel()
 	return nil
@@ -20,8 +20,11 @@ type testBuild struct {
 	setDebugCalled   bool
 	setForceCalled   bool
 	setOnErrorCalled bool
+	setResumeCalled  bool
 	cancelCalled     bool
 
+	setBuildArtifacts map[string]map[string]string
+
 	errRunResult bool
 }
 
@@ -59,6 +62,14 @@ func (b *testBuild) SetOnError(string) {
 	b.setOnErrorCalled = true
 }
 
+func (b *testBuild) SetResume(bool) {
+	b.setResumeCalled = true
+}
+
+func (b *testBuild) SetBuildArtifacts(val map[string]map[string]string) {
+	b.setBuildArtifacts = val
+}
+
 func (b *testBuild) Cancel() {
 	b.cancelCalled = true
 }
@@ -128,6 +139,19 @@ func TestBuild(t *testing.T) {
 		t.Fatal("should be called")
 	}
 
+	// Test SetResume
+	bClient.SetResume(true)
+	if !b.setResumeCalled {
+		t.Fatal("should be called")
+	}
+
+	// Test SetBuildArtifacts
+	buildArtifacts := map[string]map[string]string{"base": {"id": "foo"}}
+	bClient.SetBuildArtifacts(buildArtifacts)
+	if !reflect.DeepEqual(b.setBuildArtifacts, buildArtifacts) {
+		t.Fatalf("bad: %#v", b.setBuildArtifacts)
+	}
+
 	// Test Cancel
 	bClient.Cancel()
 	if !b.cancelCalled {
@@ -9,8 +9,9 @@ import (
 // An implementation of packer.Builder where the builder is actually executed
 // over an RPC connection.
 type builder struct {
-	client *rpc.Client
-	mux    *muxBroker
+	client   *rpc.Client
+	mux      *muxBroker
+	endpoint string
 }
 
 // BuilderServer wraps a packer.Builder implementation and makes it exportable
@@ -31,7 +32,7 @@ type BuilderPrepareResponse struct {
 
 func (b *builder) Prepare(config ...interface{}) ([]string, error) {
 	var resp BuilderPrepareResponse
-	cerr := b.client.Call("Builder.Prepare", &BuilderPrepareArgs{config}, &resp)
+	cerr := b.client.Call(b.endpoint+".Prepare", &BuilderPrepareArgs{config}, &resp)
 	if cerr != nil {
 		return nil, cerr
 	}
@@ -43,6 +44,26 @@ func (b *builder) Prepare(config ...interface{}) ([]string, error) {
 	return resp.Warnings, err
 }
 
+type BuilderPlanResponse struct {
+	Steps []string
+	Error *BasicError
+}
+
+func (b *builder) Plan() ([]string, error) {
+	var resp BuilderPlanResponse
+	if err := b.client.Call(b.endpoint+".Plan", new(interface{}), &resp); err != nil {
+		// Plugins built with older versions of Packer can't describe
+		// their steps.
+		log.Printf("Error planning builder: %s", err)
+		return nil, nil
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return resp.Steps, nil
+}
+
 func (b *builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
 	nextId := b.mux.NextId()
 	server := newServerWithMux(b.mux, nextId)
@@ -52,7 +73,7 @@ func (b *builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	go server.Serve()
 
 	var responseId uint32
-	if err := b.client.Call("Builder.Run", nextId, &responseId); err != nil {
+	if err := b.client.Call(b.endpoint+".Run", nextId, &responseId); err != nil {
 		return nil, err
 	}
 
@@ -69,7 +90,7 @@ func (b *builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 }
 
 func (b *builder) Cancel() {
-	if err := b.client.Call("Builder.Cancel", new(interface{}), new(interface{})); err != nil {
+	if err := b.client.Call(b.endpoint+".Cancel", new(interface{}), new(interface{})); err != nil {
 		log.Printf("Error cancelling builder: %s", err)
 	}
 }
@@ -83,6 +104,18 @@ func (b *BuilderServer) Prepare(args *BuilderPrepareArgs, reply *BuilderPrepareR
 	return nil
 }
 
+func (b *BuilderServer) Plan(args *interface{}, reply *BuilderPlanResponse) error {
+	if p, ok := b.builder.(packer.BuilderPlanner); ok {
+		steps, err := p.Plan()
+		*reply = BuilderPlanResponse{
+			Steps: steps,
+			Error: NewBasicError(err),
+		}
+	}
+
+	return nil
+}
+
 func (b *BuilderServer) Run(streamId uint32, reply *uint32) error {
 	client, err := newClientWithMux(b.mux, streamId)
 	if err != nil {
@@ -57,6 +57,45 @@ func TestBuilderPrepare_Warnings(t *testing.T) {
 	}
 }
 
+func TestBuilderPlan(t *testing.T) {
+	b := new(packer.MockBuilder)
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterBuilder(b)
+	bClient := client.Builder()
+
+	expected := []string{"StepOne", "StepTwo"}
+	b.PlanSteps = expected
+
+	steps, err := bClient.(packer.BuilderPlanner).Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !b.PlanCalled {
+		t.Fatal("plan should be called")
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
+
+func TestBuilderPlan_notPlanner(t *testing.T) {
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterBuilder(struct{ packer.Builder }{new(packer.MockBuilder)})
+	bClient := client.Builder()
+
+	steps, err := bClient.(packer.BuilderPlanner).Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if steps != nil {
+		t.Fatalf("bad: %#v", steps)
+	}
+}
+
 func TestBuilderRun(t *testing.T) {
 	b := new(packer.MockBuilder)
 	client, server := testClientServer(t)
@@ -23,6 +23,11 @@ type CacheRLockResponse struct {
 	Exists bool
 }
 
+type CacheDescribeArgs struct {
+	Key  string
+	Info packer.CacheInfo
+}
+
 func (c *cache) Lock(key string) (result string) {
 	if err := c.client.Call("Cache.Lock", key, &result); err != nil {
 		log.Printf("[ERR] Cache.Lock error: %s", err)
@@ -56,6 +61,23 @@ func (c *cache) RUnlock(key string) {
 	}
 }
 
+func (c *cache) Describe(key string, info packer.CacheInfo) {
+	args := &CacheDescribeArgs{Key: key, Info: info}
+	if err := c.client.Call("Cache.Describe", args, new(interface{})); err != nil {
+		log.Printf("[ERR] Cache.Describe error: %s", err)
+		return
+	}
+}
+
+func (c *cache) Find(key string) (result []string) {
+	if err := c.client.Call("Cache.Find", key, &result); err != nil {
+		log.Printf("[ERR] Cache.Find error: %s", err)
+		return nil
+	}
+
+	return
+}
+
 func (c *CacheServer) Lock(key string, result *string) error {
 	*result = c.cache.Lock(key)
 	return nil
@@ -76,3 +98,19 @@ func (c *CacheServer) RUnlock(key string, result *interface{}) error {
 	c.cache.RUnlock(key)
 	return nil
 }
+
+func (c *CacheServer) Describe(args *CacheDescribeArgs, result *interface{}) error {
+	if d, ok := c.cache.(packer.CacheDescriber); ok {
+		d.Describe(args.Key, args.Info)
+	}
+
+	return nil
+}
+
+func (c *CacheServer) Find(key string, result *[]string) error {
+	if f, ok := c.cache.(packer.CacheFinder); ok {
+		*result = f.Find(key)
+	}
+
+	return nil
+}
@@ -1,8 +1,10 @@
 package rpc
 
 import (
-	"github.com/mitchellh/packer/packer"
+	"reflect"
 	"testing"
+
+	"github.com/mitchellh/packer/packer"
 )
 
 type testCache struct {
@@ -14,6 +16,9 @@ type testCache struct {
 	rlockKey      string
 	runlockCalled bool
 	runlockKey    string
+	describeKey   string
+	describeInfo  packer.CacheInfo
+	findKey       string
 }
 
 func (t *testCache) Lock(key string) string {
@@ -38,8 +43,20 @@ func (t *testCache) RUnlock(key string) {
 	t.runlockKey = key
 }
 
+func (t *testCache) Describe(key string, info packer.CacheInfo) {
+	t.describeKey = key
+	t.describeInfo = info
+}
+
+func (t *testCache) Find(key string) []string {
+	t.findKey = key
+	return []string{"bar"}
+}
+
 func TestCache_Implements(t *testing.T) {
 	var _ packer.Cache = new(cache)
+	var _ packer.CacheDescriber = new(cache)
+	var _ packer.CacheFinder = new(cache)
 }
 
 func TestCacheRPC(t *testing.T) {
@@ -89,4 +106,23 @@ func TestCacheRPC(t *testing.T) {
 	if c.runlockKey != "foo" {
 		t.Fatalf("bad: %s", c.runlockKey)
 	}
+
+	// Test Describe
+	info := packer.CacheInfo{Source: "bar", ChecksumType: "md5", Checksum: "baz"}
+	cacheClient.(packer.CacheDescriber).Describe("foo", info)
+	if c.describeKey != "foo" {
+		t.Fatalf("bad: %s", c.describeKey)
+	}
+	if !reflect.DeepEqual(c.describeInfo, info) {
+		t.Fatalf("bad: %#v", c.describeInfo)
+	}
+
+	// Test Find
+	paths := cacheClient.(packer.CacheFinder).Find("foo")
+	if c.findKey != "foo" {
+		t.Fatalf("bad: %s", c.findKey)
+	}
+	if !reflect.DeepEqual(paths, []string{"bar"}) {
+		t.Fatalf("bad: %#v", paths)
+	}
 }
@@ -82,9 +82,16 @@ func (c *Client) Build() packer.Build {
 }
 
 func (c *Client) Builder() packer.Builder {
+	return c.NamedBuilder("")
+}
+
+// NamedBuilder returns the builder that was registered under the given
+// name with Server.RegisterNamedBuilder.
+func (c *Client) NamedBuilder(name string) packer.Builder {
 	return &builder{
-		client: c.client,
-		mux:    c.mux,
+		client:   c.client,
+		mux:      c.mux,
+		endpoint: componentEndpoint(DefaultBuilderEndpoint, name),
 	}
 }
 
@@ -108,17 +115,42 @@ func (c *Client) Hook() packer.Hook {
 	}
 }
 
+// Manifest returns the manifest of the components the server serves. The
+// API version isn't known to the server and is left empty.
+func (c *Client) Manifest() (*PluginManifest, error) {
+	var result PluginManifest
+	if err := c.client.Call("Plugin.Manifest", new(interface{}), &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 func (c *Client) PostProcessor() packer.PostProcessor {
+	return c.NamedPostProcessor("")
+}
+
+// NamedPostProcessor returns the post-processor that was registered under
+// the given name with Server.RegisterNamedPostProcessor.
+func (c *Client) NamedPostProcessor(name string) packer.PostProcessor {
 	return &postProcessor{
-		client: c.client,
-		mux:    c.mux,
+		client:   c.client,
+		mux:      c.mux,
+		endpoint: componentEndpoint(DefaultPostProcessorEndpoint, name),
 	}
 }
 
 func (c *Client) Provisioner() packer.Provisioner {
+	return c.NamedProvisioner("")
+}
+
+// NamedProvisioner returns the provisioner that was registered under the
+// given name with Server.RegisterNamedProvisioner.
+func (c *Client) NamedProvisioner(name string) packer.Provisioner {
 	return &provisioner{
-		client: c.client,
-		mux:    c.mux,
+		client:   c.client,
+		mux:      c.mux,
+		endpoint: componentEndpoint(DefaultProvisionerEndpoint, name),
 	}
 }
 
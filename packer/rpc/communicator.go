@@ -53,6 +53,13 @@ type CommunicatorUploadDirArgs struct {
 	Exclude []string
 }
 
+type CommunicatorUploadDirDeltaArgs struct {
+	Dst     string
+	Src     string
+	Exclude []string
+	Options *packer.UploadDirOptions
+}
+
 type CommunicatorDownloadDirArgs struct {
 	Dst     string
 	Src     string
@@ -146,6 +153,22 @@ func (c *communicator) UploadDir(dst string, src string, exclude []string) error
 	return err
 }
 
+func (c *communicator) UploadDirDelta(dst string, src string, exclude []string, opts *packer.UploadDirOptions) (*packer.UploadDirResult, error) {
+	args := &CommunicatorUploadDirDeltaArgs{
+		Dst:     dst,
+		Src:     src,
+		Exclude: exclude,
+		Options: opts,
+	}
+
+	var reply *packer.UploadDirResult
+	if err := c.client.Call("Communicator.UploadDirDelta", args, &reply); err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
 func (c *communicator) DownloadDir(src string, dst string, exclude []string) error {
 	args := &CommunicatorDownloadDirArgs{
 		Dst:     dst,
@@ -162,6 +185,15 @@ func (c *communicator) DownloadDir(src string, dst string, exclude []string) err
 	return err
 }
 
+func (c *communicator) HostKey() (result string) {
+	if err := c.client.Call("Communicator.HostKey", new(interface{}), &result); err != nil {
+		log.Printf("[ERR] Communicator.HostKey error: %s", err)
+		return ""
+	}
+
+	return
+}
+
 func (c *communicator) Download(path string, w io.Writer) (err error) {
 	// Serve a single connection and a single copy
 	streamId := c.mux.NextId()
@@ -285,10 +317,23 @@ func (c *CommunicatorServer) UploadDir(args *CommunicatorUploadDirArgs, reply *e
 	return c.c.UploadDir(args.Dst, args.Src, args.Exclude)
 }
 
+func (c *CommunicatorServer) UploadDirDelta(args *CommunicatorUploadDirDeltaArgs, reply **packer.UploadDirResult) (err error) {
+	*reply, err = packer.UploadDirDelta(c.c, args.Dst, args.Src, args.Exclude, args.Options)
+	return
+}
+
 func (c *CommunicatorServer) DownloadDir(args *CommunicatorUploadDirArgs, reply *error) error {
 	return c.c.DownloadDir(args.Src, args.Dst, args.Exclude)
 }
 
+func (c *CommunicatorServer) HostKey(args *interface{}, reply *string) error {
+	if hk, ok := c.c.(packer.HostKeyCommunicator); ok {
+		*reply = hk.HostKey()
+	}
+
+	return nil
+}
+
 func (c *CommunicatorServer) Download(args *CommunicatorDownloadArgs, reply *interface{}) (err error) {
 	writerC, err := c.mux.Dial(args.WriterStreamId)
 	if err != nil {
@@ -156,6 +156,79 @@ func TestCommunicatorRPC(t *testing.T) {
 	}
 }
 
+func TestCommunicatorHostKey(t *testing.T) {
+	c := &packer.MockCommunicator{HostKeyData: "ssh-rsa AAAA"}
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterCommunicator(c)
+	remote := client.Communicator()
+
+	if key := remote.(packer.HostKeyCommunicator).HostKey(); key != "ssh-rsa AAAA" {
+		t.Fatalf("bad: %s", key)
+	}
+}
+
+func TestCommunicatorHostKey_unknown(t *testing.T) {
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterCommunicator(struct{ packer.Communicator }{new(packer.MockCommunicator)})
+	remote := client.Communicator()
+
+	if key := remote.(packer.HostKeyCommunicator).HostKey(); key != "" {
+		t.Fatalf("bad: %s", key)
+	}
+}
+
+func TestCommunicatorUploadDirDelta(t *testing.T) {
+	c := &packer.MockCommunicator{
+		UploadDirResult: &packer.UploadDirResult{Files: 3, Uploaded: 1, Bytes: 42},
+	}
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterCommunicator(c)
+	remote := client.Communicator()
+
+	opts := &packer.UploadDirOptions{Compare: "checksum", Compress: true}
+	result, err := packer.UploadDirDelta(remote, "dst", "src", []string{"foo"}, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, c.UploadDirResult) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if !reflect.DeepEqual(c.UploadDirOptions, opts) {
+		t.Fatalf("bad: %#v", c.UploadDirOptions)
+	}
+	if c.UploadDirDst != "dst" || c.UploadDirSrc != "src" {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
+func TestCommunicatorUploadDirDelta_unsupported(t *testing.T) {
+	c := new(packer.MockCommunicator)
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterCommunicator(struct{ packer.Communicator }{c})
+	remote := client.Communicator()
+
+	// The whole directory is uploaded instead
+	opts := &packer.UploadDirOptions{Compare: "mtime"}
+	result, err := packer.UploadDirDelta(remote, "dst", "src", nil, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+	if c.UploadDirDst != "dst" || c.UploadDirSrc != "src" || c.UploadDirOptions != nil {
+		t.Fatalf("bad: %#v", c)
+	}
+}
+
 func TestCommunicator_ImplementsCommunicator(t *testing.T) {
 	var raw interface{}
 	raw = Communicator(nil)
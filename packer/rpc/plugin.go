@@ -0,0 +1,34 @@
+package rpc
+
+// PluginComponent is a component that a plugin serves, such as a builder.
+type PluginComponent struct {
+	// Type is the kind of component: "builder", "hook", "post-processor"
+	// or "provisioner".
+	Type string
+
+	// Name is the name the component is registered under. It is empty
+	// for the single component of a plugin, which is named after the
+	// plugin binary.
+	Name string
+}
+
+// PluginManifest describes a plugin: the API version it speaks and the
+// components it serves.
+type PluginManifest struct {
+	APIVersion string
+	Components []PluginComponent
+}
+
+// PluginServer serves the manifest of the components registered on a
+// Server.
+type PluginServer struct {
+	server *Server
+}
+
+func (p *PluginServer) Manifest(args *interface{}, reply *PluginManifest) error {
+	*reply = PluginManifest{
+		Components: p.server.components,
+	}
+
+	return nil
+}
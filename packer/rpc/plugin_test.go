@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/packer/packer"
+)
+
+func TestPluginRPC_manifest(t *testing.T) {
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterBuilder(new(packer.MockBuilder))
+	server.RegisterProvisioner(new(packer.MockProvisioner))
+
+	manifest, err := client.Manifest()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []PluginComponent{
+		{Type: "builder"},
+		{Type: "provisioner"},
+	}
+	if !reflect.DeepEqual(manifest.Components, expected) {
+		t.Fatalf("bad: %#v", manifest.Components)
+	}
+}
+
+func TestPluginRPC_namedComponents(t *testing.T) {
+	b1 := new(packer.MockBuilder)
+	b2 := new(packer.MockBuilder)
+	p := new(packer.MockProvisioner)
+	pp := new(TestPostProcessor)
+
+	client, server := testClientServer(t)
+	defer client.Close()
+	defer server.Close()
+	server.RegisterNamedBuilder("one", b1)
+	server.RegisterNamedBuilder("two", b2)
+	server.RegisterNamedProvisioner("one", p)
+	server.RegisterNamedPostProcessor("one", pp)
+
+	if _, err := client.NamedBuilder("two").Prepare(42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if b1.PrepareCalled || !b2.PrepareCalled {
+		t.Fatal("only the second builder should be called")
+	}
+
+	if err := client.NamedProvisioner("one").Prepare(42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.PrepCalled {
+		t.Fatal("provisioner should be called")
+	}
+
+	if err := client.NamedPostProcessor("one").Configure(42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !pp.configCalled {
+		t.Fatal("post-processor should be called")
+	}
+
+	if _, err := client.NamedBuilder("three").Prepare(42); err == nil {
+		t.Fatal("should have error for an unknown builder")
+	}
+
+	manifest, err := client.Manifest()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []PluginComponent{
+		{Type: "builder", Name: "one"},
+		{Type: "builder", Name: "two"},
+		{Type: "provisioner", Name: "one"},
+		{Type: "post-processor", Name: "one"},
+	}
+	if !reflect.DeepEqual(manifest.Components, expected) {
+		t.Fatalf("bad: %#v", manifest.Components)
+	}
+}
@@ -8,8 +8,9 @@ import (
 // An implementation of packer.PostProcessor where the PostProcessor is actually
 // executed over an RPC connection.
 type postProcessor struct {
-	client *rpc.Client
-	mux    *muxBroker
+	client   *rpc.Client
+	mux      *muxBroker
+	endpoint string
 }
 
 // PostProcessorServer wraps a packer.PostProcessor implementation and makes it
@@ -32,7 +33,7 @@ type PostProcessorProcessResponse struct {
 
 func (p *postProcessor) Configure(raw ...interface{}) (err error) {
 	args := &PostProcessorConfigureArgs{Configs: raw}
-	if cerr := p.client.Call("PostProcessor.Configure", args, new(interface{})); cerr != nil {
+	if cerr := p.client.Call(p.endpoint+".Configure", args, new(interface{})); cerr != nil {
 		err = cerr
 	}
 
@@ -47,7 +48,7 @@ func (p *postProcessor) PostProcess(ui packer.Ui, a packer.Artifact) (packer.Art
 	go server.Serve()
 
 	var response PostProcessorProcessResponse
-	if err := p.client.Call("PostProcessor.PostProcess", nextId, &response); err != nil {
+	if err := p.client.Call(p.endpoint+".PostProcess", nextId, &response); err != nil {
 		return nil, false, err
 	}
 
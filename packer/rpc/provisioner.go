@@ -9,8 +9,9 @@ import (
 // An implementation of packer.Provisioner where the provisioner is actually
 // executed over an RPC connection.
 type provisioner struct {
-	client *rpc.Client
-	mux    *muxBroker
+	client   *rpc.Client
+	mux      *muxBroker
+	endpoint string
 }
 
 // ProvisionerServer wraps a packer.Provisioner implementation and makes it
@@ -26,7 +27,7 @@ type ProvisionerPrepareArgs struct {
 
 func (p *provisioner) Prepare(configs ...interface{}) (err error) {
 	args := &ProvisionerPrepareArgs{configs}
-	if cerr := p.client.Call("Provisioner.Prepare", args, new(interface{})); cerr != nil {
+	if cerr := p.client.Call(p.endpoint+".Prepare", args, new(interface{})); cerr != nil {
 		err = cerr
 	}
 
@@ -40,11 +41,11 @@ func (p *provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
 	server.RegisterUi(ui)
 	go server.Serve()
 
-	return p.client.Call("Provisioner.Provision", nextId, new(interface{}))
+	return p.client.Call(p.endpoint+".Provision", nextId, new(interface{}))
 }
 
 func (p *provisioner) Cancel() {
-	err := p.client.Call("Provisioner.Cancel", new(interface{}), new(interface{}))
+	err := p.client.Call(p.endpoint+".Cancel", new(interface{}), new(interface{}))
 	if err != nil {
 		log.Printf("Provisioner.Cancel err: %s", err)
 	}
@@ -20,6 +20,7 @@ const (
 	DefaultCommandEndpoint              = "Command"
 	DefaultCommunicatorEndpoint         = "Communicator"
 	DefaultHookEndpoint                 = "Hook"
+	DefaultPluginEndpoint               = "Plugin"
 	DefaultPostProcessorEndpoint        = "PostProcessor"
 	DefaultProvisionerEndpoint          = "Provisioner"
 	DefaultUiEndpoint                   = "Ui"
@@ -32,6 +33,10 @@ type Server struct {
 	streamId uint32
 	server   *rpc.Server
 	closeMux bool
+
+	// components are the components registered on the server, which are
+	// listed in its manifest.
+	components []PluginComponent
 }
 
 // NewServer returns a new Packer RPC server.
@@ -39,6 +44,9 @@ func NewServer(conn io.ReadWriteCloser) *Server {
 	mux, _ := newMuxBrokerServer(conn)
 	result := newServerWithMux(mux, 0)
 	result.closeMux = true
+	result.server.RegisterName(DefaultPluginEndpoint, &PluginServer{
+		server: result,
+	})
 	go mux.Run()
 	return result
 }
@@ -75,7 +83,14 @@ func (s *Server) RegisterBuild(b packer.Build) {
 }
 
 func (s *Server) RegisterBuilder(b packer.Builder) {
-	s.server.RegisterName(DefaultBuilderEndpoint, &BuilderServer{
+	s.RegisterNamedBuilder("", b)
+}
+
+// RegisterNamedBuilder registers a builder under a name, so that a plugin
+// can serve several builders. Clients use it with Client.NamedBuilder.
+func (s *Server) RegisterNamedBuilder(name string, b packer.Builder) {
+	s.components = append(s.components, PluginComponent{Type: "builder", Name: name})
+	s.server.RegisterName(componentEndpoint(DefaultBuilderEndpoint, name), &BuilderServer{
 		builder: b,
 		mux:     s.mux,
 	})
@@ -95,6 +110,7 @@ func (s *Server) RegisterCommunicator(c packer.Communicator) {
 }
 
 func (s *Server) RegisterHook(h packer.Hook) {
+	s.components = append(s.components, PluginComponent{Type: "hook"})
 	s.server.RegisterName(DefaultHookEndpoint, &HookServer{
 		hook: h,
 		mux:  s.mux,
@@ -102,14 +118,30 @@ func (s *Server) RegisterHook(h packer.Hook) {
 }
 
 func (s *Server) RegisterPostProcessor(p packer.PostProcessor) {
-	s.server.RegisterName(DefaultPostProcessorEndpoint, &PostProcessorServer{
+	s.RegisterNamedPostProcessor("", p)
+}
+
+// RegisterNamedPostProcessor registers a post-processor under a name, so
+// that a plugin can serve several post-processors. Clients use it with
+// Client.NamedPostProcessor.
+func (s *Server) RegisterNamedPostProcessor(name string, p packer.PostProcessor) {
+	s.components = append(s.components, PluginComponent{Type: "post-processor", Name: name})
+	s.server.RegisterName(componentEndpoint(DefaultPostProcessorEndpoint, name), &PostProcessorServer{
 		mux: s.mux,
 		p:   p,
 	})
 }
 
 func (s *Server) RegisterProvisioner(p packer.Provisioner) {
-	s.server.RegisterName(DefaultProvisionerEndpoint, &ProvisionerServer{
+	s.RegisterNamedProvisioner("", p)
+}
+
+// RegisterNamedProvisioner registers a provisioner under a name, so that
+// a plugin can serve several provisioners. Clients use it with
+// Client.NamedProvisioner.
+func (s *Server) RegisterNamedProvisioner(name string, p packer.Provisioner) {
+	s.components = append(s.components, PluginComponent{Type: "provisioner", Name: name})
+	s.server.RegisterName(componentEndpoint(DefaultProvisionerEndpoint, name), &ProvisionerServer{
 		mux: s.mux,
 		p:   p,
 	})
@@ -141,6 +173,17 @@ func (s *Server) Serve() {
 	s.server.ServeCodec(rpcCodec)
 }
 
+// componentEndpoint returns the endpoint of a component that is
+// registered under a name. Components without a name use the default
+// endpoint.
+func componentEndpoint(endpoint, name string) string {
+	if name == "" {
+		return endpoint
+	}
+
+	return endpoint + ":" + name
+}
+
 // registerComponent registers a single Packer RPC component onto
 // the RPC server. If id is true, then a unique ID number will be appended
 // onto the end of the endpoint.
@@ -3,6 +3,7 @@ package packer
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,11 +11,14 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 	"unicode"
+
+	"github.com/mitchellh/packer/common/sensitive"
 )
 
 type UiColor uint
@@ -31,6 +35,9 @@ const (
 // The Ui interface handles all communication for Packer with the outside
 // world. This sort of control allows us to strictly control how output
 // is formatted and various levels of output.
+//
+// Implementations that write output replace the values marked with the
+// sensitive package, so that secrets are never shown.
 type Ui interface {
 	Ask(string) (string, error)
 	Say(string)
@@ -74,6 +81,30 @@ type MachineReadableUi struct {
 	Writer io.Writer
 }
 
+// JSONUi is a UI that outputs machine-readable output to the given Writer
+// as a stream of newline-delimited JSON events, one event per line.
+type JSONUi struct {
+	Writer io.Writer
+
+	l sync.Mutex
+}
+
+// JSONUiEvent is a single event written by JSONUi. Build is the target of
+// the machine-readable message, usually the name of a build, Type is the
+// machine-readable category and Data holds the remaining arguments.
+type JSONUiEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Build     string    `json:"build,omitempty"`
+	Type      string    `json:"type"`
+	Data      []string  `json:"data"`
+}
+
+// MachineDuration formats a duration for machine-readable output as a
+// decimal number of seconds.
+func MachineDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
 func (u *ColoredUi) Ask(query string) (string, error) {
 	return u.Ui.Ask(u.colorize(query, u.Color, true))
 }
@@ -183,6 +214,7 @@ func (rw *BasicUi) Ask(query string) (string, error) {
 	signal.Notify(sigCh, os.Interrupt)
 	defer signal.Stop(sigCh)
 
+	query = sensitive.Redact(query)
 	log.Printf("ui: ask: %s", query)
 	if query != "" {
 		if _, err := fmt.Fprint(rw.Writer, query+" "); err != nil {
@@ -222,6 +254,7 @@ func (rw *BasicUi) Say(message string) {
 	rw.l.Lock()
 	defer rw.l.Unlock()
 
+	message = sensitive.Redact(message)
 	log.Printf("ui: %s", message)
 	_, err := fmt.Fprint(rw.Writer, message+"\n")
 	if err != nil {
@@ -233,6 +266,7 @@ func (rw *BasicUi) Message(message string) {
 	rw.l.Lock()
 	defer rw.l.Unlock()
 
+	message = sensitive.Redact(message)
 	log.Printf("ui: %s", message)
 	_, err := fmt.Fprint(rw.Writer, message+"\n")
 	if err != nil {
@@ -249,6 +283,7 @@ func (rw *BasicUi) Error(message string) {
 		writer = rw.Writer
 	}
 
+	message = sensitive.Redact(message)
 	log.Printf("ui error: %s", message)
 	_, err := fmt.Fprint(writer, message+"\n")
 	if err != nil {
@@ -257,7 +292,7 @@ func (rw *BasicUi) Error(message string) {
 }
 
 func (rw *BasicUi) Machine(t string, args ...string) {
-	log.Printf("machine readable: %s %#v", t, args)
+	log.Printf("machine readable: %s %#v", t, sensitive.RedactAll(args))
 }
 
 func (u *MachineReadableUi) Ask(query string) (string, error) {
@@ -289,7 +324,8 @@ func (u *MachineReadableUi) Machine(category string, args ...string) {
 
 	// Prepare the args
 	for i, v := range args {
-		args[i] = strings.Replace(v, ",", "%!(PACKER_COMMA)", -1)
+		args[i] = sensitive.Redact(v)
+		args[i] = strings.Replace(args[i], ",", "%!(PACKER_COMMA)", -1)
 		args[i] = strings.Replace(args[i], "\r", "\\r", -1)
 		args[i] = strings.Replace(args[i], "\n", "\\n", -1)
 	}
@@ -305,3 +341,54 @@ func (u *MachineReadableUi) Machine(category string, args ...string) {
 		}
 	}
 }
+
+func (u *JSONUi) Ask(query string) (string, error) {
+	return "", errors.New("JSON UI can't ask")
+}
+
+func (u *JSONUi) Say(message string) {
+	u.Machine("ui", "say", message)
+}
+
+func (u *JSONUi) Message(message string) {
+	u.Machine("ui", "message", message)
+}
+
+func (u *JSONUi) Error(message string) {
+	u.Machine("ui", "error", message)
+}
+
+func (u *JSONUi) Machine(category string, args ...string) {
+	event := JSONUiEvent{
+		Timestamp: time.Now().UTC(),
+		Type:      category,
+		Data:      sensitive.RedactAll(args),
+	}
+	if event.Data == nil {
+		event.Data = []string{}
+	}
+
+	// Determine if we have a target, and set it
+	if commaIdx := strings.Index(category, ","); commaIdx > -1 {
+		event.Build = category[0:commaIdx]
+		event.Type = category[commaIdx+1:]
+	}
+
+	data, err := json.Marshal(&event)
+	if err != nil {
+		panic(err)
+	}
+
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	_, err = fmt.Fprintf(u.Writer, "%s\n", data)
+	if err != nil {
+		if err == syscall.EPIPE || strings.Contains(err.Error(), "broken pipe") {
+			// Ignore epipe errors because that just means that the file
+			// is probably closed or going to /dev/null or something.
+		} else {
+			panic(err)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/mitchellh/packer/common/sensitive"
 )
 
 // This reads the output from the bytes.Buffer in our test object
@@ -286,3 +290,86 @@ func TestMachineReadableUi(t *testing.T) {
 		t.Fatalf("bad: %#v", data)
 	}
 }
+
+func TestJSONUi_ImplUi(t *testing.T) {
+	var raw interface{}
+	raw = &JSONUi{}
+	if _, ok := raw.(Ui); !ok {
+		t.Fatalf("JSONUi must implement Ui")
+	}
+}
+
+func TestJSONUi(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ui := &JSONUi{Writer: buf}
+
+	decode := func() JSONUiEvent {
+		var event JSONUiEvent
+		if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if event.Timestamp.IsZero() {
+			t.Fatal("timestamp should be set")
+		}
+		buf.Reset()
+		return event
+	}
+
+	// No target
+	ui.Machine("foo", "bar", "baz,qux\n")
+	event := decode()
+	if event.Build != "" || event.Type != "foo" {
+		t.Fatalf("bad: %#v", event)
+	}
+	if !reflect.DeepEqual(event.Data, []string{"bar", "baz,qux\n"}) {
+		t.Fatalf("bad: %#v", event.Data)
+	}
+
+	// Target
+	ui.Machine("mitchellh,foo")
+	event = decode()
+	if event.Build != "mitchellh" || event.Type != "foo" || len(event.Data) != 0 {
+		t.Fatalf("bad: %#v", event)
+	}
+
+	// Say
+	ui.Say("hello")
+	event = decode()
+	if event.Type != "ui" || !reflect.DeepEqual(event.Data, []string{"say", "hello"}) {
+		t.Fatalf("bad: %#v", event)
+	}
+}
+
+func TestUi_sensitive(t *testing.T) {
+	sensitive.Add("ui-test-secret")
+
+	bufferUi := testUi()
+	targetted := &TargettedUi{Target: "foo", Ui: bufferUi}
+	targetted.Say("the secret is ui-test-secret")
+	if actual := readWriter(bufferUi); actual != "==> foo: the secret is <sensitive>\n" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	bufferUi.Error("ui-test-secret")
+	if actual := readErrorWriter(bufferUi); actual != "<sensitive>\n" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	buf := new(bytes.Buffer)
+	machineUi := &MachineReadableUi{Writer: buf}
+	machineUi.Machine("foo", "ui-test-secret")
+	if data := strings.SplitN(buf.String(), ",", 2)[1]; data != ",foo,<sensitive>\n" {
+		t.Fatalf("bad: %s", data)
+	}
+
+	buf.Reset()
+	args := []string{"ui-test-secret"}
+	jsonUi := &JSONUi{Writer: buf}
+	jsonUi.Machine("foo", args...)
+	if strings.Contains(buf.String(), "ui-test-secret") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	if args[0] != "ui-test-secret" {
+		t.Fatalf("args should not be modified: %#v", args)
+	}
+}
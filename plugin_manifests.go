@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/packer/packer/plugin"
+	packrpc "github.com/mitchellh/packer/packer/rpc"
+)
+
+// pluginManifestTimeout is how long starting a plugin and reading its
+// manifest may take before the plugin is considered broken.
+var pluginManifestTimeout = 10 * time.Second
+
+// readPluginManifest starts the plugin to read its manifest, and kills it
+// afterwards. A plugin that doesn't answer in time is killed and an error
+// is returned, so a hanging plugin doesn't hang Packer.
+func readPluginManifest(client *plugin.Client) (*packrpc.PluginManifest, error) {
+	type result struct {
+		manifest *packrpc.PluginManifest
+		err      error
+	}
+
+	resultCh := make(chan result, 1)
+	go func() {
+		manifest, err := client.Manifest()
+		resultCh <- result{manifest, err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		client.Kill()
+		return r.manifest, r.err
+	case <-time.After(pluginManifestTimeout):
+		client.Kill()
+		return nil, fmt.Errorf(
+			"timeout after %s reading the manifest of the plugin",
+			pluginManifestTimeout)
+	}
+}
+
+// pluginManifestCache caches the manifests of the plugins that serve
+// several components, so that they don't have to be started every time
+// Packer runs. A manifest is used as long as the plugin binary has the
+// same modification time and size. Failures aren't cached, the plugin is
+// tried again the next time.
+type pluginManifestCache struct {
+	// path is the file the cache is saved to. The cache is only kept in
+	// memory if it is empty.
+	path string
+
+	entries map[string]*pluginManifestEntry
+	seen    map[string]bool
+	changed bool
+}
+
+type pluginManifestEntry struct {
+	ModTime  time.Time
+	Size     int64
+	Manifest *packrpc.PluginManifest
+}
+
+// loadPluginManifestCache loads the cache from the file at path. A file
+// that doesn't exist or can't be read gives an empty cache.
+func loadPluginManifestCache(path string) *pluginManifestCache {
+	c := &pluginManifestCache{
+		path:    path,
+		entries: make(map[string]*pluginManifestEntry),
+		seen:    make(map[string]bool),
+	}
+	if path == "" {
+		return c
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARN] Error reading plugin manifest cache: %s", err)
+		}
+		return c
+	}
+
+	if err := json.Unmarshal(contents, &c.entries); err != nil {
+		log.Printf("[WARN] Ignoring bad plugin manifest cache: %s", err)
+		c.entries = make(map[string]*pluginManifestEntry)
+		c.changed = true
+	}
+
+	return c
+}
+
+// Get returns the cached manifest of the plugin at path, or nil if it
+// isn't cached or the plugin changed.
+func (c *pluginManifestCache) Get(path string, fi os.FileInfo) *packrpc.PluginManifest {
+	c.seen[path] = true
+
+	entry, ok := c.entries[path]
+	if !ok || !entry.ModTime.Equal(fi.ModTime()) || entry.Size != fi.Size() {
+		return nil
+	}
+
+	return entry.Manifest
+}
+
+// Put caches the manifest of the plugin at path.
+func (c *pluginManifestCache) Put(path string, fi os.FileInfo, manifest *packrpc.PluginManifest) {
+	c.seen[path] = true
+	c.entries[path] = &pluginManifestEntry{
+		ModTime:  fi.ModTime(),
+		Size:     fi.Size(),
+		Manifest: manifest,
+	}
+	c.changed = true
+}
+
+// Save writes the cache to its file if it changed. The manifests of
+// plugins that weren't seen since the cache was loaded are dropped.
+func (c *pluginManifestCache) Save() error {
+	for path := range c.entries {
+		if !c.seen[path] {
+			delete(c.entries, path)
+			c.changed = true
+		}
+	}
+
+	if c.path == "" || !c.changed {
+		return nil
+	}
+
+	contents, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a Packer running at the
+	// same time never reads half of the cache
+	tf, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	_, err = tf.Write(contents)
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tf.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tf.Name())
+		return err
+	}
+
+	c.changed = false
+	return nil
+}
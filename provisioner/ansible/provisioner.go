@@ -107,8 +107,6 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 			log.Println(p.config.SSHHostKeyFile, "does not exist")
 			errs = packer.MultiErrorAppend(errs, err)
 		}
-	} else {
-		p.config.AnsibleEnvVars = append(p.config.AnsibleEnvVars, "ANSIBLE_HOST_KEY_CHECKING=False")
 	}
 
 	if !p.config.UseSFTP {
@@ -247,6 +245,19 @@ func (p *Provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
 
 	go p.adapter.Serve()
 
+	// If the host key of the machine is known, the machine can be trusted,
+	// and Ansible can check the key of the proxy strictly.
+	var knownHostsFile string
+	if p.config.SSHHostKeyFile == "" && p.ansibleMajVersion >= 2 {
+		if hk, ok := comm.(packer.HostKeyCommunicator); ok && hk.HostKey() != "" {
+			knownHostsFile, err = newKnownHostsFile(hostSigner.PublicKey())
+			if err != nil {
+				return err
+			}
+			defer os.Remove(knownHostsFile)
+		}
+	}
+
 	if len(p.config.inventoryFile) == 0 {
 		tf, err := ioutil.TempFile("", "packer-provisioner-ansible")
 		if err != nil {
@@ -282,7 +293,7 @@ func (p *Provisioner) Provision(ui packer.Ui, comm packer.Communicator) error {
 		}()
 	}
 
-	if err := p.executeAnsible(ui, comm, k.privKeyFile); err != nil {
+	if err := p.executeAnsible(ui, comm, k.privKeyFile, knownHostsFile); err != nil {
 		return fmt.Errorf("Error executing Ansible: %s", err)
 	}
 
@@ -299,7 +310,7 @@ func (p *Provisioner) Cancel() {
 	os.Exit(0)
 }
 
-func (p *Provisioner) executeAnsible(ui packer.Ui, comm packer.Communicator, privKeyFile string) error {
+func (p *Provisioner) executeAnsible(ui packer.Ui, comm packer.Communicator, privKeyFile string, knownHostsFile string) error {
 	playbook, _ := filepath.Abs(p.config.PlaybookFile)
 	inventory := p.config.inventoryFile
 	var envvars []string
@@ -308,7 +319,21 @@ func (p *Provisioner) executeAnsible(ui packer.Ui, comm packer.Communicator, pri
 	if len(privKeyFile) > 0 {
 		args = append(args, "--private-key", privKeyFile)
 	}
+	if knownHostsFile != "" {
+		// This applies to inventory files given with inventory_file too.
+		// The host key alias makes SSH look up the key of the proxy under
+		// the same name, whatever the inventory calls the host.
+		args = append(args, "--ssh-common-args", fmt.Sprintf(
+			"-o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s -o HostKeyAlias=%s",
+			knownHostsFile, knownHostsAlias))
+	}
 	args = append(args, p.config.ExtraArguments...)
+	switch {
+	case knownHostsFile != "":
+		envvars = append(envvars, "ANSIBLE_HOST_KEY_CHECKING=True")
+	case p.config.SSHHostKeyFile == "":
+		envvars = append(envvars, "ANSIBLE_HOST_KEY_CHECKING=False")
+	}
 	if len(p.config.AnsibleEnvVars) > 0 {
 		envvars = append(envvars, p.config.AnsibleEnvVars...)
 	}
@@ -468,6 +493,27 @@ func newSigner(privKeyFile string) (*signer, error) {
 	return signer, nil
 }
 
+// knownHostsAlias is the name of the SSH proxy in the known_hosts file
+// that Packer writes for Ansible.
+const knownHostsAlias = "packer-ansible-proxy"
+
+// newKnownHostsFile writes a temporary known_hosts file with the key of
+// the SSH proxy, and returns its path.
+func newKnownHostsFile(key ssh.PublicKey) (string, error) {
+	tf, err := ioutil.TempFile("", "packer-provisioner-ansible-known-hosts")
+	if err != nil {
+		return "", fmt.Errorf("Error preparing known_hosts file: %s", err)
+	}
+	defer tf.Close()
+
+	if _, err := fmt.Fprintf(tf, "%s %s", knownHostsAlias, ssh.MarshalAuthorizedKey(key)); err != nil {
+		os.Remove(tf.Name())
+		return "", fmt.Errorf("Error preparing known_hosts file: %s", err)
+	}
+
+	return tf.Name(), nil
+}
+
 // Ui provides concurrency-safe access to packer.Ui.
 type Ui struct {
 	sem chan int
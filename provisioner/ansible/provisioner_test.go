@@ -8,13 +8,19 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/mitchellh/packer/packer"
+	"golang.org/x/crypto/ssh"
 )
 
 // Be sure to remove the Ansible stub file in each test with:
-//   defer os.Remove(config["command"].(string))
+//
+//	defer os.Remove(config["command"].(string))
 func testConfig(t *testing.T) map[string]interface{} {
 	m := make(map[string]interface{})
 	wd, err := os.Getwd()
@@ -282,3 +288,82 @@ func TestAnsibleLongMessages(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestNewKnownHostsFile(t *testing.T) {
+	s, err := newSigner("")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path, err := newKnownHostsFile(s.PublicKey())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(path)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, hosts, key, _, _, err := ssh.ParseKnownHosts(contents)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(hosts) != 1 || hosts[0] != knownHostsAlias {
+		t.Fatalf("bad: %#v", hosts)
+	}
+	if !bytes.Equal(key.Marshal(), s.PublicKey().Marshal()) {
+		t.Fatalf("bad: %s", contents)
+	}
+}
+
+func TestProvisionerExecuteAnsible_knownHostsInventoryFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The command records its arguments and host key checking setting
+	out := filepath.Join(dir, "out")
+	command := filepath.Join(dir, "ansible-playbook")
+	script := fmt.Sprintf("#!/bin/sh\nfor arg; do echo \"$arg\"; done > %s\n"+
+		"echo \"$ANSIBLE_HOST_KEY_CHECKING\" >> %s\n", out, out)
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var p Provisioner
+	p.config.Command = command
+	p.config.PlaybookFile = "playbook.yml"
+	p.config.inventoryFile = "my-inventory"
+
+	ui := &packer.BasicUi{
+		Reader: new(bytes.Buffer),
+		Writer: new(bytes.Buffer),
+	}
+	if err := p.executeAnsible(ui, new(packer.MockCommunicator), "", "/tmp/known_hosts"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	expected := []string{
+		"-i", "my-inventory",
+		"--ssh-common-args",
+		"-o StrictHostKeyChecking=yes -o UserKnownHostsFile=/tmp/known_hosts -o HostKeyAlias=" + knownHostsAlias,
+		"True",
+	}
+	if !reflect.DeepEqual(lines[1:], expected) {
+		t.Fatalf("bad: %#v", lines)
+	}
+}
@@ -26,6 +26,13 @@ type Config struct {
 	// Direction
 	Direction string
 
+	// How directories are compared with the ones on the machine, so only
+	// the files that changed are uploaded: "checksum" or "mtime".
+	Delta string
+
+	// Whether directories are uploaded as a gzipped tar archive.
+	Compress bool
+
 	ctx interpolate.Context
 }
 
@@ -55,6 +62,14 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		errs = packer.MultiErrorAppend(errs,
 			errors.New("Direction must be one of: download, upload."))
 	}
+	if p.config.Delta != "" && p.config.Delta != "checksum" && p.config.Delta != "mtime" {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("Delta must be one of: checksum, mtime."))
+	}
+	if p.config.Direction == "download" && (p.config.Delta != "" || p.config.Compress) {
+		errs = packer.MultiErrorAppend(errs,
+			errors.New("Delta and compress can only be used to upload."))
+	}
 	if p.config.Source != "" {
 		p.config.Sources = append(p.config.Sources, p.config.Source)
 	}
@@ -144,7 +159,26 @@ func (p *Provisioner) ProvisionUpload(ui packer.Ui, comm packer.Communicator) er
 
 		// If we're uploading a directory, short circuit and do that
 		if info.IsDir() {
-			return comm.UploadDir(p.config.Destination, src, nil)
+			if p.config.Delta == "" && !p.config.Compress {
+				return comm.UploadDir(p.config.Destination, src, nil)
+			}
+
+			result, err := packer.UploadDirDelta(comm, p.config.Destination, src, nil,
+				&packer.UploadDirOptions{
+					Compare:  p.config.Delta,
+					Compress: p.config.Compress,
+				})
+			if err != nil {
+				ui.Error(fmt.Sprintf("Upload failed: %s", err))
+				return err
+			}
+
+			// Communicators that can't compare upload the whole directory
+			if result != nil {
+				ui.Message(fmt.Sprintf("Uploaded %d of %d files (%d bytes)",
+					result.Uploaded, result.Files, result.Bytes))
+			}
+			return nil
 		}
 
 		// We're uploading a file...
@@ -198,3 +198,71 @@ func TestProvisionDownloadMkdirAll(t *testing.T) {
 		}
 	}
 }
+
+func TestProvisionerPrepare_Delta(t *testing.T) {
+	tf, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("error tempfile: %s", err)
+	}
+	defer os.Remove(tf.Name())
+
+	cases := []struct {
+		Delta     string
+		Direction string
+		Valid     bool
+	}{
+		{"checksum", "upload", true},
+		{"mtime", "upload", true},
+		{"size", "upload", false},
+		{"checksum", "download", false},
+	}
+	for _, tc := range cases {
+		var p Provisioner
+		config := testConfig()
+		config["source"] = tf.Name()
+		config["delta"] = tc.Delta
+		config["direction"] = tc.Direction
+
+		err := p.Prepare(config)
+		if tc.Valid && err != nil {
+			t.Fatalf("%s %s: err: %s", tc.Delta, tc.Direction, err)
+		}
+		if !tc.Valid && err == nil {
+			t.Fatalf("%s %s: should have error", tc.Delta, tc.Direction)
+		}
+	}
+}
+
+func TestProvisionerProvision_DeltaDir(t *testing.T) {
+	td, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("error tempdir: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	var p Provisioner
+	config := map[string]interface{}{
+		"source":      td,
+		"destination": "something",
+		"delta":       "checksum",
+		"compress":    true,
+	}
+	if err := p.Prepare(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	comm := &packer.MockCommunicator{
+		UploadDirResult: &packer.UploadDirResult{Files: 2, Uploaded: 1},
+	}
+	if err := p.Provision(&stubUi{}, comm); err != nil {
+		t.Fatalf("should successfully provision: %s", err)
+	}
+
+	if comm.UploadDirSrc != td || comm.UploadDirDst != "something" {
+		t.Fatalf("bad: %s %s", comm.UploadDirSrc, comm.UploadDirDst)
+	}
+	opts := comm.UploadDirOptions
+	if opts == nil || opts.Compare != "checksum" || !opts.Compress {
+		t.Fatalf("bad: %#v", opts)
+	}
+}
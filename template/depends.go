@@ -0,0 +1,66 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// validateDependsOn checks that the builders only depend on builders that
+// exist and that the dependencies don't form a cycle.
+func (t *Template) validateDependsOn() error {
+	names := make([]string, 0, len(t.Builders))
+	for k := range t.Builders {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var errs error
+	for _, name := range names {
+		b := t.Builders[name]
+		for _, dep := range b.DependsOn {
+			if _, ok := t.Builders[dep]; !ok {
+				errs = multierror.Append(errs, fmt.Errorf(
+					"builder '%s'%s: depends on unknown builder '%s'",
+					name, fromSource(b.Source), dep))
+			}
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	visited := make(map[string]bool, len(t.Builders))
+	var visit func(string, []string) error
+	visit = func(name string, stack []string) error {
+		for i, n := range stack {
+			if n == name {
+				return fmt.Errorf("builder '%s': depends_on cycle: %s",
+					stack[0], strings.Join(append(stack[i:], name), " -> "))
+			}
+		}
+		if visited[name] {
+			return nil
+		}
+
+		stack = append(stack, name)
+		for _, dep := range t.Builders[name].DependsOn {
+			if err := visit(dep, stack); err != nil {
+				return err
+			}
+		}
+
+		visited[name] = true
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
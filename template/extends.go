@@ -0,0 +1,81 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// resolveExtends flattens the builders that extend other builders. The
+// configuration of a builder is the configuration of its base with the
+// keys the builder sets itself replacing those of the base. Only the top
+// level keys are merged; a key whose value is an object or array replaces
+// the whole value of the base.
+func (t *Template) resolveExtends() error {
+	// Go through the builders in a stable order so that the errors are
+	// always the same.
+	names := make([]string, 0, len(t.Builders))
+	for k := range t.Builders {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	resolved := make(map[string]bool, len(t.Builders))
+	var errs error
+	for _, name := range names {
+		if err := t.resolveBuilder(name, resolved, nil); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (t *Template) resolveBuilder(
+	name string, resolved map[string]bool, stack []string) error {
+	b := t.Builders[name]
+	if b.Extends == "" || resolved[name] {
+		return nil
+	}
+
+	for i, n := range stack {
+		if n == name {
+			return fmt.Errorf("builder '%s': extends cycle: %s",
+				stack[0], strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+
+	base, ok := t.Builders[b.Extends]
+	if !ok {
+		return fmt.Errorf("builder '%s': extends unknown builder '%s'",
+			name, b.Extends)
+	}
+
+	if err := t.resolveBuilder(b.Extends, resolved, append(stack, name)); err != nil {
+		return err
+	}
+
+	if b.Type != "" && b.Type != base.Type {
+		return fmt.Errorf(
+			"builder '%s': type '%s' doesn't match type '%s' of base '%s'",
+			name, b.Type, base.Type, base.Name)
+	}
+	b.Type = base.Type
+
+	config := make(map[string]interface{}, len(base.Config)+len(b.Config))
+	for k, v := range base.Config {
+		config[k] = v
+	}
+	for k, v := range b.Config {
+		config[k] = v
+	}
+	if len(config) == 0 {
+		config = nil
+	}
+	b.Config = config
+
+	resolved[name] = true
+	return nil
+}
@@ -0,0 +1,88 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_builderExtends(t *testing.T) {
+	tpl, err := ParseFile(fixtureDir("parse-builder-extends.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tags := map[string]interface{}{"a": "b"}
+	expected := map[string]*Builder{
+		"base": {
+			Name: "base",
+			Type: "something",
+			Config: map[string]interface{}{
+				"region": "us-east-1",
+				"size":   "small",
+				"tags":   tags,
+			},
+		},
+		"west": {
+			Name:    "west",
+			Type:    "something",
+			Extends: "base",
+			Config: map[string]interface{}{
+				"region": "us-west-2",
+				"size":   "small",
+				"tags":   tags,
+			},
+		},
+		"west-big": {
+			Name:    "west-big",
+			Type:    "something",
+			Extends: "west",
+			Config: map[string]interface{}{
+				"region": "us-west-2",
+				"size":   "large",
+				"tags":   tags,
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(tpl.Builders, expected) {
+		t.Fatalf("bad:\n\n%#v\n\n%#v", tpl.Builders, expected)
+	}
+}
+
+func TestParse_builderExtendsImport(t *testing.T) {
+	tpl, err := ParseFile(fixtureDir("import-builder-extends.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b := tpl.Builders["west"]
+	if b.Type != "something" || b.Source != "" {
+		t.Fatalf("bad: %#v", b)
+	}
+	if !reflect.DeepEqual(b.Config, map[string]interface{}{"region": "us-west-2"}) {
+		t.Fatalf("bad: %#v", b.Config)
+	}
+}
+
+func TestParse_builderExtendsBad(t *testing.T) {
+	cases := []struct {
+		File     string
+		Expected string
+	}{
+		{"error-builder-extends-cycle.json", "extends cycle: a -> b -> a"},
+		{"error-builder-extends-unknown.json", "extends unknown builder 'nope'"},
+		{"error-builder-extends-type.json", "doesn't match type 'something'"},
+		{"error-builder-extends-name.json", "'name' is required"},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseFile(fixtureDir(tc.File))
+		if err == nil {
+			t.Fatalf("%s: should error", tc.File)
+		}
+		if !strings.Contains(err.Error(), tc.Expected) {
+			t.Fatalf("%s: bad error: %s", tc.File, err)
+		}
+	}
+}
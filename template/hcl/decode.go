@@ -0,0 +1,155 @@
+// Package hcl maps HCL documents, as parsed by github.com/hashicorp/hcl,
+// onto the generic structure that encoding/json decodes JSON documents
+// into, and formats such structures as HCL. It is used for the HCL
+// template format and HCL var-files.
+package hcl
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Parse parses the given HCL source. Syntax errors are *parser.PosError
+// values.
+func Parse(src []byte) (*ast.ObjectList, error) {
+	f, err := parser.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("expected an object at the top level")
+	}
+
+	return list, nil
+}
+
+// Decode parses the given HCL source and decodes it with DecodeObject.
+func Decode(src []byte) (map[string]interface{}, error) {
+	list, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeObject(list)
+}
+
+// IsBlock returns true if the item is a block ("key "label" { ... }")
+// rather than an attribute ("key = value").
+func IsBlock(item *ast.ObjectItem) bool {
+	return !item.Assign.IsValid()
+}
+
+// Key returns the key of the item, and Labels returns the labels of a
+// block.
+func Key(item *ast.ObjectItem) string {
+	return keyValue(item.Keys[0])
+}
+
+func Labels(item *ast.ObjectItem) []string {
+	labels := make([]string, 0, len(item.Keys)-1)
+	for _, k := range item.Keys[1:] {
+		labels = append(labels, keyValue(k))
+	}
+
+	return labels
+}
+
+func keyValue(k *ast.ObjectKey) string {
+	if s, ok := k.Token.Value().(string); ok {
+		return s
+	}
+
+	return k.Token.Text
+}
+
+// Body returns the items of a block, or nil if the item's value isn't an
+// object.
+func Body(item *ast.ObjectItem) *ast.ObjectList {
+	obj, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return nil
+	}
+
+	return obj.List
+}
+
+// DecodeObject converts the items of an object into the generic
+// structure that encoding/json would produce for the equivalent JSON
+// document: maps, slices, strings, numbers and booleans. A block
+// "key { ... }" becomes a map under "key", a labeled block
+// "key "a" { ... }" becomes a map under "key" and then "a", and repeated
+// blocks with the same key are collected into a list.
+func DecodeObject(list *ast.ObjectList) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	blocks := make(map[string]bool)
+	for _, item := range list.Items {
+		key := Key(item)
+		value, err := DecodeValue(item.Val)
+		if err != nil {
+			return nil, err
+		}
+
+		labels := Labels(item)
+		for i := len(labels) - 1; i >= 0; i-- {
+			value = map[string]interface{}{labels[i]: value}
+		}
+
+		existing, ok := result[key]
+		if !ok {
+			result[key] = value
+			blocks[key] = IsBlock(item)
+			continue
+		}
+
+		if !IsBlock(item) || !blocks[key] {
+			return nil, Errorf(item, "duplicate key %q", key)
+		}
+
+		if list, ok := existing.([]interface{}); ok {
+			result[key] = append(list, value)
+		} else {
+			result[key] = []interface{}{existing, value}
+		}
+	}
+
+	return result, nil
+}
+
+// DecodeValue converts a value node into its generic representation.
+// See DecodeObject.
+func DecodeValue(n ast.Node) (interface{}, error) {
+	switch n := n.(type) {
+	case *ast.LiteralType:
+		switch n.Token.Type {
+		case token.STRING, token.HEREDOC, token.NUMBER, token.FLOAT, token.BOOL:
+			return n.Token.Value(), nil
+		default:
+			return nil, Errorf(n, "unexpected %s", n.Token.Type)
+		}
+	case *ast.ObjectType:
+		return DecodeObject(n.List)
+	case *ast.ListType:
+		result := make([]interface{}, len(n.List))
+		for i, v := range n.List {
+			var err error
+			result[i], err = DecodeValue(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	default:
+		return nil, Errorf(n, "unexpected value of type %T", n)
+	}
+}
+
+// Errorf returns a *parser.PosError for the position of the given node.
+func Errorf(n ast.Node, format string, args ...interface{}) error {
+	return &parser.PosError{Pos: n.Pos(), Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,108 @@
+package hcl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/hcl/hcl/parser"
+)
+
+func TestDecode(t *testing.T) {
+	src := `
+# A comment
+description = "hello \"world\""
+count = 3
+ratio = 1.5
+enabled = true
+command = "echo ${HOME}"
+
+// Another comment
+builder "qemu" {
+  name = "foo"
+  tags = ["a", "b",]
+  nested {
+    key = "value"
+  }
+  list = [
+    { a = 1 },
+    { a = 2 },
+  ]
+}
+
+/* A block
+   comment */
+post-processors {
+  post-processor "compress" {}
+  post-processor "checksum" {}
+}
+
+script = <<EOF
+echo hi
+EOF
+`
+
+	actual, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"description": `hello "world"`,
+		"count":       int64(3),
+		"ratio":       1.5,
+		"enabled":     true,
+		"command":     "echo ${HOME}",
+		"builder": map[string]interface{}{
+			"qemu": map[string]interface{}{
+				"name": "foo",
+				"tags": []interface{}{"a", "b"},
+				"nested": map[string]interface{}{
+					"key": "value",
+				},
+				"list": []interface{}{
+					map[string]interface{}{"a": int64(1)},
+					map[string]interface{}{"a": int64(2)},
+				},
+			},
+		},
+		"post-processors": map[string]interface{}{
+			"post-processor": []interface{}{
+				map[string]interface{}{"compress": map[string]interface{}{}},
+				map[string]interface{}{"checksum": map[string]interface{}{}},
+			},
+		},
+		"script": "echo hi\n",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDecode_errors(t *testing.T) {
+	cases := []struct {
+		Src    string
+		Line   int
+		Column int
+	}{
+		{"foo = \"bar", 1, 11},
+		{"a = ]", 1, 5},
+		{"a = 1\na = 2", 2, 1},
+		{"a = 1\na {}", 2, 1},
+	}
+
+	for _, tc := range cases {
+		_, err := Decode([]byte(tc.Src))
+		if err == nil {
+			t.Fatalf("%q: should error", tc.Src)
+		}
+
+		posErr, ok := err.(*parser.PosError)
+		if !ok {
+			t.Fatalf("%q: bad error type: %#v", tc.Src, err)
+		}
+		if posErr.Pos.Line != tc.Line || posErr.Pos.Column != tc.Column {
+			t.Fatalf("%q: bad position: %s", tc.Src, posErr.Pos)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package hcl
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/hcl/printer"
+)
+
+// identRe matches the keys that don't need to be quoted.
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Writer writes HCL source from values in the generic structure produced
+// by encoding/json. Null values have no HCL representation: attributes and
+// object keys set to null are left out, which packer treats the same as
+// an unset key, and null list elements are written as empty strings.
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Attribute writes "key = value".
+func (w *Writer) Attribute(key string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	value, err := Value(v)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+
+	fmt.Fprintf(&w.buf, "%s = %s\n", quoteKey(key), value)
+	return nil
+}
+
+// Attributes writes an attribute for each key of the map in sorted order,
+// except that the keys given in first are written first.
+func (w *Writer) Attributes(m map[string]interface{}, first ...string) error {
+	for _, k := range first {
+		if v, ok := m[k]; ok {
+			if err := w.Attribute(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(m) {
+		if contains(first, k) {
+			continue
+		}
+		if err := w.Attribute(k, m[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Block starts a block with the given key and labels. It is closed by
+// End.
+func (w *Writer) Block(key string, labels ...string) {
+	w.buf.WriteString(quoteKey(key))
+	for _, label := range labels {
+		w.buf.WriteString(" ")
+		w.buf.WriteString(quote(label))
+	}
+	w.buf.WriteString(" {\n")
+}
+
+// End closes the last block started with Block.
+func (w *Writer) End() {
+	w.buf.WriteString("}\n")
+}
+
+// Format returns the written source laid out by the HCL printer.
+func (w *Writer) Format() ([]byte, error) {
+	return printer.Format(w.buf.Bytes())
+}
+
+// Value returns the HCL representation of a value in the generic structure
+// produced by encoding/json. Map keys are sorted so that the output is
+// stable.
+func Value(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		// Only reached for list elements, see Writer
+		return `""`, nil
+	case string:
+		return quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		// JSON numbers are always float64, but most are really integers
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "", fmt.Errorf("%v can't be represented in HCL", v)
+		}
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, raw := range v {
+			var err error
+			parts[i], err = Value(raw)
+			if err != nil {
+				return "", err
+			}
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case map[string]interface{}:
+		var w Writer
+		w.buf.WriteString("{\n")
+		if err := w.Attributes(v); err != nil {
+			return "", err
+		}
+		w.buf.WriteString("}")
+		return w.buf.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// quote returns the string quoted for HCL. The parser doesn't unescape
+// "${...}" sequences, so those are written as they are. Strings with an
+// unbalanced "${" can't be represented.
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "${") {
+			if n := interpolationLen(s); n > 0 {
+				buf.WriteString(s[:n])
+				s = s[n:]
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+// interpolationLen returns the length of the "${...}" sequence at the
+// start of s, or 0 if it isn't balanced or contains characters that
+// would have to be escaped.
+func interpolationLen(s string) int {
+	braces := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			braces++
+		case '}':
+			braces--
+			if braces == 0 {
+				return i + 1
+			}
+		case '\\', '\n':
+			return 0
+		}
+	}
+
+	return 0
+}
+
+func quoteKey(k string) string {
+	if identRe.MatchString(k) {
+		return k
+	}
+
+	return quote(k)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package hcl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	value := map[string]interface{}{
+		"string":   "with \"quotes\"\nand newlines\t\x01",
+		"interp":   `${foo("bar")} and \ ${HOME}`,
+		"int":      float64(42),
+		"negative": float64(-3),
+		"float":    float64(1.5),
+		"bool":     false,
+		"list":     []interface{}{"a", nil, "b"},
+		"empty":    []interface{}{},
+		"objects":  []interface{}{map[string]interface{}{"a": "b"}},
+		"nested":   map[string]interface{}{"needs quotes": "x", "ok-key": "y", "null": nil},
+		"null":     nil,
+	}
+
+	var w Writer
+	if err := w.Attributes(value, "string"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	w.Block("block", "label")
+	if err := w.Attribute("key", "value"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	w.End()
+
+	output, err := w.Format()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(string(output), "string = ") {
+		t.Fatalf("bad order:\n\n%s", output)
+	}
+
+	actual, err := Decode(output)
+	if err != nil {
+		t.Fatalf("err: %s\n\n%s", err, output)
+	}
+
+	expected := map[string]interface{}{
+		"string":   "with \"quotes\"\nand newlines\t\x01",
+		"interp":   `${foo("bar")} and \ ${HOME}`,
+		"int":      int64(42),
+		"negative": int64(-3),
+		"float":    float64(1.5),
+		"bool":     false,
+		"list":     []interface{}{"a", "", "b"},
+		"empty":    []interface{}{},
+		"objects":  []interface{}{map[string]interface{}{"a": "b"}},
+		"nested":   map[string]interface{}{"needs quotes": "x", "ok-key": "y"},
+		"block": map[string]interface{}{
+			"label": map[string]interface{}{"key": "value"},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\n%s", actual, output)
+	}
+}
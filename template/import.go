@@ -0,0 +1,178 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// resolveImports merges the templates imported by the given template into
+// it. The path is the absolute path of the template, or blank if it didn't
+// come from a file, in which case imports are relative to the working
+// directory.
+//
+// Imports are merged in the order they're listed, depth first, followed
+// by the template itself. Later definitions win over earlier ones:
+//
+//   * Variables and builders with the same name are replaced.
+//   * Provisioners and post-processor chains are appended.
+//   * The description, push and retry configuration are replaced if set.
+//   * The highest min_packer_version is kept.
+//
+// A template that is imported more than once is only merged the first
+// time it is seen. Import cycles are an error.
+func resolveImports(tpl *Template, path string) (*Template, error) {
+	if len(tpl.Imports) == 0 {
+		return tpl, nil
+	}
+
+	i := &importer{seen: make(map[string]struct{})}
+	if path != "" {
+		i.stack = []string{path}
+		i.seen[path] = struct{}{}
+	}
+
+	return i.resolve(tpl, filepath.Dir(path))
+}
+
+type importer struct {
+	// stack is the chain of templates currently being imported, used to
+	// detect cycles.
+	stack []string
+
+	// seen is every template that has been imported so far.
+	seen map[string]struct{}
+}
+
+func (i *importer) resolve(tpl *Template, dir string) (*Template, error) {
+	result := new(Template)
+	for _, imp := range tpl.Imports {
+		path := imp
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("import '%s': %s", imp, err)
+		}
+
+		for j, p := range i.stack {
+			if p == path {
+				cycle := append(i.stack[j:], path)
+				return nil, fmt.Errorf(
+					"import cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		if _, ok := i.seen[path]; ok {
+			continue
+		}
+		i.seen[path] = struct{}{}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("import '%s': %s", imp, err)
+		}
+
+		imported, err := parseContents(path, contents)
+		if err != nil {
+			return nil, fmt.Errorf("import '%s': %s", imp, err)
+		}
+
+		i.stack = append(i.stack, path)
+		imported, err = i.resolve(imported, filepath.Dir(path))
+		i.stack = i.stack[:len(i.stack)-1]
+		if err != nil {
+			return nil, err
+		}
+
+		if err := mergeTemplate(result, imported, path); err != nil {
+			return nil, fmt.Errorf("import '%s': %s", imp, err)
+		}
+	}
+
+	if err := mergeTemplate(result, tpl, ""); err != nil {
+		return nil, err
+	}
+
+	result.Path = tpl.Path
+	result.Imports = tpl.Imports
+	result.RawContents = tpl.RawContents
+	return result, nil
+}
+
+// mergeTemplate merges src into dst. Anything in src without a source yet
+// is marked as coming from the given source.
+func mergeTemplate(dst, src *Template, source string) error {
+	if src.Description != "" {
+		dst.Description = src.Description
+	}
+
+	if src.MinVersion != "" {
+		if dst.MinVersion == "" {
+			dst.MinVersion = src.MinVersion
+		} else {
+			current, err := version.NewVersion(dst.MinVersion)
+			if err != nil {
+				return fmt.Errorf("min_packer_version: %s", err)
+			}
+			v, err := version.NewVersion(src.MinVersion)
+			if err != nil {
+				return fmt.Errorf("min_packer_version: %s", err)
+			}
+			if v.GreaterThan(current) {
+				dst.MinVersion = src.MinVersion
+			}
+		}
+	}
+
+	if len(src.Variables) > 0 && dst.Variables == nil {
+		dst.Variables = make(map[string]*Variable, len(src.Variables))
+	}
+	for k, v := range src.Variables {
+		if v.Source == "" {
+			v.Source = source
+		}
+		dst.Variables[k] = v
+	}
+
+	if len(src.Builders) > 0 && dst.Builders == nil {
+		dst.Builders = make(map[string]*Builder, len(src.Builders))
+	}
+	for k, b := range src.Builders {
+		if b.Source == "" {
+			b.Source = source
+		}
+		dst.Builders[k] = b
+	}
+
+	for _, p := range src.Provisioners {
+		if p.Source == "" {
+			p.Source = source
+		}
+		dst.Provisioners = append(dst.Provisioners, p)
+	}
+
+	for _, chain := range src.PostProcessors {
+		for _, p := range chain {
+			if p.Source == "" {
+				p.Source = source
+			}
+		}
+		dst.PostProcessors = append(dst.PostProcessors, chain)
+	}
+
+	if !reflect.DeepEqual(src.Push, Push{}) {
+		dst.Push = src.Push
+	}
+
+	if src.Retry != nil {
+		dst.Retry = src.Retry
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package template
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_imports(t *testing.T) {
+	tpl, err := ParseFile(fixtureDir("import-basic.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	base, _ := filepath.Abs(fixtureDir("import/base.json"))
+	common, _ := filepath.Abs(fixtureDir("import/common.json"))
+	provs, _ := filepath.Abs(fixtureDir("import/provisioners.hcl"))
+
+	tpl.Path = ""
+	tpl.RawContents = nil
+
+	expected := &Template{
+		MinVersion: "0.9.0",
+		Imports:    []string{"import/base.json", "import/provisioners.hcl"},
+		Variables: map[string]*Variable{
+			"region": {Default: "us-west-2"},
+			"size":   {Default: "10", Source: base},
+			"user":   {Required: true, Source: common},
+		},
+		Builders: map[string]*Builder{
+			"app": {
+				Name: "app",
+				Type: "qemu",
+			},
+			"base": {
+				Name:   "base",
+				Type:   "something",
+				Source: base,
+			},
+		},
+		Provisioners: []*Provisioner{
+			{Type: "file", Source: common},
+			{Type: "shell-local", Source: provs},
+			{Type: "shell"},
+		},
+		PostProcessors: [][]*PostProcessor{
+			{
+				{Type: "checksum", Source: provs},
+			},
+			{
+				{Type: "compress"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(tpl, expected) {
+		t.Fatalf("bad:\n\n%#v\n\n%#v", tpl, expected)
+	}
+}
+
+func TestParse_importsBad(t *testing.T) {
+	cases := []struct {
+		File     string
+		Expected string
+	}{
+		{"import-cycle.json", "import cycle"},
+		{"import-missing.json", "import 'import/missing.json'"},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseFile(fixtureDir(tc.File))
+		if err == nil {
+			t.Fatalf("%s: should error", tc.File)
+		}
+		if !strings.Contains(err.Error(), tc.Expected) {
+			t.Fatalf("%s: bad error: %s", tc.File, err)
+		}
+	}
+}
+
+func TestTemplateValidate_importSource(t *testing.T) {
+	tpl, err := ParseFile(fixtureDir("validate-bad-import.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = tpl.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	source, _ := filepath.Abs(fixtureDir("import/bad-only.json"))
+	if !strings.Contains(err.Error(), "imported from "+source) {
+		t.Fatalf("bad error: %s", err)
+	}
+}
@@ -1,15 +1,23 @@
 package interpolate
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/mitchellh/packer/common/sensitive"
 	"github.com/mitchellh/packer/common/uuid"
 )
 
@@ -24,11 +32,15 @@ func init() {
 
 // Funcs are the interpolation funcs that are available within interpolations.
 var FuncGens = map[string]FuncGenerator{
+	"build":        funcGenBuild,
 	"build_name":   funcGenBuildName,
 	"build_type":   funcGenBuildType,
 	"env":          funcGenEnv,
 	"isotime":      funcGenIsotime,
 	"pwd":          funcGenPwd,
+	"secret":       funcGenSecret,
+	"secret_env":   funcGenSecretEnv,
+	"secret_file":  funcGenSecretFile,
 	"template_dir": funcGenTemplateDir,
 	"timestamp":    funcGenTimestamp,
 	"uuid":         funcGenUuid,
@@ -36,6 +48,37 @@ var FuncGens = map[string]FuncGenerator{
 
 	"upper": funcGenPrimitive(strings.ToUpper),
 	"lower": funcGenPrimitive(strings.ToLower),
+
+	// Strings
+	"replace":       funcGenPrimitive(funcReplace),
+	"split":         funcGenPrimitive(funcSplit),
+	"join":          funcGenPrimitive(funcJoin),
+	"trim":          funcGenPrimitive(strings.TrimSpace),
+	"trim_prefix":   funcGenPrimitive(funcTrimPrefix),
+	"trim_suffix":   funcGenPrimitive(funcTrimSuffix),
+	"regex_match":   funcGenPrimitive(funcRegexMatch),
+	"regex_find":    funcGenPrimitive(funcRegexFind),
+	"regex_replace": funcGenPrimitive(funcRegexReplace),
+	"coalesce":      funcGenPrimitive(funcCoalesce),
+
+	// Encoding and hashing
+	"base64_encode": funcGenPrimitive(funcBase64Encode),
+	"base64_decode": funcGenPrimitive(funcBase64Decode),
+	"sha256":        funcGenPrimitive(funcSha256),
+	"sha256_file":   funcGenPrimitive(funcSha256File),
+
+	// Paths
+	"abspath":   funcGenPrimitive(filepath.Abs),
+	"basename":  funcGenPrimitive(filepath.Base),
+	"dirname":   funcGenPrimitive(filepath.Dir),
+	"path_join": funcGenPrimitive(filepath.Join),
+
+	// Arithmetic
+	"add": funcGenPrimitive(funcArithmetic("add")),
+	"sub": funcGenPrimitive(funcArithmetic("sub")),
+	"mul": funcGenPrimitive(funcArithmetic("mul")),
+	"div": funcGenPrimitive(funcArithmetic("div")),
+	"mod": funcGenPrimitive(funcArithmetic("mod")),
 }
 
 // FuncGenerator is a function that given a context generates a template
@@ -58,6 +101,28 @@ func Funcs(ctx *Context) template.FuncMap {
 	return template.FuncMap(result)
 }
 
+func funcGenBuild(ctx *Context) interface{} {
+	return func(name, key string) (string, error) {
+		if ctx == nil || ctx.BuildArtifacts == nil {
+			return "", fmt.Errorf(
+				"build '%s' not available: only builds that depend on it can use its artifact", name)
+		}
+
+		vars, ok := ctx.BuildArtifacts[name]
+		if !ok {
+			return "", fmt.Errorf(
+				"build '%s' not available: it must be in depends_on and built in the same run", name)
+		}
+
+		v, ok := vars[key]
+		if !ok {
+			return "", fmt.Errorf("build '%s' has no artifact value '%s'", name, key)
+		}
+
+		return v, nil
+	}
+}
+
 func funcGenBuildName(ctx *Context) interface{} {
 	return func() (string, error) {
 		if ctx == nil || ctx.BuildName == "" {
@@ -116,6 +181,80 @@ func funcGenPwd(ctx *Context) interface{} {
 	}
 }
 
+// errSecretNotAllowed is returned by the secret functions outside of the
+// places that env is allowed.
+var errSecretNotAllowed = errors.New("secrets can only be read in user variable defaults")
+
+func funcGenSecret(ctx *Context) interface{} {
+	return func(provider, path string, key ...string) (string, error) {
+		if ctx == nil || !ctx.EnableEnv {
+			return "", errSecretNotAllowed
+		}
+
+		if len(key) > 1 {
+			return "", fmt.Errorf("too many values, 1 key needed: %v", key)
+		}
+		k := "value"
+		if len(key) == 1 {
+			k = key[0]
+		}
+
+		providers := SecretProviders
+		if ctx.SecretProviders != nil {
+			providers = ctx.SecretProviders
+		}
+
+		p, ok := providers[provider]
+		if !ok {
+			return "", fmt.Errorf("unknown secret provider '%s'", provider)
+		}
+
+		v, err := p.Secret(path, k)
+		if err != nil {
+			return "", err
+		}
+
+		sensitive.Add(v)
+		return v, nil
+	}
+}
+
+func funcGenSecretEnv(ctx *Context) interface{} {
+	return func(k string) (string, error) {
+		if ctx == nil || !ctx.EnableEnv {
+			return "", errSecretNotAllowed
+		}
+
+		v := os.Getenv(k)
+		if v == "" {
+			return "", fmt.Errorf("environment variable %s must be set", k)
+		}
+
+		sensitive.Add(v)
+		return v, nil
+	}
+}
+
+func funcGenSecretFile(ctx *Context) interface{} {
+	return func(path string) (string, error) {
+		if ctx == nil || !ctx.EnableEnv {
+			return "", errSecretNotAllowed
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		// Files almost always end in a newline that isn't part of the secret
+		v := strings.TrimSuffix(string(contents), "\n")
+		v = strings.TrimSuffix(v, "\r")
+
+		sensitive.Add(v)
+		return v, nil
+	}
+}
+
 func funcGenTemplateDir(ctx *Context) interface{} {
 	return func() (string, error) {
 		if ctx == nil || ctx.TemplatePath == "" {
@@ -152,3 +291,184 @@ func funcGenUuid(ctx *Context) interface{} {
 		return uuid.TimeOrderedUUID()
 	}
 }
+
+func funcReplace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func funcSplit(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func funcJoin(sep string, list interface{}) (string, error) {
+	switch v := list.(type) {
+	case []string:
+		return strings.Join(v, sep), nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = fmt.Sprintf("%v", p)
+		}
+		return strings.Join(parts, sep), nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("join: can't join a value of type %T", list)
+	}
+}
+
+func funcTrimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func funcTrimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+func funcRegexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(s), nil
+}
+
+func funcRegexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return re.FindString(s), nil
+}
+
+func funcRegexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// funcCoalesce returns the first of its arguments that isn't empty.
+func funcCoalesce(values ...interface{}) string {
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+
+		if s := fmt.Sprintf("%v", v); s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+func funcBase64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func funcBase64Decode(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+func funcSha256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func funcSha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// funcArithmetic returns the function for the given arithmetic operation.
+// The operands can be numbers or strings containing numbers, so that user
+// variables can be used directly. The result is an integer if both
+// operands are integers and the result is whole.
+func funcArithmetic(op string) func(a, b interface{}) (interface{}, error) {
+	return func(a, b interface{}) (interface{}, error) {
+		x, xInt, err := toNumber(a)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		y, yInt, err := toNumber(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+
+		var result float64
+		switch op {
+		case "add":
+			result = x + y
+		case "sub":
+			result = x - y
+		case "mul":
+			result = x * y
+		case "div":
+			if y == 0 {
+				return nil, errors.New("div: division by zero")
+			}
+			result = x / y
+		case "mod":
+			if !xInt || !yInt {
+				return nil, errors.New("mod: operands must be integers")
+			}
+			if y == 0 {
+				return nil, errors.New("mod: division by zero")
+			}
+			return int64(x) % int64(y), nil
+		default:
+			return nil, fmt.Errorf("unknown operation '%s'", op)
+		}
+
+		if xInt && yInt && result == math.Trunc(result) {
+			return int64(result), nil
+		}
+
+		return result, nil
+	}
+}
+
+// toNumber converts an operand of an arithmetic function to a number,
+// reporting whether it is an integer.
+func toNumber(v interface{}) (float64, bool, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true, nil
+	case int64:
+		return float64(n), true, nil
+	case float64:
+		return n, n == math.Trunc(n), nil
+	case string:
+		s := strings.TrimSpace(n)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return float64(i), true, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("'%s' is not a number", n)
+		}
+		return f, f == math.Trunc(f), nil
+	default:
+		return 0, false, fmt.Errorf("%v is not a number", v)
+	}
+}
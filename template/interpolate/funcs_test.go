@@ -1,13 +1,52 @@
 package interpolate
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/mitchellh/packer/common/sensitive"
 )
 
+func TestFuncBuild(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{`{{build "base" "id"}}`, "image:1", false},
+		{`{{build "base" "files"}}`, "a,b", false},
+		{`{{build "base" "nope"}}`, "", true},
+		{`{{build "other" "id"}}`, "", true},
+	}
+
+	ctx := &Context{
+		BuildArtifacts: map[string]map[string]string{
+			"base": {"id": "image:1", "files": "a,b"},
+		},
+	}
+	for _, tc := range cases {
+		i := &I{Value: tc.Input}
+		result, err := i.Render(ctx)
+		if (err != nil) != tc.Err {
+			t.Fatalf("Input: %s\n\nerr: %s", tc.Input, err)
+		}
+
+		if result != tc.Output {
+			t.Fatalf("Input: %s\n\nGot: %s", tc.Input, result)
+		}
+	}
+
+	i := &I{Value: `{{build "base" "id"}}`}
+	if _, err := i.Render(&Context{}); err == nil {
+		t.Fatal("should error without artifacts")
+	}
+}
+
 func TestFuncBuildName(t *testing.T) {
 	cases := []struct {
 		Input  string
@@ -257,3 +296,182 @@ func TestFuncUser(t *testing.T) {
 		}
 	}
 }
+
+func TestFuncSecretEnv(t *testing.T) {
+	os.Setenv("PACKER_TEST_SECRET_ENV", "hunter2")
+	defer os.Setenv("PACKER_TEST_SECRET_ENV", "")
+
+	ctx := &Context{EnableEnv: true}
+	result, err := Render(`{{secret_env "PACKER_TEST_SECRET_ENV"}}`, ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "hunter2" {
+		t.Fatalf("bad: %s", result)
+	}
+	if sensitive.Redact(result) != sensitive.Mask {
+		t.Fatal("value should be sensitive")
+	}
+
+	if _, err := Render(`{{secret_env "PACKER_TEST_SECRET_ENV_NOPE"}}`, ctx); err == nil {
+		t.Fatal("should error if not set")
+	}
+
+	ctx.EnableEnv = false
+	if _, err := Render(`{{secret_env "PACKER_TEST_SECRET_ENV"}}`, ctx); err == nil {
+		t.Fatal("should error if disabled")
+	}
+}
+
+func TestFuncSecretFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file-secret\n")
+	f.Close()
+
+	ctx := &Context{EnableEnv: true}
+	result, err := Render(fmt.Sprintf(`{{secret_file %q}}`, f.Name()), ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != "file-secret" {
+		t.Fatalf("bad: %q", result)
+	}
+	if sensitive.Redact(result) != sensitive.Mask {
+		t.Fatal("value should be sensitive")
+	}
+}
+
+type testSecretProvider map[string]string
+
+func (p testSecretProvider) Secret(path, key string) (string, error) {
+	v, ok := p[path+"#"+key]
+	if !ok {
+		return "", fmt.Errorf("not found")
+	}
+	return v, nil
+}
+
+func TestFuncSecret(t *testing.T) {
+	ctx := &Context{
+		EnableEnv: true,
+		SecretProviders: map[string]SecretProvider{
+			"test": testSecretProvider{
+				"foo#value":  "provider-default",
+				"foo#bar":    "provider-bar",
+				"other#nope": "",
+			},
+		},
+	}
+
+	cases := []struct {
+		Input  string
+		Output string
+		Error  bool
+	}{
+		{`{{secret "test" "foo"}}`, "provider-default", false},
+		{`{{secret "test" "foo" "bar"}}`, "provider-bar", false},
+		{`{{secret "test" "foo" "bar" "baz"}}`, "", true},
+		{`{{secret "test" "nope"}}`, "", true},
+		{`{{secret "unknown" "foo"}}`, "", true},
+	}
+
+	for _, tc := range cases {
+		result, err := Render(tc.Input, ctx)
+		if (err != nil) != tc.Error {
+			t.Fatalf("Input: %s\n\nerr: %s", tc.Input, err)
+		}
+		if result != tc.Output {
+			t.Fatalf("Input: %s\n\nGot: %s", tc.Input, result)
+		}
+		if result != "" && sensitive.Redact(result) != sensitive.Mask {
+			t.Fatalf("Input: %s\n\nvalue should be sensitive", tc.Input)
+		}
+	}
+}
+
+func TestFuncPrimitives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		// Strings
+		{`{{replace "-" "_" "a-b-c"}}`, "a_b_c"},
+		{`{{"a-b-c" | replace "-" "."}}`, "a.b.c"},
+		{`{{split "," "a,b,c" | join "-"}}`, "a-b-c"},
+		{`{{trim "  foo  "}}`, "foo"},
+		{`{{trim_prefix "v" "v1.2"}}`, "1.2"},
+		{`{{trim_suffix ".iso" "ubuntu.iso"}}`, "ubuntu"},
+		{`{{regex_match "^[0-9]+$" "123"}}`, "true"},
+		{`{{regex_match "^[0-9]+$" "12a"}}`, "false"},
+		{`{{regex_find "[0-9]+" "abc123def"}}`, "123"},
+		{`{{regex_replace "[aeiou]" "_" "packer"}}`, "p_ck_r"},
+		{`{{coalesce "" "" "b" "c"}}`, "b"},
+		{`{{coalesce "" ""}}`, ""},
+
+		// Encoding and hashing
+		{`{{base64_encode "hello"}}`, "aGVsbG8="},
+		{`{{base64_decode "aGVsbG8="}}`, "hello"},
+		{`{{sha256 "hello"}}`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{fmt.Sprintf(`{{sha256_file %q}}`, file), "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+
+		// Paths
+		{`{{path_join "a" "b" "c.txt"}}`, filepath.Join("a", "b", "c.txt")},
+		{fmt.Sprintf(`{{basename %q}}`, file), "file"},
+		{fmt.Sprintf(`{{dirname %q}}`, file), dir},
+
+		// Arithmetic
+		{`{{add 1 2}}`, "3"},
+		{`{{add "1" 2.5}}`, "3.5"},
+		{`{{sub 10 "4"}}`, "6"},
+		{`{{mul 3 4}}`, "12"},
+		{`{{div 8 2}}`, "4"},
+		{`{{div 7 2}}`, "3.5"},
+		{`{{mod 7 3}}`, "1"},
+		{`{{mul (add 1 2) 2}}`, "6"},
+	}
+
+	for _, tc := range cases {
+		i := &I{Value: tc.Input}
+		result, err := i.Render(nil)
+		if err != nil {
+			t.Fatalf("Input: %s\n\nerr: %s", tc.Input, err)
+		}
+
+		if result != tc.Output {
+			t.Fatalf("Input: %s\n\nGot: %s", tc.Input, result)
+		}
+	}
+}
+
+func TestFuncPrimitives_errors(t *testing.T) {
+	cases := []string{
+		`{{regex_match "[" "foo"}}`,
+		`{{base64_decode "!!!"}}`,
+		`{{sha256_file "/nope/nope"}}`,
+		`{{add "foo" 1}}`,
+		`{{div 1 0}}`,
+		`{{mod 1.5 2}}`,
+	}
+
+	for _, tc := range cases {
+		i := &I{Value: tc}
+		if _, err := i.Render(nil); err == nil {
+			t.Fatalf("Input: %s\n\nshould error", tc)
+		}
+	}
+}
@@ -18,9 +18,19 @@ type Context struct {
 	// "user" function reads from.
 	UserVariables map[string]string
 
-	// EnableEnv enables the env function
+	// EnableEnv enables the env function and the functions that read
+	// secrets.
 	EnableEnv bool
 
+	// SecretProviders are the providers available to the secret
+	// function. If it is nil, the global SecretProviders are used.
+	SecretProviders map[string]SecretProvider
+
+	// BuildArtifacts are the artifacts of the builds that this build
+	// depends on, keyed by build name, that the "build" function reads
+	// from. See packer.ArtifactVariables for the keys.
+	BuildArtifacts map[string]map[string]string
+
 	// All the fields below are used for built-in functions.
 	//
 	// BuildName and BuildType are the name and type, respectively,
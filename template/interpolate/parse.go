@@ -2,6 +2,7 @@ package interpolate
 
 import (
 	"fmt"
+	"sort"
 	"text/template"
 	"text/template/parse"
 )
@@ -40,3 +41,81 @@ func functionsCalledWalk(raw parse.Node, r map[string]struct{}) {
 		panic(fmt.Sprintf("unknown type: %T", node))
 	}
 }
+
+// ReferencedUserVariables returns the sorted names of the user variables
+// that the given template string reads with the "user" function. Only
+// names that are written literally can be found.
+func ReferencedUserVariables(v string) ([]string, error) {
+	return literalArguments(v, "user")
+}
+
+// ReferencedEnvironmentVariables returns the sorted names of the
+// environment variables that the given template string reads with the
+// "env" function. Only names that are written literally can be found.
+func ReferencedEnvironmentVariables(v string) ([]string, error) {
+	return literalArguments(v, "env")
+}
+
+// literalArguments returns the sorted, literal string arguments that the
+// given function is called with in the template string.
+func literalArguments(v, fn string) ([]string, error) {
+	t, err := template.New("root").Funcs(Funcs(nil)).Parse(v)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{})
+	literalArgumentsWalk(t.Tree.Root, fn, found)
+
+	result := make([]string, 0, len(found))
+	for k := range found {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func literalArgumentsWalk(raw parse.Node, fn string, r map[string]struct{}) {
+	switch node := raw.(type) {
+	case *parse.ActionNode:
+		literalArgumentsWalk(node.Pipe, fn, r)
+	case *parse.CommandNode:
+		if in, ok := node.Args[0].(*parse.IdentifierNode); ok && in.Ident == fn {
+			if len(node.Args) > 1 {
+				if s, ok := node.Args[1].(*parse.StringNode); ok {
+					r[s.Text] = struct{}{}
+				}
+			}
+		}
+
+		for _, n := range node.Args[1:] {
+			literalArgumentsWalk(n, fn, r)
+		}
+	case *parse.IfNode:
+		literalArgumentsWalkBranch(&node.BranchNode, fn, r)
+	case *parse.RangeNode:
+		literalArgumentsWalkBranch(&node.BranchNode, fn, r)
+	case *parse.WithNode:
+		literalArgumentsWalkBranch(&node.BranchNode, fn, r)
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			literalArgumentsWalk(n, fn, r)
+		}
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Cmds {
+			literalArgumentsWalk(n, fn, r)
+		}
+	}
+}
+
+func literalArgumentsWalkBranch(node *parse.BranchNode, fn string, r map[string]struct{}) {
+	literalArgumentsWalk(node.Pipe, fn, r)
+	literalArgumentsWalk(node.List, fn, r)
+	literalArgumentsWalk(node.ElseList, fn, r)
+}
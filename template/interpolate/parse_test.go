@@ -37,3 +37,64 @@ func TestFunctionsCalled(t *testing.T) {
 		}
 	}
 }
+
+func TestReferencedUserVariables(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Result []string
+	}{
+		{
+			"foo",
+			[]string{},
+		},
+
+		{
+			"{{user `b`}}-{{user `a`}}-{{user `b`}}",
+			[]string{"a", "b"},
+		},
+
+		{
+			"{{if user `a`}}{{upper (user `b`)}}{{else}}{{env `c`}}{{end}}",
+			[]string{"a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := ReferencedUserVariables(tc.Input)
+		if err != nil {
+			t.Fatalf("err: %s\n\n%s", tc.Input, err)
+		}
+
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("bad: %v\n\ngot: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestReferencedEnvironmentVariables(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Result []string
+	}{
+		{
+			"{{user `a`}}",
+			[]string{},
+		},
+
+		{
+			"{{if user `a`}}{{env `HOME`}}{{else}}{{env `USER`}}{{end}}",
+			[]string{"HOME", "USER"},
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := ReferencedEnvironmentVariables(tc.Input)
+		if err != nil {
+			t.Fatalf("err: %s\n\n%s", tc.Input, err)
+		}
+
+		if !reflect.DeepEqual(actual, tc.Result) {
+			t.Fatalf("bad: %v\n\ngot: %#v", tc.Input, actual)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package interpolate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SecretProvider looks up secrets for the "secret" function. A secret is
+// identified by a path and holds one or more keys, in the same way as a
+// secret in Vault.
+type SecretProvider interface {
+	Secret(path, key string) (string, error)
+}
+
+// SecretProviders are the secret providers available by name to the
+// "secret" function, unless the context has its own providers.
+var SecretProviders = map[string]SecretProvider{
+	"file":  new(FileSecretProvider),
+	"vault": new(VaultSecretProvider),
+}
+
+// SecretsFileEnvVar is the environment variable with the path of the file
+// read by a FileSecretProvider that has no path set.
+const SecretsFileEnvVar = "PACKER_SECRETS_FILE"
+
+// FileSecretProvider reads secrets from a local JSON file that maps paths
+// to objects of keys and values:
+//
+//	{"secret/aws": {"access_key": "...", "secret_key": "..."}}
+//
+// It is a simple stand-in for a real secret store.
+type FileSecretProvider struct {
+	// Path is the path of the file. If it is blank, the path is read
+	// from the PACKER_SECRETS_FILE environment variable.
+	Path string
+}
+
+func (p *FileSecretProvider) Secret(path, key string) (string, error) {
+	file := p.Path
+	if file == "" {
+		file = os.Getenv(SecretsFileEnvVar)
+	}
+	if file == "" {
+		return "", fmt.Errorf(
+			"no secrets file given, set %s", SecretsFileEnvVar)
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	var secrets map[string]map[string]interface{}
+	if err := json.Unmarshal(contents, &secrets); err != nil {
+		return "", fmt.Errorf("error parsing secrets file %s: %s", file, err)
+	}
+
+	secret, ok := secrets[path]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' not found", path)
+	}
+
+	return secretValue(secret, path, key)
+}
+
+// VaultSecretProvider reads secrets from the HTTP API of Vault, or any
+// server that implements the same API for reading secrets. Both version 1
+// and version 2 of the key/value secrets engine are supported.
+type VaultSecretProvider struct {
+	// Address and Token default to the VAULT_ADDR and VAULT_TOKEN
+	// environment variables.
+	Address string
+	Token   string
+
+	// Client is the HTTP client to use. If it is nil, a client with a
+	// reasonable timeout is used.
+	Client *http.Client
+}
+
+func (p *VaultSecretProvider) Secret(path, key string) (string, error) {
+	address := p.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return "", fmt.Errorf("no Vault address given, set VAULT_ADDR")
+	}
+
+	token := p.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	url := strings.TrimRight(address, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret '%s': %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == 200 {
+		return "", fmt.Errorf("error reading secret '%s': %s", path, err)
+	}
+
+	switch {
+	case resp.StatusCode == 404:
+		return "", fmt.Errorf("secret '%s' not found", path)
+	case resp.StatusCode != 200:
+		return "", fmt.Errorf("error reading secret '%s': %s: %s",
+			path, resp.Status, strings.Join(body.Errors, ", "))
+	}
+
+	// Version 2 of the key/value engine nests the secret with metadata
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	return secretValue(data, path, key)
+}
+
+// secretValue returns the value of the key in the secret as a string.
+func secretValue(secret map[string]interface{}, path, key string) (string, error) {
+	raw, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' has no key '%s'", path, key)
+	}
+
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
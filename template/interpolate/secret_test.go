@@ -0,0 +1,97 @@
+package interpolate
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestSecretProvider_impl(t *testing.T) {
+	var _ SecretProvider = new(FileSecretProvider)
+	var _ SecretProvider = new(VaultSecretProvider)
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	f, err := ioutil.TempFile("", "packer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"secret/aws": {"access_key": "foo", "port": 22}}`)
+	f.Close()
+
+	p := &FileSecretProvider{Path: f.Name()}
+	cases := []struct {
+		Path, Key string
+		Output    string
+		Error     bool
+	}{
+		{"secret/aws", "access_key", "foo", false},
+		{"secret/aws", "port", "22", false},
+		{"secret/aws", "nope", "", true},
+		{"secret/nope", "access_key", "", true},
+	}
+
+	for _, tc := range cases {
+		v, err := p.Secret(tc.Path, tc.Key)
+		if (err != nil) != tc.Error {
+			t.Fatalf("%s#%s: err: %s", tc.Path, tc.Key, err)
+		}
+		if v != tc.Output {
+			t.Fatalf("%s#%s: bad: %s", tc.Path, tc.Key, v)
+		}
+	}
+}
+
+func TestFileSecretProvider_env(t *testing.T) {
+	os.Setenv(SecretsFileEnvVar, "")
+	if _, err := new(FileSecretProvider).Secret("foo", "value"); err == nil {
+		t.Fatal("should error without a file")
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(403)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/v1":
+			w.Write([]byte(`{"data": {"value": "one"}}`))
+		case "/v1/secret/data/v2":
+			w.Write([]byte(`{"data": {"data": {"value": "two"}, "metadata": {"version": 1}}}`))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		Token  string
+		Path   string
+		Output string
+		Error  bool
+	}{
+		{"token", "secret/v1", "one", false},
+		{"token", "secret/data/v2", "two", false},
+		{"token", "secret/nope", "", true},
+		{"wrong", "secret/v1", "", true},
+	}
+
+	for _, tc := range cases {
+		p := &VaultSecretProvider{Address: ts.URL, Token: tc.Token}
+		v, err := p.Secret(tc.Path, "value")
+		if (err != nil) != tc.Error {
+			t.Fatalf("%s: err: %s", tc.Path, err)
+		}
+		if v != tc.Output {
+			t.Fatalf("%s: bad: %s", tc.Path, v)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/hcl/parser"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -22,11 +23,13 @@ import (
 type rawTemplate struct {
 	MinVersion  string `mapstructure:"min_packer_version"`
 	Description string
+	Imports     []string
 
 	Builders       []map[string]interface{}
 	Push           map[string]interface{}
 	PostProcessors []interface{} `mapstructure:"post-processors"`
 	Provisioners   []map[string]interface{}
+	Retry          map[string]interface{}
 	Variables      map[string]interface{}
 
 	RawContents []byte
@@ -41,6 +44,7 @@ func (r *rawTemplate) Template() (*Template, error) {
 	// Copy some literals
 	result.Description = r.Description
 	result.MinVersion = r.MinVersion
+	result.Imports = r.Imports
 	result.RawContents = r.RawContents
 
 	// Gather the variables
@@ -48,19 +52,14 @@ func (r *rawTemplate) Template() (*Template, error) {
 		result.Variables = make(map[string]*Variable, len(r.Variables))
 	}
 	for k, rawV := range r.Variables {
-		var v Variable
-
-		// Variable is required if the value is exactly nil
-		v.Required = rawV == nil
-
-		// Weak decode the default if we have one
-		if err := r.decoder(&v.Default, nil).Decode(rawV); err != nil {
+		v, err := r.parseVariable(rawV)
+		if err != nil {
 			errs = multierror.Append(errs, fmt.Errorf(
 				"variable %s: %s", k, err))
 			continue
 		}
 
-		result.Variables[k] = &v
+		result.Variables[k] = v
 	}
 
 	// Let's start by gathering all the builders
@@ -77,14 +76,25 @@ func (r *rawTemplate) Template() (*Template, error) {
 
 		// Set the raw configuration and delete any special keys
 		b.Config = rawB
+		delete(b.Config, "depends_on")
+		delete(b.Config, "extends")
 		delete(b.Config, "name")
 		delete(b.Config, "type")
 		if len(b.Config) == 0 {
 			b.Config = nil
 		}
 
+		// A builder that extends another one inherits its type, but it
+		// needs a name of its own.
+		if b.Extends != "" && b.Name == "" {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"builder %d: 'name' is required when extending '%s'",
+				i+1, b.Extends))
+			continue
+		}
+
 		// If there is no type set, it is an error
-		if b.Type == "" {
+		if b.Type == "" && b.Extends == "" {
 			errs = multierror.Append(errs, fmt.Errorf(
 				"builder %d: missing 'type'", i+1))
 			continue
@@ -176,6 +186,7 @@ func (r *rawTemplate) Template() (*Template, error) {
 		delete(v, "only")
 		delete(v, "override")
 		delete(v, "pause_before")
+		delete(v, "retry")
 		delete(v, "type")
 		if len(v) > 0 {
 			p.Config = v
@@ -196,6 +207,17 @@ func (r *rawTemplate) Template() (*Template, error) {
 		result.Push = p
 	}
 
+	// Retry
+	if r.Retry != nil {
+		var retry Retry
+		if err := r.decoder(&retry, nil).Decode(r.Retry); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"retry: %s", err))
+		}
+
+		result.Retry = &retry
+	}
+
 	// If we have errors, return those with a nil result
 	if errs != nil {
 		return nil, errs
@@ -221,6 +243,62 @@ func (r *rawTemplate) decoder(
 	return d
 }
 
+// parseVariable parses a variable, which is either just the default value
+// or an object with the type, description, default and validation rules.
+// The variable is required if the default is exactly nil.
+func (r *rawTemplate) parseVariable(raw interface{}) (*Variable, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		var v Variable
+		v.Required = raw == nil
+		if !v.Required {
+			def, err := VariableValue(raw)
+			if err != nil {
+				return nil, err
+			}
+			v.Default = def
+		}
+
+		return &v, nil
+	}
+
+	var md mapstructure.Metadata
+	var rawV rawVariable
+	if err := r.decoder(&rawV, &md).Decode(m); err != nil {
+		return nil, err
+	}
+	if len(md.Unused) > 0 {
+		sort.Strings(md.Unused)
+		return nil, fmt.Errorf("unknown keys: %s", strings.Join(md.Unused, ", "))
+	}
+
+	v := &Variable{
+		Type:        rawV.Type,
+		Description: rawV.Description,
+		Regex:       rawV.Regex,
+		Sensitive:   rawV.Sensitive,
+		Required:    rawV.Default == nil,
+	}
+
+	if !v.Required {
+		def, err := VariableValue(rawV.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default: %s", err)
+		}
+		v.Default = def
+	}
+
+	for _, allowed := range rawV.AllowedValues {
+		value, err := VariableValue(allowed)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_values: %s", err)
+		}
+		v.AllowedValues = append(v.AllowedValues, value)
+	}
+
+	return v, nil
+}
+
 func (r *rawTemplate) parsePostProcessor(
 	i int, raw interface{}) ([]map[string]interface{}, error) {
 	switch v := raw.(type) {
@@ -261,7 +339,18 @@ func (r *rawTemplate) parsePostProcessor(
 }
 
 // Parse takes the given io.Reader and parses a Template object out of it.
+// Imports are resolved relative to the working directory.
 func Parse(r io.Reader) (*Template, error) {
+	tpl, err := parseJSON(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveTemplate(tpl, "")
+}
+
+// parseJSON parses a JSON template without resolving its imports.
+func parseJSON(r io.Reader) (*Template, error) {
 	// Create a buffer to copy what we read
 	var buf bytes.Buffer
 	r = io.TeeReader(r, &buf)
@@ -274,10 +363,16 @@ func Parse(r io.Reader) (*Template, error) {
 		return nil, err
 	}
 
+	return parseRaw(raw, buf.Bytes())
+}
+
+// parseRaw builds a Template from the generic structure of a template
+// document, as it is decoded from JSON.
+func parseRaw(raw interface{}, contents []byte) (*Template, error) {
 	// Create our decoder
 	var md mapstructure.Metadata
 	var rawTpl rawTemplate
-	rawTpl.RawContents = buf.Bytes()
+	rawTpl.RawContents = contents
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		Metadata: &md,
 		Result:   &rawTpl,
@@ -334,17 +429,13 @@ func ParseFile(path string) (*Template, error) {
 		}
 		defer f.Close()
 	}
-	tpl, err := Parse(f)
+	contents, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := parseContents(path, contents)
 	if err != nil {
-		syntaxErr, ok := err.(*json.SyntaxError)
-		if !ok {
-			return nil, err
-		}
-		// Rewind the file and get a better error
-		f.Seek(0, os.SEEK_SET)
-		// Grab the error location, and return a string to point to offending syntax error
-		line, col, highlight := highlightPosition(f, syntaxErr.Offset)
-		err = fmt.Errorf("Error parsing JSON: %s\nAt line %d, column %d (offset %d):\n%s", err, line, col, syntaxErr.Offset, highlight)
 		return nil, err
 	}
 
@@ -355,15 +446,72 @@ func ParseFile(path string) (*Template, error) {
 		}
 	}
 
+	tpl, err = resolveTemplate(tpl, path)
+	if err != nil {
+		return nil, err
+	}
+
 	tpl.Path = path
 	return tpl, nil
 }
 
+// resolveTemplate merges the imports of a freshly parsed template and
+// flattens the builders that extend other builders. The path is the
+// absolute path of the template, if it came from a file.
+func resolveTemplate(tpl *Template, path string) (*Template, error) {
+	tpl, err := resolveImports(tpl, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tpl.resolveExtends(); err != nil {
+		return nil, err
+	}
+
+	return tpl, nil
+}
+
+// parseContents parses the contents of the template file at the given
+// path, in either the JSON or the HCL format, without resolving its
+// imports. Syntax errors point to the offending line.
+func parseContents(path string, contents []byte) (*Template, error) {
+	if isHCL(path, contents) {
+		tpl, err := parseHCL(contents)
+		if err != nil {
+			posErr, ok := err.(*parser.PosError)
+			if !ok {
+				return nil, fmt.Errorf("Error parsing HCL: %s", err)
+			}
+			// Point to the offending syntax
+			highlight := highlightLine(contents, posErr.Pos.Line, posErr.Pos.Column)
+			err = fmt.Errorf("Error parsing HCL: %s\nAt line %d, column %d:\n%s",
+				posErr.Err, posErr.Pos.Line, posErr.Pos.Column, highlight)
+			return nil, err
+		}
+
+		return tpl, nil
+	}
+
+	tpl, err := parseJSON(bytes.NewReader(contents))
+	if err != nil {
+		syntaxErr, ok := err.(*json.SyntaxError)
+		if !ok {
+			return nil, err
+		}
+		// Grab the error location, and return a string to point to offending syntax error
+		line, col, highlight := highlightPosition(bytes.NewReader(contents), syntaxErr.Offset)
+		err = fmt.Errorf("Error parsing JSON: %s\nAt line %d, column %d (offset %d):\n%s", err, line, col, syntaxErr.Offset, highlight)
+		return nil, err
+	}
+
+	return tpl, nil
+}
+
 // Takes a file and the location in bytes of a parse error
 // from json.SyntaxError.Offset and returns the line, column,
 // and pretty-printed context around the error with an arrow indicating the exact
 // position of the syntax error.
-func highlightPosition(f *os.File, pos int64) (line, col int, highlight string) {
+func highlightPosition(f io.Reader, pos int64) (line, col int, highlight string) {
 	// Modified version of the function in Camlistore by Brad Fitzpatrick
 	// https://github.com/camlistore/camlistore/blob/4b5403dd5310cf6e1ae8feb8533fd59262701ebc/vendor/go4.org/errorutil/highlight.go
 	line = 1
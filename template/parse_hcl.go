@@ -0,0 +1,522 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/packer/template/hcl"
+)
+
+// ParseHCL takes the given io.Reader and parses a Template object out of
+// it, reading the HCL template format. The HCL format maps onto the same
+// structure as the JSON format:
+//
+//	variable "name" { default = "value" type = "string" ... }
+//	builder "type" { ... }
+//	builder { extends = "name" ... }
+//	provisioner "type" { ... }
+//	post-processor "type" { ... }
+//	post-processors { post-processor "type" { ... } ... }
+//	push { ... }
+//	retry { ... }
+//
+// A variable without a default is required.
+//
+// Imports are resolved relative to the working directory.
+func ParseHCL(r io.Reader) (*Template, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := parseHCL(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveTemplate(tpl, "")
+}
+
+// parseHCL parses an HCL template without resolving its imports.
+func parseHCL(contents []byte) (*Template, error) {
+	list, err := hcl.Parse(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := hclRawTemplate(list)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRaw(raw, contents)
+}
+
+// hclRawTemplate converts the HCL syntax tree into the generic structure
+// that the JSON format decodes into.
+func hclRawTemplate(list *ast.ObjectList) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	variables := make(map[string]interface{})
+	var builders, provisioners, postProcessors []interface{}
+
+	for _, item := range list.Items {
+		key := hcl.Key(item)
+		if !hcl.IsBlock(item) {
+			if _, ok := result[key]; ok {
+				return nil, hcl.Errorf(item, "duplicate key %q", key)
+			}
+
+			v, err := hcl.DecodeValue(item.Val)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = v
+			continue
+		}
+
+		labels := hcl.Labels(item)
+		switch key {
+		case "variable":
+			name, body, err := hclLabeledBlock(item)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := variables[name]; ok {
+				return nil, hcl.Errorf(item, "variable %q already defined", name)
+			}
+
+			// A variable with only a default uses the short form, the
+			// same as in JSON templates.
+			var def interface{} = body
+			for k := range body {
+				switch k {
+				case "default", "type", "description", "allowed_values", "regex", "sensitive":
+				default:
+					return nil, hcl.Errorf(item, "variable %q: unknown key %q", name, k)
+				}
+			}
+			if len(body) == 0 {
+				def = nil
+			} else if v, ok := body["default"]; ok && len(body) == 1 {
+				def = v
+			}
+
+			variables[name] = def
+		case "builder":
+			// Builders that extend another builder inherit the type, so
+			// they may leave out the label.
+			if len(labels) == 0 {
+				config, err := hclBody(item)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := config["extends"]; !ok {
+					return nil, hcl.Errorf(item,
+						"builder block requires a type label unless it sets 'extends'")
+				}
+
+				builders = append(builders, config)
+				continue
+			}
+
+			config, err := hclTypedBlock(item)
+			if err != nil {
+				return nil, err
+			}
+
+			builders = append(builders, config)
+		case "provisioner":
+			config, err := hclTypedBlock(item)
+			if err != nil {
+				return nil, err
+			}
+
+			provisioners = append(provisioners, config)
+		case "post-processor":
+			config, err := hclTypedBlock(item)
+			if err != nil {
+				return nil, err
+			}
+
+			postProcessors = append(postProcessors, config)
+		case "post-processors":
+			if len(labels) > 0 {
+				return nil, hcl.Errorf(item, "post-processors block doesn't take labels")
+			}
+
+			var seq []interface{}
+			for _, inner := range hcl.Body(item).Items {
+				if !hcl.IsBlock(inner) || hcl.Key(inner) != "post-processor" {
+					return nil, hcl.Errorf(inner,
+						"post-processors block may only contain post-processor blocks")
+				}
+
+				config, err := hclTypedBlock(inner)
+				if err != nil {
+					return nil, err
+				}
+
+				seq = append(seq, config)
+			}
+
+			postProcessors = append(postProcessors, seq)
+		case "push", "retry":
+			if len(labels) > 0 {
+				return nil, hcl.Errorf(item, "%s block doesn't take labels", key)
+			}
+			if _, ok := result[key]; ok {
+				return nil, hcl.Errorf(item, "%s can only be defined once", key)
+			}
+
+			body, err := hclBody(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = body
+		default:
+			return nil, hcl.Errorf(item, "unknown block type %q", key)
+		}
+	}
+
+	if len(variables) > 0 {
+		result["variables"] = variables
+	}
+	if len(builders) > 0 {
+		result["builders"] = builders
+	}
+	if len(provisioners) > 0 {
+		result["provisioners"] = provisioners
+	}
+	if len(postProcessors) > 0 {
+		result["post-processors"] = postProcessors
+	}
+
+	return result, nil
+}
+
+// hclBody decodes the body of a block.
+func hclBody(item *ast.ObjectItem) (map[string]interface{}, error) {
+	body := hcl.Body(item)
+	if body == nil {
+		return nil, hcl.Errorf(item, "%s must be a block", hcl.Key(item))
+	}
+
+	return hcl.DecodeObject(body)
+}
+
+// hclLabeledBlock returns the single label and the decoded body of a block.
+func hclLabeledBlock(item *ast.ObjectItem) (string, map[string]interface{}, error) {
+	labels := hcl.Labels(item)
+	if len(labels) != 1 {
+		return "", nil, hcl.Errorf(item,
+			"%s block requires exactly one label, got %d", hcl.Key(item), len(labels))
+	}
+
+	body, err := hclBody(item)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return labels[0], body, nil
+}
+
+// hclTypedBlock decodes a component block whose label is the type of the
+// component.
+func hclTypedBlock(item *ast.ObjectItem) (map[string]interface{}, error) {
+	typ, body, err := hclLabeledBlock(item)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := body["type"]; ok {
+		return nil, hcl.Errorf(item,
+			"%s %q: the type is set by the block label, 'type' isn't allowed", hcl.Key(item), typ)
+	}
+
+	body["type"] = typ
+	return body, nil
+}
+
+// FormatHCL converts the generic structure of a JSON template, as decoded
+// by encoding/json, into the HCL template format. Keys set to null are
+// left out and null list elements become empty strings, since HCL has no
+// null. The result is parsed again to make sure that it describes the
+// same template.
+func FormatHCL(raw map[string]interface{}) ([]byte, error) {
+	var w hcl.Writer
+
+	// Top level attributes come first
+	top := make(map[string]interface{})
+	for k, v := range raw {
+		switch k {
+		case "variables", "builders", "provisioners", "post-processors", "push", "retry":
+		default:
+			top[k] = v
+		}
+	}
+	if err := w.Attributes(top, "description", "min_packer_version"); err != nil {
+		return nil, err
+	}
+
+	if rawVars, ok := raw["variables"]; ok && rawVars != nil {
+		vars, ok := rawVars.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("variables: must be an object")
+		}
+
+		names := make([]string, 0, len(vars))
+		for k := range vars {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			w.Block("variable", name)
+			var err error
+			switch v := vars[name].(type) {
+			case nil:
+			case map[string]interface{}:
+				err = w.Attributes(v)
+			default:
+				err = w.Attribute("default", v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("variable %s: %s", name, err)
+			}
+			w.End()
+		}
+	}
+
+	for _, section := range []struct {
+		Key   string
+		Block string
+	}{
+		{"builders", "builder"},
+		{"provisioners", "provisioner"},
+	} {
+		rawList, ok := raw[section.Key]
+		if !ok || rawList == nil {
+			continue
+		}
+
+		list, ok := rawList.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an array", section.Key)
+		}
+
+		for i, v := range list {
+			if err := hclWriteTypedBlock(&w, section.Block, v); err != nil {
+				return nil, fmt.Errorf("%s %d: %s", section.Block, i+1, err)
+			}
+		}
+	}
+
+	if rawList, ok := raw["post-processors"]; ok && rawList != nil {
+		list, ok := rawList.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("post-processors: must be an array")
+		}
+
+		for i, v := range list {
+			seq, ok := v.([]interface{})
+			if !ok {
+				if err := hclWriteTypedBlock(&w, "post-processor", v); err != nil {
+					return nil, fmt.Errorf("post-processor %d: %s", i+1, err)
+				}
+				continue
+			}
+
+			w.Block("post-processors")
+			for j, inner := range seq {
+				if err := hclWriteTypedBlock(&w, "post-processor", inner); err != nil {
+					return nil, fmt.Errorf("post-processor %d.%d: %s", i+1, j+1, err)
+				}
+			}
+			w.End()
+		}
+	}
+
+	for _, k := range []string{"push", "retry"} {
+		v, ok := raw[k]
+		if !ok || v == nil {
+			continue
+		}
+
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an object", k)
+		}
+
+		w.Block(k)
+		if err := w.Attributes(obj); err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+		w.End()
+	}
+
+	result, err := w.Format()
+	if err != nil {
+		return nil, fmt.Errorf("Error formatting HCL: %s", err)
+	}
+
+	if err := hclCheckRoundTrip(raw, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// hclWriteTypedBlock writes the block for a builder, provisioner or
+// post-processor configuration. Post-processors may also be given as
+// just the type name.
+func hclWriteTypedBlock(w *hcl.Writer, key string, v interface{}) error {
+	if typ, ok := v.(string); ok && key == "post-processor" {
+		w.Block(key, typ)
+		w.End()
+		return nil
+	}
+
+	config, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("must be an object")
+	}
+
+	var labels []string
+	typ, ok := config["type"].(string)
+	if ok {
+		labels = append(labels, typ)
+	} else if _, ok := config["extends"]; !ok || key != "builder" {
+		return fmt.Errorf("missing 'type'")
+	}
+
+	rest := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		if k != "type" {
+			rest[k] = v
+		}
+	}
+
+	// Keep the name of builders at the top where it is easy to spot
+	w.Block(key, labels...)
+	if err := w.Attributes(rest, "name"); err != nil {
+		return err
+	}
+	w.End()
+
+	return nil
+}
+
+// hclCheckRoundTrip parses the HCL template converted from the given JSON
+// template and returns an error if it doesn't describe the same template,
+// for example because of strings that HCL can't represent.
+func hclCheckRoundTrip(raw map[string]interface{}, contents []byte) error {
+	// Variables set to null are required, so those nulls stay
+	cleaned := withoutNulls(raw).(map[string]interface{})
+	if vars, ok := raw["variables"].(map[string]interface{}); ok {
+		cleanedVars := make(map[string]interface{}, len(vars))
+		for k, v := range vars {
+			cleanedVars[k] = withoutNulls(v)
+		}
+		cleaned["variables"] = cleanedVars
+	}
+
+	expected, err := parseRaw(cleaned, nil)
+	if err != nil {
+		// The template isn't valid to begin with, so there is nothing to
+		// compare with
+		return nil
+	}
+
+	actual, err := parseHCL(contents)
+	if err != nil {
+		return fmt.Errorf("Error parsing the converted template: %s", err)
+	}
+
+	// Compare through JSON so that integers and floats are the same
+	actual.RawContents = nil
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		return err
+	}
+	actualJSON, err := json.Marshal(actual)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(expectedJSON, actualJSON) {
+		return fmt.Errorf(
+			"The template can't be represented in HCL without changing it. " +
+				"Strings containing an unbalanced \"${\" can't be converted.")
+	}
+
+	return nil
+}
+
+// withoutNulls returns the value with the null object values removed and
+// null list elements replaced by empty strings, the same as FormatHCL
+// writes them.
+func withoutNulls(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, raw := range v {
+			if raw != nil {
+				result[k] = withoutNulls(raw)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, raw := range v {
+			if raw == nil {
+				result[i] = ""
+			} else {
+				result[i] = withoutNulls(raw)
+			}
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// isHCL determines whether the template at the given path is in the HCL
+// format, either by its extension or, if the extension is neither ".json"
+// nor ".hcl", because it doesn't look like a JSON document.
+func isHCL(path string, contents []byte) bool {
+	switch filepath.Ext(path) {
+	case ".hcl":
+		return true
+	case ".json":
+		return false
+	}
+
+	trimmed := strings.TrimLeft(string(contents), " \t\r\n")
+	return trimmed != "" && trimmed[0] != '{'
+}
+
+// highlightLine returns the given line of the contents along with the
+// previous line and a '^' pointing at the given column, in the same
+// format as highlightPosition.
+func highlightLine(contents []byte, line, col int) (highlight string) {
+	lines := strings.Split(string(contents), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	if line > 1 {
+		highlight += fmt.Sprintf("%5d: %s\n", line-1, lines[line-2])
+	}
+
+	highlight += fmt.Sprintf("%5d: %s\n", line, lines[line-1])
+	highlight += fmt.Sprintf("%s^\n", strings.Repeat(" ", col+6))
+	return
+}
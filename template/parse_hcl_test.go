@@ -0,0 +1,168 @@
+package template
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHCL(t *testing.T) {
+	tpl, err := ParseFile(fixtureDir("parse-hcl-basic.hcl"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tpl.Path = ""
+	tpl.RawContents = nil
+
+	expected := &Template{
+		Description: "foo",
+		MinVersion:  "0.8.0",
+		Variables: map[string]*Variable{
+			"region": {Default: "us-east-1"},
+			"secret": {Required: true},
+		},
+		Builders: map[string]*Builder{
+			"bar": {
+				Name: "bar",
+				Type: "something",
+				Config: map[string]interface{}{
+					"region": "{{user `region`}}",
+				},
+			},
+		},
+		Provisioners: []*Provisioner{
+			{
+				OnlyExcept:  OnlyExcept{Only: []string{"bar"}},
+				Type:        "shell",
+				PauseBefore: 1 * time.Second,
+				Config: map[string]interface{}{
+					"inline": []interface{}{"echo hi"},
+				},
+				Override: map[string]interface{}{
+					"bar": map[string]interface{}{
+						"inline": []interface{}{"echo bar"},
+					},
+				},
+			},
+		},
+		PostProcessors: [][]*PostProcessor{
+			{
+				{Type: "compress"},
+			},
+			{
+				{Type: "foo", KeepInputArtifact: true},
+				{Type: "bar"},
+			},
+		},
+		Push: Push{Name: "foo/bar"},
+	}
+
+	if !reflect.DeepEqual(tpl, expected) {
+		t.Fatalf("bad:\n\n%#v\n\n%#v", tpl, expected)
+	}
+}
+
+func TestParseHCL_errors(t *testing.T) {
+	cases := []struct {
+		File     string
+		Expected string
+	}{
+		{"error-hcl-syntax.hcl", "line 3, column 9"},
+		{"error-hcl-type.hcl", "'type' isn't allowed"},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseFile(fixtureDir(tc.File))
+		if err == nil {
+			t.Fatalf("%s: should error", tc.File)
+		}
+		if !strings.Contains(err.Error(), tc.Expected) {
+			t.Fatalf("%s: bad error: %s", tc.File, err)
+		}
+	}
+}
+
+// TestFormatHCL converts all the valid JSON fixtures to HCL and makes
+// sure they parse into the same template.
+func TestFormatHCL(t *testing.T) {
+	files, err := filepath.Glob(fixtureDir("parse-*.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, path := range files {
+		expected, err := ParseFile(path)
+		if err != nil {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal(contents, &raw); err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+
+		output, err := FormatHCL(raw)
+		if err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+
+		actual, err := ParseHCL(strings.NewReader(string(output)))
+		if err != nil {
+			t.Fatalf("%s: err: %s\n\n%s", path, err, output)
+		}
+
+		expected.Path = ""
+		expected.RawContents = nil
+		actual.RawContents = nil
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: bad:\n\n%#v\n\n%#v\n\n%s", path, actual, expected, output)
+		}
+	}
+}
+
+func TestFormatHCL_null(t *testing.T) {
+	raw := map[string]interface{}{
+		"variables": map[string]interface{}{"required": nil},
+		"builders": []interface{}{
+			map[string]interface{}{"type": "foo", "password": nil},
+		},
+	}
+
+	output, err := FormatHCL(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tpl, err := ParseHCL(strings.NewReader(string(output)))
+	if err != nil {
+		t.Fatalf("err: %s\n\n%s", err, output)
+	}
+	if !tpl.Variables["required"].Required {
+		t.Fatalf("bad: %#v", tpl.Variables["required"])
+	}
+	if _, ok := tpl.Builders["foo"].Config["password"]; ok {
+		t.Fatalf("bad: %#v", tpl.Builders["foo"].Config)
+	}
+}
+
+func TestFormatHCL_unrepresentable(t *testing.T) {
+	raw := map[string]interface{}{
+		"builders": []interface{}{
+			map[string]interface{}{"type": "foo", "command": "echo ${"},
+		},
+	}
+
+	if _, err := FormatHCL(raw); err == nil {
+		t.Fatal("should error")
+	}
+}
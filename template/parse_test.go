@@ -40,6 +40,52 @@ func TestParse(t *testing.T) {
 			true,
 		},
 
+		{
+			"parse-builder-depends-on.json",
+			&Template{
+				Builders: map[string]*Builder{
+					"qemu": {
+						Name: "qemu",
+						Type: "qemu",
+						Config: map[string]interface{}{
+							"output_directory": "out",
+						},
+					},
+					"docker": {
+						Name:      "docker",
+						Type:      "docker",
+						DependsOn: []string{"qemu"},
+					},
+				},
+			},
+			false,
+		},
+
+		/*
+		 * Retry
+		 */
+		{
+			"parse-retry.json",
+			&Template{
+				Retry: &Retry{
+					MaxAttempts: 3,
+					Backoff:     10 * time.Second,
+					MaxBackoff:  1 * time.Minute,
+					On:          []string{"api", "network"},
+				},
+				Provisioners: []*Provisioner{
+					{
+						Type: "shell",
+						Retry: &Retry{
+							MaxAttempts: 2,
+							On:          []string{"ssh"},
+						},
+					},
+				},
+			},
+			false,
+		},
+
 		/*
 		 * Provisioners
 		 */
@@ -143,6 +189,29 @@ func TestParse(t *testing.T) {
 			false,
 		},
 
+		{
+			"parse-variable-typed.json",
+			&Template{
+				Variables: map[string]*Variable{
+					"count": {
+						Type:          "number",
+						Description:   "How many",
+						Default:       "2",
+						AllowedValues: []string{"1", "2", "3"},
+					},
+					"tags": {
+						Type:    "list",
+						Default: `["a","b"]`,
+					},
+					"ami": {
+						Required: true,
+						Regex:    "^ami-",
+					},
+				},
+			},
+			false,
+		},
+
 		{
 			"parse-pp-basic.json",
 			&Template{
@@ -3,6 +3,7 @@ package template
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -18,12 +19,20 @@ type Template struct {
 	Description string
 	MinVersion  string
 
+	// Imports are the paths of the templates that were merged into this
+	// one, as they were written in the template.
+	Imports []string
+
 	Variables      map[string]*Variable
 	Builders       map[string]*Builder
 	Provisioners   []*Provisioner
 	PostProcessors [][]*PostProcessor
 	Push           Push
 
+	// Retry is the policy for re-running builds that failed. It is nil
+	// if builds aren't retried.
+	Retry *Retry
+
 	// RawContents is just the raw data for this template
 	RawContents []byte
 }
@@ -33,6 +42,20 @@ type Builder struct {
 	Name   string
 	Type   string
 	Config map[string]interface{}
+
+	// Extends is the name of the builder that this builder is based on.
+	// The configuration is already merged with the base when the template
+	// is parsed, so Config is the effective configuration of the builder.
+	Extends string
+
+	// DependsOn are the names of the builders whose builds must finish
+	// successfully before this builder's build starts.
+	DependsOn []string `mapstructure:"depends_on"`
+
+	// Source is the path of the imported template that defined this
+	// builder. It is blank if the builder is defined in the template
+	// itself.
+	Source string `mapstructure:"-"`
 }
 
 // PostProcessor represents a post-processor within the template.
@@ -42,6 +65,7 @@ type PostProcessor struct {
 	Type              string
 	KeepInputArtifact bool `mapstructure:"keep_input_artifact"`
 	Config            map[string]interface{}
+	Source            string `mapstructure:"-"`
 }
 
 // Provisioner represents a provisioner within the template.
@@ -52,6 +76,33 @@ type Provisioner struct {
 	Config      map[string]interface{}
 	Override    map[string]interface{}
 	PauseBefore time.Duration `mapstructure:"pause_before"`
+	Retry       *Retry
+	Source      string `mapstructure:"-"`
+}
+
+// The classes of errors that a retry policy can be limited to.
+const (
+	RetryOnAny     = "any"
+	RetryOnAPI     = "api"
+	RetryOnNetwork = "network"
+	RetryOnSSH     = "ssh"
+	RetryOnTimeout = "timeout"
+)
+
+// Retry is the policy for re-running a provisioner or a build that failed.
+type Retry struct {
+	// MaxAttempts is the number of times to try in total, including the
+	// first attempt.
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// Backoff is how long to wait before the first retry. The wait is
+	// doubled after every attempt, up to MaxBackoff if it is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+
+	// On are the classes of errors that are retried. Any error is
+	// retried if it is empty.
+	On []string
 }
 
 // Push represents the configuration for pushing the template to Atlas.
@@ -69,6 +120,20 @@ type Push struct {
 type Variable struct {
 	Default  string
 	Required bool
+	Source   string
+
+	// Type is one of the VariableType constants. Values of all types are
+	// strings; lists and maps are JSON documents. A blank type is the same
+	// as VariableTypeString.
+	Type        string
+	Description string
+
+	// Sensitive values are redacted from all output.
+	Sensitive bool
+
+	// AllowedValues and Regex restrict the values the variable can have.
+	AllowedValues []string
+	Regex         string
 }
 
 // OnlyExcept is a struct that is meant to be embedded that contains the
@@ -96,13 +161,45 @@ func (t *Template) Validate() error {
 			"at least one builder must be defined"))
 	}
 
+	// Verify the variable definitions
+	varNames := make([]string, 0, len(t.Variables))
+	for n := range t.Variables {
+		varNames = append(varNames, n)
+	}
+	sort.Strings(varNames)
+	for _, n := range varNames {
+		if verr := t.Variables[n].validate(); verr != nil {
+			err = multierror.Append(err, fmt.Errorf(
+				"variable '%s'%s: %s", n, fromSource(t.Variables[n].Source), verr))
+		}
+	}
+
+	// Verify the dependencies between builders
+	if verr := t.validateDependsOn(); verr != nil {
+		err = multierror.Append(err, verr)
+	}
+
+	// Verify the retry policies
+	if t.Retry != nil {
+		if verr := t.Retry.validate(); verr != nil {
+			err = multierror.Append(err, fmt.Errorf("retry: %s", verr))
+		}
+	}
+
 	// Verify that the provisioner overrides target builders that exist
 	for i, p := range t.Provisioners {
+		if p.Retry != nil {
+			if verr := p.Retry.validate(); verr != nil {
+				err = multierror.Append(err, fmt.Errorf(
+					"provisioner %d%s: retry: %s", i+1, fromSource(p.Source), verr))
+			}
+		}
+
 		// Validate only/except
 		if verr := p.OnlyExcept.Validate(t); verr != nil {
 			for _, e := range multierror.Append(verr).Errors {
 				err = multierror.Append(err, fmt.Errorf(
-					"provisioner %d: %s", i+1, e))
+					"provisioner %d%s: %s", i+1, fromSource(p.Source), e))
 			}
 		}
 
@@ -110,8 +207,8 @@ func (t *Template) Validate() error {
 		for name := range p.Override {
 			if _, ok := t.Builders[name]; !ok {
 				err = multierror.Append(err, fmt.Errorf(
-					"provisioner %d: override '%s' doesn't exist",
-					i+1, name))
+					"provisioner %d%s: override '%s' doesn't exist",
+					i+1, fromSource(p.Source), name))
 			}
 		}
 	}
@@ -123,7 +220,7 @@ func (t *Template) Validate() error {
 			if verr := p.OnlyExcept.Validate(t); verr != nil {
 				for _, e := range multierror.Append(verr).Errors {
 					err = multierror.Append(err, fmt.Errorf(
-						"post-processor %d.%d: %s", i+1, j+1, e))
+						"post-processor %d.%d%s: %s", i+1, j+1, fromSource(p.Source), e))
 				}
 			}
 		}
@@ -132,6 +229,16 @@ func (t *Template) Validate() error {
 	return err
 }
 
+// fromSource describes where a piece of the template came from for use
+// in error messages.
+func fromSource(source string) string {
+	if source == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (imported from %s)", source)
+}
+
 // Skip says whether or not to skip the build with the given name.
 func (o *OnlyExcept) Skip(n string) bool {
 	if len(o.Only) > 0 {
@@ -199,3 +306,31 @@ func (p *PostProcessor) GoString() string {
 func (v *Variable) GoString() string {
 	return fmt.Sprintf("*%#v", *v)
 }
+
+// validate checks that the settings of the retry policy make sense.
+func (r *Retry) validate() error {
+	var err error
+	if r.MaxAttempts < 1 {
+		err = multierror.Append(err, errors.New(
+			"max_attempts must be at least 1"))
+	}
+	if r.Backoff < 0 {
+		err = multierror.Append(err, errors.New(
+			"backoff must not be negative"))
+	}
+	if r.MaxBackoff != 0 && r.MaxBackoff < r.Backoff {
+		err = multierror.Append(err, errors.New(
+			"max_backoff must not be less than backoff"))
+	}
+
+	for _, class := range r.On {
+		switch class {
+		case RetryOnAny, RetryOnAPI, RetryOnNetwork, RetryOnSSH, RetryOnTimeout:
+		default:
+			err = multierror.Append(err, fmt.Errorf(
+				"unknown error class '%s'", class))
+		}
+	}
+
+	return err
+}
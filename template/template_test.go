@@ -72,6 +72,66 @@ func TestTemplateValidate(t *testing.T) {
 			"validate-good-pp-except.json",
 			false,
 		},
+
+		{
+			"validate-variable-good.json",
+			false,
+		},
+
+		{
+			"validate-variable-unknown-type.json",
+			true,
+		},
+
+		{
+			"validate-variable-bad-default.json",
+			true,
+		},
+
+		{
+			"validate-variable-bad-allowed.json",
+			true,
+		},
+
+		{
+			"validate-variable-bad-regex.json",
+			true,
+		},
+
+		{
+			"validate-variable-default-not-allowed.json",
+			true,
+		},
+
+		{
+			"validate-good-depends-on.json",
+			false,
+		},
+
+		{
+			"validate-bad-depends-on-unknown.json",
+			true,
+		},
+
+		{
+			"validate-bad-depends-on-cycle.json",
+			true,
+		},
+
+		{
+			"validate-retry-good.json",
+			false,
+		},
+
+		{
+			"validate-retry-bad.json",
+			true,
+		},
+
+		{
+			"validate-retry-bad-class.json",
+			true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -135,3 +195,30 @@ func TestOnlyExceptSkip(t *testing.T) {
 		}
 	}
 }
+
+func TestVariableValue(t *testing.T) {
+	cases := []struct {
+		Input  interface{}
+		Output string
+		Err    bool
+	}{
+		{"foo", "foo", false},
+		{true, "true", false},
+		{42, "42", false},
+		{float64(42), "42", false},
+		{1.5, "1.5", false},
+		{[]interface{}{"a", float64(1)}, `["a",1]`, false},
+		{map[string]interface{}{"a": "b"}, `{"a":"b"}`, false},
+		{nil, "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := VariableValue(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %s", tc.Input, err)
+		}
+		if actual != tc.Output {
+			t.Fatalf("%#v: bad: %s", tc.Input, actual)
+		}
+	}
+}
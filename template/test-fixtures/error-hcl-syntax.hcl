@@ -0,0 +1,4 @@
+builder "something" {
+  name = "a"
+  foo = ]
+}
@@ -0,0 +1,6 @@
+# common.json was already imported by base.json, so it isn't merged again
+imports = ["common.json"]
+
+provisioner "shell-local" {}
+
+post-processor "checksum" {}
@@ -0,0 +1,39 @@
+# Comments are allowed in HCL templates
+description = "foo"
+min_packer_version = "0.8.0"
+
+variable "region" {
+  default = "us-east-1"
+}
+
+variable "secret" {}
+
+builder "something" {
+  name   = "bar"
+  region = "{{user `region`}}"
+}
+
+provisioner "shell" {
+  only         = ["bar"]
+  pause_before = "1s"
+  inline       = ["echo hi"]
+
+  override = {
+    bar = {
+      inline = ["echo bar"]
+    }
+  }
+}
+
+post-processor "compress" {}
+
+post-processors {
+  post-processor "foo" {
+    keep_input_artifact = true
+  }
+  post-processor "bar" {}
+}
+
+push {
+  name = "foo/bar"
+}
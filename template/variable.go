@@ -0,0 +1,152 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The types a variable can have.
+const (
+	VariableTypeString = "string"
+	VariableTypeNumber = "number"
+	VariableTypeBool   = "bool"
+	VariableTypeList   = "list"
+	VariableTypeMap    = "map"
+)
+
+// rawVariable is the long form of a variable definition in a template.
+type rawVariable struct {
+	Type          string
+	Description   string
+	Default       interface{}
+	AllowedValues []interface{} `mapstructure:"allowed_values"`
+	Regex         string
+	Sensitive     bool
+}
+
+// VariableValue converts a value decoded from a template or a variable
+// file into the string value of a variable. Numbers and booleans are
+// formatted as they would be written, and lists and maps become JSON.
+func VariableValue(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case []interface{}, map[string]interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	case nil:
+		return "", errors.New("null isn't a valid value")
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// ValidateValue checks that the given value has the type of the variable
+// and is allowed by its validation rules.
+func (v *Variable) ValidateValue(value string) error {
+	var err error
+	switch v.Type {
+	case "", VariableTypeString:
+	case VariableTypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case VariableTypeBool:
+		_, err = strconv.ParseBool(value)
+	case VariableTypeList:
+		var list []interface{}
+		err = json.Unmarshal([]byte(value), &list)
+	case VariableTypeMap:
+		var m map[string]interface{}
+		err = json.Unmarshal([]byte(value), &m)
+	default:
+		return fmt.Errorf("unknown type '%s'", v.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("value '%s' is not a valid %s", value, v.Type)
+	}
+
+	if len(v.AllowedValues) > 0 {
+		found := false
+		for _, allowed := range v.AllowedValues {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf(
+				"value '%s' is not one of the allowed values: %s",
+				value, strings.Join(v.AllowedValues, ", "))
+		}
+	}
+
+	if v.Regex != "" {
+		re, err := regexp.Compile(v.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex '%s': %s", v.Regex, err)
+		}
+
+		if !re.MatchString(value) {
+			return fmt.Errorf(
+				"value '%s' doesn't match the regex '%s'", value, v.Regex)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that the definition of the variable makes sense. The
+// default is only checked if it is set and isn't interpolated, since the
+// result isn't known until the template is used.
+func (v *Variable) validate() error {
+	switch v.Type {
+	case "", VariableTypeString, VariableTypeNumber, VariableTypeBool,
+		VariableTypeList, VariableTypeMap:
+	default:
+		return fmt.Errorf("unknown type '%s'", v.Type)
+	}
+
+	if v.Regex != "" {
+		if _, err := regexp.Compile(v.Regex); err != nil {
+			return fmt.Errorf("invalid regex '%s': %s", v.Regex, err)
+		}
+	}
+
+	// The allowed values must be valid themselves
+	check := *v
+	check.AllowedValues = nil
+	for _, allowed := range v.AllowedValues {
+		if err := check.ValidateValue(allowed); err != nil {
+			return fmt.Errorf("allowed value: %s", err)
+		}
+	}
+
+	if v.Default != "" && !strings.Contains(v.Default, "{{") {
+		if err := v.ValidateValue(v.Default); err != nil {
+			return fmt.Errorf("default: %s", err)
+		}
+	}
+
+	return nil
+}